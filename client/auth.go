@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AuthTagSize is how much of the HMAC-SHA256 tag -psk appends to each
+// audio datagram and control message; it must match the server's
+const AuthTagSize = 16
+
+// errAuthFailed means a message's tag didn't match its contents under the
+// pre-shared key: it was forged, altered, or sent with another key
+var errAuthFailed = errors.New("authentication tag mismatch")
+
+// authTag computes the truncated tag for b under key
+func authTag(key, b []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)[:AuthTagSize]
+}
+
+// appendAuthTag appends b's tag under key to b
+func appendAuthTag(key, b []byte) []byte {
+	return append(b, authTag(key, b)...)
+}
+
+// checkAuthTag verifies the tag at the end of b and returns b without it
+func checkAuthTag(key, b []byte) ([]byte, error) {
+	if len(b) < AuthTagSize {
+		return nil, fmt.Errorf("message too short for an authentication tag: %d bytes", len(b))
+	}
+	body, tag := b[:len(b)-AuthTagSize], b[len(b)-AuthTagSize:]
+	if !hmac.Equal(tag, authTag(key, body)) {
+		return nil, errAuthFailed
+	}
+	return body, nil
+}
+
+// signingWriter appends an authentication tag to each datagram written
+// through it. With -encrypt it wraps the sealed datagram, so the server
+// can drop forgeries before trying to decrypt them.
+type signingWriter struct {
+	w   io.Writer
+	key []byte
+	buf []byte
+}
+
+// Write tags p and writes it. It reports p as fully written only if the
+// whole tagged datagram was.
+func (s *signingWriter) Write(p []byte) (int, error) {
+	s.buf = appendAuthTag(s.key, append(s.buf[:0], p...))
+	n, err := s.w.Write(s.buf)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(s.buf) {
+		return min(n, len(p)), nil
+	}
+	return len(p), nil
+}
+
+// signedConn tags the handshake and key exchange packets written through
+// it and drops replies whose tag doesn't verify, so with -psk neither
+// exchange can be forged from either side
+type signedConn struct {
+	handshakeConn
+	key []byte
+	buf []byte
+}
+
+// newSignedConn wraps conn to sign and verify with key
+func newSignedConn(conn handshakeConn, key []byte) *signedConn {
+	return &signedConn{handshakeConn: conn, key: key, buf: make([]byte, MaxControlPacketSize+AuthTagSize)}
+}
+
+// Write tags b and writes it
+func (c *signedConn) Write(b []byte) (int, error) {
+	if _, err := c.handshakeConn.Write(appendAuthTag(c.key, append([]byte(nil), b...))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read returns the next packet whose tag verifies, without the tag, or
+// the underlying error once the read deadline passes
+func (c *signedConn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.handshakeConn.Read(c.buf)
+		if err != nil {
+			return 0, err
+		}
+		if body, err := checkAuthTag(c.key, c.buf[:n]); err == nil {
+			return copy(b, body), nil
+		}
+	}
+}
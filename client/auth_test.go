@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestAuthTag tests that a tagged message verifies, and that a tampered
+// payload or a tag made with another key doesn't
+func TestAuthTag(t *testing.T) {
+	key := []byte("s3cret")
+	msg := []byte{1, 2, 3, 4}
+	tagged := appendAuthTag(key, append([]byte(nil), msg...))
+
+	body, err := checkAuthTag(key, tagged)
+	if err != nil || !bytes.Equal(body, msg) {
+		t.Fatalf("valid tag: got %v, %v", body, err)
+	}
+
+	tampered := append([]byte(nil), tagged...)
+	tampered[0] ^= 0xFF
+	if _, err := checkAuthTag(key, tampered); err != errAuthFailed {
+		t.Errorf("tampered payload: got %v, want errAuthFailed", err)
+	}
+	if _, err := checkAuthTag([]byte("guess"), tagged); err != errAuthFailed {
+		t.Errorf("wrong key: got %v, want errAuthFailed", err)
+	}
+	if _, err := checkAuthTag(key, tagged[:3]); err == nil {
+		t.Error("expected a message shorter than a tag to fail")
+	}
+}
+
+// TestSigningWriterTagsDatagrams tests that each datagram is written with
+// its tag and reported as written without it
+func TestSigningWriterTagsDatagrams(t *testing.T) {
+	conn := &recordingConn{}
+	w := &signingWriter{w: conn, key: []byte("s3cret")}
+	for i := byte(0); i < 2; i++ {
+		packet := bytes.Repeat([]byte{i}, 8)
+		if n, err := w.Write(packet); err != nil || n != len(packet) {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+		body, err := checkAuthTag([]byte("s3cret"), conn.datagrams[i])
+		if err != nil || !bytes.Equal(body, packet) {
+			t.Errorf("datagram %d didn't verify: %v, %v", i, body, err)
+		}
+	}
+}
+
+// TestSignedHandshake tests that with a pre-shared key the hello is sent
+// tagged and an untagged reply is ignored until a tagged one arrives
+func TestSignedHandshake(t *testing.T) {
+	key := []byte("s3cret")
+	hello := newHello(FormatInt16)
+	accept := hello
+	accept.Type = HandshakeAccept
+	forged := encodeHandshake(accept)
+	fake := &fakeHandshakeConn{replies: [][]byte{forged, appendAuthTag(key, encodeHandshake(accept))}}
+
+	reply, err := performHandshake(newSignedConn(fake, key), hello, time.Millisecond, HandshakeAttempts)
+	if err != nil || reply.Type != HandshakeAccept {
+		t.Fatalf("expected acceptance, got type %d (%v)", reply.Type, err)
+	}
+	if len(fake.hellos) != 2 {
+		t.Errorf("expected the untagged reply to be ignored and the hello resent, sent %d", len(fake.hellos))
+	}
+	for i, sent := range fake.hellos {
+		if body, err := checkAuthTag(key, sent); err != nil || !bytes.Equal(body, encodeHandshake(hello)) {
+			t.Errorf("hello %d not tagged: %v", i, err)
+		}
+	}
+}
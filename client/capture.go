@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// captureOptions are the flags that decide which input device is opened and how
+type captureOptions struct {
+	deviceIndex        int
+	deviceName         string
+	autoDevice         bool
+	autoDeviceLoopback bool
+	sourceChannels     int
+	format             SampleFormat
+	formatAuto         bool
+	maxPPS             int
+	autoFrames         bool
+	blocking           bool
+}
+
+// noDeviceError means no input device could be opened at all, which main
+// reports with the device list and ExitNoInputDevice
+type noDeviceError struct {
+	cause error
+}
+
+func (e *noDeviceError) Error() string {
+	if e.cause == nil {
+		return "no usable default audio input device"
+	}
+	return fmt.Sprintf("no usable default audio input device: %v", e.cause)
+}
+
+// capture is an open input stream feeding the pipeline
+type capture struct {
+	stream *portaudio.Stream
+	// With -blocking, called after each read of the stream's buffer
+	processBlocking func(captured time.Time)
+}
+
+// selectDevice picks the input device from the options, or returns nil to
+// use the default device
+func selectDevice(opts captureOptions) (*portaudio.DeviceInfo, error) {
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("listing devices for stream setup: %v", err)
+	}
+
+	if opts.deviceIndex >= 0 {
+		// User specified a device index
+		if opts.deviceIndex >= len(devices) {
+			return nil, fmt.Errorf("invalid device index: %d. Max index is %d", opts.deviceIndex, len(devices)-1)
+		}
+		if devices[opts.deviceIndex].MaxInputChannels == 0 {
+			return nil, fmt.Errorf("device at index %d is not an input device", opts.deviceIndex)
+		}
+		log.Printf("Using specified device by index: [%d] %s", opts.deviceIndex, devices[opts.deviceIndex].Name)
+		return devices[opts.deviceIndex], nil
+	} else if opts.deviceName != "" {
+		// User specified a device name
+		for _, device := range devices {
+			if strings.EqualFold(device.Name, opts.deviceName) && device.MaxInputChannels > 0 {
+				log.Printf("Using specified device by name: %s", device.Name)
+				return device, nil
+			}
+		}
+		return nil, fmt.Errorf("specified device '%s' not found or is not an input device", opts.deviceName)
+	} else if opts.autoDevice {
+		device, index, found := lowestLatencyDevice(devices, opts.sourceChannels, opts.autoDeviceLoopback)
+		if !found {
+			log.Println("Warning: no suitable input device found for -auto-device. Will fall back to default device.")
+			return nil, nil
+		}
+		log.Printf("Auto-selected lowest latency device: [%d] %s (%v)", index, device.Name, device.DefaultLowInputLatency)
+		return device, nil
+	}
+	// Default behavior: search for "Stereo Mix"
+	device, found := findWasapiStereoMixDevice(devices)
+	if !found {
+		log.Println("Warning: 'Stereo Mix' on WASAPI not found. Will fall back to default device.")
+	}
+	return device, nil
+}
+
+// openCapture selects an input device, negotiates the sample format and
+// opens a stream sending to pipeline. The stream is not started.
+func openCapture(opts captureOptions, pipeline *sendPipeline) (*capture, error) {
+	format := opts.format
+
+	// audioCallback is the function called by PortAudio when new audio data is available.
+	audioCallback := func(in []int16) {
+		pipeline.ProcessInt16(in, time.Now())
+	}
+
+	// float32Callback is the -format f32 equivalent of audioCallback.
+	float32Callback := func(in []float32) {
+		pipeline.ProcessFloat32(in, time.Now())
+	}
+
+	chosenDevice, err := selectDevice(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// With -sample-format-auto, fall back to another format if the device
+	// doesn't support the requested one.
+	if opts.formatAuto {
+		inputDevice := chosenDevice
+		if inputDevice == nil {
+			inputDevice, err = portaudio.DefaultInputDevice()
+			if err != nil || inputDevice == nil {
+				return nil, &noDeviceError{err}
+			}
+		}
+		// Surround and coalescing only work with int16
+		allowed := func(f SampleFormat) bool {
+			return f == FormatInt16 || (opts.sourceChannels == Channels && opts.maxPPS == 0)
+		}
+		supported := func(f SampleFormat) bool {
+			params := portaudio.LowLatencyParameters(inputDevice, nil)
+			params.Input.Channels = opts.sourceChannels
+			params.SampleRate = float64(SampleRate)
+			params.FramesPerBuffer = FramesPerBuffer
+			var callback interface{} = audioCallback
+			if f == FormatFloat32 {
+				callback = float32Callback
+			}
+			return portaudio.IsFormatSupported(params, callback) == nil
+		}
+		negotiated, err := negotiateFormat(format, allowed, supported)
+		if err != nil {
+			return nil, fmt.Errorf("negotiating sample format with %s: %v", inputDevice.Name, err)
+		}
+		if negotiated != format {
+			log.Printf("Sample format %s not supported by %s, using %s", format, inputDevice.Name, negotiated)
+		} else {
+			log.Printf("Using sample format %s", negotiated)
+		}
+		format = negotiated
+	}
+
+	var streamCallback interface{} = audioCallback
+	if format == FormatFloat32 {
+		streamCallback = float32Callback
+	}
+
+	// With -auto-frames, PortAudio may deliver any number of frames per
+	// callback, so regroup them into FramesPerBuffer-frame packets.
+	framesPerBuffer := FramesPerBuffer
+	if opts.autoFrames {
+		framesPerBuffer = portaudio.FramesPerBufferUnspecified
+		var reported bool
+		report := func(samples int) {
+			if !reported {
+				log.Printf("PortAudio selected %d frames per buffer", samples/opts.sourceChannels)
+				reported = true
+			}
+		}
+		if format == FormatFloat32 {
+			accumulator := newFrameAccumulator[float32](FramesPerBuffer * opts.sourceChannels)
+			streamCallback = func(in []float32) {
+				report(len(in))
+				accumulator.Push(in, float32Callback)
+			}
+		} else {
+			accumulator := newFrameAccumulator[int16](FramesPerBuffer * opts.sourceChannels)
+			streamCallback = func(in []int16) {
+				report(len(in))
+				accumulator.Push(in, audioCallback)
+			}
+		}
+	}
+
+	// With -blocking, PortAudio fills a buffer that is read in a loop
+	// instead of calling back.
+	c := &capture{}
+	if opts.blocking {
+		if format == FormatFloat32 {
+			buffer := make([]float32, FramesPerBuffer*opts.sourceChannels)
+			streamCallback = buffer
+			c.processBlocking = func(captured time.Time) { pipeline.ProcessFloat32(buffer, captured) }
+		} else {
+			buffer := make([]int16, FramesPerBuffer*opts.sourceChannels)
+			streamCallback = buffer
+			c.processBlocking = func(captured time.Time) { pipeline.ProcessInt16(buffer, captured) }
+		}
+	}
+
+	if chosenDevice != nil {
+		// A specific device was chosen (by index, name, or 'Stereo Mix' search)
+		log.Printf("Attempting to open stream with: %s", chosenDevice.Name)
+		param := portaudio.StreamParameters{
+			Input: portaudio.StreamDeviceParameters{
+				Device:   chosenDevice,
+				Channels: opts.sourceChannels,
+				Latency:  chosenDevice.DefaultLowInputLatency,
+			},
+			SampleRate:      float64(SampleRate),
+			FramesPerBuffer: framesPerBuffer,
+		}
+		c.stream, err = portaudio.OpenStream(param, streamCallback)
+		if err == nil {
+			fmt.Printf("Using audio input: %s\\n", chosenDevice.Name)
+			return c, nil
+		}
+		log.Printf("Warning: Failed to open '%s': %v. Falling back to default device.", chosenDevice.Name, err)
+	}
+
+	// If a specific device failed or was never found, use the default.
+	log.Println("Attempting to open stream with default input device.")
+	defaultDevice, err := portaudio.DefaultInputDevice()
+	if err != nil || defaultDevice == nil {
+		return nil, &noDeviceError{err}
+	}
+	c.stream, err = portaudio.OpenDefaultStream(opts.sourceChannels, 0, float64(SampleRate), framesPerBuffer, streamCallback)
+	if err != nil {
+		return nil, &noDeviceError{fmt.Errorf("opening %s: %v", defaultDevice.Name, err)}
+	}
+	fmt.Printf("Using default audio input: %s\\n", defaultDevice.Name)
+	return c, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseChannelMap parses a comma-separated channel mapping such as "1,0".
+// Output channel i is taken from input channel mapping[i].
+func parseChannelMap(s string, channels int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != channels {
+		return nil, fmt.Errorf("channel map %q has %d entries, expected %d", s, len(parts), channels)
+	}
+	mapping := make([]int, len(parts))
+	for i, part := range parts {
+		ch, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel %q in channel map: %v", part, err)
+		}
+		if ch < 0 || ch >= channels {
+			return nil, fmt.Errorf("channel %d in channel map is out of range 0-%d", ch, channels-1)
+		}
+		mapping[i] = ch
+	}
+	return mapping, nil
+}
+
+// remapChannels reorders interleaved samples from src into dst using mapping.
+// dst and src must have the same length and must not overlap.
+func remapChannels[T int16 | float32](dst, src []T, mapping []int) {
+	channels := len(mapping)
+	for frame := 0; frame+channels <= len(src); frame += channels {
+		for out, in := range mapping {
+			dst[frame+out] = src[frame+in]
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+// TestRemapChannelsSwapsStereo tests that a "1,0" map swaps left and right
+func TestRemapChannelsSwapsStereo(t *testing.T) {
+	mapping, err := parseChannelMap("1,0", 2)
+	if err != nil {
+		t.Fatalf("parseChannelMap failed: %v", err)
+	}
+
+	src := []int16{1, 2, 3, 4, 5, 6} // L,R interleaved
+	dst := make([]int16, len(src))
+	remapChannels(dst, src, mapping)
+
+	expected := []int16{2, 1, 4, 3, 6, 5}
+	for i := range expected {
+		if dst[i] != expected[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, expected[i], dst[i])
+		}
+	}
+}
+
+// TestParseChannelMapRejectsInvalid tests that malformed channel maps are rejected
+func TestParseChannelMapRejectsInvalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mapping string
+	}{
+		{"Too Few Entries", "0"},
+		{"Too Many Entries", "0,1,0"},
+		{"Out Of Range", "0,2"},
+		{"Negative", "-1,0"},
+		{"Not A Number", "left,right"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseChannelMap(tc.mapping, 2); err == nil {
+				t.Errorf("expected error for channel map %q", tc.mapping)
+			}
+		})
+	}
+}
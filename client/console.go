@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// inputStream is the part of *portaudio.Stream the restarter manages
+type inputStream interface {
+	Start() error
+	Stop() error
+	Close() error
+}
+
+// streamRestarter owns the running input stream and can replace it with a
+// freshly opened one, re-running device selection
+type streamRestarter struct {
+	mu      sync.Mutex
+	current inputStream // Nil if the last reopen failed
+	open    func() (inputStream, error)
+}
+
+// Restart stops and closes the current stream, then opens and starts a new
+// one. The old stream is closed first so the device is free to reopen.
+func (r *streamRestarter) Restart() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeCurrent()
+	stream, err := r.open()
+	if err != nil {
+		return fmt.Errorf("reopening input stream: %v", err)
+	}
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		return fmt.Errorf("starting input stream: %v", err)
+	}
+	r.current = stream
+	return nil
+}
+
+// Close stops and closes the current stream
+func (r *streamRestarter) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeCurrent()
+}
+
+// closeCurrent stops and closes the current stream, if any
+func (r *streamRestarter) closeCurrent() {
+	if r.current == nil {
+		return
+	}
+	if err := r.current.Stop(); err != nil {
+		log.Printf("Error stopping input stream: %v", err)
+	}
+	if err := r.current.Close(); err != nil {
+		log.Printf("Error closing input stream: %v", err)
+	}
+	r.current = nil
+}
+
+// consoleHelp lists the commands the client console understands
+const consoleHelp = "Commands: restart (reopen the input device), help"
+
+// Console runs commands typed by the local user
+type Console struct {
+	restarter *streamRestarter // Nil with -blocking, which can't restart
+}
+
+// handleCommand runs one command line and returns its result
+func (c *Console) handleCommand(line string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "restart":
+		if c.restarter == nil {
+			return "", errors.New("restart is not supported with -blocking")
+		}
+		if err := c.restarter.Restart(); err != nil {
+			return "", err
+		}
+		return "Input stream restarted", nil
+	case "help":
+		return consoleHelp, nil
+	}
+	return "", fmt.Errorf("unknown command %q. %s", line, consoleHelp)
+}
+
+// Run reads commands from r, one per line, and prints their results to w
+// until r is exhausted
+func (c *Console) Run(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		result, err := c.handleCommand(line)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+		} else {
+			fmt.Fprintln(w, result)
+		}
+	}
+}
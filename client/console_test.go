@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeInputStream records the calls made on it
+type fakeInputStream struct {
+	calls    []string
+	startErr error
+}
+
+func (s *fakeInputStream) Start() error {
+	s.calls = append(s.calls, "start")
+	return s.startErr
+}
+
+func (s *fakeInputStream) Stop() error {
+	s.calls = append(s.calls, "stop")
+	return nil
+}
+
+func (s *fakeInputStream) Close() error {
+	s.calls = append(s.calls, "close")
+	return nil
+}
+
+// TestRestartReplacesStream tests that restart closes the old stream before
+// opening and starting a new one from the factory
+func TestRestartReplacesStream(t *testing.T) {
+	old := &fakeInputStream{}
+	var opened []*fakeInputStream
+	r := &streamRestarter{
+		current: old,
+		open: func() (inputStream, error) {
+			if len(old.calls) != 2 {
+				t.Errorf("expected the old stream to be closed before reopening, got %v", old.calls)
+			}
+			s := &fakeInputStream{}
+			opened = append(opened, s)
+			return s, nil
+		},
+	}
+	if err := r.Restart(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(old.calls, ",") != "stop,close" {
+		t.Errorf("expected the old stream to be stopped and closed, got %v", old.calls)
+	}
+	if len(opened) != 1 || strings.Join(opened[0].calls, ",") != "start" {
+		t.Fatalf("expected one new stream to be started, got %d", len(opened))
+	}
+	if r.current != opened[0] {
+		t.Error("expected the new stream to become current")
+	}
+}
+
+// TestRestartOpenFailure tests that a failed reopen leaves no stream and
+// that a later restart can recover
+func TestRestartOpenFailure(t *testing.T) {
+	old := &fakeInputStream{}
+	fail := true
+	r := &streamRestarter{
+		current: old,
+		open: func() (inputStream, error) {
+			if fail {
+				return nil, errors.New("device gone")
+			}
+			return &fakeInputStream{}, nil
+		},
+	}
+	if err := r.Restart(); err == nil || !strings.Contains(err.Error(), "device gone") {
+		t.Errorf("expected the open error, got %v", err)
+	}
+	if r.current != nil {
+		t.Error("expected no current stream after a failed reopen")
+	}
+
+	// A stream that won't start is closed again
+	failing := &fakeInputStream{startErr: errors.New("busy")}
+	r.open = func() (inputStream, error) { return failing, nil }
+	if err := r.Restart(); err == nil {
+		t.Error("expected the start error")
+	}
+	if strings.Join(failing.calls, ",") != "start,close" {
+		t.Errorf("expected the unstarted stream to be closed, got %v", failing.calls)
+	}
+
+	fail = false
+	r.open = func() (inputStream, error) { return &fakeInputStream{}, nil }
+	if err := r.Restart(); err != nil || r.current == nil {
+		t.Errorf("expected a later restart to recover, got %v", err)
+	}
+}
+
+// TestConsoleCommands tests the console's command dispatch
+func TestConsoleCommands(t *testing.T) {
+	restarts := 0
+	c := &Console{restarter: &streamRestarter{open: func() (inputStream, error) {
+		restarts++
+		return &fakeInputStream{}, nil
+	}}}
+	var out bytes.Buffer
+	c.Run(strings.NewReader("restart\n\nhelp\nbogus\n"), &out)
+	if restarts != 1 {
+		t.Errorf("expected 1 restart, got %d", restarts)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != "Input stream restarted" || lines[1] != consoleHelp || !strings.HasPrefix(lines[2], "Error: unknown command") {
+		t.Errorf("unexpected console output %q", out.String())
+	}
+
+	blocking := &Console{}
+	if _, err := blocking.handleCommand("restart"); err == nil {
+		t.Error("expected restart to be refused without a restarter")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Control messages come in two versions. v0 is a bare little-endian float64
+// volume. v1 frames carry a type and length so more controls fit:
+//
+//	'A' 'C' version(1) type length(uint16 LE) payload
+const (
+	ControlMagic0        = 'A'
+	ControlMagic1        = 'C'
+	ControlVersion       = 1
+	ControlHeaderSize    = 6
+	ControlV0Size        = 8
+	MaxControlPacketSize = 512
+)
+
+// Control message types
+const (
+	ControlVolume = 1 // Payload is a little-endian float64 volume
+	ControlAck    = 2 // Payload is an AckMessage
+)
+
+// ControlMessage is a decoded control message of either version
+type ControlMessage struct {
+	Version uint8
+	Type    uint8
+	Payload []byte
+}
+
+// decodeControlMessage parses a control packet. v1 frames are recognized by
+// their magic and length; any other 8-byte packet is a v0 volume.
+func decodeControlMessage(b []byte) (ControlMessage, error) {
+	if len(b) >= ControlHeaderSize && b[0] == ControlMagic0 && b[1] == ControlMagic1 {
+		length := int(binary.LittleEndian.Uint16(b[4:6]))
+		if len(b) == ControlHeaderSize+length {
+			if b[2] != ControlVersion {
+				return ControlMessage{}, fmt.Errorf("unsupported control version %d", b[2])
+			}
+			return ControlMessage{Version: b[2], Type: b[3], Payload: b[ControlHeaderSize:]}, nil
+		}
+	}
+	if len(b) == ControlV0Size {
+		return ControlMessage{Version: 0, Type: ControlVolume, Payload: b}, nil
+	}
+	return ControlMessage{}, fmt.Errorf("malformed control message of %d bytes", len(b))
+}
+
+// encodeControlMessage frames payload as a v1 control message of the given type
+func encodeControlMessage(msgType uint8, payload []byte) []byte {
+	b := make([]byte, ControlHeaderSize+len(payload))
+	b[0], b[1], b[2], b[3] = ControlMagic0, ControlMagic1, ControlVersion, msgType
+	binary.LittleEndian.PutUint16(b[4:6], uint16(len(payload)))
+	copy(b[ControlHeaderSize:], payload)
+	return b
+}
+
+// Volume returns the volume carried by a ControlVolume message
+func (m ControlMessage) Volume() (float64, error) {
+	if m.Type != ControlVolume || len(m.Payload) != 8 {
+		return 0, errors.New("not a volume message")
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(m.Payload)), nil
+}
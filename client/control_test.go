@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// volumePayload encodes a volume as the v0 message and v1 payload share it
+func volumePayload(v float64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	return b
+}
+
+// TestDecodeControlV0 tests that a bare float64 is still understood as a volume
+func TestDecodeControlV0(t *testing.T) {
+	msg, err := decodeControlMessage(volumePayload(0.4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, err := msg.Volume(); msg.Version != 0 || err != nil || v != 0.4 {
+		t.Errorf("expected a v0 volume of 0.4, got version %d volume %v (%v)", msg.Version, v, err)
+	}
+}
+
+// TestDecodeControlV1 tests round-tripping framed messages
+func TestDecodeControlV1(t *testing.T) {
+	msg, err := decodeControlMessage(encodeControlMessage(ControlVolume, volumePayload(0.9)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, err := msg.Volume(); msg.Version != 1 || err != nil || v != 0.9 {
+		t.Errorf("expected a v1 volume of 0.9, got version %d volume %v (%v)", msg.Version, v, err)
+	}
+
+	// Unknown types decode so the caller can skip them
+	msg, err = decodeControlMessage(encodeControlMessage(42, []byte{1, 2, 3}))
+	if err != nil || msg.Type != 42 || len(msg.Payload) != 3 {
+		t.Errorf("expected an unknown type to decode, got %+v (%v)", msg, err)
+	}
+	if _, err := msg.Volume(); err == nil {
+		t.Error("expected a non-volume message not to yield a volume")
+	}
+}
+
+// TestDecodeControlMalformed tests that malformed frames are rejected
+func TestDecodeControlMalformed(t *testing.T) {
+	truncated := encodeControlMessage(ControlVolume, volumePayload(0.5))[:10]
+	badVersion := encodeControlMessage(ControlVolume, volumePayload(0.5))
+	badVersion[2] = 9
+
+	for name, b := range map[string][]byte{
+		"empty":       nil,
+		"short":       {1, 2, 3},
+		"truncated":   truncated,
+		"bad version": badVersion,
+	} {
+		if _, err := decodeControlMessage(b); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// DeviceWatchInterval is how often -list-devices -watch re-enumerates devices
+const DeviceWatchInterval = 2 * time.Second
+
+// inputDeviceNames describes each input device. Indices shift as devices come
+// and go, so devices are identified by name and host API instead.
+func inputDeviceNames(devices []*portaudio.DeviceInfo) []string {
+	var names []string
+	for _, info := range devices {
+		if info.MaxInputChannels > 0 {
+			hostAPI := ""
+			if info.HostApi != nil {
+				hostAPI = info.HostApi.Name
+			}
+			names = append(names, fmt.Sprintf("%s (Host API: %s)", info.Name, hostAPI))
+		}
+	}
+	return names
+}
+
+// diffDevices returns the devices in after but not before, and those in
+// before but not after
+func diffDevices(before, after []string) (added, removed []string) {
+	count := make(map[string]int)
+	for _, name := range before {
+		count[name]++
+	}
+	for _, name := range after {
+		if count[name] > 0 {
+			count[name]--
+		} else {
+			added = append(added, name)
+		}
+	}
+	for _, name := range before {
+		if count[name] > 0 {
+			count[name]--
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
+
+// watchDevices prints input devices as they are added and removed, until
+// the program is interrupted. PortAudio only enumerates devices when it is
+// initialized, so it's restarted for each check.
+func watchDevices(interval time.Duration) {
+	devices, err := portaudio.Devices()
+	if err != nil {
+		log.Fatalf("Error listing devices: %v", err)
+	}
+	previous := inputDeviceNames(devices)
+	fmt.Println("Watching for device changes (Ctrl+C to stop)...")
+	for {
+		time.Sleep(interval)
+		if err := portaudio.Terminate(); err != nil {
+			log.Fatalf("Error restarting PortAudio: %v", err)
+		}
+		if err := portaudio.Initialize(); err != nil {
+			log.Fatalf("Error restarting PortAudio: %v", err)
+		}
+		devices, err := portaudio.Devices()
+		if err != nil {
+			log.Printf("Error listing devices: %v", err)
+			continue
+		}
+		current := inputDeviceNames(devices)
+		added, removed := diffDevices(previous, current)
+		for _, name := range added {
+			fmt.Printf("  + %s\n", name)
+		}
+		for _, name := range removed {
+			fmt.Printf("  - %s\n", name)
+		}
+		previous = current
+	}
+}
+
+// loopbackNames are name fragments of devices that capture system output
+var loopbackNames = []string{"stereo mix", "loopback", "monitor of", "what u hear", "wave out mix"}
+
+// isLoopbackDevice guesses from its name whether a device captures system output
+func isLoopbackDevice(info *portaudio.DeviceInfo) bool {
+	name := strings.ToLower(info.Name)
+	for _, fragment := range loopbackNames {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowestLatencyDevice returns the input device with the lowest default low
+// input latency and its index, optionally considering only loopback devices.
+// Devices with fewer than channels input channels can't be opened for
+// capture and are skipped. Ties go to the device enumerated first.
+func lowestLatencyDevice(devices []*portaudio.DeviceInfo, channels int, loopbackOnly bool) (*portaudio.DeviceInfo, int, bool) {
+	best := -1
+	for i, info := range devices {
+		if info.MaxInputChannels == 0 || info.MaxInputChannels < channels || (loopbackOnly && !isLoopbackDevice(info)) {
+			continue
+		}
+		if best < 0 || info.DefaultLowInputLatency < devices[best].DefaultLowInputLatency {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, -1, false
+	}
+	return devices[best], best, true
+}
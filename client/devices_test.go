@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// TestDiffDevices tests that additions and removals between snapshots are reported
+func TestDiffDevices(t *testing.T) {
+	tests := []struct {
+		name        string
+		before      []string
+		after       []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{"unchanged", []string{"Mic", "Line In"}, []string{"Line In", "Mic"}, nil, nil},
+		{"plugged in", []string{"Mic"}, []string{"Mic", "USB Interface"}, []string{"USB Interface"}, nil},
+		{"unplugged", []string{"Mic", "USB Interface"}, []string{"Mic"}, nil, []string{"USB Interface"}},
+		{"swapped", []string{"Mic", "Headset"}, []string{"Mic", "USB Interface"}, []string{"USB Interface"}, []string{"Headset"}},
+		{"second identical device", []string{"USB Mic"}, []string{"USB Mic", "USB Mic"}, []string{"USB Mic"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := diffDevices(tt.before, tt.after)
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("expected added %v, got %v", tt.wantAdded, added)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("expected removed %v, got %v", tt.wantRemoved, removed)
+			}
+		})
+	}
+}
+
+// TestInputDeviceNames tests that only input devices are described
+func TestInputDeviceNames(t *testing.T) {
+	api := &portaudio.HostApiInfo{Name: "ALSA"}
+	devices := []*portaudio.DeviceInfo{
+		{Name: "Mic", MaxInputChannels: 2, HostApi: api},
+		{Name: "Speakers", MaxOutputChannels: 2, HostApi: api},
+	}
+	want := []string{"Mic (Host API: ALSA)"}
+	if got := inputDeviceNames(devices); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestLowestLatencyDevice tests choosing the input device with the lowest latency
+func TestLowestLatencyDevice(t *testing.T) {
+	devices := []*portaudio.DeviceInfo{
+		{Name: "Speakers", MaxOutputChannels: 2},
+		{Name: "USB Mic", MaxInputChannels: 1, DefaultLowInputLatency: 10 * time.Millisecond},
+		{Name: "Stereo Mix", MaxInputChannels: 2, DefaultLowInputLatency: 20 * time.Millisecond},
+		{Name: "Headset", MaxInputChannels: 1, DefaultLowInputLatency: 3 * time.Millisecond},
+		{Name: "Monitor of Built-in Audio", MaxInputChannels: 2, DefaultLowInputLatency: 8 * time.Millisecond},
+	}
+
+	tests := []struct {
+		name         string
+		devices      []*portaudio.DeviceInfo
+		channels     int
+		loopbackOnly bool
+		wantIndex    int
+	}{
+		{"lowest latency input", devices, 1, false, 3},
+		{"loopback only", devices, 1, true, 4},
+		{"output devices are skipped", devices[:1], 1, false, -1},
+		{"devices with too few channels are skipped", devices, 2, false, 4},
+		{"no device has enough channels", devices, 6, false, -1},
+		{"ties go to the first device", []*portaudio.DeviceInfo{
+			{Name: "A", MaxInputChannels: 2, DefaultLowInputLatency: 5 * time.Millisecond},
+			{Name: "B", MaxInputChannels: 2, DefaultLowInputLatency: 5 * time.Millisecond},
+		}, 2, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, index, found := lowestLatencyDevice(tt.devices, tt.channels, tt.loopbackOnly)
+			if index != tt.wantIndex || found != (tt.wantIndex >= 0) {
+				t.Fatalf("expected index %d, got %d (found %v)", tt.wantIndex, index, found)
+			}
+			if found && device != tt.devices[tt.wantIndex] {
+				t.Errorf("expected device %q, got %q", tt.devices[tt.wantIndex].Name, device.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiagReportInterval is how often -diag prints the latency distribution
+const DiagReportInterval = 10 * time.Second
+
+// latencyBuckets are the upper bounds of the histogram buckets. Latencies
+// above the last bound are counted in a final overflow bucket.
+var latencyBuckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+}
+
+// latencyHistogram accumulates latency samples into fixed buckets
+type latencyHistogram struct {
+	mu     sync.Mutex
+	counts []int64
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// newLatencyHistogram creates an empty histogram
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]int64, len(latencyBuckets)+1)}
+}
+
+// Record adds one latency sample
+func (h *latencyHistogram) Record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Count returns the number of samples recorded
+func (h *latencyHistogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Mean returns the average latency
+func (h *latencyHistogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Min returns the smallest latency recorded
+func (h *latencyHistogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+// Max returns the largest latency recorded
+func (h *latencyHistogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+// Percentile returns the upper bound of the bucket containing the p-th
+// percentile (0 to 100). Samples in the overflow bucket report the maximum.
+func (h *latencyHistogram) Percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(p / 100 * float64(h.count))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if i < len(latencyBuckets) && latencyBuckets[i] < h.max {
+				return latencyBuckets[i]
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// String summarizes the distribution on one line followed by the non-empty buckets
+func (h *latencyHistogram) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Send latency - Count: %d, Min: %v, Mean: %v, P50: %v, P99: %v, Max: %v",
+		h.Count(), h.Min(), h.Mean(), h.Percentile(50), h.Percentile(99), h.Max())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+		if i < len(latencyBuckets) {
+			fmt.Fprintf(&sb, "\n  <= %v: %d", latencyBuckets[i], n)
+		} else {
+			fmt.Fprintf(&sb, "\n  >  %v: %d", latencyBuckets[len(latencyBuckets)-1], n)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLatencyHistogramStatistics tests the summary statistics over known samples
+func TestLatencyHistogramStatistics(t *testing.T) {
+	h := newLatencyHistogram()
+	samples := []time.Duration{
+		40 * time.Microsecond,
+		80 * time.Microsecond,
+		80 * time.Microsecond,
+		200 * time.Microsecond,
+		400 * time.Microsecond,
+		800 * time.Microsecond,
+		2 * time.Millisecond,
+		4 * time.Millisecond,
+		8 * time.Millisecond,
+		50 * time.Millisecond,
+	}
+	var sum time.Duration
+	for _, d := range samples {
+		h.Record(d)
+		sum += d
+	}
+
+	if h.Count() != int64(len(samples)) {
+		t.Errorf("expected count %d, got %d", len(samples), h.Count())
+	}
+	if h.Min() != 40*time.Microsecond {
+		t.Errorf("expected min 40µs, got %v", h.Min())
+	}
+	if h.Max() != 50*time.Millisecond {
+		t.Errorf("expected max 50ms, got %v", h.Max())
+	}
+	if want := sum / time.Duration(len(samples)); h.Mean() != want {
+		t.Errorf("expected mean %v, got %v", want, h.Mean())
+	}
+
+	tests := []struct {
+		percentile float64
+		want       time.Duration
+	}{
+		{0, 50 * time.Microsecond},
+		{10, 50 * time.Microsecond},
+		{30, 100 * time.Microsecond},
+		{50, 500 * time.Microsecond},
+		{90, 10 * time.Millisecond},
+		{100, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := h.Percentile(tt.percentile); got != tt.want {
+			t.Errorf("P%v: expected %v, got %v", tt.percentile, tt.want, got)
+		}
+	}
+}
+
+// TestLatencyHistogramBuckets tests that samples land in the expected buckets
+func TestLatencyHistogramBuckets(t *testing.T) {
+	h := newLatencyHistogram()
+	h.Record(50 * time.Microsecond) // On a bound, counted in that bucket
+	h.Record(51 * time.Microsecond)
+	h.Record(time.Second)
+
+	if h.counts[0] != 1 {
+		t.Errorf("expected 1 sample in the first bucket, got %d", h.counts[0])
+	}
+	if h.counts[1] != 1 {
+		t.Errorf("expected 1 sample in the second bucket, got %d", h.counts[1])
+	}
+	if h.counts[len(latencyBuckets)] != 1 {
+		t.Errorf("expected 1 sample in the overflow bucket, got %d", h.counts[len(latencyBuckets)])
+	}
+}
+
+// TestLatencyHistogramEmpty tests that an empty histogram reports zeros
+func TestLatencyHistogramEmpty(t *testing.T) {
+	h := newLatencyHistogram()
+	if h.Count() != 0 || h.Mean() != 0 || h.Min() != 0 || h.Max() != 0 || h.Percentile(99) != 0 {
+		t.Errorf("expected an empty histogram to report zeros")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SampleFormat is the sample encoding sent over the network
+type SampleFormat string
+
+const (
+	FormatInt16   SampleFormat = "s16" // Little-endian int16 samples
+	FormatFloat32 SampleFormat = "f32" // Little-endian IEEE 754 float32 samples
+)
+
+// parseSampleFormat validates a -format flag value
+func parseSampleFormat(s string) (SampleFormat, error) {
+	switch format := SampleFormat(s); format {
+	case FormatInt16, FormatFloat32:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown sample format %q (expected %q or %q)", s, FormatInt16, FormatFloat32)
+}
+
+// parseByteOrder validates an -endian flag value
+func parseByteOrder(s string) (binary.ByteOrder, error) {
+	switch s {
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("unknown byte order %q (expected little or big)", s)
+}
+
+// putFloat32Samples applies the volume to each sample and writes it to out,
+// which must hold 4 bytes per sample, in the given byte order
+func putFloat32Samples(out []byte, in []float32, vol float64, order binary.ByteOrder) {
+	for i, sample := range in {
+		order.PutUint32(out[i*4:], math.Float32bits(sample*float32(vol)))
+	}
+}
+
+// formatPriority is the order formats are tried in by -sample-format-auto,
+// after the format that was asked for
+var formatPriority = []SampleFormat{FormatFloat32, FormatInt16}
+
+// negotiateFormat returns the first supported format, trying preferred and
+// then formatPriority. Formats rejected by allowed are skipped.
+func negotiateFormat(preferred SampleFormat, allowed, supported func(SampleFormat) bool) (SampleFormat, error) {
+	candidates := append([]SampleFormat{preferred}, formatPriority...)
+	for _, format := range candidates {
+		if allowed(format) && supported(format) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("no supported sample format (tried %v)", candidates)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// TestPutFloat32Samples tests float volume application and float32 byte packing
+func TestPutFloat32Samples(t *testing.T) {
+	in := []float32{1.0, -1.0, 0.5, 0.0}
+	buf := make([]byte, len(in)*4)
+	putFloat32Samples(buf, in, 0.5, binary.LittleEndian)
+
+	out := make([]float32, len(in))
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, out); err != nil {
+		t.Fatalf("Failed to unpack samples: %v", err)
+	}
+	expected := []float32{0.5, -0.5, 0.25, 0.0}
+	for i := range expected {
+		if out[i] != expected[i] {
+			t.Errorf("sample %d: expected %f, got %f", i, expected[i], out[i])
+		}
+	}
+}
+
+// TestParseSampleFormat tests flag validation for sample formats
+func TestParseSampleFormat(t *testing.T) {
+	for _, s := range []string{"s16", "f32"} {
+		if _, err := parseSampleFormat(s); err != nil {
+			t.Errorf("expected %q to be accepted: %v", s, err)
+		}
+	}
+	if _, err := parseSampleFormat("s24"); err == nil {
+		t.Error("expected unknown format to be rejected")
+	}
+}
+
+// TestNegotiateFormat tests that negotiation picks the first supported format
+func TestNegotiateFormat(t *testing.T) {
+	only := func(formats ...SampleFormat) func(SampleFormat) bool {
+		return func(f SampleFormat) bool {
+			for _, s := range formats {
+				if f == s {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	all := only(FormatInt16, FormatFloat32)
+
+	tests := []struct {
+		name      string
+		preferred SampleFormat
+		allowed   func(SampleFormat) bool
+		supported func(SampleFormat) bool
+		want      SampleFormat
+		wantErr   bool
+	}{
+		{"preferred supported", FormatInt16, all, all, FormatInt16, false},
+		{"f32 falls back to s16", FormatFloat32, all, only(FormatInt16), FormatInt16, false},
+		{"s16 falls back to f32", FormatInt16, all, only(FormatFloat32), FormatFloat32, false},
+		{"disallowed fallback skipped", FormatInt16, only(FormatInt16), only(FormatFloat32), "", true},
+		{"nothing supported", FormatFloat32, all, only(), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := negotiateFormat(tt.preferred, tt.allowed, tt.supported)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiateFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("negotiateFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
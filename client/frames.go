@@ -0,0 +1,35 @@
+package main
+
+// frameAccumulator regroups callback buffers of any size into packets of a
+// fixed number of samples, so -auto-frames keeps the wire packet size constant
+type frameAccumulator[T int16 | float32] struct {
+	buf  []T
+	size int
+}
+
+// newFrameAccumulator creates an accumulator emitting packets of packetSamples samples
+func newFrameAccumulator[T int16 | float32](packetSamples int) *frameAccumulator[T] {
+	return &frameAccumulator[T]{buf: make([]T, 0, packetSamples), size: packetSamples}
+}
+
+// Push appends samples and calls emit for each packet completed. The slice
+// passed to emit is reused and only valid during the call.
+func (fa *frameAccumulator[T]) Push(in []T, emit func([]T)) {
+	for len(in) > 0 {
+		n := fa.size - len(fa.buf)
+		if n > len(in) {
+			n = len(in)
+		}
+		fa.buf = append(fa.buf, in[:n]...)
+		in = in[n:]
+		if len(fa.buf) == fa.size {
+			emit(fa.buf)
+			fa.buf = fa.buf[:0]
+		}
+	}
+}
+
+// Pending returns the number of samples waiting for a complete packet
+func (fa *frameAccumulator[T]) Pending() int {
+	return len(fa.buf)
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+// TestFrameAccumulatorNonDefaultFrames tests regrouping callbacks whose size isn't FramesPerBuffer
+func TestFrameAccumulatorNonDefaultFrames(t *testing.T) {
+	tests := []struct {
+		name           string
+		callbackFrames int
+	}{
+		{"smaller callbacks", 441},
+		{"larger callbacks", 1024 + 7},
+		{"single frames", 1},
+		{"default size", FramesPerBuffer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fa := newFrameAccumulator[int16](FramesPerBuffer * Channels)
+			var packets [][]int16
+			emit := func(p []int16) {
+				packets = append(packets, append([]int16(nil), p...))
+			}
+
+			// Feed a running sample counter so order can be checked
+			totalFrames := FramesPerBuffer * 5
+			var next int16
+			for sent := 0; sent < totalFrames; sent += tt.callbackFrames {
+				frames := tt.callbackFrames
+				if sent+frames > totalFrames {
+					frames = totalFrames - sent
+				}
+				in := make([]int16, frames*Channels)
+				for i := range in {
+					in[i] = next
+					next++
+				}
+				fa.Push(in, emit)
+			}
+
+			if len(packets) != 5 {
+				t.Fatalf("expected 5 packets, got %d", len(packets))
+			}
+			var want int16
+			for i, p := range packets {
+				if len(p) != FramesPerBuffer*Channels {
+					t.Fatalf("packet %d: expected %d samples, got %d", i, FramesPerBuffer*Channels, len(p))
+				}
+				for j, s := range p {
+					if s != want {
+						t.Fatalf("packet %d sample %d: expected %d, got %d", i, j, want, s)
+					}
+					want++
+				}
+			}
+			if fa.Pending() != 0 {
+				t.Errorf("expected no pending samples, got %d", fa.Pending())
+			}
+		})
+	}
+}
+
+// TestFrameAccumulatorHoldsPartialPacket tests that incomplete packets wait for more samples
+func TestFrameAccumulatorHoldsPartialPacket(t *testing.T) {
+	fa := newFrameAccumulator[float32](8)
+	emitted := 0
+	fa.Push(make([]float32, 5), func([]float32) { emitted++ })
+	if emitted != 0 || fa.Pending() != 5 {
+		t.Fatalf("expected 5 pending samples and no packets, got %d pending and %d packets", fa.Pending(), emitted)
+	}
+	fa.Push(make([]float32, 5), func([]float32) { emitted++ })
+	if emitted != 1 || fa.Pending() != 2 {
+		t.Errorf("expected 1 packet and 2 pending samples, got %d packets and %d pending", emitted, fa.Pending())
+	}
+}
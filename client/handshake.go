@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Handshake packets let the client check, before streaming, that the server
+// plays the audio it is about to send. A hello describing the stream goes to
+// the server's audio port and the server answers with an accept, or a
+// reject carrying its own parameters. Packets are a HandshakePacket written
+// with binary.Write:
+//
+//	'A' 'H' version(1) type sample_rate(uint32 LE) channels(uint16 LE) frames(uint16 LE) codec
+const (
+	HandshakeMagic0  = 'A'
+	HandshakeMagic1  = 'H'
+	HandshakeVersion = 1
+	HandshakeSize    = 13
+)
+
+// Handshake packet types
+const (
+	HandshakeHello  = 1
+	HandshakeAccept = 2
+	HandshakeReject = 3
+)
+
+// Codec IDs carried in handshakes
+const (
+	CodecPCM16   = 0 // int16 PCM, including surround sources
+	CodecFloat32 = 1 // float32 PCM
+)
+
+// HandshakeTimeout is how long to wait for each reply to a hello
+const HandshakeTimeout = 500 * time.Millisecond
+
+// HandshakeAttempts is how many hellos are sent before giving up, in case
+// one or its reply is lost
+const HandshakeAttempts = 4
+
+// HandshakePacket is the handshake's wire format, in field order
+type HandshakePacket struct {
+	Magic      [2]byte
+	Version    uint8
+	Type       uint8
+	SampleRate uint32
+	Channels   uint16
+	Frames     uint16
+	Codec      uint8
+}
+
+// newHello creates a hello describing the client's audio parameters
+func newHello(format SampleFormat) HandshakePacket {
+	codec := uint8(CodecPCM16)
+	if format == FormatFloat32 {
+		codec = CodecFloat32
+	}
+	return HandshakePacket{
+		Magic:      [2]byte{HandshakeMagic0, HandshakeMagic1},
+		Version:    HandshakeVersion,
+		Type:       HandshakeHello,
+		SampleRate: uint32(SampleRate),
+		Channels:   uint16(Channels),
+		Frames:     uint16(FramesPerBuffer),
+		Codec:      codec,
+	}
+}
+
+// String describes the parameters a handshake carries
+func (h HandshakePacket) String() string {
+	return fmt.Sprintf("%d Hz, %d channels, %d frames", h.SampleRate, h.Channels, h.Frames)
+}
+
+// encodeHandshake encodes a handshake packet for sending
+func encodeHandshake(h HandshakePacket) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h) // Writes to a bytes.Buffer can't fail
+	return buf.Bytes()
+}
+
+// decodeHandshake parses a handshake packet
+func decodeHandshake(b []byte) (HandshakePacket, error) {
+	if len(b) != HandshakeSize || b[0] != HandshakeMagic0 || b[1] != HandshakeMagic1 {
+		return HandshakePacket{}, fmt.Errorf("not a handshake packet (%d bytes)", len(b))
+	}
+	var h HandshakePacket
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &h); err != nil {
+		return HandshakePacket{}, err
+	}
+	if h.Version != HandshakeVersion {
+		return HandshakePacket{}, fmt.Errorf("unsupported handshake version %d", h.Version)
+	}
+	return h, nil
+}
+
+// handshakeConn is the part of the audio *net.UDPConn the handshake uses
+type handshakeConn interface {
+	Read(b []byte) (int, error)
+	Write(b []byte) (int, error)
+	SetReadDeadline(t time.Time) error
+}
+
+// errNoHandshakeReply means the server never answered, as servers without
+// handshake support don't
+var errNoHandshakeReply = errors.New("no reply to handshake")
+
+// performHandshake sends hello until the server replies, up to attempts
+// times, and returns the reply. A rejection is returned with an error
+// describing what the server plays instead.
+func performHandshake(conn handshakeConn, hello HandshakePacket, timeout time.Duration, attempts int) (HandshakePacket, error) {
+	defer conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, MaxControlPacketSize)
+	for i := 0; i < attempts; i++ {
+		if _, err := conn.Write(encodeHandshake(hello)); err != nil {
+			return HandshakePacket{}, fmt.Errorf("sending handshake: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break // Timed out (or refused): send another hello
+			}
+			reply, err := decodeHandshake(buf[:n])
+			if err != nil {
+				continue
+			}
+			switch reply.Type {
+			case HandshakeAccept:
+				return reply, nil
+			case HandshakeReject:
+				return reply, fmt.Errorf("server rejected the stream: it plays %v, this client sends %v", reply, hello)
+			}
+		}
+	}
+	return HandshakePacket{}, errNoHandshakeReply
+}
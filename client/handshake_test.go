@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeHandshakeConn answers the nth hello with replies[n], or times out
+type fakeHandshakeConn struct {
+	hellos  [][]byte
+	replies [][]byte
+	pending []byte
+}
+
+func (c *fakeHandshakeConn) Write(b []byte) (int, error) {
+	c.hellos = append(c.hellos, append([]byte(nil), b...))
+	c.pending = nil
+	if n := len(c.hellos) - 1; n < len(c.replies) {
+		c.pending = c.replies[n]
+	}
+	return len(b), nil
+}
+
+func (c *fakeHandshakeConn) Read(b []byte) (int, error) {
+	if c.pending == nil {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n := copy(b, c.pending)
+	c.pending = nil
+	return n, nil
+}
+
+func (c *fakeHandshakeConn) SetReadDeadline(time.Time) error { return nil }
+
+// TestHandshakeRoundTrip tests that a hello decodes to what was encoded
+func TestHandshakeRoundTrip(t *testing.T) {
+	if size := binary.Size(HandshakePacket{}); size != HandshakeSize {
+		t.Fatalf("expected HandshakeSize to be the encoded size %d", size)
+	}
+	hello := newHello(FormatFloat32)
+	decoded, err := decodeHandshake(encodeHandshake(hello))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded != hello {
+		t.Errorf("expected %+v, got %+v", hello, decoded)
+	}
+	if decoded.SampleRate != uint32(SampleRate) || decoded.Channels != uint16(Channels) ||
+		decoded.Frames != uint16(FramesPerBuffer) || decoded.Codec != CodecFloat32 {
+		t.Errorf("expected the client's parameters with the float32 codec, got %+v", decoded)
+	}
+	if _, err := decodeHandshake(make([]byte, HandshakeSize)); err == nil {
+		t.Error("expected a packet without the magic to be rejected")
+	}
+}
+
+// TestPerformHandshake tests accepted, rejected and unanswered handshakes
+func TestPerformHandshake(t *testing.T) {
+	hello := newHello(FormatInt16)
+	accept := hello
+	accept.Type = HandshakeAccept
+	conn := &fakeHandshakeConn{replies: [][]byte{nil, encodeHandshake(accept)}}
+	if reply, err := performHandshake(conn, hello, time.Millisecond, HandshakeAttempts); err != nil || reply.Type != HandshakeAccept {
+		t.Errorf("expected acceptance after a lost reply, got type %d (%v)", reply.Type, err)
+	}
+	if len(conn.hellos) != 2 {
+		t.Errorf("expected the hello resent once, sent %d", len(conn.hellos))
+	}
+
+	reject := hello
+	reject.Type = HandshakeReject
+	reject.SampleRate = 44100
+	conn = &fakeHandshakeConn{replies: [][]byte{encodeHandshake(reject)}}
+	_, err := performHandshake(conn, hello, time.Millisecond, HandshakeAttempts)
+	if err == nil || !strings.Contains(err.Error(), "44100 Hz") {
+		t.Errorf("expected the rejection to name the server's rate, got %v", err)
+	}
+
+	conn = &fakeHandshakeConn{}
+	if _, err := performHandshake(conn, hello, time.Millisecond, 3); !errors.Is(err, errNoHandshakeReply) {
+		t.Errorf("expected no reply, got %v", err)
+	}
+	if len(conn.hellos) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(conn.hellos))
+	}
+}
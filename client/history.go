@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AckMessage is the server's acknowledgment of delivered packets. All fields
+// are little-endian uint32s, in order.
+type AckMessage struct {
+	Epoch    uint32
+	Sequence uint32 // Highest sequence delivered in order
+	Expected uint32 // Sequenced packets sent, judging by the highest received
+	Received uint32 // Sequenced packets received
+}
+
+// Ack returns the acknowledgment carried by a ControlAck message
+func (m ControlMessage) Ack() (AckMessage, error) {
+	if m.Type != ControlAck || len(m.Payload) != 16 {
+		return AckMessage{}, errors.New("not an ack message")
+	}
+	return AckMessage{
+		Epoch:    binary.LittleEndian.Uint32(m.Payload[0:]),
+		Sequence: binary.LittleEndian.Uint32(m.Payload[4:]),
+		Expected: binary.LittleEndian.Uint32(m.Payload[8:]),
+		Received: binary.LittleEndian.Uint32(m.Payload[12:]),
+	}, nil
+}
+
+// LossPercent returns the percentage of packets the server never received
+func (a AckMessage) LossPercent() float64 {
+	if a.Expected == 0 || a.Received >= a.Expected {
+		return 0
+	}
+	return float64(a.Expected-a.Received) / float64(a.Expected) * 100
+}
+
+// String summarizes the acknowledgment for the -diag report
+func (a AckMessage) String() string {
+	return fmt.Sprintf("Delivery - Acked sequence: %d, Received: %d of %d, Loss: %.2f%%",
+		a.Sequence, a.Received, a.Expected, a.LossPercent())
+}
+
+// DefaultSendHistory is how many sent datagrams are kept for the server to
+// acknowledge, a few seconds of audio at the default buffer size
+const DefaultSendHistory = 256
+
+// historyEntry is one sent datagram carrying packets consecutive sequences
+type historyEntry struct {
+	sequence uint32
+	packets  int
+	data     []byte
+}
+
+// sendHistory keeps the most recent sequenced datagrams sent until the
+// server acknowledges them. Slots are reused, so adding doesn't allocate
+// once each has grown to the datagram size.
+type sendHistory struct {
+	mu      sync.Mutex
+	entries []historyEntry
+	start   int
+	count   int
+}
+
+// newSendHistory creates a history of at most size datagrams; when full the
+// oldest is dropped
+func newSendHistory(size int) *sendHistory {
+	return &sendHistory{entries: make([]historyEntry, size)}
+}
+
+// Add records a datagram holding packets packets starting at sequence
+func (h *sendHistory) Add(sequence uint32, packets int, datagram []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == len(h.entries) {
+		h.start = (h.start + 1) % len(h.entries)
+		h.count--
+	}
+	e := &h.entries[(h.start+h.count)%len(h.entries)]
+	e.sequence = sequence
+	e.packets = packets
+	e.data = append(e.data[:0], datagram...)
+	h.count++
+}
+
+// Trim drops datagrams whose packets are all at or before acked, returning
+// how many were dropped
+func (h *sendHistory) Trim(acked uint32) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dropped := 0
+	for h.count > 0 {
+		e := h.entries[h.start]
+		last := e.sequence + uint32(e.packets) - 1
+		if int32(last-acked) > 0 {
+			break
+		}
+		h.start = (h.start + 1) % len(h.entries)
+		h.count--
+		dropped++
+	}
+	return dropped
+}
+
+// Len returns the number of datagrams held
+func (h *sendHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// TestSendHistoryTrimsToAck tests that acknowledged datagrams are freed
+func TestSendHistoryTrimsToAck(t *testing.T) {
+	h := newSendHistory(16)
+	for seq := uint32(0); seq < 10; seq++ {
+		h.Add(seq, 1, []byte{byte(seq)})
+	}
+	// A coalesced datagram of three packets
+	h.Add(10, 3, []byte{10, 11, 12})
+
+	if dropped := h.Trim(5); dropped != 6 || h.Len() != 5 {
+		t.Errorf("expected 6 trimmed and 5 left, got %d trimmed and %d left", dropped, h.Len())
+	}
+	// The coalesced datagram stays until its last packet is acknowledged
+	if h.Trim(11); h.Len() != 1 {
+		t.Errorf("expected the partly acknowledged datagram to be kept, got %d left", h.Len())
+	}
+	if h.Trim(12); h.Len() != 0 {
+		t.Errorf("expected everything to be trimmed, got %d left", h.Len())
+	}
+	// Stale acks are harmless
+	h.Add(13, 1, []byte{13})
+	if dropped := h.Trim(3); dropped != 0 || h.Len() != 1 {
+		t.Errorf("expected an old ack to trim nothing, got %d trimmed", dropped)
+	}
+}
+
+// TestSendHistoryBounded tests that the oldest datagrams are dropped when full
+func TestSendHistoryBounded(t *testing.T) {
+	h := newSendHistory(4)
+	for seq := uint32(0); seq < 10; seq++ {
+		h.Add(seq, 1, []byte{byte(seq)})
+	}
+	if h.Len() != 4 {
+		t.Fatalf("expected 4 datagrams held, got %d", h.Len())
+	}
+	if e := h.entries[h.start]; e.sequence != 6 {
+		t.Errorf("expected the oldest held to be 6, got %d", e.sequence)
+	}
+}
+
+// TestSendPipelineHandlesAck tests that an ack for the pipeline's epoch trims its history
+func TestSendPipelineHandlesAck(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.framed = true
+	pipeline.history = newSendHistory(8)
+	in := make([]int16, FramesPerBuffer*Channels)
+	in[0] = 1
+	for i := 0; i < 5; i++ {
+		pipeline.ProcessInt16(in, time.Now())
+	}
+	if pipeline.history.Len() != 5 {
+		t.Fatalf("expected 5 datagrams in the history, got %d", pipeline.history.Len())
+	}
+
+	pipeline.HandleAck(AckMessage{Epoch: pipeline.epoch + 1, Sequence: 4})
+	if pipeline.history.Len() != 5 {
+		t.Error("expected an ack for another epoch to be ignored")
+	}
+	pipeline.HandleAck(AckMessage{Epoch: pipeline.epoch, Sequence: 2, Expected: 5, Received: 4})
+	if pipeline.history.Len() != 2 {
+		t.Errorf("expected 2 datagrams left after acking 0-2, got %d", pipeline.history.Len())
+	}
+	if ack, ok := pipeline.LastAck(); !ok || ack.LossPercent() != 20 {
+		t.Errorf("expected 20%% loss from the last ack, got %+v", ack)
+	}
+}
+
+// TestDecodeAck tests decoding an ack control message
+func TestDecodeAck(t *testing.T) {
+	payload := make([]byte, 16)
+	for i, v := range []uint32{7, 100, 200, 150} {
+		binary.LittleEndian.PutUint32(payload[i*4:], v)
+	}
+	msg, err := decodeControlMessage(encodeControlMessage(ControlAck, payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ack, err := msg.Ack()
+	want := AckMessage{Epoch: 7, Sequence: 100, Expected: 200, Received: 150}
+	if err != nil || ack != want {
+		t.Errorf("expected %+v, got %+v (%v)", want, ack, err)
+	}
+	if loss := ack.LossPercent(); loss != 25 {
+		t.Errorf("expected 25%% loss, got %v", loss)
+	}
+}
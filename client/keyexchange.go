@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// With -encrypt, the client agrees a fresh session key with the server
+// before streaming and sends every datagram encrypted with it. The hello
+// carries an ephemeral X25519 public key and the server replies with its
+// own; both derive an AES-256-GCM key from the shared secret with
+// HKDF-SHA256. Key exchange packets are:
+//
+//	'A' 'K' version type suite public_key(32)
+const (
+	KeyExchangeMagic0  = 'A'
+	KeyExchangeMagic1  = 'K'
+	KeyExchangeVersion = 1
+	KeyExchangeSize    = 37
+)
+
+// Key exchange packet types
+const (
+	KeyExchangeHello = 1
+	KeyExchangeReply = 2
+)
+
+// SuiteX25519AESGCM is the only cipher suite: X25519, HKDF-SHA256 and AES-256-GCM
+const SuiteX25519AESGCM = 1
+
+// sessionKeyInfo binds derived keys to this protocol
+const sessionKeyInfo = "cli-audio-streamer audio key v1"
+
+// Encrypted datagrams are:
+//
+//	'A' 'E' counter(uint64 LE) ciphertext
+//
+// The counter is the GCM nonce and the 10-byte prefix is authenticated.
+const (
+	SealedMagic0     = 'A'
+	SealedMagic1     = 'E'
+	SealedHeaderSize = 10
+	SealOverhead     = SealedHeaderSize + 16 // Prefix and GCM tag
+)
+
+// encodeKeyExchange builds a key exchange packet carrying public
+func encodeKeyExchange(msgType uint8, public *ecdh.PublicKey) []byte {
+	b := make([]byte, 0, KeyExchangeSize)
+	b = append(b, KeyExchangeMagic0, KeyExchangeMagic1, KeyExchangeVersion, msgType, SuiteX25519AESGCM)
+	return append(b, public.Bytes()...)
+}
+
+// decodeKeyExchange parses a key exchange packet
+func decodeKeyExchange(b []byte) (msgType uint8, public *ecdh.PublicKey, err error) {
+	if len(b) != KeyExchangeSize || b[0] != KeyExchangeMagic0 || b[1] != KeyExchangeMagic1 {
+		return 0, nil, fmt.Errorf("not a key exchange packet (%d bytes)", len(b))
+	}
+	if b[2] != KeyExchangeVersion {
+		return 0, nil, fmt.Errorf("unsupported key exchange version %d", b[2])
+	}
+	if b[4] != SuiteX25519AESGCM {
+		return 0, nil, fmt.Errorf("unsupported cipher suite %d", b[4])
+	}
+	public, err = ecdh.X25519().NewPublicKey(b[5:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return b[3], public, nil
+}
+
+// deriveSessionKey combines private with the peer's public key and derives
+// the session's AES-GCM cipher, salted with both public keys
+func deriveSessionKey(private *ecdh.PrivateKey, peer, client, server *ecdh.PublicKey) (cipher.AEAD, error) {
+	secret, err := private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(client.Bytes(), server.Bytes()...)
+	key, err := hkdf.Key(sha256.New, secret, salt, sessionKeyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// errNoKeyExchangeReply means the server never answered, as servers run
+// without -encrypt don't
+var errNoKeyExchangeReply = errors.New("no reply to key exchange")
+
+// performKeyExchange sends a hello until the server replies, up to attempts
+// times, and returns the agreed session cipher
+func performKeyExchange(conn handshakeConn, timeout time.Duration, attempts int) (cipher.AEAD, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hello := encodeKeyExchange(KeyExchangeHello, private.PublicKey())
+	defer conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, MaxControlPacketSize)
+	for i := 0; i < attempts; i++ {
+		if _, err := conn.Write(hello); err != nil {
+			return nil, fmt.Errorf("sending key exchange: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break // Timed out (or refused): send another hello
+			}
+			msgType, server, err := decodeKeyExchange(buf[:n])
+			if err != nil || msgType != KeyExchangeReply {
+				continue
+			}
+			return deriveSessionKey(private, server, private.PublicKey(), server)
+		}
+	}
+	return nil, errNoKeyExchangeReply
+}
+
+// sealingWriter encrypts each datagram written through it with the
+// session key before passing it on
+type sealingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	counter uint64
+	nonce   []byte
+	buf     []byte
+}
+
+// newSealingWriter creates a writer sealing datagrams for w with aead
+func newSealingWriter(w io.Writer, aead cipher.AEAD) *sealingWriter {
+	return &sealingWriter{w: w, aead: aead, nonce: make([]byte, aead.NonceSize())}
+}
+
+// Write seals p as the next datagram and writes it. It reports p as fully
+// written only if the whole sealed datagram was.
+func (s *sealingWriter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf[:0], SealedMagic0, SealedMagic1)
+	s.buf = binary.LittleEndian.AppendUint64(s.buf, s.counter)
+	s.counter++
+	copy(s.nonce[len(s.nonce)-8:], s.buf[2:SealedHeaderSize])
+	s.buf = s.aead.Seal(s.buf, s.nonce, p, s.buf[:SealedHeaderSize])
+	n, err := s.w.Write(s.buf)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(s.buf) {
+		return max(0, n-SealOverhead), nil
+	}
+	return len(p), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+// serverKey derives the key a server with private would agree on for hello
+func serverKey(t *testing.T, private *ecdh.PrivateKey, hello []byte) cipher.AEAD {
+	t.Helper()
+	_, client, err := decodeKeyExchange(hello)
+	if err != nil {
+		t.Fatalf("decoding hello: %v", err)
+	}
+	aead, err := deriveSessionKey(private, client, client, private.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+// openSealed decrypts a datagram the way the server does
+func openSealed(aead cipher.AEAD, b []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce[len(nonce)-8:], b[2:SealedHeaderSize])
+	return aead.Open(nil, nonce, b[SealedHeaderSize:], b[:SealedHeaderSize])
+}
+
+// TestKeyExchangeAgreesKey tests that the client and server derive the
+// same key, so datagrams the client seals open on the server, and that a
+// man in the middle answering with its own key can't read them
+func TestKeyExchangeAgreesKey(t *testing.T) {
+	server, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	conn := &fakeHandshakeConn{replies: [][]byte{nil, encodeKeyExchange(KeyExchangeReply, server.PublicKey())}}
+	aead, err := performKeyExchange(conn, 0, HandshakeAttempts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.hellos) != 2 {
+		t.Fatalf("expected a second hello after the first went unanswered, got %d", len(conn.hellos))
+	}
+
+	out := &recordingConn{}
+	w := newSealingWriter(out, aead)
+	for _, audio := range []string{"first", "second"} {
+		if n, err := w.Write([]byte(audio)); err != nil || n != len(audio) {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+	}
+	if len(out.datagrams[0]) != SealOverhead+len("first") {
+		t.Errorf("sealed datagram is %d bytes, want %d", len(out.datagrams[0]), SealOverhead+len("first"))
+	}
+
+	matching := serverKey(t, server, conn.hellos[1])
+	for i, want := range []string{"first", "second"} {
+		opened, err := openSealed(matching, out.datagrams[i])
+		if err != nil || string(opened) != want {
+			t.Errorf("datagram %d opened as %q, %v; want %q", i, opened, err, want)
+		}
+	}
+
+	mitm, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err := openSealed(serverKey(t, mitm, conn.hellos[1]), out.datagrams[0]); err == nil {
+		t.Error("a different key decrypted the audio")
+	}
+}
+
+// TestKeyExchangeNoReply tests that a server without -encrypt is reported
+func TestKeyExchangeNoReply(t *testing.T) {
+	conn := &fakeHandshakeConn{}
+	if _, err := performKeyExchange(conn, 0, HandshakeAttempts); !errors.Is(err, errNoKeyExchangeReply) {
+		t.Errorf("expected errNoKeyExchangeReply, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// Sustained clipping is when at least ClipSamples samples are at full scale
+// in each of ClipBuffers consecutive buffers
+const (
+	ClipSamples = 4
+	ClipBuffers = 5
+)
+
+// The limiter backs off by LimiterBackoff per ClipBuffers clipped buffers,
+// down to LimiterMinGain, and steps back up after LimiterRecoverBuffers
+// clean buffers in a row (about a second)
+const (
+	LimiterBackoff        = 0.8
+	LimiterMinGain        = 0.25
+	LimiterRecoverBuffers = 100
+)
+
+// ClipLogInterval limits how often clipping is warned about when the gain
+// isn't being reduced
+const ClipLogInterval = 10 * time.Second
+
+// InputLimiter detects captured audio hitting full scale, meaning the
+// source is too hot and any gain applied after it only clips further.
+// With reduce set it also returns a gain that backs off while the clipping
+// lasts and recovers once it stops; otherwise the gain stays at 1 and the
+// clipping is only warned about. It is used from the capture goroutine only.
+type InputLimiter struct {
+	reduce     bool
+	gain       float64
+	clippedRun int
+	cleanRun   int
+	lastWarn   time.Time
+}
+
+// NewInputLimiter creates a limiter at unity gain
+func NewInputLimiter(reduce bool) *InputLimiter {
+	return &InputLimiter{reduce: reduce, gain: 1}
+}
+
+// Observe records how many samples of a captured buffer were at full scale
+// and returns the gain to apply to it
+func (l *InputLimiter) Observe(clipped int) float64 {
+	if clipped < ClipSamples {
+		l.clippedRun = 0
+		l.cleanRun++
+		if l.gain < 1 && l.cleanRun >= LimiterRecoverBuffers {
+			l.cleanRun = 0
+			l.gain = math.Min(1, l.gain/LimiterBackoff)
+			if l.gain == 1 {
+				log.Println("Input no longer clipping, gain restored")
+			}
+		}
+		return l.gain
+	}
+	l.cleanRun = 0
+	l.clippedRun++
+	if l.clippedRun < ClipBuffers {
+		return l.gain
+	}
+	l.clippedRun = 0
+	if !l.reduce {
+		if now := time.Now(); now.Sub(l.lastWarn) >= ClipLogInterval {
+			l.lastWarn = now
+			log.Println("Warning: captured audio is clipping; lower the source's level or use -limit-input")
+		}
+		return l.gain
+	}
+	if l.gain > LimiterMinGain {
+		l.gain = math.Max(LimiterMinGain, l.gain*LimiterBackoff)
+		log.Printf("Warning: captured audio is clipping, reducing input gain to %.2f", l.gain)
+	}
+	return l.gain
+}
+
+// Gain returns the gain currently applied
+func (l *InputLimiter) Gain() float64 {
+	return l.gain
+}
+
+// countClippedInt16 returns how many samples are at full scale
+func countClippedInt16(samples []int16) int {
+	n := 0
+	for _, s := range samples {
+		if s >= math.MaxInt16 || s <= math.MinInt16+1 {
+			n++
+		}
+	}
+	return n
+}
+
+// countClippedFloat32 returns how many samples are at or beyond full scale
+func countClippedFloat32(samples []float32) int {
+	n := 0
+	for _, s := range samples {
+		if s >= 1 || s <= -1 {
+			n++
+		}
+	}
+	return n
+}
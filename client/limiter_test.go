@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestInputLimiterBacksOffAndRecovers tests that sustained clipping reduces
+// the gain, never below the minimum, and that clean input restores it
+func TestInputLimiterBacksOffAndRecovers(t *testing.T) {
+	l := NewInputLimiter(true)
+	clipped := make([]int16, 64)
+	for i := range clipped {
+		clipped[i] = math.MaxInt16
+	}
+	clean := make([]int16, 64)
+
+	for i := 0; i < ClipBuffers-1; i++ {
+		if gain := l.Observe(countClippedInt16(clipped)); gain != 1 {
+			t.Fatalf("gain %.2f after %d clipped buffers, want 1 until clipping is sustained", gain, i+1)
+		}
+	}
+	if gain := l.Observe(countClippedInt16(clipped)); gain != LimiterBackoff {
+		t.Fatalf("gain %.2f once clipping is sustained, want %.2f", gain, LimiterBackoff)
+	}
+	for i := 0; i < 100*ClipBuffers; i++ {
+		l.Observe(countClippedInt16(clipped))
+	}
+	if gain := l.Gain(); gain != LimiterMinGain {
+		t.Fatalf("gain %.2f after long clipping, want the minimum %.2f", gain, LimiterMinGain)
+	}
+
+	for i := 0; i < 100*LimiterRecoverBuffers; i++ {
+		l.Observe(countClippedInt16(clean))
+	}
+	if gain := l.Gain(); gain != 1 {
+		t.Errorf("gain %.2f after clipping stopped, want 1", gain)
+	}
+}
+
+// TestInputLimiterDetectOnly tests that without reduction clipping is
+// detected but the gain is left alone
+func TestInputLimiterDetectOnly(t *testing.T) {
+	l := NewInputLimiter(false)
+	clipped := []float32{1, -1, 1, -1, 1.5, 0.2}
+	if n := countClippedFloat32(clipped); n != 5 {
+		t.Fatalf("countClippedFloat32 = %d, want 5", n)
+	}
+	for i := 0; i < 10*ClipBuffers; i++ {
+		if gain := l.Observe(countClippedFloat32(clipped)); gain != 1 {
+			t.Fatalf("gain %.2f without reduction, want 1", gain)
+		}
+	}
+}
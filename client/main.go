@@ -1,26 +1,33 @@
 package main
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
-	"sync/atomic" // For atomic.Value
+	"time"
 
 	"github.com/gordonklaus/portaudio"
 )
 
-// Audio parameters
-const (
+// Audio parameters. These are the defaults; -sample-rate, -channels and
+// -frames replace them through setStreamParams, and must match the server's.
+var (
 	SampleRate      = 48000 // Hz
 	Channels        = 2     // Stereo
 	FramesPerBuffer = 512   // Number of audio frames per buffer
-	ServerAudioPort = 8080  // Default server port for audio
 )
 
+// ServerAudioPort is the server's audio port
+const ServerAudioPort = 8080
+
 // findWasapiStereoMixDevice searches for a "Stereo Mix" device on the "Windows WASAPI" host API.
 func findWasapiStereoMixDevice(devices []*portaudio.DeviceInfo) (device *portaudio.DeviceInfo, found bool) {
 	for _, info := range devices {
@@ -37,16 +44,94 @@ func main() {
 	initialVolume := flag.Float64("volume", 1.0, "Initial client-side volume adjustment (0.0 to 1.0)")
 	controlPort := flag.Int("control-port", 8081, "Port to listen for server control messages")
 	listDevices := flag.Bool("list-devices", false, "List available audio input devices and exit.")
+	watch := flag.Bool("watch", false, "With -list-devices, keep running and print input devices as they are added or removed.")
 	deviceName := flag.String("device-name", "", "Name of the audio input device to use.")
 	deviceIndex := flag.Int("device-index", -1, "Index of the audio input device to use.")
+	autoDevice := flag.Bool("auto-device", false, "Use the input device with the lowest latency.")
+	autoDeviceLoopback := flag.Bool("auto-device-loopback", false, "With -auto-device, only consider loopback devices (e.g. Stereo Mix, monitors).")
+	sampleRate := flag.Int("sample-rate", SampleRate, fmt.Sprintf("Sample rate to capture and send in Hz (%d to %d); must match the server's -sample-rate", MinSampleRate, MaxSampleRate))
+	channels := flag.Int("channels", Channels, "Channels to send: 1 (mono) or 2 (stereo); must match the server's -channels")
+	frames := flag.Int("frames", FramesPerBuffer, fmt.Sprintf("Audio frames per packet (%d to %d); must match the server's -frames", MinFrames, MaxFrames))
+	handshake := flag.Bool("handshake", false, "Before streaming, check that the server plays the same sample rate, channels and frames, and exit if it doesn't")
+	sourceChannels := flag.Int("source-channels", Channels, "Number of channels to capture: the -channels value, or with stereo 6 (5.1) or 8 (7.1). Surround is downmixed by the server.")
+	formatStr := flag.String("format", string(FormatInt16), "Sample format to capture and send (s16 or f32)")
+	formatAuto := flag.Bool("sample-format-auto", false, "Fall back to another sample format if the device doesn't support -format")
+	maxPPS := flag.Int("max-pps", 0, "Maximum packets per second to send; extra audio is coalesced into larger packets (0 disables)")
+	autoFrames := flag.Bool("auto-frames", false, "Let PortAudio choose the capture buffer size; audio is regrouped into standard packets before sending")
+	blocking := flag.Bool("blocking", false, "Read from the input stream in a loop instead of using a PortAudio callback")
+	keepalive := flag.Bool("keepalive", false, "Send a small keepalive packet every 50ms instead of full packets of digital silence (ignored with -max-pps)")
+	diag := flag.Bool("diag", false, "Measure and periodically report the latency from capture callback to UDP send completing")
+	endian := flag.String("endian", "little", "Byte order to send samples in (little or big); big-endian packets are flagged in the header")
+	historySize := flag.Int("send-history", DefaultSendHistory, "Number of sequenced datagrams to keep until the server acknowledges them, with -keepalive, -endian big or -max-pps (0 disables)")
+	initialSequence := flag.Uint("initial-sequence", 0, "Sequence number of the first packet sent (for testing wraparound and mid-stream joins)")
+	pinThread := flag.Bool("pin-thread", false, "With -blocking, lock the capture loop to one OS thread to reduce scheduling jitter")
+	raisePriority := flag.Bool("raise-priority", false, "With -blocking, raise the capture thread's priority (implies -pin-thread; may need elevated privileges)")
+	encrypt := flag.Bool("encrypt", false, "Agree a session key with the server and encrypt the audio with it; the server must be run with -encrypt")
+	psk := flag.String("psk", "", "Pre-shared key to authenticate audio, control messages, handshakes and key exchanges with (HMAC-SHA256); the server must be run with the same -psk")
+	limitInput := flag.Bool("limit-input", false, "Reduce the gain automatically while the captured audio is clipping at full scale, restoring it once the clipping stops")
+	channelMapStr := flag.String("channel-map", "", "Comma-separated input channel for each output channel (e.g., \"1,0\" swaps left and right).")
 	flag.Parse()
 
 	if *initialVolume < 0.0 || *initialVolume > 1.0 {
 		log.Fatalf("Initial volume must be between 0.0 and 1.0")
 	}
 
+	format, err := parseSampleFormat(*formatStr)
+	if err != nil {
+		log.Fatalf("Invalid sample format: %v", err)
+	}
+	byteOrder, err := parseByteOrder(*endian)
+	if err != nil {
+		log.Fatalf("Invalid endian: %v", err)
+	}
+
+	if err := checkStreamParams(*sampleRate, *channels, *frames); err != nil {
+		log.Fatalf("Invalid stream parameters: %v", err)
+	}
+	setStreamParams(*sampleRate, *channels, *frames)
+	// Capture as many channels as are sent unless told otherwise
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["source-channels"] {
+		*sourceChannels = Channels
+	}
+
+	if *sourceChannels != Channels && (Channels != 2 || (*sourceChannels != 6 && *sourceChannels != 8)) {
+		log.Fatalf("Source channels must match -channels, or be 6 or 8 with stereo")
+	}
+	if *sourceChannels != Channels && format != FormatInt16 {
+		log.Fatalf("Surround capture requires -format %s", FormatInt16)
+	}
+
+	if *maxPPS < 0 {
+		log.Fatalf("Max packets per second must not be negative")
+	}
+	if *maxPPS > 0 && (*sourceChannels != Channels || format != FormatInt16) {
+		log.Fatalf("-max-pps requires stereo -format %s", FormatInt16)
+	}
+
+	if *historySize < 0 {
+		log.Fatalf("Send history size must not be negative")
+	}
+
+	if (*pinThread || *raisePriority) && !*blocking {
+		log.Fatalf("-pin-thread and -raise-priority need -blocking; capture callbacks run on PortAudio's own thread")
+	}
+
+	if *blocking && *autoFrames {
+		log.Fatalf("-blocking reads fixed-size buffers and can't be combined with -auto-frames")
+	}
+
+	var channelMap []int
+	if *channelMapStr != "" {
+		channelMap, err = parseChannelMap(*channelMapStr, *sourceChannels)
+		if err != nil {
+			log.Fatalf("Invalid channel map: %v", err)
+		}
+	}
+
 	// Initialize PortAudio for device listing or streaming
-	err := portaudio.Initialize()
+	err = portaudio.Initialize()
 	if err != nil {
 		log.Fatalf("Error initializing PortAudio: %v", err)
 	}
@@ -63,12 +148,17 @@ func main() {
 				fmt.Printf("  [%d] %s (Host API: %s)\\n", i, info.Name, info.HostApi.Name)
 			}
 		}
+		if *watch {
+			watchDevices(DeviceWatchInterval)
+		}
 		return // Exit after listing devices
 	}
 
-	// Use atomic.Value for thread-safe volume adjustment
-	var currentClientVolume atomic.Value
-	currentClientVolume.Store(*initialVolume)
+	// Thread-safe volume, updated by the control listener
+	currentClientVolume, err := NewVolume(*initialVolume)
+	if err != nil {
+		log.Fatalf("Invalid initial volume: %v", err)
+	}
 
 	// Construct server address string
 	serverAddrStr := fmt.Sprintf("%s:%d", *serverIP, ServerAudioPort)
@@ -86,6 +176,64 @@ func main() {
 	}
 	defer audioConn.Close()
 
+	// With -psk the handshake and key exchange are signed like the audio
+	var exchangeConn handshakeConn = audioConn
+	if *psk != "" {
+		exchangeConn = newSignedConn(audioConn, []byte(*psk))
+	}
+
+	if *handshake {
+		reply, err := performHandshake(exchangeConn, newHello(format), HandshakeTimeout, HandshakeAttempts)
+		if errors.Is(err, errNoHandshakeReply) {
+			log.Println("Warning: the server didn't answer the handshake; it may not support one. Streaming anyway.")
+		} else if err != nil {
+			log.Fatalf("Handshake failed: %v", err)
+		} else {
+			log.Printf("Server accepted the stream (%v)", reply)
+		}
+	}
+
+	var audioWriter io.Writer = audioConn
+	if *encrypt {
+		aead, err := performKeyExchange(exchangeConn, HandshakeTimeout, HandshakeAttempts)
+		if errors.Is(err, errNoKeyExchangeReply) {
+			log.Fatalf("The server didn't answer the key exchange; is it running with -encrypt?")
+		} else if err != nil {
+			log.Fatalf("Key exchange failed: %v", err)
+		}
+		log.Println("Agreed a session key with the server, encrypting audio")
+		audioWriter = newSealingWriter(audioConn, aead)
+	}
+	if *psk != "" {
+		audioWriter = &signingWriter{w: audioWriter, key: []byte(*psk)}
+	}
+
+	pipeline := newSendPipeline(audioWriter, currentClientVolume, *sourceChannels)
+	pipeline.channelMap = channelMap
+	pipeline.limiter = NewInputLimiter(*limitInput)
+	if *maxPPS > 0 {
+		pipeline.coalescer = newPacketCoalescer(*maxPPS, FramesPerBuffer*Channels*2, DefaultMaxCoalesce)
+	}
+	pipeline.byteOrder = byteOrder
+	pipeline.keepalive = *keepalive
+	if (*keepalive || byteOrder == binary.BigEndian) && pipeline.coalescer == nil {
+		pipeline.framed = true
+	}
+	// Only packets with the full header carry the epoch acks are matched by
+	headered := pipeline.coalescer != nil || pipeline.framed
+	if *historySize > 0 && headered {
+		pipeline.history = newSendHistory(*historySize)
+	}
+	if *initialSequence > math.MaxUint32 {
+		log.Fatalf("Initial sequence must fit in 32 bits")
+	}
+	pipeline.sequencer = newSequencer(uint32(*initialSequence))
+	if headered {
+		log.Printf("Sending epoch %d starting at sequence %d", pipeline.epoch, pipeline.sequencer.Next())
+	} else {
+		log.Printf("Sending packets starting at sequence %d", pipeline.sequencer.Next())
+	}
+
 	// Start goroutine to listen for control messages from server
 	go func() {
 		controlAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", *controlPort))
@@ -102,153 +250,130 @@ func main() {
 
 		log.Printf("Client control listener started on :%d", *controlPort)
 
-		controlBuffer := make([]byte, 8) // For float64 volume
+		controlBuffer := make([]byte, MaxControlPacketSize)
+		var authFailures int64 // Forged or replayed
+		var replays ReplayWindow
 		for {
 			n, _, err := controlConn.ReadFromUDP(controlBuffer)
 			if err != nil {
 				log.Printf("Error reading control UDP packet: %v", err)
 				continue
 			}
-			if n == 8 {
-				var receivedVolume float64
-				buf := bytes.NewReader(controlBuffer[:n])
-				err = binary.Read(buf, binary.LittleEndian, &receivedVolume)
+			packet := controlBuffer[:n]
+			if *psk != "" {
+				if packet, err = openSignedControl([]byte(*psk), &replays, packet); err != nil {
+					authFailures++
+					log.Printf("Dropping control message: %v (%d so far)", err, authFailures)
+					continue
+				}
+			}
+			msg, err := decodeControlMessage(packet)
+			if err != nil {
+				log.Printf("Error decoding control message: %v", err)
+				continue
+			}
+			switch msg.Type {
+			case ControlVolume:
+				receivedVolume, err := msg.Volume()
 				if err != nil {
 					log.Printf("Error decoding received volume: %v", err)
 					continue
 				}
-				if receivedVolume >= 0.0 && receivedVolume <= 1.0 {
-					currentClientVolume.Store(receivedVolume)
+				if err := currentClientVolume.SetVolume(receivedVolume); err == nil {
 					log.Printf("Client volume updated by server to: %.2f", receivedVolume)
 				} else {
 					log.Printf("Received invalid volume value: %.2f", receivedVolume)
 				}
-			} else {
-				log.Printf("Received control packet of unexpected size: %d bytes (expected 8)", n)
+			case ControlAck:
+				ack, err := msg.Ack()
+				if err != nil {
+					log.Printf("Error decoding ack: %v", err)
+					continue
+				}
+				pipeline.HandleAck(ack)
+			default:
+				log.Printf("Ignoring unsupported control message type %d", msg.Type)
 			}
 		}
 	}()
 
-	// Buffer for sending data over UDP.
-	sendBuffer := new(bytes.Buffer)
-
-	// audioCallback is the function called by PortAudio when new audio data is available.
-	audioCallback := func(in []int16) {
-		sendBuffer.Reset() // Clear buffer for new data
-
-		// Get current volume.
-		vol := currentClientVolume.Load().(float64)
-
-		// Apply volume adjustment and write to buffer.
-		for _, sample := range in {
-			adjustedSample := int16(float64(sample) * vol)
-			err := binary.Write(sendBuffer, binary.LittleEndian, adjustedSample)
-			if err != nil {
-				log.Printf("Error writing sample to buffer: %v", err)
-				// Continue processing the rest of the buffer.
+	if *diag {
+		sendLatency := newLatencyHistogram()
+		pipeline.sendLatency = sendLatency
+		go func() {
+			ticker := time.NewTicker(DiagReportInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				log.Println(sendLatency)
+				if ack, ok := pipeline.LastAck(); ok {
+					log.Println(ack)
+				}
 			}
-		}
+		}()
+	}
 
-		// Send the audio buffer over UDP if it has data.
-		if sendBuffer.Len() > 0 {
-			_, err := audioConn.Write(sendBuffer.Bytes())
-			if err != nil {
-				log.Printf("Error sending UDP packet: %v", err)
-			}
+	opts := captureOptions{
+		deviceIndex:        *deviceIndex,
+		deviceName:         *deviceName,
+		autoDevice:         *autoDevice,
+		autoDeviceLoopback: *autoDeviceLoopback,
+		sourceChannels:     *sourceChannels,
+		format:             format,
+		formatAuto:         *formatAuto,
+		maxPPS:             *maxPPS,
+		autoFrames:         *autoFrames,
+		blocking:           *blocking,
+	}
+	input, err := openCapture(opts, pipeline)
+	if err != nil {
+		var noDevice *noDeviceError
+		if errors.As(err, &noDevice) {
+			exitNoDevice(noDevice.cause)
 		}
+		log.Fatalf("Error opening input stream: %v", err)
 	}
 
-	// --- Device Selection Logic ---
-	var chosenDevice *portaudio.DeviceInfo
-	devices, err := portaudio.Devices()
+	// Start the stream
+	err = input.stream.Start()
 	if err != nil {
-		log.Fatalf("Error listing devices for stream setup: %v", err)
+		log.Fatalf("Error starting stream: %v", err)
 	}
 
-	if *deviceIndex >= 0 {
-		// User specified a device index
-		if *deviceIndex < len(devices) {
-			if devices[*deviceIndex].MaxInputChannels > 0 {
-				chosenDevice = devices[*deviceIndex]
-				log.Printf("Using specified device by index: [%d] %s", *deviceIndex, chosenDevice.Name)
-			} else {
-				log.Fatalf("Device at index %d is not an input device.", *deviceIndex)
-			}
-		} else {
-			log.Fatalf("Invalid device index: %d. Max index is %d.", *deviceIndex, len(devices)-1)
-		}
-	} else if *deviceName != "" {
-		// User specified a device name
-		var found bool
-		for _, device := range devices {
-			if strings.EqualFold(device.Name, *deviceName) && device.MaxInputChannels > 0 {
-				chosenDevice = device
-				found = true
-				break
+	// The console's restart reopens the stream, re-running device selection.
+	// A blocking read loop can't follow the stream being replaced under it.
+	restarter := &streamRestarter{current: input.stream}
+	console := &Console{}
+	if input.processBlocking == nil {
+		restarter.open = func() (inputStream, error) {
+			c, err := openCapture(opts, pipeline)
+			if err != nil {
+				return nil, err
 			}
+			return c.stream, nil
 		}
-		if !found {
-			log.Fatalf("Specified device '%s' not found or is not an input device.", *deviceName)
-		}
-		log.Printf("Using specified device by name: %s", chosenDevice.Name)
-	} else {
-		// Default behavior: search for "Stereo Mix"
-		var found bool
-		chosenDevice, found = findWasapiStereoMixDevice(devices)
-		if !found {
-			log.Println("Warning: 'Stereo Mix' on WASAPI not found. Will fall back to default device.")
-		}
-	}
-	// --- End of Device Selection ---
-
-	var stream *portaudio.Stream
-	var useDefault bool
-
-	if chosenDevice != nil {
-		// A specific device was chosen (by index, name, or 'Stereo Mix' search)
-		log.Printf("Attempting to open stream with: %s", chosenDevice.Name)
-		param := portaudio.StreamParameters{
-			Input: portaudio.StreamDeviceParameters{
-				Device:   chosenDevice,
-				Channels: Channels,
-				Latency:  chosenDevice.DefaultLowInputLatency,
-			},
-			SampleRate:      SampleRate,
-			FramesPerBuffer: FramesPerBuffer,
-		}
-		stream, err = portaudio.OpenStream(param, audioCallback)
-		if err != nil {
-			log.Printf("Warning: Failed to open '%s': %v. Falling back to default device.", chosenDevice.Name, err)
-			useDefault = true // Mark to fallback
-		} else {
-			fmt.Printf("Using audio input: %s\\n", chosenDevice.Name)
-		}
-	} else {
-		// No specific device was found (e.g., 'Stereo Mix' not present)
-		useDefault = true
+		console.restarter = restarter
 	}
+	go console.Run(os.Stdin, os.Stdout)
 
-	// If a specific device failed or was never found, use the default.
-	if useDefault {
-		log.Println("Attempting to open stream with default input device.")
-		stream, err = portaudio.OpenDefaultStream(Channels, 0, SampleRate, FramesPerBuffer, audioCallback)
-		if err != nil {
-			log.Fatalf("Error opening default input stream: %v", err)
-		}
-		defaultDevice, _ := portaudio.DefaultInputDevice()
-		fmt.Printf("Using default audio input: %s\\n", defaultDevice.Name)
-	}
-	defer stream.Close()
-
-	// Start the stream
-	err = stream.Start()
-	if err != nil {
-		log.Fatalf("Error starting stream: %v", err)
-	}
-	defer stream.Stop()
+	// On Ctrl+C or SIGTERM, stop capturing and send what's left before the
+	// deferred cleanup, down to portaudio.Terminate, runs as main returns
+	done := make(chan struct{})
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, shutdownSignals...)
+	go awaitShutdown(interrupts, done)
 
 	fmt.Println("Streaming... Press Ctrl+C to stop.")
+	fmt.Println(consoleHelp)
+
+	if input.processBlocking != nil {
+		if *pinThread || *raisePriority {
+			lockRealtimeThread(*raisePriority)
+		}
+		if err := runBlockingCapture(input.stream, input.processBlocking, done); err != nil {
+			log.Fatalf("Error reading from input stream: %v", err)
+		}
+	}
 
-	// Block the main goroutine indefinitely
-	select {}
+	<-done
+	shutdown(restarter, pipeline)
 }
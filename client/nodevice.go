@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// ExitNoInputDevice is the exit code when no input device can be opened,
+// so scripts and CI can tell a missing device apart from other failures
+const ExitNoInputDevice = 3
+
+// noDeviceMessage explains that the default input device couldn't be used
+// and lists the input devices that could be chosen instead
+func noDeviceMessage(cause error, devices []*portaudio.DeviceInfo) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "No usable default audio input device: %v\n", cause)
+	var inputs int
+	for i, info := range devices {
+		if info.MaxInputChannels == 0 {
+			continue
+		}
+		if inputs == 0 {
+			sb.WriteString("Available input devices:\n")
+		}
+		inputs++
+		hostAPI := ""
+		if info.HostApi != nil {
+			hostAPI = info.HostApi.Name
+		}
+		fmt.Fprintf(&sb, "  [%d] %s (Host API: %s)\n", i, info.Name, hostAPI)
+	}
+	if inputs == 0 {
+		sb.WriteString("No input devices were found. Check that a microphone or loopback device is connected and enabled.\n")
+	} else {
+		sb.WriteString("Choose one with -device-index <index> or -device-name <name>.\n")
+	}
+	return sb.String()
+}
+
+// exitNoDevice prints noDeviceMessage for the current devices and exits with ExitNoInputDevice
+func exitNoDevice(cause error) {
+	if cause == nil {
+		cause = portaudio.NoDefaultInputDevice
+	}
+	devices, _ := portaudio.Devices() // Listing is best effort, nil lists nothing
+	fmt.Fprint(os.Stderr, noDeviceMessage(cause, devices))
+	os.Exit(ExitNoInputDevice)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// TestNoDeviceMessageListsDevices tests that the error enumerates the input devices
+func TestNoDeviceMessageListsDevices(t *testing.T) {
+	api := &portaudio.HostApiInfo{Name: "WASAPI"}
+	devices := []*portaudio.DeviceInfo{
+		{Name: "Speakers", MaxOutputChannels: 2, HostApi: api},
+		{Name: "Microphone", MaxInputChannels: 1, HostApi: api},
+		{Name: "Stereo Mix", MaxInputChannels: 2, HostApi: api},
+	}
+	msg := noDeviceMessage(errors.New("no default input device"), devices)
+
+	for _, want := range []string{
+		"no default input device",
+		"[1] Microphone (Host API: WASAPI)",
+		"[2] Stereo Mix (Host API: WASAPI)",
+		"-device-index",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in message:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "Speakers") {
+		t.Errorf("expected output devices to be left out:\n%s", msg)
+	}
+}
+
+// TestNoDeviceMessageEmpty tests the message when there are no devices at all
+func TestNoDeviceMessageEmpty(t *testing.T) {
+	msg := noDeviceMessage(errors.New("no default input device"), nil)
+	if !strings.Contains(msg, "No input devices were found") {
+		t.Errorf("expected the message to say no devices were found:\n%s", msg)
+	}
+	if strings.Contains(msg, "-device-index") {
+		t.Errorf("expected no device suggestion without devices:\n%s", msg)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Extended packet header, see server/packet.go for the layout
+const (
+	HeaderMagic0  = 'A'
+	HeaderMagic1  = 'S'
+	HeaderVersion = 1
+	HeaderSize    = 12
+	SequenceSize  = 4 // Size of the bare sequence number prefix
+)
+
+// Header flags
+const (
+	// FlagCoalesced marks a datagram carrying several consecutive packets'
+	// worth of audio; Sequence is that of the first packet
+	FlagCoalesced = 0x01
+	// FlagKeepalive marks a datagram sent in place of a run of packets of
+	// silence; a uint16 count of the packets follows the header
+	FlagKeepalive = 0x02
+	// FlagBigEndian marks a payload whose samples are big-endian
+	FlagBigEndian = 0x04
+)
+
+const (
+	// KeepaliveCountSize is the size of the packet count after a keepalive's header
+	KeepaliveCountSize = 2
+	// MaxKeepalivePackets is the most packets of silence one keepalive
+	// stands for; the server fills no more
+	MaxKeepalivePackets = 64
+	// KeepaliveInterval is how often keepalives are sent while the input is
+	// silent, well within the server's buffer
+	KeepaliveInterval = 50 * time.Millisecond
+)
+
+// PacketHeader is the extended packet header
+type PacketHeader struct {
+	Flags    uint8
+	Epoch    uint32
+	Sequence uint32
+}
+
+// EncodeHeader writes the header into the first HeaderSize bytes of dst
+func EncodeHeader(dst []byte, h PacketHeader) {
+	dst[0] = HeaderMagic0
+	dst[1] = HeaderMagic1
+	dst[2] = HeaderVersion
+	dst[3] = h.Flags
+	binary.LittleEndian.PutUint32(dst[4:8], h.Epoch)
+	binary.LittleEndian.PutUint32(dst[8:12], h.Sequence)
+}
+
+// isSilent reports whether a payload is digital silence
+func isSilent(payload []byte) bool {
+	for _, b := range payload {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
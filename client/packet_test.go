@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+// TestIsSilent tests digital silence detection
+func TestIsSilent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"all zero", make([]byte, 2048), true},
+		{"empty", nil, true},
+		{"one sample", append(make([]byte, 2047), 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSilent(tt.payload); got != tt.want {
+				t.Errorf("isSilent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// Limits on the audio parameters that can be configured. They match the
+// server's, which must be run with the same values.
+const (
+	MinSampleRate = 8000
+	MaxSampleRate = 192000
+	MaxChannels   = 2 // Surround is captured with -source-channels and downmixed by the server
+	MinFrames     = 16
+	MaxFrames     = 8192
+)
+
+// checkStreamParams rejects audio parameters the server can't play
+func checkStreamParams(sampleRate, channels, frames int) error {
+	if sampleRate < MinSampleRate || sampleRate > MaxSampleRate {
+		return fmt.Errorf("sample rate must be between %d and %d Hz, got %d", MinSampleRate, MaxSampleRate, sampleRate)
+	}
+	if channels < 1 || channels > MaxChannels {
+		return fmt.Errorf("channels must be between 1 and %d, got %d", MaxChannels, channels)
+	}
+	if frames < MinFrames || frames > MaxFrames {
+		return fmt.Errorf("frames per buffer must be between %d and %d, got %d", MinFrames, MaxFrames, frames)
+	}
+	return nil
+}
+
+// setStreamParams makes these the client's audio parameters. It must be
+// called before any stream or pipeline is sized from them.
+func setStreamParams(sampleRate, channels, frames int) {
+	SampleRate, Channels, FramesPerBuffer = sampleRate, channels, frames
+}
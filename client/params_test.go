@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCheckStreamParams tests that out of range stream parameters are rejected
+func TestCheckStreamParams(t *testing.T) {
+	if err := checkStreamParams(48000, 2, 512); err != nil {
+		t.Errorf("expected the defaults to pass, got %v", err)
+	}
+	if err := checkStreamParams(16000, 1, 320); err != nil {
+		t.Errorf("expected 16kHz mono to pass, got %v", err)
+	}
+	invalid := map[string][3]int{
+		"rate too low":   {4000, 2, 512},
+		"rate too high":  {384000, 2, 512},
+		"no channels":    {48000, 0, 512},
+		"surround":       {48000, 6, 512},
+		"too few frames": {48000, 2, 8},
+		"too many":       {48000, 2, MaxFrames + 1},
+	}
+	for name, p := range invalid {
+		if err := checkStreamParams(p[0], p[1], p[2]); err == nil {
+			t.Errorf("%s: expected an error for %v", name, p)
+		}
+	}
+}
+
+// TestSetStreamParamsSizesPipeline tests that the pipeline sends packets of
+// the configured size
+func TestSetStreamParamsSizesPipeline(t *testing.T) {
+	t.Cleanup(func() { setStreamParams(48000, 2, 512) })
+	setStreamParams(16000, 1, 320)
+
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1.0)
+	p := newSendPipeline(conn, volume, Channels)
+	p.ProcessInt16(make([]int16, FramesPerBuffer*Channels), time.Now())
+	if len(conn.datagrams) != 1 || len(conn.datagrams[0]) != SequenceSize+320*2 {
+		t.Errorf("expected one %d-byte datagram, got %d datagrams", SequenceSize+320*2, len(conn.datagrams))
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// sendPipeline turns captured buffers into datagrams and sends them. It is
+// shared by the callback and blocking capture modes.
+type sendPipeline struct {
+	conn       io.Writer
+	volume     *Volume
+	channelMap []int
+
+	// The datagram being built: a header followed by payloadLen bytes of
+	// samples. It is allocated once, sized for the largest packet. Framed
+	// packets send the whole header, others only a bare sequence number in
+	// its last SequenceSize bytes.
+	packet         []byte
+	payloadLen     int
+	remapBuffer    []int16
+	scaleBuffer    []int16 // Samples after the volume is applied
+	remapBufferF32 []float32
+
+	// With -max-pps, packets are coalesced and sent with the extended header
+	// so the server can split them again.
+	coalescer *packetCoalescer
+	// With -keepalive or -endian big, every packet carries the extended
+	// header so the server can slot keepalives into the sequence as silence
+	// and knows to byte-swap the samples.
+	framed    bool
+	keepalive bool
+	epoch     uint32
+	sequencer *sequencer
+	// With -keepalive, silent packets are held back and sent as one
+	// keepalive per keepaliveInterval standing for the whole run
+	keepaliveInterval time.Duration
+	keepaliveBuffer   []byte
+	silentFrom        uint32 // Sequence of the first packet in the held run
+	silentCount       int
+	lastKeepalive     time.Time
+
+	// With -send-history, sequenced datagrams are kept until the server
+	// acknowledges them
+	history *sendHistory
+	ackMu   sync.Mutex
+	lastAck AckMessage
+	acked   bool
+
+	// Full-scale input is detected and, with -limit-input, the gain backed
+	// off while it lasts
+	limiter *InputLimiter
+
+	// Byte order the samples are sent in
+	byteOrder binary.ByteOrder
+
+	// With -diag, time spent between capture and the send completing
+	sendLatency *latencyHistogram
+	// Partial datagrams are useless to the server, so they're counted as errors
+	shortWrites int64
+}
+
+// newSendPipeline creates a pipeline sending buffers of sourceChannels
+// interleaved channels to conn
+func newSendPipeline(conn io.Writer, volume *Volume, sourceChannels int) *sendPipeline {
+	return &sendPipeline{
+		conn:              conn,
+		volume:            volume,
+		packet:            make([]byte, HeaderSize+FramesPerBuffer*sourceChannels*4),
+		remapBuffer:       make([]int16, FramesPerBuffer*sourceChannels),
+		scaleBuffer:       make([]int16, FramesPerBuffer*sourceChannels),
+		remapBufferF32:    make([]float32, FramesPerBuffer*sourceChannels),
+		limiter:           NewInputLimiter(false),
+		epoch:             uint32(time.Now().Unix()),
+		sequencer:         newSequencer(0),
+		keepaliveInterval: KeepaliveInterval,
+		keepaliveBuffer:   make([]byte, HeaderSize+KeepaliveCountSize),
+		byteOrder:         binary.LittleEndian,
+	}
+}
+
+// ProcessInt16 applies the channel map and volume to a buffer of int16
+// samples captured at captured and sends it
+func (p *sendPipeline) ProcessInt16(in []int16, captured time.Time) {
+	// Reorder channels if a mapping was configured.
+	if p.channelMap != nil && len(in) <= len(p.remapBuffer) {
+		remapChannels(p.remapBuffer[:len(in)], in, p.channelMap)
+		in = p.remapBuffer[:len(in)]
+	}
+
+	// Get current volume, backed off if the input is clipping.
+	vol := p.volume.GetVolume() * p.limiter.Observe(countClippedInt16(in))
+
+	// Apply volume adjustment and write the samples after the header.
+	if len(p.scaleBuffer) < len(in) {
+		p.scaleBuffer = make([]int16, len(in))
+	}
+	scaled := p.scaleBuffer[:len(in)]
+	for i, sample := range in {
+		scaled[i] = int16(float64(sample) * vol)
+	}
+	encoded := p.payload(len(in) * 2)
+	int16ToBytes(scaled, encoded)
+	if p.byteOrder == binary.BigEndian {
+		for i := 0; i < len(encoded); i += 2 {
+			encoded[i], encoded[i+1] = encoded[i+1], encoded[i]
+		}
+	}
+
+	p.send(captured)
+}
+
+// ProcessFloat32 is the -format f32 equivalent of ProcessInt16, which
+// sends PortAudio's float samples as-is without converting to int16.
+func (p *sendPipeline) ProcessFloat32(in []float32, captured time.Time) {
+	if p.channelMap != nil && len(in) <= len(p.remapBufferF32) {
+		remapChannels(p.remapBufferF32[:len(in)], in, p.channelMap)
+		in = p.remapBufferF32[:len(in)]
+	}
+
+	vol := p.volume.GetVolume() * p.limiter.Observe(countClippedFloat32(in))
+	putFloat32Samples(p.payload(len(in)*4), in, vol, p.byteOrder)
+
+	p.send(captured)
+}
+
+// payload returns the next n bytes of samples to fill, after the header.
+// The packet only grows if a capture buffer is larger than expected.
+func (p *sendPipeline) payload(n int) []byte {
+	if HeaderSize+n > len(p.packet) {
+		p.packet = make([]byte, HeaderSize+n)
+	}
+	p.payloadLen = n
+	return p.packet[HeaderSize : HeaderSize+n]
+}
+
+// send sends the audio buffer over UDP if it has data.
+// captured is when the audio was captured.
+func (p *sendPipeline) send(captured time.Time) {
+	if p.payloadLen == 0 {
+		return
+	}
+	datagram := p.packet[HeaderSize : HeaderSize+p.payloadLen]
+	var flags uint8
+	if p.byteOrder == binary.BigEndian {
+		flags = FlagBigEndian
+	}
+	if p.coalescer != nil {
+		batch, packets, ok := p.coalescer.Add(datagram, time.Now())
+		if !ok {
+			return
+		}
+		datagram = p.coalesced(batch, packets, flags)
+	} else if p.framed {
+		if p.keepalive && isSilent(datagram) {
+			p.addSilence(captured)
+			return
+		}
+		p.sendKeepalive(captured)
+		header := PacketHeader{Flags: flags, Epoch: p.epoch, Sequence: p.sequencer.Take(1)}
+		datagram = p.packet[:HeaderSize+p.payloadLen]
+		EncodeHeader(datagram, header)
+		if p.history != nil {
+			p.history.Add(header.Sequence, 1, datagram)
+		}
+	} else {
+		// A little-endian sequence number right before the samples lets the
+		// server reorder packets without the full header
+		datagram = p.packet[HeaderSize-SequenceSize : HeaderSize+p.payloadLen]
+		binary.LittleEndian.PutUint32(datagram, p.sequencer.Take(1))
+	}
+	p.write(datagram)
+	if p.sendLatency != nil {
+		p.sendLatency.Record(time.Since(captured))
+	}
+}
+
+// coalesced frames a batch of packets coalesced by -max-pps as one datagram
+func (p *sendPipeline) coalesced(batch []byte, packets int, flags uint8) []byte {
+	sequence := p.sequencer.Take(packets)
+	datagram := make([]byte, HeaderSize+len(batch))
+	EncodeHeader(datagram, PacketHeader{Flags: FlagCoalesced | flags, Epoch: p.epoch, Sequence: sequence})
+	copy(datagram[HeaderSize:], batch)
+	if p.history != nil {
+		p.history.Add(sequence, packets, datagram)
+	}
+	return datagram
+}
+
+// Flush sends the audio -max-pps or -keepalive is still holding back, so
+// stopping doesn't drop it. Capture must have stopped.
+func (p *sendPipeline) Flush() {
+	p.sendKeepalive(time.Now())
+	if p.coalescer == nil {
+		return
+	}
+	batch, packets, ok := p.coalescer.Flush()
+	if !ok {
+		return
+	}
+	var flags uint8
+	if p.byteOrder == binary.BigEndian {
+		flags = FlagBigEndian
+	}
+	p.write(p.coalesced(batch, packets, flags))
+}
+
+// write sends one datagram, logging failures
+func (p *sendPipeline) write(datagram []byte) {
+	if err := sendDatagram(p.conn, datagram); err != nil {
+		var short *shortWriteError
+		if errors.As(err, &short) {
+			p.shortWrites++
+			log.Printf("Error sending UDP packet: %v (%d short writes so far)", err, p.shortWrites)
+		} else {
+			log.Printf("Error sending UDP packet: %v", err)
+		}
+	}
+}
+
+// addSilence numbers a silent packet captured at captured and adds it to the
+// held run, sending the run as a keepalive if the last one is at least
+// keepaliveInterval old or the run is as long as one keepalive may be
+func (p *sendPipeline) addSilence(captured time.Time) {
+	sequence := p.sequencer.Take(1)
+	if p.silentCount == 0 {
+		p.silentFrom = sequence
+	}
+	p.silentCount++
+	if captured.Sub(p.lastKeepalive) >= p.keepaliveInterval || p.silentCount == MaxKeepalivePackets {
+		p.sendKeepalive(captured)
+	}
+}
+
+// sendKeepalive sends the held run of silent packets, if any, as one keepalive
+func (p *sendPipeline) sendKeepalive(now time.Time) {
+	if p.silentCount == 0 {
+		return
+	}
+	EncodeHeader(p.keepaliveBuffer, PacketHeader{Flags: FlagKeepalive, Epoch: p.epoch, Sequence: p.silentFrom})
+	binary.LittleEndian.PutUint16(p.keepaliveBuffer[HeaderSize:], uint16(p.silentCount))
+	if p.history != nil {
+		p.history.Add(p.silentFrom, p.silentCount, p.keepaliveBuffer)
+	}
+	p.write(p.keepaliveBuffer)
+	p.silentCount = 0
+	p.lastKeepalive = now
+}
+
+// HandleAck frees the history the server has acknowledged and records the
+// ack for loss reporting. Acks for another epoch are from an earlier run
+// and are ignored.
+func (p *sendPipeline) HandleAck(ack AckMessage) {
+	if ack.Epoch != p.epoch {
+		return
+	}
+	if p.history != nil {
+		p.history.Trim(ack.Sequence)
+	}
+	p.ackMu.Lock()
+	p.lastAck, p.acked = ack, true
+	p.ackMu.Unlock()
+}
+
+// LastAck returns the most recent acknowledgment, or false if none arrived
+func (p *sendPipeline) LastAck() (AckMessage, bool) {
+	p.ackMu.Lock()
+	defer p.ackMu.Unlock()
+	return p.lastAck, p.acked
+}
+
+// blockingReader is the part of *portaudio.Stream used by -blocking capture
+type blockingReader interface {
+	Read() error
+}
+
+// runBlockingCapture reads from a blocking stream into its buffer and calls
+// process after each read, until done is closed or a read fails with
+// anything but an overflow
+func runBlockingCapture(stream blockingReader, process func(captured time.Time), done <-chan struct{}) error {
+	for {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+		err := stream.Read()
+		if err == portaudio.InputOverflowed {
+			// Some input was lost, but the buffer still holds fresh audio
+			log.Printf("Input overflowed, audio was dropped")
+		} else if err != nil {
+			return err
+		}
+		process(time.Now())
+	}
+}
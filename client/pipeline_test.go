@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+// recordingConn keeps a copy of every datagram written
+type recordingConn struct {
+	datagrams [][]byte
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.datagrams = append(c.datagrams, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// fakeBlockingStream fills its buffer with a running counter on each Read
+type fakeBlockingStream struct {
+	buffer []int16
+	reads  int
+	limit  int
+	next   int16
+}
+
+var errStreamStopped = errors.New("stream stopped")
+
+func (s *fakeBlockingStream) Read() error {
+	if s.reads == s.limit {
+		return errStreamStopped
+	}
+	s.reads++
+	for i := range s.buffer {
+		s.buffer[i] = s.next
+		s.next++
+	}
+	return nil
+}
+
+// TestBlockingCaptureSharesPipeline tests that blocking reads go through the send pipeline
+func TestBlockingCaptureSharesPipeline(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(0.5)
+	pipeline := newSendPipeline(conn, volume, Channels)
+
+	stream := &fakeBlockingStream{buffer: make([]int16, FramesPerBuffer*Channels), limit: 3}
+	err := runBlockingCapture(stream, func(captured time.Time) {
+		pipeline.ProcessInt16(stream.buffer, captured)
+	}, nil)
+	if !errors.Is(err, errStreamStopped) {
+		t.Fatalf("expected the read error to end capture, got %v", err)
+	}
+
+	if len(conn.datagrams) != 3 {
+		t.Fatalf("expected 3 datagrams, got %d", len(conn.datagrams))
+	}
+	var counter int16
+	for i, datagram := range conn.datagrams {
+		if len(datagram) != SequenceSize+FramesPerBuffer*Channels*2 {
+			t.Fatalf("datagram %d: expected %d bytes, got %d", i, SequenceSize+FramesPerBuffer*Channels*2, len(datagram))
+		}
+		samples := make([]int16, FramesPerBuffer*Channels)
+		bytesToInt16(datagram[SequenceSize:], samples)
+		for j, got := range samples {
+			if want := int16(float64(counter) * 0.5); got != want {
+				t.Fatalf("datagram %d sample %d: expected %d, got %d", i, j, want, got)
+			}
+			counter++
+		}
+	}
+}
+
+// TestSendPipelineSequenceNumbers tests that plain packets carry a
+// little-endian sequence number that goes up by one per packet
+func TestSendPipelineSequenceNumbers(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1.0)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.sequencer = newSequencer(math.MaxUint32 - 1)
+
+	in := make([]int16, FramesPerBuffer*Channels)
+	for i := 0; i < 4; i++ {
+		pipeline.ProcessInt16(in, time.Now())
+	}
+	if len(conn.datagrams) != 4 {
+		t.Fatalf("expected 4 datagrams, got %d", len(conn.datagrams))
+	}
+	want := uint32(math.MaxUint32 - 1)
+	for i, datagram := range conn.datagrams {
+		if got := binary.LittleEndian.Uint32(datagram[:SequenceSize]); got != want {
+			t.Errorf("datagram %d: expected sequence %d, got %d", i, want, got)
+		}
+		want++ // Wraps around to 0
+	}
+}
+
+// TestSendPipelineKeepalive tests that the pipeline numbers packets and sends keepalives for silence
+func TestSendPipelineKeepalive(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.framed = true
+	pipeline.keepalive = true
+
+	audio := make([]int16, FramesPerBuffer*Channels)
+	audio[0] = 1
+	pipeline.ProcessInt16(audio, time.Now())
+	pipeline.ProcessInt16(make([]int16, FramesPerBuffer*Channels), time.Now())
+
+	if len(conn.datagrams) != 2 {
+		t.Fatalf("expected 2 datagrams, got %d", len(conn.datagrams))
+	}
+	if len(conn.datagrams[0]) != HeaderSize+FramesPerBuffer*Channels*2 {
+		t.Errorf("expected a full audio packet first, got %d bytes", len(conn.datagrams[0]))
+	}
+	keepalive := conn.datagrams[1]
+	if len(keepalive) != HeaderSize+KeepaliveCountSize || keepalive[3]&FlagKeepalive == 0 {
+		t.Errorf("expected a keepalive, got %d bytes with flags %#x", len(keepalive), keepalive[3])
+	}
+	if seq := binary.LittleEndian.Uint32(keepalive[8:12]); seq != 1 {
+		t.Errorf("expected keepalive sequence 1, got %d", seq)
+	}
+	if count := binary.LittleEndian.Uint16(keepalive[HeaderSize:]); count != 1 {
+		t.Errorf("expected a keepalive for 1 packet, got %d", count)
+	}
+}
+
+// TestSendPipelineKeepaliveInterval tests that silence is sent as one
+// keepalive per interval standing for every packet since the last, and that
+// the run is sent before audio resumes
+func TestSendPipelineKeepaliveInterval(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.framed = true
+	pipeline.keepalive = true
+	pipeline.keepaliveInterval = 50 * time.Millisecond
+
+	// 20 silent packets 10ms apart span 200ms, so keepalives go out at 0,
+	// 50, 100 and 150ms with the last 4 packets still held
+	start := time.Now()
+	silence := make([]int16, FramesPerBuffer*Channels)
+	for i := 0; i < 20; i++ {
+		pipeline.ProcessInt16(silence, start.Add(time.Duration(i)*10*time.Millisecond))
+	}
+	audio := make([]int16, FramesPerBuffer*Channels)
+	audio[0] = 1
+	pipeline.ProcessInt16(audio, start.Add(200*time.Millisecond))
+
+	type keepalive struct {
+		sequence uint32
+		count    uint16
+	}
+	want := []keepalive{{0, 1}, {1, 5}, {6, 5}, {11, 5}, {16, 4}}
+	if len(conn.datagrams) != len(want)+1 {
+		t.Fatalf("expected %d keepalives and an audio packet, got %d datagrams", len(want), len(conn.datagrams))
+	}
+	for i, w := range want {
+		datagram := conn.datagrams[i]
+		if len(datagram) != HeaderSize+KeepaliveCountSize || datagram[3]&FlagKeepalive == 0 {
+			t.Fatalf("datagram %d: expected a keepalive, got %d bytes with flags %#x", i, len(datagram), datagram[3])
+		}
+		got := keepalive{binary.LittleEndian.Uint32(datagram[8:12]), binary.LittleEndian.Uint16(datagram[HeaderSize:])}
+		if got != w {
+			t.Errorf("datagram %d: expected keepalive %+v, got %+v", i, w, got)
+		}
+	}
+	if seq := binary.LittleEndian.Uint32(conn.datagrams[len(want)][8:12]); seq != 20 {
+		t.Errorf("expected the audio packet to have sequence 20, got %d", seq)
+	}
+}
+
+// TestSendPipelineBigEndian tests that big-endian samples are sent with the header flag set
+func TestSendPipelineBigEndian(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1.0)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.byteOrder = binary.BigEndian
+	pipeline.framed = true
+
+	in := make([]int16, FramesPerBuffer*Channels)
+	in[0] = 1234
+	pipeline.ProcessInt16(in, time.Now())
+	// Without -keepalive, silence is still sent in full
+	pipeline.ProcessInt16(make([]int16, FramesPerBuffer*Channels), time.Now())
+
+	if len(conn.datagrams) != 2 {
+		t.Fatalf("expected 2 datagrams, got %d", len(conn.datagrams))
+	}
+	for i, datagram := range conn.datagrams {
+		if len(datagram) != HeaderSize+FramesPerBuffer*Channels*2 || datagram[3] != FlagBigEndian {
+			t.Errorf("datagram %d: expected a full big-endian packet, got %d bytes with flags %#x", i, len(datagram), datagram[3])
+		}
+	}
+	if got := int16(binary.BigEndian.Uint16(conn.datagrams[0][HeaderSize:])); got != 1234 {
+		t.Errorf("expected first sample 1234, got %d", got)
+	}
+}
+
+// TestSendPipelineInitialSequence tests that packets are numbered from the
+// configured start, wrapping around past the largest sequence
+func TestSendPipelineInitialSequence(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.framed = true
+	pipeline.sequencer = newSequencer(math.MaxUint32 - 1)
+
+	in := make([]int16, FramesPerBuffer*Channels)
+	for i := 0; i < 3; i++ {
+		pipeline.ProcessInt16(in, time.Now())
+	}
+	for i, want := range []uint32{math.MaxUint32 - 1, math.MaxUint32, 0} {
+		if seq := binary.LittleEndian.Uint32(conn.datagrams[i][8:12]); seq != want {
+			t.Errorf("datagram %d: expected sequence %d, got %d", i, want, seq)
+		}
+	}
+	if next := pipeline.sequencer.Next(); next != 1 {
+		t.Errorf("expected the next sequence to be 1, got %d", next)
+	}
+}
+
+// TestSendPipelineLayout tests that a framed packet is the header followed
+// by the samples, written in place, and that sending allocates nothing
+func TestSendPipelineLayout(t *testing.T) {
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1.0)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.framed = true
+	pipeline.sequencer = newSequencer(41)
+
+	in := make([]int16, FramesPerBuffer*Channels)
+	in[0], in[1], in[len(in)-1] = 1, -2, 300
+	pipeline.ProcessInt16(in, time.Now())
+
+	datagram := conn.datagrams[0]
+	if len(datagram) != HeaderSize+len(in)*2 {
+		t.Fatalf("expected %d bytes, got %d", HeaderSize+len(in)*2, len(datagram))
+	}
+	if datagram[0] != HeaderMagic0 || datagram[1] != HeaderMagic1 || datagram[2] != HeaderVersion || datagram[3] != 0 {
+		t.Errorf("bad header start % x", datagram[:4])
+	}
+	epoch, sequence := binary.LittleEndian.Uint32(datagram[4:8]), binary.LittleEndian.Uint32(datagram[8:12])
+	if sequence != 41 || epoch != pipeline.epoch {
+		t.Errorf("got sequence %d epoch %d, want 41 and %d", sequence, epoch, pipeline.epoch)
+	}
+	samples := make([]int16, len(in))
+	bytesToInt16(datagram[HeaderSize:], samples)
+	for i := range in {
+		if samples[i] != in[i] {
+			t.Fatalf("sample %d: expected %d, got %d", i, in[i], samples[i])
+		}
+	}
+
+	discard := newSendPipeline(io.Discard, volume, Channels)
+	discard.framed = true
+	if allocs := testing.AllocsPerRun(100, func() { discard.ProcessInt16(in, time.Now()) }); allocs != 0 {
+		t.Errorf("sending a packet allocated %v times, want 0", allocs)
+	}
+}
+
+// BenchmarkSendPipeline measures building and sending one framed packet
+func BenchmarkSendPipeline(b *testing.B) {
+	volume, _ := NewVolume(0.8)
+	pipeline := newSendPipeline(io.Discard, volume, Channels)
+	pipeline.framed = true
+	in := make([]int16, FramesPerBuffer*Channels)
+	for i := range in {
+		in[i] = int16(i)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pipeline.ProcessInt16(in, time.Now())
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "time"
+
+// DefaultMaxCoalesce is the most packets merged into one datagram before
+// the oldest pending audio is dropped
+const DefaultMaxCoalesce = 8
+
+// packetCoalescer caps the datagram send rate by merging packets that arrive
+// too soon after the previous send into the next datagram
+type packetCoalescer struct {
+	interval    time.Duration
+	nextSend    time.Time
+	packetSize  int
+	maxCoalesce int
+	pending     []byte
+	dropped     int64
+}
+
+// newPacketCoalescer creates a coalescer allowing at most maxPPS datagrams per second
+func newPacketCoalescer(maxPPS, packetSize, maxCoalesce int) *packetCoalescer {
+	return &packetCoalescer{
+		interval:    time.Second / time.Duration(maxPPS),
+		packetSize:  packetSize,
+		maxCoalesce: maxCoalesce,
+		pending:     make([]byte, 0, packetSize*maxCoalesce),
+	}
+}
+
+// Add queues one packet of audio. If a send is allowed at now it returns all
+// pending audio and the number of packets it contains; the returned slice is
+// only valid until the next call.
+func (pc *packetCoalescer) Add(packet []byte, now time.Time) ([]byte, int, bool) {
+	if len(pc.pending) >= pc.packetSize*pc.maxCoalesce {
+		// Too much backlog, drop the oldest packet to make room
+		pc.pending = append(pc.pending[:0], pc.pending[pc.packetSize:]...)
+		pc.dropped++
+	}
+	pc.pending = append(pc.pending, packet...)
+
+	if now.Before(pc.nextSend) {
+		return nil, 0, false
+	}
+	pc.nextSend = now.Add(pc.interval)
+	batch := pc.pending
+	pc.pending = pc.pending[:0]
+	return batch, len(batch) / pc.packetSize, true
+}
+
+// Flush returns all pending audio and the number of packets it contains,
+// whatever the rate, or false if nothing is pending. The returned slice is
+// only valid until the next call.
+func (pc *packetCoalescer) Flush() ([]byte, int, bool) {
+	if len(pc.pending) == 0 {
+		return nil, 0, false
+	}
+	batch := pc.pending
+	pc.pending = pc.pending[:0]
+	return batch, len(batch) / pc.packetSize, true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPacketCoalescerCapsRate tests that sends are capped per second while all audio is kept
+func TestPacketCoalescerCapsRate(t *testing.T) {
+	const packetSize = 4
+	const maxPPS = 30
+	pc := newPacketCoalescer(maxPPS, packetSize, DefaultMaxCoalesce)
+
+	// One second of capture at 48000 Hz with 512 frame buffers
+	callbackInterval := time.Second * time.Duration(FramesPerBuffer) / time.Duration(SampleRate)
+	callbacks := int(time.Second / callbackInterval)
+
+	start := time.Now()
+	sends, packetsSent, bytesSent := 0, 0, 0
+	for i := 0; i < callbacks; i++ {
+		packet := []byte{byte(i), byte(i), byte(i), byte(i)}
+		if batch, packets, ok := pc.Add(packet, start.Add(time.Duration(i)*callbackInterval)); ok {
+			sends++
+			packetsSent += packets
+			bytesSent += len(batch)
+		}
+	}
+
+	if sends > maxPPS+1 {
+		t.Errorf("expected at most %d sends in one second, got %d", maxPPS+1, sends)
+	}
+	if packetsSent+len(pc.pending)/packetSize != callbacks {
+		t.Errorf("expected all %d packets to be sent or pending, sent %d with %d pending",
+			callbacks, packetsSent, len(pc.pending)/packetSize)
+	}
+	if bytesSent != packetsSent*packetSize {
+		t.Errorf("expected %d bytes sent, got %d", packetsSent*packetSize, bytesSent)
+	}
+	if pc.dropped != 0 {
+		t.Errorf("expected no dropped packets, got %d", pc.dropped)
+	}
+}
+
+// TestPacketCoalescerPreservesOrder tests coalesced audio keeps packet order
+func TestPacketCoalescerPreservesOrder(t *testing.T) {
+	pc := newPacketCoalescer(10, 1, DefaultMaxCoalesce)
+	now := time.Now()
+
+	pc.Add([]byte{1}, now) // Sent immediately
+	pc.Add([]byte{2}, now.Add(10*time.Millisecond))
+	pc.Add([]byte{3}, now.Add(20*time.Millisecond))
+	batch, packets, ok := pc.Add([]byte{4}, now.Add(100*time.Millisecond))
+
+	if !ok || packets != 3 {
+		t.Fatalf("expected a send of 3 packets, got ok=%v packets=%d", ok, packets)
+	}
+	for i, expected := range []byte{2, 3, 4} {
+		if batch[i] != expected {
+			t.Errorf("position %d: expected %d, got %d", i, expected, batch[i])
+		}
+	}
+}
+
+// TestPacketCoalescerDropsOldestWhenFull tests the backlog is bounded
+func TestPacketCoalescerDropsOldestWhenFull(t *testing.T) {
+	pc := newPacketCoalescer(1, 1, 2)
+	now := time.Now()
+
+	pc.Add([]byte{1}, now)
+	pc.Add([]byte{2}, now)
+	pc.Add([]byte{3}, now)
+	pc.Add([]byte{4}, now)
+	batch, packets, ok := pc.Add([]byte{5}, now.Add(time.Second))
+
+	if !ok || packets != 2 {
+		t.Fatalf("expected a send of 2 packets, got ok=%v packets=%d", ok, packets)
+	}
+	if batch[0] != 4 || batch[1] != 5 {
+		t.Errorf("expected newest packets [4 5], got %v", batch)
+	}
+	if pc.dropped != 2 {
+		t.Errorf("expected 2 dropped packets, got %d", pc.dropped)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"runtime"
+)
+
+// RealtimeNice is the nice value -raise-priority asks for where priorities
+// are nice values. A negative nice value needs CAP_SYS_NICE or root.
+const RealtimeNice = -10
+
+// errPriorityUnsupported is returned where thread priority can't be raised
+var errPriorityUnsupported = errors.New("raising thread priority is not supported on this platform")
+
+// lockRealtimeThread pins the calling goroutine to its OS thread so the
+// scheduler doesn't migrate time-critical audio work, and with
+// raisePriority also raises that thread's priority. A priority that can't
+// be raised is only a warning; capture works as before.
+func lockRealtimeThread(raisePriority bool) {
+	runtime.LockOSThread()
+	if !raisePriority {
+		return
+	}
+	if err := raiseThreadPriority(); err != nil {
+		log.Printf("Warning: could not raise thread priority: %v", err)
+	}
+}
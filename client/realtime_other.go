@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package main
+
+// raiseThreadPriority is unavailable on this platform
+func raiseThreadPriority() error {
+	return errPriorityUnsupported
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// TestRaiseThreadPriority tests that raising the priority succeeds or fails
+// with an error saying why
+func TestRaiseThreadPriority(t *testing.T) {
+	errc := make(chan error)
+	go func() {
+		// The thread exits with the goroutine, so its priority doesn't leak
+		runtime.LockOSThread()
+		errc <- raiseThreadPriority()
+	}()
+	err := <-errc
+	switch runtime.GOOS {
+	case "linux":
+		// Unprivileged users may only lower their priority
+		if err != nil && !errors.Is(err, syscall.EACCES) && !errors.Is(err, syscall.EPERM) {
+			t.Errorf("expected success or a permission error, got %v", err)
+		}
+	case "windows":
+		if err != nil {
+			t.Errorf("expected success, got %v", err)
+		}
+	default:
+		if !errors.Is(err, errPriorityUnsupported) {
+			t.Errorf("expected the unsupported error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// threadPriorityTimeCritical is THREAD_PRIORITY_TIME_CRITICAL from <winbase.h>
+const threadPriorityTimeCritical = 15
+
+var (
+	kernel32              = syscall.NewLazyDLL("kernel32.dll")
+	procGetCurrentThread  = kernel32.NewProc("GetCurrentThread")
+	procSetThreadPriority = kernel32.NewProc("SetThreadPriority")
+)
+
+// raiseThreadPriority makes the calling thread time critical, the level
+// audio threads use within the process's priority class
+func raiseThreadPriority() error {
+	thread, _, _ := procGetCurrentThread.Call()
+	if ok, _, err := procSetThreadPriority.Call(thread, threadPriorityTimeCritical); ok == 0 {
+		return fmt.Errorf("SetThreadPriority: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ReplayWindowSize is how many sequence numbers below the highest seen are
+// remembered; anything older is rejected outright
+const ReplayWindowSize = 64
+
+// ReplayWindow rejects control messages whose sequence number (or nonce
+// counter) has already been accepted or has fallen out of the window, so a
+// captured message can't be replayed. It is a sliding bitmap as used by
+// IPsec and DTLS.
+type ReplayWindow struct {
+	highest uint64
+	seen    uint64 // Bit i is set if highest-i has been accepted
+	started bool
+}
+
+// Accept reports whether seq is fresh, and if so records it
+func (w *ReplayWindow) Accept(seq uint64) bool {
+	if !w.started {
+		w.started = true
+		w.highest = seq
+		w.seen = 1
+		return true
+	}
+	if seq > w.highest {
+		shift := seq - w.highest
+		if shift >= ReplayWindowSize {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+		w.seen |= 1
+		w.highest = seq
+		return true
+	}
+	offset := w.highest - seq
+	if offset >= ReplayWindowSize {
+		return false // Too old to tell whether it was seen
+	}
+	if w.seen&(1<<offset) != 0 {
+		return false
+	}
+	w.seen |= 1 << offset
+	return true
+}
+
+// ControlSequenceSize is the length of the sequence number the server puts
+// between a signed control message and its tag
+const ControlSequenceSize = 8
+
+// errReplayed means a control message's sequence number was already used
+var errReplayed = errors.New("replayed control message")
+
+// openSignedControl verifies a control message signed with key and checks
+// its sequence number against window, returning the message without them
+func openSignedControl(key []byte, window *ReplayWindow, b []byte) ([]byte, error) {
+	body, err := checkAuthTag(key, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < ControlSequenceSize {
+		return nil, fmt.Errorf("signed control message too short for a sequence number: %d bytes", len(body))
+	}
+	msg := body[:len(body)-ControlSequenceSize]
+	if !window.Accept(binary.LittleEndian.Uint64(body[len(msg):])) {
+		return nil, errReplayed
+	}
+	return msg, nil
+}
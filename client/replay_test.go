@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// TestReplayWindowAcceptsFresh tests that new and reordered sequence numbers are accepted once
+func TestReplayWindowAcceptsFresh(t *testing.T) {
+	var w ReplayWindow
+	for _, seq := range []uint64{10, 11, 13, 12, 20} {
+		if !w.Accept(seq) {
+			t.Errorf("expected fresh sequence %d to be accepted", seq)
+		}
+	}
+}
+
+// TestReplayWindowRejectsReplays tests that repeated and too-old sequence numbers are rejected
+func TestReplayWindowRejectsReplays(t *testing.T) {
+	var w ReplayWindow
+	w.Accept(100)
+	w.Accept(102)
+
+	if w.Accept(100) || w.Accept(102) {
+		t.Error("expected replayed sequence numbers to be rejected")
+	}
+	if !w.Accept(101) {
+		t.Error("expected a late but unseen sequence number within the window to be accepted")
+	}
+	if w.Accept(101) {
+		t.Error("expected the late sequence number to be rejected the second time")
+	}
+
+	w.Accept(102 + ReplayWindowSize)
+	if w.Accept(102) {
+		t.Error("expected a sequence number older than the window to be rejected")
+	}
+	if !w.Accept(103) {
+		t.Error("expected an unseen sequence number at the edge of the window to be accepted")
+	}
+}
+
+// signedControl signs msg with sequence number seq as the server does
+func signedControl(key, msg []byte, seq uint64) []byte {
+	b := binary.LittleEndian.AppendUint64(append([]byte(nil), msg...), seq)
+	return appendAuthTag(key, b)
+}
+
+// TestOpenSignedControl tests that a signed control message is accepted
+// once, a replay of it is rejected, and a forged one fails authentication
+func TestOpenSignedControl(t *testing.T) {
+	key := []byte("s3cret")
+	var window ReplayWindow
+	msg := []byte{ControlMagic0, ControlMagic1, ControlVersion, ControlVolume, 0, 0}
+	first := signedControl(key, msg, 1000)
+
+	got, err := openSignedControl(key, &window, first)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("fresh message: got %v, %v", got, err)
+	}
+	if _, err := openSignedControl(key, &window, first); err != errReplayed {
+		t.Errorf("replayed message: got %v, want errReplayed", err)
+	}
+	if _, err := openSignedControl(key, &window, signedControl(key, msg, 999)); err != nil {
+		t.Errorf("reordered message: got %v, want it accepted", err)
+	}
+	if _, err := openSignedControl(key, &window, signedControl([]byte("guess"), msg, 1001)); err != errAuthFailed {
+		t.Errorf("forged message: got %v, want errAuthFailed", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "encoding/binary"
+
+// bytesToInt16 decodes little-endian PCM from b into out and returns the
+// number of samples decoded, the lesser of len(b)/2 and len(out). A
+// trailing odd byte is ignored.
+func bytesToInt16(b []byte, out []int16) int {
+	n := min(len(b)/2, len(out))
+	b = b[:n*2] // Lets the compiler drop the bounds checks in the loop
+	for i := range out[:n] {
+		out[i] = int16(binary.LittleEndian.Uint16(b[i*2:]))
+	}
+	return n
+}
+
+// int16ToBytes encodes in as little-endian PCM into out and returns the
+// number of samples encoded, the lesser of len(in) and len(out)/2
+func int16ToBytes(in []int16, out []byte) int {
+	n := min(len(in), len(out)/2)
+	out = out[:n*2]
+	for i, sample := range in[:n] {
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(sample))
+	}
+	return n
+}
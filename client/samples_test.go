@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+// TestSampleConversionRoundTrip tests that samples survive conversion to
+// bytes and back, including the extremes
+func TestSampleConversionRoundTrip(t *testing.T) {
+	samples := []int16{0, 1, -1, 256, -256, 12345, -12345, 32767, -32768}
+	b := make([]byte, len(samples)*2)
+	if n := int16ToBytes(samples, b); n != len(samples) {
+		t.Fatalf("encoded %d samples, want %d", n, len(samples))
+	}
+	if b[2] != 0x01 || b[3] != 0x00 || b[4] != 0xFF || b[5] != 0xFF {
+		t.Errorf("not little-endian: % x", b[:6])
+	}
+	out := make([]int16, len(samples))
+	if n := bytesToInt16(b, out); n != len(samples) {
+		t.Fatalf("decoded %d samples, want %d", n, len(samples))
+	}
+	for i := range samples {
+		if out[i] != samples[i] {
+			t.Errorf("sample %d: got %d, want %d", i, out[i], samples[i])
+		}
+	}
+}
+
+// TestSampleConversionShortBuffers tests that a trailing odd byte is
+// ignored and neither function writes past its output
+func TestSampleConversionShortBuffers(t *testing.T) {
+	out := []int16{7, 7, 7}
+	if n := bytesToInt16([]byte{0x01, 0x00, 0x02, 0x00, 0x03}, out); n != 2 {
+		t.Fatalf("decoded %d samples from 5 bytes, want 2", n)
+	}
+	if out[0] != 1 || out[1] != 2 || out[2] != 7 {
+		t.Errorf("got %v, want [1 2 7]", out)
+	}
+	if n := bytesToInt16([]byte{0x01, 0x00, 0x02, 0x00}, out[:1]); n != 1 {
+		t.Errorf("decoded %d samples into a 1-sample buffer", n)
+	}
+
+	b := []byte{9, 9, 9}
+	if n := int16ToBytes([]int16{-1, -1}, b); n != 1 {
+		t.Fatalf("encoded %d samples into 3 bytes, want 1", n)
+	}
+	if b[0] != 0xFF || b[1] != 0xFF || b[2] != 9 {
+		t.Errorf("got % x, want ff ff 09", b)
+	}
+}
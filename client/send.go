@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// shortWriteError reports a datagram that was only partly written
+type shortWriteError struct {
+	written int
+	size    int
+}
+
+func (e *shortWriteError) Error() string {
+	return fmt.Sprintf("short write: sent %d of %d bytes", e.written, e.size)
+}
+
+// sendDatagram writes one datagram and fails unless all of it was written,
+// since a partial audio packet can't be played
+func sendDatagram(w io.Writer, datagram []byte) error {
+	n, err := w.Write(datagram)
+	if err != nil {
+		return err
+	}
+	if n != len(datagram) {
+		return &shortWriteError{written: n, size: len(datagram)}
+	}
+	return nil
+}
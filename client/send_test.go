@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeConn accepts at most limit bytes per write
+type fakeConn struct {
+	limit int
+	err   error
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if len(p) > c.limit {
+		return c.limit, nil
+	}
+	return len(p), nil
+}
+
+// TestSendDatagram tests that short writes and write errors are reported
+func TestSendDatagram(t *testing.T) {
+	datagram := make([]byte, 2048)
+	writeErr := errors.New("network is unreachable")
+
+	tests := []struct {
+		name      string
+		conn      *fakeConn
+		wantShort bool
+		wantErr   error
+	}{
+		{"full write", &fakeConn{limit: 4096}, false, nil},
+		{"short write", &fakeConn{limit: 1000}, true, nil},
+		{"write error", &fakeConn{err: writeErr}, false, writeErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendDatagram(tt.conn, datagram)
+			var short *shortWriteError
+			if got := errors.As(err, &short); got != tt.wantShort {
+				t.Fatalf("expected short write %v, got error %v", tt.wantShort, err)
+			}
+			if tt.wantShort && (short.written != 1000 || short.size != 2048) {
+				t.Errorf("expected 1000 of 2048 bytes, got %d of %d", short.written, short.size)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantShort && tt.wantErr == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "sync/atomic"
+
+// sequencer numbers the packets of one epoch. It starts at 0 unless told
+// otherwise, which is useful for testing wraparound and joining mid-stream.
+// The counter is atomic, so numbering stays consecutive even if capture
+// callbacks ever overlap.
+type sequencer struct {
+	next uint32
+}
+
+// newSequencer creates a sequencer whose first packet is numbered start
+func newSequencer(start uint32) *sequencer {
+	return &sequencer{next: start}
+}
+
+// Take numbers packets consecutive packets, returning the sequence of the
+// first. The counter wraps around after math.MaxUint32.
+func (s *sequencer) Take(packets int) uint32 {
+	return atomic.AddUint32(&s.next, uint32(packets)) - uint32(packets)
+}
+
+// Next returns the sequence the next packet will carry
+func (s *sequencer) Next() uint32 {
+	return atomic.LoadUint32(&s.next)
+}
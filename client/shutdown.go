@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+)
+
+// shutdownSignals ask the client to stop cleanly instead of being killed
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// awaitShutdown closes done when the first signal arrives
+func awaitShutdown(signals <-chan os.Signal, done chan<- struct{}) {
+	sig := <-signals
+	log.Printf("Received %v, shutting down", sig)
+	close(done)
+}
+
+// shutdown stops and closes the input stream, so no more audio is
+// captured, then sends whatever the pipeline is still holding
+func shutdown(restarter *streamRestarter, pipeline *sendPipeline) {
+	restarter.Close()
+	pipeline.Flush()
+}
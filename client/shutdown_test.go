@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestShutdownOnInterrupt tests that an interrupt closes done and that
+// shutting down then stops the input stream and sends the audio -max-pps
+// was still holding back
+func TestShutdownOnInterrupt(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go awaitShutdown(signals, done)
+	signals <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done not closed after an interrupt")
+	}
+
+	conn := &recordingConn{}
+	volume, _ := NewVolume(1)
+	pipeline := newSendPipeline(conn, volume, Channels)
+	pipeline.coalescer = newPacketCoalescer(1, FramesPerBuffer*Channels*2, DefaultMaxCoalesce)
+	samples := make([]int16, FramesPerBuffer*Channels)
+	pipeline.ProcessInt16(samples, time.Now()) // Sent at once
+	pipeline.ProcessInt16(samples, time.Now()) // Held back by the rate limit
+	if len(conn.datagrams) != 1 {
+		t.Fatalf("expected 1 datagram before shutdown, got %d", len(conn.datagrams))
+	}
+
+	stream := &fakeInputStream{}
+	shutdown(&streamRestarter{current: stream}, pipeline)
+	if got := strings.Join(stream.calls, ","); got != "stop,close" {
+		t.Errorf("expected the input stream stopped and closed, got %v", stream.calls)
+	}
+	if len(conn.datagrams) != 2 {
+		t.Fatalf("expected the held back packet sent on shutdown, got %d datagrams", len(conn.datagrams))
+	}
+	if got, want := len(conn.datagrams[1]), HeaderSize+FramesPerBuffer*Channels*2; got != want {
+		t.Errorf("flushed datagram is %d bytes, want %d", got, want)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Volume is a thread-safe volume setting in the range [0.0, 1.0]
+type Volume struct {
+	value atomic.Value // float64
+}
+
+// NewVolume creates a volume with the given initial value
+func NewVolume(initial float64) (*Volume, error) {
+	v := &Volume{}
+	if err := v.SetVolume(initial); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetVolume updates the volume, rejecting values outside [0.0, 1.0]
+func (v *Volume) SetVolume(volume float64) error {
+	if !(volume >= 0.0 && volume <= 1.0) {
+		return fmt.Errorf("volume %.2f out of range 0.0-1.0", volume)
+	}
+	v.value.Store(volume)
+	return nil
+}
+
+// GetVolume returns the current volume
+func (v *Volume) GetVolume() float64 {
+	return v.value.Load().(float64)
+}
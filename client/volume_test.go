@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+// TestVolumeBounds tests that SetVolume rejects out-of-range values
+func TestVolumeBounds(t *testing.T) {
+	v, err := NewVolume(0.5)
+	if err != nil {
+		t.Fatalf("NewVolume failed: %v", err)
+	}
+
+	for _, bad := range []float64{-0.1, 1.1, math.NaN()} {
+		if err := v.SetVolume(bad); err == nil {
+			t.Errorf("expected SetVolume(%v) to fail", bad)
+		}
+	}
+	if got := v.GetVolume(); got != 0.5 {
+		t.Errorf("expected rejected values to leave volume at 0.5, got %.2f", got)
+	}
+
+	if _, err := NewVolume(2.0); err == nil {
+		t.Error("expected NewVolume to reject an out-of-range initial value")
+	}
+}
+
+// TestVolumeConcurrentAccess tests concurrent SetVolume and GetVolume calls
+func TestVolumeConcurrentAccess(t *testing.T) {
+	v, _ := NewVolume(0.0)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				v.SetVolume(float64((i+j)%11) / 10)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if got := v.GetVolume(); got < 0.0 || got > 1.0 {
+					t.Errorf("read out-of-range volume %.2f", got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
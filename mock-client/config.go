@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Default audio parameters, kept in sync with server/main.go
+const (
+	Channels        = 2
+	FramesPerBuffer = 512
+	SampleRate      = 48000
+	BytesPerSample  = 2 // int16
+	PacketSize      = FramesPerBuffer * Channels * BytesPerSample
+)
+
+// Limits on the audio parameters, kept in sync with server/packetsize.go
+const (
+	MinSampleRate = 8000
+	MaxSampleRate = 192000
+	MinFrames     = 16
+	MaxFrames     = 8192
+)
+
+// config holds the mock-client command line options
+type config struct {
+	serverAddr string
+	sampleRate int
+	channels   int
+	frames     int
+	chunkSize  int
+	pattern    time.Duration
+	realtime   bool
+	rate       float64
+}
+
+// parseArgs parses the command line arguments (without the program name)
+func parseArgs(args []string, output io.Writer) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet("mock-client", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintln(output, "Usage: mock-client [flags] <host:port>")
+		fs.PrintDefaults()
+	}
+	fs.IntVar(&cfg.sampleRate, "sample-rate", SampleRate, fmt.Sprintf("Sample rate of the stream in Hz (%d to %d); must match the server's -sample-rate", MinSampleRate, MaxSampleRate))
+	fs.IntVar(&cfg.channels, "channels", Channels, "Channels to send: 1 (mono) or 2 (stereo); must match the server's -channels")
+	fs.IntVar(&cfg.frames, "frames", FramesPerBuffer, fmt.Sprintf("Audio frames per packet (%d to %d); must match the server's -frames", MinFrames, MaxFrames))
+	fs.IntVar(&cfg.chunkSize, "chunk-size", PacketSize, "Bytes of audio per packet; the server expects the default, -frames * -channels * 2 (override for fuzz testing)")
+	fs.DurationVar(&cfg.pattern, "pattern", 0, "Send this much verification pattern instead of hello.mp3, for checking with the server's -verify-pattern")
+	fs.BoolVar(&cfg.realtime, "realtime", true, "Pace packets to the speed the audio plays at instead of sending them as fast as possible")
+	fs.Float64Var(&cfg.rate, "rate", 1, "With -realtime, send at this multiple of playback speed (e.g. 2 for twice as fast)")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return cfg, errors.New("expected exactly one server address")
+	}
+	if cfg.sampleRate < MinSampleRate || cfg.sampleRate > MaxSampleRate {
+		return cfg, fmt.Errorf("sample rate must be between %d and %d Hz, got %d", MinSampleRate, MaxSampleRate, cfg.sampleRate)
+	}
+	if cfg.channels != 1 && cfg.channels != 2 {
+		return cfg, fmt.Errorf("channels must be 1 or 2, got %d", cfg.channels)
+	}
+	if cfg.frames < MinFrames || cfg.frames > MaxFrames {
+		return cfg, fmt.Errorf("frames per packet must be between %d and %d, got %d", MinFrames, MaxFrames, cfg.frames)
+	}
+	chunkSizeSet := false
+	fs.Visit(func(f *flag.Flag) { chunkSizeSet = chunkSizeSet || f.Name == "chunk-size" })
+	if !chunkSizeSet {
+		cfg.chunkSize = cfg.frames * cfg.channels * BytesPerSample
+	}
+	if cfg.pattern < 0 {
+		return cfg, fmt.Errorf("pattern duration must not be negative, got %v", cfg.pattern)
+	}
+	if cfg.pattern > 0 && cfg.channels != 2 {
+		return cfg, errors.New("-pattern needs -channels 2")
+	}
+	if cfg.chunkSize <= 0 {
+		return cfg, fmt.Errorf("chunk size must be positive, got %d", cfg.chunkSize)
+	}
+	if cfg.rate <= 0 {
+		return cfg, fmt.Errorf("rate must be positive, got %v", cfg.rate)
+	}
+	cfg.serverAddr = fs.Arg(0)
+	return cfg, nil
+}
+
+// bytesPerSecond returns how many bytes of audio the stream plays per second
+func (c config) bytesPerSecond() int {
+	return c.sampleRate * c.channels * BytesPerSample
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// TestDefaultChunkSize tests that the default chunk size matches the server packet size
+func TestDefaultChunkSize(t *testing.T) {
+	if PacketSize != 2048 {
+		t.Errorf("expected computed packet size 2048, got %d", PacketSize)
+	}
+	cfg, err := parseArgs([]string{"127.0.0.1:8080"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.chunkSize != PacketSize {
+		t.Errorf("expected default chunk size %d, got %d", PacketSize, cfg.chunkSize)
+	}
+	if cfg.serverAddr != "127.0.0.1:8080" {
+		t.Errorf("expected server address 127.0.0.1:8080, got %q", cfg.serverAddr)
+	}
+}
+
+// TestChunkSizeOverride tests the -chunk-size flag
+func TestChunkSizeOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int
+		wantErr bool
+	}{
+		{"override", []string{"-chunk-size", "100", "host:1"}, 100, false},
+		{"zero", []string{"-chunk-size", "0", "host:1"}, 0, true},
+		{"negative", []string{"-chunk-size", "-5", "host:1"}, 0, true},
+		{"missing address", []string{"-chunk-size", "100"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseArgs(tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.chunkSize != tt.want {
+				t.Errorf("expected chunk size %d, got %d", tt.want, cfg.chunkSize)
+			}
+		})
+	}
+}
+
+// TestPacingFlags tests the -realtime and -rate defaults and validation
+func TestPacingFlags(t *testing.T) {
+	cfg, err := parseArgs([]string{"host:1"}, io.Discard)
+	if err != nil || !cfg.realtime || cfg.rate != 1 {
+		t.Errorf("expected real-time pacing at rate 1 by default, got %+v, %v", cfg, err)
+	}
+	cfg, err = parseArgs([]string{"-realtime=false", "-rate", "2.5", "host:1"}, io.Discard)
+	if err != nil || cfg.realtime || cfg.rate != 2.5 {
+		t.Errorf("expected flags to override pacing, got %+v, %v", cfg, err)
+	}
+	for _, rate := range []string{"0", "-1"} {
+		if _, err := parseArgs([]string{"-rate", rate, "host:1"}, io.Discard); err == nil {
+			t.Errorf("expected rate %s to be rejected", rate)
+		}
+	}
+}
+
+// TestStreamParamFlags tests that -sample-rate, -channels and -frames set
+// the chunk size and pacing unless -chunk-size overrides the size
+func TestStreamParamFlags(t *testing.T) {
+	cfg, err := parseArgs([]string{"-sample-rate", "16000", "-channels", "1", "-frames", "160", "host:1"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if cfg.sampleRate != 16000 || cfg.channels != 1 || cfg.frames != 160 {
+		t.Errorf("expected 16000 Hz, 1 channel, 160 frames, got %+v", cfg)
+	}
+	if cfg.chunkSize != 320 {
+		t.Errorf("expected chunk size 320 for 160 mono frames, got %d", cfg.chunkSize)
+	}
+	if got, want := chunkDuration(cfg.chunkSize, cfg.bytesPerSecond()), 10*time.Millisecond; got != want {
+		t.Errorf("expected chunks paced %v apart, got %v", want, got)
+	}
+
+	cfg, err = parseArgs([]string{"-frames", "160", "-chunk-size", "100", "host:1"}, io.Discard)
+	if err != nil || cfg.chunkSize != 100 {
+		t.Errorf("expected -chunk-size to win over -frames, got %d, %v", cfg.chunkSize, err)
+	}
+
+	for _, args := range [][]string{
+		{"-sample-rate", "4000"},
+		{"-sample-rate", "400000"},
+		{"-channels", "0"},
+		{"-channels", "6"},
+		{"-frames", "8"},
+		{"-frames", "10000"},
+		{"-channels", "1", "-pattern", "1s"},
+	} {
+		if _, err := parseArgs(append(args, "host:1"), io.Discard); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
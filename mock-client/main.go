@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/hajimehoshi/go-mp3"
 )
@@ -15,74 +18,103 @@ func sendPacket(conn *net.UDPConn, message []byte) error {
 	return err
 }
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go <host:port>")
-		return
+// openAudioFile opens hello.mp3 from next to the executable and returns a
+// decoder streaming it as int16 stereo PCM, the decoded length in bytes and
+// the file to close once done
+func openAudioFile() (io.Reader, int64, io.Closer, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("Error getting executable path: %v", err)
 	}
-	serverAddrStr := os.Args[1]
-
-	serverAddr, err := net.ResolveUDPAddr("udp", serverAddrStr)
+	file, err := os.Open(filepath.Join(filepath.Dir(exePath), "hello.mp3"))
 	if err != nil {
-		fmt.Println("Error resolving UDP address:", err)
-		return
+		return nil, 0, nil, fmt.Errorf("Error opening audio file: %v", err)
 	}
 
-	conn, err := net.DialUDP("udp", nil, serverAddr)
+	decoder, err := mp3.NewDecoder(file)
 	if err != nil {
-		fmt.Println("Error dialing UDP:", err)
-		return
+		file.Close()
+		return nil, 0, nil, fmt.Errorf("Error creating MP3 decoder: %v", err)
 	}
-	defer conn.Close()
+	return decoder, decoder.Length(), file, nil
+}
 
-	// Read the audio file
-	exePath, err := os.Executable()
+func main() {
+	cfg, err := parseArgs(os.Args[1:], os.Stderr)
 	if err != nil {
-		fmt.Println("Error getting executable path:", err)
+		if err != flag.ErrHelp {
+			fmt.Println("Error:", err)
+		}
 		return
 	}
-	file, err := os.Open(filepath.Join(filepath.Dir(exePath), "hello.mp3"))
+
+	serverAddr, err := net.ResolveUDPAddr("udp", cfg.serverAddr)
 	if err != nil {
-		fmt.Println("Error opening audio file:", err)
+		fmt.Println("Error resolving UDP address:", err)
 		return
 	}
-	defer file.Close()
 
-	decoder, err := mp3.NewDecoder(file)
+	conn, err := net.DialUDP("udp", nil, serverAddr)
 	if err != nil {
-		fmt.Println("Error creating MP3 decoder:", err)
+		fmt.Println("Error dialing UDP:", err)
 		return
 	}
+	defer conn.Close()
 
-	audioData, err := ioutil.ReadAll(decoder)
-	if err != nil {
-		fmt.Println("Error decoding MP3 file:", err)
-		return
+	var audio io.Reader
+	var total int64
+	if cfg.pattern > 0 {
+		pattern := generatePattern(int(cfg.pattern.Seconds() * float64(cfg.sampleRate)))
+		audio, total = bytes.NewReader(pattern), int64(len(pattern))
+	} else {
+		var file io.Closer
+		audio, total, file, err = openAudioFile()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer file.Close()
+		if cfg.channels == 1 {
+			audio, total = &monoReader{source: audio}, total/2
+		}
 	}
 
 	fmt.Println("Mock client started. Streaming to", serverAddr)
 
-	// Simulate sending audio data
-	const chunkSize = 2048
-	for i := 0; i < len(audioData); i += chunkSize {
-		end := i + chunkSize
-		if end > len(audioData) {
-			end = len(audioData)
+	// Simulate sending audio data, decoding one packet at a time
+	packets := newPacketReader(audio, cfg.chunkSize)
+	start := time.Now()
+	var summary sendSummary
+	throttle := progressThrottle{interval: ProgressInterval}
+	var pacer *sendPacer
+	if cfg.realtime {
+		pacer = newSendPacer(cfg.chunkSize, cfg.bytesPerSecond(), cfg.rate)
+	}
+	for {
+		chunk, err := packets.Next()
+		if err == io.EOF {
+			break
 		}
-		chunk := audioData[i:end]
-
-		// Pad the last chunk if it's smaller than chunkSize
-		if len(chunk) < chunkSize {
-			paddedChunk := make([]byte, chunkSize)
-			copy(paddedChunk, chunk)
-			chunk = paddedChunk
+		if err != nil {
+			fmt.Println("Error decoding audio:", err)
+			return
+		}
+		if pacer != nil {
+			pacer.Wait()
 		}
 
 		if err := sendPacket(conn, chunk); err != nil {
 			fmt.Println("Error sending message:", err)
 			return
 		}
-		fmt.Printf("Sent %d bytes\n", len(chunk))
+		summary.Packets++
+		summary.Bytes += int64(len(chunk))
+		summary.Duration = time.Since(start)
+		if throttle.Ready(time.Now()) {
+			fmt.Printf("\r%s", formatProgress(summary, total))
+		}
 	}
+	fmt.Printf("\r%s\n", formatProgress(summary, total))
 	fmt.Println("Finished sending audio file.")
+	fmt.Println(summary)
 }
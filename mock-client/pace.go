@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// chunkDuration returns how long chunkSize bytes of audio take to play in a
+// stream of bytesPerSecond
+func chunkDuration(chunkSize, bytesPerSecond int) time.Duration {
+	return time.Duration(chunkSize) * time.Second / time.Duration(bytesPerSecond)
+}
+
+// sendPacer spaces sends out so audio leaves at rate times playback speed.
+// Each send is due a fixed interval after the first rather than after the
+// previous one, so oversleeping doesn't accumulate into drift.
+type sendPacer struct {
+	interval time.Duration
+	start    time.Time
+	sent     int
+}
+
+// newSendPacer paces chunks of chunkSize bytes of a stream playing
+// bytesPerSecond at rate times real time
+func newSendPacer(chunkSize, bytesPerSecond int, rate float64) *sendPacer {
+	return &sendPacer{interval: time.Duration(float64(chunkDuration(chunkSize, bytesPerSecond)) / rate)}
+}
+
+// Wait sleeps until the next chunk is due. The first chunk is due at once.
+func (p *sendPacer) Wait() {
+	if p.sent == 0 {
+		p.start = time.Now()
+	} else if d := time.Until(p.start.Add(time.Duration(p.sent) * p.interval)); d > 0 {
+		time.Sleep(d)
+	}
+	p.sent++
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestChunkDuration tests that a default packet lasts FramesPerBuffer frames
+func TestChunkDuration(t *testing.T) {
+	want := time.Duration(FramesPerBuffer) * time.Second / SampleRate
+	if got := chunkDuration(PacketSize, SampleRate*Channels*BytesPerSample); got != want {
+		t.Errorf("chunkDuration(%d) = %v, want %v", PacketSize, got, want)
+	}
+	// 160 mono frames at 16 kHz
+	if got, want := chunkDuration(320, 16000*BytesPerSample), 10*time.Millisecond; got != want {
+		t.Errorf("chunkDuration(320) at 16 kHz mono = %v, want %v", got, want)
+	}
+}
+
+// TestSendPacerRealTime tests that paced chunks take about as long to send
+// as they take to play, scaled by the rate
+func TestSendPacerRealTime(t *testing.T) {
+	const chunks = 10
+	const bytesPerSecond = SampleRate * Channels * BytesPerSample
+	for _, rate := range []float64{1, 2} {
+		p := newSendPacer(PacketSize, bytesPerSecond, rate)
+		start := time.Now()
+		for i := 0; i < chunks; i++ {
+			p.Wait()
+		}
+		elapsed := time.Since(start)
+
+		// The first chunk goes at once, so chunks-1 intervals pass
+		want := time.Duration(float64((chunks-1)*chunkDuration(PacketSize, bytesPerSecond)) / rate)
+		if elapsed < want || elapsed > want+50*time.Millisecond {
+			t.Errorf("rate %v: %d chunks took %v, want about %v", rate, chunks, elapsed, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "encoding/binary"
+
+// The verification pattern numbers every stereo frame with a counter. The
+// left channel carries the low 15 bits of the counter and the right channel
+// a scrambled copy, so the server can check each frame independently and
+// spot swapped channels. Keep in sync with server/pattern.go.
+
+// patternLeft returns the left sample for frame counter c
+func patternLeft(c uint32) int16 {
+	return int16(c & 0x7FFF)
+}
+
+// patternRight returns the right sample for frame counter c
+func patternRight(c uint32) int16 {
+	return int16((c * 3) & 0x7FFF)
+}
+
+// generatePattern returns frames of int16 stereo verification pattern
+func generatePattern(frames int) []byte {
+	data := make([]byte, frames*Channels*BytesPerSample)
+	for c := 0; c < frames; c++ {
+		binary.LittleEndian.PutUint16(data[c*4:], uint16(patternLeft(uint32(c))))
+		binary.LittleEndian.PutUint16(data[c*4+2:], uint16(patternRight(uint32(c))))
+	}
+	return data
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestGeneratePattern tests that the pattern numbers frames consecutively
+func TestGeneratePattern(t *testing.T) {
+	const frames = 40000 // Past the 15-bit wrap
+	data := generatePattern(frames)
+	if len(data) != frames*Channels*BytesPerSample {
+		t.Fatalf("expected %d bytes, got %d", frames*Channels*BytesPerSample, len(data))
+	}
+	for c := 0; c < frames; c++ {
+		left := int16(binary.LittleEndian.Uint16(data[c*4:]))
+		right := int16(binary.LittleEndian.Uint16(data[c*4+2:]))
+		if left != int16(c%32768) {
+			t.Fatalf("frame %d: expected left %d, got %d", c, c%32768, left)
+		}
+		if right != int16((c*3)%32768) {
+			t.Fatalf("frame %d: expected right %d, got %d", c, (c*3)%32768, right)
+		}
+	}
+}
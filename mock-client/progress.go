@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProgressInterval is the minimum time between progress updates
+const ProgressInterval = 250 * time.Millisecond
+
+// sendSummary describes a completed (or in progress) file transfer
+type sendSummary struct {
+	Packets  int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// PacketRate returns the average packets sent per second
+func (s sendSummary) PacketRate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Packets) / s.Duration.Seconds()
+}
+
+// ByteRate returns the average bytes sent per second
+func (s sendSummary) ByteRate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// String formats the final summary
+func (s sendSummary) String() string {
+	return fmt.Sprintf("Sent %d packets (%d bytes) in %v, average %.1f packets/s (%.1f KB/s)",
+		s.Packets, s.Bytes, s.Duration.Round(time.Millisecond), s.PacketRate(), s.ByteRate()/1024)
+}
+
+// formatProgress formats a single-line progress update for total bytes of audio.
+// Padding of the final packet can take the bytes sent past total.
+func formatProgress(s sendSummary, total int64) string {
+	percent := 100.0
+	if total > 0 && s.Bytes < total {
+		percent = float64(s.Bytes) * 100 / float64(total)
+	}
+	return fmt.Sprintf("%5.1f%% sent, %d packets, %v elapsed", percent, s.Packets, s.Duration.Round(time.Second))
+}
+
+// progressThrottle limits how often progress is printed
+type progressThrottle struct {
+	interval time.Duration
+	last     time.Time
+}
+
+// Ready reports whether an update may be printed at now, and if so records it
+func (pt *progressThrottle) Ready(now time.Time) bool {
+	if !pt.last.IsZero() && now.Sub(pt.last) < pt.interval {
+		return false
+	}
+	pt.last = now
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSendSummary tests the summary computation for a known transfer
+func TestSendSummary(t *testing.T) {
+	s := sendSummary{Packets: 500, Bytes: 500 * 2048, Duration: 2 * time.Second}
+
+	if got := s.PacketRate(); got != 250 {
+		t.Errorf("expected 250 packets/s, got %v", got)
+	}
+	if got := s.ByteRate(); got != 512000 {
+		t.Errorf("expected 512000 bytes/s, got %v", got)
+	}
+	want := "Sent 500 packets (1024000 bytes) in 2s, average 250.0 packets/s (500.0 KB/s)"
+	if got := s.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	empty := sendSummary{}
+	if empty.PacketRate() != 0 || empty.ByteRate() != 0 {
+		t.Errorf("expected zero rates for an empty transfer")
+	}
+}
+
+// TestFormatProgress tests the progress line
+func TestFormatProgress(t *testing.T) {
+	s := sendSummary{Packets: 10, Bytes: 1024, Duration: 1500 * time.Millisecond}
+	want := " 25.0% sent, 10 packets, 2s elapsed"
+	if got := formatProgress(s, 4096); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestProgressThrottle tests that updates are limited to one per interval
+func TestProgressThrottle(t *testing.T) {
+	pt := progressThrottle{interval: time.Second}
+	start := time.Unix(0, 0)
+	if !pt.Ready(start) {
+		t.Error("expected the first update to be printed")
+	}
+	if pt.Ready(start.Add(500 * time.Millisecond)) {
+		t.Error("expected an update within the interval to be suppressed")
+	}
+	if !pt.Ready(start.Add(time.Second)) {
+		t.Error("expected an update after the interval to be printed")
+	}
+}
+
+// TestFormatProgressPaddedFinalPacket tests that padding doesn't report more than 100%
+func TestFormatProgressPaddedFinalPacket(t *testing.T) {
+	s := sendSummary{Packets: 2, Bytes: 4096}
+	want := "100.0% sent, 2 packets, 0s elapsed"
+	if got := formatProgress(s, 3000); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
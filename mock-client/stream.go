@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// packetReader splits an audio source into packets as it is read, so only
+// one packet of audio is held at a time however long the source is
+type packetReader struct {
+	source io.Reader
+	packet []byte
+}
+
+// newPacketReader reads source in packets of chunkSize bytes
+func newPacketReader(source io.Reader, chunkSize int) *packetReader {
+	return &packetReader{source: source, packet: make([]byte, chunkSize)}
+}
+
+// Next returns the next packet, padding the last one with silence, or
+// io.EOF once the source is exhausted. The packet is overwritten by the
+// next call.
+func (pr *packetReader) Next() ([]byte, error) {
+	n, err := io.ReadFull(pr.source, pr.packet)
+	switch err {
+	case nil:
+		return pr.packet, nil
+	case io.ErrUnexpectedEOF:
+		clear(pr.packet[n:])
+		return pr.packet, nil
+	}
+	return nil, err
+}
+
+// monoReader downmixes int16 stereo PCM read from source to mono by
+// averaging each frame's channels, so hello.mp3 can be sent to a server
+// run with -channels 1
+type monoReader struct {
+	source io.Reader
+	stereo []byte
+}
+
+// Read fills p with as many whole mono samples as source has frames for
+func (m *monoReader) Read(p []byte) (int, error) {
+	samples := len(p) / BytesPerSample
+	if len(m.stereo) < samples*2*BytesPerSample {
+		m.stereo = make([]byte, samples*2*BytesPerSample)
+	}
+	n, err := io.ReadFull(m.source, m.stereo[:samples*2*BytesPerSample])
+	frames := n / (2 * BytesPerSample)
+	for i := 0; i < frames; i++ {
+		left := int16(binary.LittleEndian.Uint16(m.stereo[i*4:]))
+		right := int16(binary.LittleEndian.Uint16(m.stereo[i*4+2:]))
+		binary.LittleEndian.PutUint16(p[i*2:], uint16((int32(left)+int32(right))/2))
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = nil // The rest is io.EOF on the next call
+	}
+	if frames == 0 && err == nil && samples > 0 {
+		err = io.EOF // Only part of a frame was left
+	}
+	return frames * BytesPerSample, err
+}
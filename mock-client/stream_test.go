@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// syntheticSource produces size bytes of audio on demand and tracks how far
+// reads have got ahead of what the consumer has taken
+type syntheticSource struct {
+	size     int64
+	read     int64
+	consumed int64
+	maxAhead int64
+}
+
+func (s *syntheticSource) Read(p []byte) (int, error) {
+	if s.read == s.size {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if n > s.size-s.read {
+		n = s.size - s.read
+	}
+	for i := range p[:n] {
+		p[i] = byte(s.read + int64(i))
+	}
+	s.read += n
+	if ahead := s.read - s.consumed; ahead > s.maxAhead {
+		s.maxAhead = ahead
+	}
+	return int(n), nil
+}
+
+// TestPacketReaderBoundedMemory tests that a long source is streamed one
+// packet at a time, never reading more than a packet ahead
+func TestPacketReaderBoundedMemory(t *testing.T) {
+	source := &syntheticSource{size: 64<<20 + 100} // Not a whole number of packets
+	packets := newPacketReader(source, PacketSize)
+	var count int64
+	for {
+		packet, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(packet) != PacketSize {
+			t.Fatalf("packet %d is %d bytes, want %d", count, len(packet), PacketSize)
+		}
+		count++
+		source.consumed = source.read
+	}
+	if want := (source.size + PacketSize - 1) / PacketSize; count != want {
+		t.Errorf("got %d packets, want %d", count, want)
+	}
+	if source.maxAhead > PacketSize {
+		t.Errorf("read up to %d bytes ahead, want at most one packet (%d)", source.maxAhead, PacketSize)
+	}
+}
+
+// TestPacketReaderPadsLastPacket tests that a partial final packet is
+// padded with silence
+func TestPacketReaderPadsLastPacket(t *testing.T) {
+	source := &syntheticSource{size: 6}
+	packets := newPacketReader(source, 4)
+	if _, err := packets.Next(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	last, err := packets.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last[0] != 4 || last[1] != 5 || last[2] != 0 || last[3] != 0 {
+		t.Errorf("expected 04 05 00 00, got % x", last)
+	}
+	if _, err := packets.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last packet, got %v", err)
+	}
+}
+
+// TestMonoReaderDownmixes tests that stereo frames are averaged into mono
+// samples, with a trailing partial frame dropped
+func TestMonoReaderDownmixes(t *testing.T) {
+	stereo := []int16{100, 300, -32768, -32768, 32767, -32767, 5, 7}
+	data := make([]byte, len(stereo)*2)
+	for i, sample := range stereo {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	data = append(data, 1, 2) // Half a frame
+
+	packets := newPacketReader(&monoReader{source: bytes.NewReader(data)}, 6)
+	var got []int16
+	for {
+		packet, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 0; i < len(packet); i += 2 {
+			got = append(got, int16(binary.LittleEndian.Uint16(packet[i:])))
+		}
+	}
+	want := []int16{200, -32768, 0, 6, 0, 0} // The last packet padded with silence
+	if len(got) != len(want) {
+		t.Fatalf("got samples %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got samples %v, want %v", got, want)
+		}
+	}
+}
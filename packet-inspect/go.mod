@@ -0,0 +1,3 @@
+module packet-inspect
+
+go 1.24.5
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+)
+
+// Audio parameters (must match the server's)
+const (
+	Channels        = 2   // Stereo
+	FramesPerBuffer = 512 // Number of audio frames per buffer
+
+	PacketSize        = FramesPerBuffer * Channels * 2 // 2 bytes per int16 sample
+	Float32PacketSize = FramesPerBuffer * Channels * 4 // 4 bytes per float32 sample
+	SequenceSize      = 4                              // uint32 sequence number prefix
+)
+
+// Extended header layout (see server/packet.go)
+const (
+	HeaderMagic0  = 'A'
+	HeaderMagic1  = 'S'
+	HeaderVersion = 1
+	HeaderSize    = 12
+)
+
+// Header variants understood by the server
+const (
+	VariantLegacy    = "legacy"    // Raw PCM, no header
+	VariantSequenced = "sequenced" // uint32 little-endian sequence followed by PCM
+	VariantExtended  = "extended"  // Magic, version, flags, epoch and sequence followed by PCM
+)
+
+// Codec tags, identified by payload size
+const (
+	CodecPCM16   = "pcm16" // Interleaved little-endian int16 samples
+	CodecFloat32 = "f32"   // Interleaved little-endian float32 samples
+)
+
+// payloadCodec returns the codec tag for a payload of n bytes, or "" if unknown
+func payloadCodec(n int) string {
+	switch n {
+	case PacketSize:
+		return CodecPCM16
+	case Float32PacketSize:
+		return CodecFloat32
+	}
+	return ""
+}
+
+// PacketInfo holds the decoded metadata of a single audio packet
+type PacketInfo struct {
+	Variant     string
+	Sequence    uint32
+	HasSequence bool
+	Epoch       uint32
+	HasEpoch    bool
+	Flags       uint8
+	Size        int // Total datagram size in bytes
+	PayloadSize int // Audio payload size in bytes
+	Codec       string
+}
+
+// decodePacket extracts packet metadata using the same size rules as the server
+func decodePacket(packet []byte) (PacketInfo, error) {
+	info := PacketInfo{Size: len(packet)}
+	switch {
+	case len(packet) >= HeaderSize && packet[0] == HeaderMagic0 && packet[1] == HeaderMagic1 && payloadCodec(len(packet)-HeaderSize) != "":
+		if packet[2] != HeaderVersion {
+			return info, fmt.Errorf("unsupported header version %d", packet[2])
+		}
+		info.Variant = VariantExtended
+		info.Flags = packet[3]
+		info.Epoch = binary.LittleEndian.Uint32(packet[4:8])
+		info.HasEpoch = true
+		info.Sequence = binary.LittleEndian.Uint32(packet[8:12])
+		info.HasSequence = true
+		info.PayloadSize = len(packet) - HeaderSize
+	case payloadCodec(len(packet)-SequenceSize) != "":
+		info.Variant = VariantSequenced
+		info.Sequence = binary.LittleEndian.Uint32(packet[:SequenceSize])
+		info.HasSequence = true
+		info.PayloadSize = len(packet) - SequenceSize
+	case payloadCodec(len(packet)) != "":
+		info.Variant = VariantLegacy
+		info.PayloadSize = len(packet)
+	default:
+		return info, errors.New("unrecognized packet size")
+	}
+	info.Codec = payloadCodec(info.PayloadSize)
+	return info, nil
+}
+
+// String formats the packet metadata as a single log line
+func (pi PacketInfo) String() string {
+	seq := "-"
+	if pi.HasSequence {
+		seq = fmt.Sprintf("%d", pi.Sequence)
+	}
+	epoch := "-"
+	if pi.HasEpoch {
+		epoch = fmt.Sprintf("%d", pi.Epoch)
+	}
+	return fmt.Sprintf("variant=%s epoch=%s seq=%s flags=%#02x size=%d payload=%d codec=%s",
+		pi.Variant, epoch, seq, pi.Flags, pi.Size, pi.PayloadSize, pi.Codec)
+}
+
+func main() {
+	listenPort := flag.Int("port", 8080, "Port to listen for audio packets")
+	flag.Parse()
+
+	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", *listenPort))
+	if err != nil {
+		log.Fatalf("Error resolving listen address: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Fatalf("Error listening on UDP: %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("Inspecting packets on UDP port %d. Press Ctrl+C to stop.\n", *listenPort)
+
+	buffer := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			log.Printf("Error reading UDP packet: %v", err)
+			continue
+		}
+		info, err := decodePacket(buffer[:n])
+		if err != nil {
+			log.Printf("%s: %v (%d bytes)", from, err, n)
+			continue
+		}
+		log.Printf("%s: %s", from, info)
+	}
+}
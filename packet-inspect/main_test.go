@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestDecodeSequencedPacket tests decoding a packet with a sequence number prefix
+func TestDecodeSequencedPacket(t *testing.T) {
+	packet := make([]byte, PacketSize+SequenceSize)
+	binary.LittleEndian.PutUint32(packet, 42)
+
+	info, err := decodePacket(packet)
+	if err != nil {
+		t.Fatalf("decodePacket failed: %v", err)
+	}
+	if info.Variant != VariantSequenced {
+		t.Errorf("expected variant %q, got %q", VariantSequenced, info.Variant)
+	}
+	if !info.HasSequence || info.Sequence != 42 {
+		t.Errorf("expected sequence 42, got %d (present: %v)", info.Sequence, info.HasSequence)
+	}
+	if info.PayloadSize != PacketSize {
+		t.Errorf("expected payload size %d, got %d", PacketSize, info.PayloadSize)
+	}
+	if info.Codec != CodecPCM16 {
+		t.Errorf("expected codec %q, got %q", CodecPCM16, info.Codec)
+	}
+}
+
+// TestDecodeExtendedPacket tests decoding a packet with the epoch header
+func TestDecodeExtendedPacket(t *testing.T) {
+	packet := make([]byte, HeaderSize+PacketSize)
+	copy(packet, []byte{HeaderMagic0, HeaderMagic1, HeaderVersion, 0x01})
+	binary.LittleEndian.PutUint32(packet[4:8], 3)
+	binary.LittleEndian.PutUint32(packet[8:12], 99)
+
+	info, err := decodePacket(packet)
+	if err != nil {
+		t.Fatalf("decodePacket failed: %v", err)
+	}
+	if info.Variant != VariantExtended {
+		t.Errorf("expected variant %q, got %q", VariantExtended, info.Variant)
+	}
+	if !info.HasEpoch || info.Epoch != 3 {
+		t.Errorf("expected epoch 3, got %d (present: %v)", info.Epoch, info.HasEpoch)
+	}
+	if !info.HasSequence || info.Sequence != 99 {
+		t.Errorf("expected sequence 99, got %d (present: %v)", info.Sequence, info.HasSequence)
+	}
+	if info.Flags != 0x01 {
+		t.Errorf("expected flags 0x01, got %#02x", info.Flags)
+	}
+	if info.PayloadSize != PacketSize {
+		t.Errorf("expected payload size %d, got %d", PacketSize, info.PayloadSize)
+	}
+
+	packet[2] = HeaderVersion + 1
+	if _, err := decodePacket(packet); err == nil {
+		t.Error("expected error for unsupported header version")
+	}
+}
+
+// TestDecodeLegacyPacket tests decoding a raw PCM packet without a header
+func TestDecodeLegacyPacket(t *testing.T) {
+	info, err := decodePacket(make([]byte, PacketSize))
+	if err != nil {
+		t.Fatalf("decodePacket failed: %v", err)
+	}
+	if info.Variant != VariantLegacy {
+		t.Errorf("expected variant %q, got %q", VariantLegacy, info.Variant)
+	}
+	if info.HasSequence {
+		t.Error("expected legacy packet to have no sequence")
+	}
+	if info.PayloadSize != PacketSize {
+		t.Errorf("expected payload size %d, got %d", PacketSize, info.PayloadSize)
+	}
+}
+
+// TestDecodeFloat32Packet tests that float32 payloads are tagged with the f32 codec
+func TestDecodeFloat32Packet(t *testing.T) {
+	info, err := decodePacket(make([]byte, SequenceSize+Float32PacketSize))
+	if err != nil {
+		t.Fatalf("decodePacket failed: %v", err)
+	}
+	if info.Variant != VariantSequenced || info.Codec != CodecFloat32 {
+		t.Errorf("expected sequenced f32 packet, got variant %q codec %q", info.Variant, info.Codec)
+	}
+	if info.PayloadSize != Float32PacketSize {
+		t.Errorf("expected payload size %d, got %d", Float32PacketSize, info.PayloadSize)
+	}
+}
+
+// TestDecodeUnexpectedSize tests that packets of unknown size are rejected
+func TestDecodeUnexpectedSize(t *testing.T) {
+	for _, size := range []int{0, 1, PacketSize - 1, PacketSize + 1, PacketSize + SequenceSize + 1} {
+		if _, err := decodePacket(make([]byte, size)); err == nil {
+			t.Errorf("expected error for %d byte packet", size)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AdaptiveDeviations is how many standard deviations of inter-arrival time
+// the adaptive target covers; late packets beyond that underflow
+const AdaptiveDeviations = 4
+
+// InterArrivalEstimator tracks the mean and variance of the time between
+// packets reaching the jitter buffer, smoothed with a gain of 1/16 so it
+// follows the network within a second or two
+type InterArrivalEstimator struct {
+	mu       sync.Mutex
+	last     time.Time
+	mean     float64 // Nanoseconds
+	variance float64 // Nanoseconds squared
+	primed   bool    // The mean has been seeded from a first interval
+}
+
+// Record adds a packet that arrived at now
+func (e *InterArrivalEstimator) Record(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.last.IsZero() {
+		e.last = now
+		return
+	}
+	interval := float64(now.Sub(e.last))
+	e.last = now
+	if !e.primed {
+		e.mean, e.primed = interval, true
+		return
+	}
+	diff := interval - e.mean
+	e.mean += diff / 16
+	e.variance = (e.variance + diff*diff/16) * 15 / 16
+}
+
+// Deviation returns the standard deviation of the inter-arrival time
+func (e *InterArrivalEstimator) Deviation() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(math.Sqrt(e.variance))
+}
+
+// Reset forgets all arrivals, as when a new stream starts
+func (e *InterArrivalEstimator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// The fields are cleared one by one: overwriting e would clobber the
+	// mutex held here
+	e.last = time.Time{}
+	e.mean, e.variance, e.primed = 0, 0, false
+}
+
+// SetAdaptiveTarget makes the buffer target follow the measured
+// inter-arrival jitter instead of the cold and warm targets
+func (jb *JitterBuffer) SetAdaptiveTarget(enabled bool) {
+	if enabled {
+		jb.arrivals = &InterArrivalEstimator{}
+	} else {
+		jb.arrivals = nil
+	}
+}
+
+// adaptiveTarget returns the number of packets needed to ride out the
+// measured jitter, between minBufferSize and maxBufferSize
+func (jb *JitterBuffer) adaptiveTarget() int {
+	deviation := jb.arrivals.Deviation()
+	target := int(math.Ceil(float64(AdaptiveDeviations*deviation) / float64(PacketDuration)))
+	return max(jb.minBufferSize, min(jb.maxBufferSize, target))
+}
+
+// GetTargetSize returns the buffer level currently aimed for
+func (jb *JitterBuffer) GetTargetSize() int {
+	return int(atomic.LoadInt64(&jb.targetSize))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAdaptiveTargetFollowsJitter tests that the target grows while packets
+// arrive with widely varying spacing and shrinks again once they are steady
+func TestAdaptiveTargetFollowsJitter(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetAdaptiveTarget(true)
+	packet := make([]byte, PacketSize)
+	now := time.Now()
+	feed := func(count int, spacing func(i int) time.Duration) {
+		for i := 0; i < count; i++ {
+			now = now.Add(spacing(i))
+			jb.addPacket(packet, now)
+			if _, ok := jb.GetPacket(); !ok {
+				t.Fatal("packet not buffered")
+			}
+		}
+	}
+	steadily := func(int) time.Duration { return PacketDuration }
+
+	feed(200, steadily)
+	initial := jb.UpdateTarget(now)
+	if initial != jb.minBufferSize {
+		t.Fatalf("target %d with steady arrivals, want the minimum %d", initial, jb.minBufferSize)
+	}
+
+	// Bursts: packets arrive in pairs 4 packets' worth of time apart
+	feed(200, func(i int) time.Duration { return time.Duration(i%2*4) * PacketDuration })
+	jittery := jb.UpdateTarget(now)
+	if jittery <= initial {
+		t.Fatalf("target %d with jittery arrivals, want more than %d", jittery, initial)
+	}
+	if got := jb.GetTargetSize(); got != jittery {
+		t.Errorf("GetTargetSize() = %d, want %d", got, jittery)
+	}
+
+	feed(200, steadily)
+	if steady := jb.UpdateTarget(now); steady >= jittery {
+		t.Errorf("target %d once arrivals are steady again, want less than %d", steady, jittery)
+	}
+}
+
+// TestAdaptiveTargetDisabled tests that without an adaptive target the
+// cold target applies regardless of jitter
+func TestAdaptiveTargetDisabled(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetTargets(30, 20, time.Hour)
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		now = now.Add(time.Duration(i%2*8) * PacketDuration)
+		jb.addPacket(make([]byte, PacketSize), now)
+	}
+	if target := jb.UpdateTarget(now); target != 30 {
+		t.Errorf("target %d, want the cold target 30", target)
+	}
+}
+
+// TestAdaptiveTargetReset tests that resetting a buffer with an adaptive
+// target forgets the arrivals, and can be done more than once
+func TestAdaptiveTargetReset(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetAdaptiveTarget(true)
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		now = now.Add(time.Duration(i%2*8) * PacketDuration)
+		jb.addPacket(make([]byte, PacketSize), now)
+	}
+	if jb.arrivals.Deviation() == 0 {
+		t.Fatal("expected jittery arrivals to be measured")
+	}
+
+	jb.Reset()
+	jb.Reset()
+	if deviation := jb.arrivals.Deviation(); deviation != 0 {
+		t.Errorf("deviation %v after a reset, want 0", deviation)
+	}
+	jb.addPacket(make([]byte, PacketSize), now)
+	if !jb.arrivals.last.Equal(now) {
+		t.Error("expected arrivals to be recorded again after a reset")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// MaxAdmissionPace bounds -admission-pace; faster pacing barely smooths a burst
+const MaxAdmissionPace = 16
+
+// AdmissionQueue stages packets arriving in a burst, after a network
+// pause for example, and admits them to the jitter buffer at a paced rate
+// so the level rises smoothly instead of spiking. A packet arriving while
+// nothing is staged and its slot has come is admitted straight away, so a
+// steady stream isn't delayed.
+type AdmissionQueue struct {
+	interval time.Duration // Minimum spacing of admitted packets
+	capacity int
+
+	mu     sync.Mutex
+	staged [][]byte
+	next   time.Time // When the next packet may be admitted
+}
+
+// NewAdmissionQueue creates a queue admitting packets at pace times the
+// playback rate and staging up to capacity packets
+func NewAdmissionQueue(pace float64, capacity int) *AdmissionQueue {
+	return &AdmissionQueue{
+		interval: time.Duration(float64(PacketDuration) / pace),
+		capacity: capacity,
+	}
+}
+
+// Stage decides on packet arriving at now. It returns false if packet may
+// be admitted straight away. Otherwise packet is staged; if the stage is
+// full, its oldest packet is admitted early to make room.
+func (q *AdmissionQueue) Stage(packet []byte, now time.Time, admit func([]byte)) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.staged) == 0 && !now.Before(q.next) {
+		q.next = now.Add(q.interval)
+		return false
+	}
+	if len(q.staged) == q.capacity {
+		admit(q.staged[0])
+		q.staged[0] = nil
+		q.staged = q.staged[1:]
+	}
+	q.staged = append(q.staged, packet)
+	return true
+}
+
+// Transfer admits the staged packets whose slots have come by now and
+// returns how many it admitted. Admitting under the lock keeps packets in
+// order with ones Stage lets straight through.
+func (q *AdmissionQueue) Transfer(now time.Time, admit func([]byte)) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	admitted := 0
+	for len(q.staged) > 0 && !now.Before(q.next) {
+		admit(q.staged[0])
+		q.staged[0] = nil
+		q.staged = q.staged[1:]
+		q.next = q.next.Add(q.interval)
+		admitted++
+	}
+	return admitted
+}
+
+// Len returns the number of staged packets
+func (q *AdmissionQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.staged)
+}
+
+// Reset discards the staged packets
+func (q *AdmissionQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	clear(q.staged)
+	q.staged = q.staged[:0]
+	q.next = time.Time{}
+}
+
+// SetAdmissionPace stages bursts and admits them at pace times the playback
+// rate (0 admits every packet immediately). The staged packets are moved
+// into the buffer by AdmitStaged, which the player calls before each buffer.
+func (jb *JitterBuffer) SetAdmissionPace(pace float64) {
+	if pace > 0 {
+		jb.admission = NewAdmissionQueue(pace, jb.maxBufferSize)
+	} else {
+		jb.admission = nil
+	}
+}
+
+// AdmitStaged moves the staged packets that are due at now into the buffer
+func (jb *JitterBuffer) AdmitStaged(now time.Time) {
+	if jb.admission != nil {
+		jb.admission.Transfer(now, func(packet []byte) { jb.admit(packet, now) })
+	}
+}
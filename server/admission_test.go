@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAdmissionPacesBurst tests that a burst of packets arriving at once is
+// admitted to the jitter buffer one interval apart, in order, rather than
+// all at once
+func TestAdmissionPacesBurst(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetAdmissionPace(2)
+	interval := PacketDuration / 2
+	now := time.Now()
+
+	const burst = 10
+	for i := 0; i < burst; i++ {
+		packet := make([]byte, PacketSize)
+		packet[0] = byte(i)
+		jb.addPacket(packet, now)
+	}
+	if level := jb.GetBufferLevel(); level != 1 {
+		t.Fatalf("level %d right after the burst, want only the first packet admitted", level)
+	}
+	if staged := jb.admission.Len(); staged != burst-1 {
+		t.Fatalf("%d packets staged, want %d", staged, burst-1)
+	}
+
+	jb.AdmitStaged(now.Add(interval / 2))
+	if level := jb.GetBufferLevel(); level != 1 {
+		t.Errorf("level %d before the next slot, want 1", level)
+	}
+	jb.AdmitStaged(now.Add(interval))
+	if level := jb.GetBufferLevel(); level != 2 {
+		t.Errorf("level %d after one interval, want 2", level)
+	}
+	jb.AdmitStaged(now.Add(4 * interval))
+	if level := jb.GetBufferLevel(); level != 5 {
+		t.Errorf("level %d after four intervals, want 5", level)
+	}
+	jb.AdmitStaged(now.Add(time.Second))
+	if level := jb.GetBufferLevel(); level != burst {
+		t.Fatalf("level %d once the burst has drained, want %d", level, burst)
+	}
+	for i := 0; i < burst; i++ {
+		packet, _ := jb.GetPacket()
+		if packet[0] != byte(i) {
+			t.Fatalf("packet %d admitted out of order (got %d)", i, packet[0])
+		}
+	}
+
+	// A steady stream passes straight through
+	now = now.Add(2 * time.Second)
+	for i := 0; i < 5; i++ {
+		jb.addPacket(make([]byte, PacketSize), now.Add(time.Duration(i)*PacketDuration))
+		if level := jb.GetBufferLevel(); level != i+1 {
+			t.Fatalf("steady packet %d staged (level %d)", i, level)
+		}
+	}
+}
+
+// TestAdmissionStageFull tests that a full stage admits its oldest packet
+// early rather than dropping or reordering
+func TestAdmissionStageFull(t *testing.T) {
+	q := NewAdmissionQueue(2, 2)
+	var admitted []byte
+	admit := func(p []byte) { admitted = append(admitted, p[0]) }
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if !q.Stage([]byte{byte(i)}, now, admit) {
+			admit([]byte{byte(i)})
+		}
+	}
+	if string(admitted) != "\x00\x01\x02" || q.Len() != 2 {
+		t.Errorf("admitted %v with %d staged, want [0 1 2] with 2", admitted, q.Len())
+	}
+}
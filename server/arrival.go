@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ArrivalStats measures packet loss and interarrival jitter as packets are
+// received, before any reordering or buffering
+type ArrivalStats struct {
+	mu          sync.Mutex
+	started     bool
+	baseSeq     uint32
+	nextSeq     uint32 // One past the highest sequence received
+	received    int64  // Sequenced packets received since baseSeq
+	lastArrival time.Time
+	lastSeq     uint32
+	lastPackets int
+	jitter      float64 // Smoothed deviation from the expected spacing, in nanoseconds
+}
+
+// ArrivalSnapshot is a point-in-time copy of the arrival statistics
+type ArrivalSnapshot struct {
+	expected int64
+	received int64
+	jitter   time.Duration
+}
+
+// restartGap is how far back a sequence may jump before it is taken as a new stream
+const restartGap = 1000
+
+// Record adds a datagram that arrived at now
+func (as *ArrivalStats) Record(now time.Time, info packetInfo) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	// Jitter as in RFC 3550: the deviation of the arrival spacing from the
+	// spacing of the audio it carries, smoothed with a gain of 1/16
+	if !as.lastArrival.IsZero() {
+		expected := time.Duration(as.lastPackets) * PacketDuration
+		if info.sequenced && as.started {
+			expected = time.Duration(int32(info.sequence-as.lastSeq)) * PacketDuration
+		}
+		d := float64(now.Sub(as.lastArrival) - expected)
+		if d < 0 {
+			d = -d
+		}
+		as.jitter += (d - as.jitter) / 16
+	}
+	as.lastArrival = now
+	as.lastPackets = info.packets
+
+	if !info.sequenced {
+		return
+	}
+	end := info.sequence + uint32(info.packets)
+	if !as.started || int32(info.sequence-as.baseSeq) < -restartGap {
+		as.started = true
+		as.baseSeq = info.sequence
+		as.nextSeq = end
+		as.received = 0
+	} else if int32(end-as.nextSeq) > 0 {
+		as.nextSeq = end
+	}
+	as.lastSeq = info.sequence
+	as.received += int64(info.packets)
+}
+
+// Snapshot returns the current statistics
+func (as *ArrivalStats) Snapshot() ArrivalSnapshot {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return ArrivalSnapshot{
+		expected: int64(as.nextSeq - as.baseSeq),
+		received: as.received,
+		jitter:   time.Duration(as.jitter),
+	}
+}
+
+// LossPercent returns the percentage of sequenced packets never received
+func (s ArrivalSnapshot) LossPercent() float64 {
+	if s.expected <= 0 || s.received >= s.expected {
+		return 0
+	}
+	return float64(s.expected-s.received) * 100 / float64(s.expected)
+}
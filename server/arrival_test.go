@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestArrivalStatsLoss tests loss accounting from sequence gaps
+func TestArrivalStatsLoss(t *testing.T) {
+	var as ArrivalStats
+	now := time.Unix(0, 0)
+	for seq := uint32(0); seq < 100; seq++ {
+		if seq%10 == 3 {
+			continue // Lose one packet in ten
+		}
+		as.Record(now.Add(time.Duration(seq)*PacketDuration), packetInfo{sequence: seq, packets: 1, sequenced: true})
+	}
+	snap := as.Snapshot()
+	if snap.expected != 100 || snap.received != 90 {
+		t.Errorf("expected 90 of 100 packets, got %d of %d", snap.received, snap.expected)
+	}
+	if snap.LossPercent() != 10 {
+		t.Errorf("expected 10%% loss, got %v", snap.LossPercent())
+	}
+	// Perfectly spaced arrivals have no jitter
+	if snap.jitter != 0 {
+		t.Errorf("expected no jitter, got %v", snap.jitter)
+	}
+}
+
+// TestArrivalStatsJitter tests that uneven spacing is measured as jitter
+func TestArrivalStatsJitter(t *testing.T) {
+	var as ArrivalStats
+	now := time.Unix(0, 0)
+	for i := 0; i < 200; i++ {
+		// Alternate arriving 2ms early and 2ms late
+		offset := 2 * time.Millisecond
+		if i%2 == 0 {
+			offset = -offset
+		}
+		as.Record(now.Add(time.Duration(i)*PacketDuration+offset), packetInfo{packets: 1})
+	}
+	jitter := as.Snapshot().jitter
+	if jitter < 3900*time.Microsecond || jitter > 4100*time.Microsecond {
+		t.Errorf("expected jitter near 4ms, got %v", jitter)
+	}
+}
+
+// TestArrivalStatsRestart tests that a sequence restarting from zero starts a new count
+func TestArrivalStatsRestart(t *testing.T) {
+	var as ArrivalStats
+	now := time.Unix(0, 0)
+	as.Record(now, packetInfo{sequence: 5000, packets: 1, sequenced: true})
+	as.Record(now, packetInfo{sequence: 0, packets: 1, sequenced: true})
+	as.Record(now, packetInfo{sequence: 1, packets: 1, sequenced: true})
+	snap := as.Snapshot()
+	if snap.expected != 2 || snap.received != 2 {
+		t.Errorf("expected 2 of 2 packets after restart, got %d of %d", snap.received, snap.expected)
+	}
+}
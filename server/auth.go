@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// AuthTagSize is how much of the HMAC-SHA256 tag -psk appends to each
+// audio datagram and control message
+const AuthTagSize = 16
+
+// errAuthFailed means a datagram's tag didn't match its contents under the
+// pre-shared key: it was forged, altered, or sent with another key
+var errAuthFailed = errors.New("authentication tag mismatch")
+
+// authTag computes the truncated tag for b under key
+func authTag(key, b []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)[:AuthTagSize]
+}
+
+// appendAuthTag appends b's tag under key to b
+func appendAuthTag(key, b []byte) []byte {
+	return append(b, authTag(key, b)...)
+}
+
+// checkAuthTag verifies the tag at the end of b and returns b without it
+func checkAuthTag(key, b []byte) ([]byte, error) {
+	if len(b) < AuthTagSize {
+		return nil, fmt.Errorf("datagram too short for an authentication tag: %d bytes", len(b))
+	}
+	body, tag := b[:len(b)-AuthTagSize], b[len(b)-AuthTagSize:]
+	if !hmac.Equal(tag, authTag(key, body)) {
+		return nil, errAuthFailed
+	}
+	return body, nil
+}
+
+// ControlSequenceSize is the length of the sequence number signed control
+// messages carry between the message and its tag
+const ControlSequenceSize = 8
+
+// signingWriter numbers and tags each control message written through it.
+// The number is a little-endian uint64 counter that the client checks
+// against a replay window, so a captured message can't be sent again. It
+// keeps no buffer, so several goroutines may share it.
+type signingWriter struct {
+	w        io.Writer
+	key      []byte
+	sequence uint64 // Last number used; advanced atomically
+}
+
+// newSigningWriter creates a writer signing control messages for w. The
+// counter starts at the current time in nanoseconds, so it keeps rising
+// across server restarts and a running client still accepts it.
+func newSigningWriter(w io.Writer, key []byte) *signingWriter {
+	return &signingWriter{w: w, key: key, sequence: uint64(time.Now().UnixNano())}
+}
+
+// Write numbers and tags p and writes it, reporting p as fully written
+// only if the whole signed message was
+func (s *signingWriter) Write(p []byte) (int, error) {
+	signed := append(make([]byte, 0, len(p)+ControlSequenceSize+AuthTagSize), p...)
+	signed = binary.LittleEndian.AppendUint64(signed, atomic.AddUint64(&s.sequence, 1))
+	signed = appendAuthTag(s.key, signed)
+	n, err := s.w.Write(signed)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(signed) {
+		return min(n, len(p)), nil
+	}
+	return len(p), nil
+}
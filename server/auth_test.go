@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// TestAuthTag tests that a tagged datagram verifies, and that a tampered
+// payload or a tag made with another key doesn't
+func TestAuthTag(t *testing.T) {
+	key := []byte("s3cret")
+	packet := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	tagged := appendAuthTag(key, append([]byte(nil), packet...))
+	if len(tagged) != len(packet)+AuthTagSize {
+		t.Fatalf("tagged datagram is %d bytes, want %d", len(tagged), len(packet)+AuthTagSize)
+	}
+
+	body, err := checkAuthTag(key, tagged)
+	if err != nil || !bytes.Equal(body, packet) {
+		t.Fatalf("valid tag: got %v, %v", body, err)
+	}
+
+	tampered := append([]byte(nil), tagged...)
+	tampered[3] ^= 0xFF
+	if _, err := checkAuthTag(key, tampered); err != errAuthFailed {
+		t.Errorf("tampered payload: got %v, want errAuthFailed", err)
+	}
+	if _, err := checkAuthTag([]byte("guess"), tagged); err != errAuthFailed {
+		t.Errorf("wrong key: got %v, want errAuthFailed", err)
+	}
+	if _, err := checkAuthTag(key, tagged[:AuthTagSize-1]); err == nil {
+		t.Error("expected a datagram shorter than a tag to fail")
+	}
+}
+
+// TestReceiverAuthenticatesAudio tests that with -psk only audio tagged
+// with the key reaches the jitter buffer and failures are counted
+func TestReceiverAuthenticatesAudio(t *testing.T) {
+	key := []byte("s3cret")
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	r.psk = key
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	r.HandleDatagram(addr, make([]byte, PacketSize))
+	r.HandleDatagram(addr, appendAuthTag([]byte("wrong"), make([]byte, PacketSize)))
+	if jb.GetBufferLevel() != 0 || r.AuthFailures() != 2 {
+		t.Fatalf("unauthenticated audio: level %d, %d failures; want 0 and 2", jb.GetBufferLevel(), r.AuthFailures())
+	}
+	r.HandleDatagram(addr, appendAuthTag(key, make([]byte, PacketSize)))
+	if jb.GetBufferLevel() != 1 {
+		t.Errorf("level %d after authenticated audio, want 1", jb.GetBufferLevel())
+	}
+}
+
+// TestSigningWriterTagsMessages tests that control messages are written
+// with an increasing sequence number and a tag the client can verify
+func TestSigningWriterTagsMessages(t *testing.T) {
+	var buf bytes.Buffer
+	w := newSigningWriter(&buf, []byte("s3cret"))
+	msg := encodeAck(AckMessage{Epoch: 1, Sequence: 2})
+	var last uint64
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		if n, err := w.Write(msg); err != nil || n != len(msg) {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+		body, err := checkAuthTag([]byte("s3cret"), buf.Bytes())
+		if err != nil || len(body) != len(msg)+ControlSequenceSize || !bytes.Equal(body[:len(msg)], msg) {
+			t.Fatalf("written message didn't verify: %v, %v", body, err)
+		}
+		sequence := binary.LittleEndian.Uint64(body[len(msg):])
+		if i > 0 && sequence != last+1 {
+			t.Errorf("sequence %d after %d, want consecutive numbers", sequence, last)
+		}
+		last = sequence
+	}
+}
+
+// TestReceiverAuthenticatesKeyExchange tests that with -psk an untagged
+// key exchange hello is dropped unanswered, while a tagged one is answered
+// with a tagged reply
+func TestReceiverAuthenticatesKeyExchange(t *testing.T) {
+	key := []byte("s3cret")
+	r := NewReceiver(NewJitterBuffer())
+	r.psk = key
+	r.sessionKeys = NewSessionKeys()
+	var replies [][]byte
+	r.reply = func(b []byte, _ *net.UDPAddr) (int, error) {
+		replies = append(replies, b)
+		return len(b), nil
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := encodeKeyExchange(KeyExchangeHello, private.PublicKey())
+
+	r.HandleDatagram(addr, hello)
+	if len(replies) != 0 || r.AuthFailures() != 1 {
+		t.Fatalf("untagged hello: %d replies, %d failures; want 0 and 1", len(replies), r.AuthFailures())
+	}
+	r.HandleDatagram(addr, appendAuthTag(key, append([]byte(nil), hello...)))
+	if len(replies) != 1 {
+		t.Fatalf("tagged hello: %d replies, want 1", len(replies))
+	}
+	reply, err := checkAuthTag(key, replies[0])
+	if err != nil {
+		t.Fatalf("reply not tagged: %v", err)
+	}
+	if msgType, _, err := decodeKeyExchange(reply); err != nil || msgType != KeyExchangeReply {
+		t.Errorf("reply type %d, err %v", msgType, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+// AutoPauseLevel is the peak sample level at or below which a buffer
+// counts as silent, about -72 dBFS, so dither and faint hiss still pause
+const AutoPauseLevel = 8
+
+// PauseAction is what the playback loop should do with the output stream
+type PauseAction int
+
+const (
+	PauseNone  PauseAction = iota // Keep the stream as it is
+	PauseStop                     // Stop the stream, silence has gone on long enough
+	PauseStart                    // Restart the stream, real audio is back
+)
+
+// AutoPause stops the output device after sustained silence and restarts
+// it when real audio returns. The first buffer after a pause is faded in
+// so the device doesn't start with a click; the stream is only stopped on
+// silence, so it needs no fade out.
+type AutoPause struct {
+	after  int // Silent buffers before stopping
+	silent int
+	paused bool
+	quiet  []int16 // Zeroed buffer the fade in starts from
+}
+
+// NewAutoPause creates an auto-pause stopping after the given number of
+// consecutive silent buffers
+func NewAutoPause(after int) *AutoPause {
+	return &AutoPause{after: after, quiet: make([]int16, FramesPerBuffer*Channels)}
+}
+
+// Observe looks at the next buffer to be played and returns what to do
+// with the stream before playing it. A buffer that resumes playback is
+// faded in place.
+func (a *AutoPause) Observe(buffer []int16) PauseAction {
+	silent := isQuietBuffer(buffer)
+	if a.paused {
+		if silent {
+			return PauseNone
+		}
+		a.paused = false
+		a.silent = 0
+		crossfade(buffer, a.quiet[:len(buffer)], buffer)
+		return PauseStart
+	}
+	if !silent {
+		a.silent = 0
+		return PauseNone
+	}
+	a.silent++
+	if a.silent >= a.after {
+		a.paused = true
+		return PauseStop
+	}
+	return PauseNone
+}
+
+// Paused reports whether the stream is stopped
+func (a *AutoPause) Paused() bool {
+	return a.paused
+}
+
+// isQuietBuffer reports whether every sample is within AutoPauseLevel of zero
+func isQuietBuffer(buffer []int16) bool {
+	for _, s := range buffer {
+		if s > AutoPauseLevel || s < -AutoPauseLevel {
+			return false
+		}
+	}
+	return true
+}
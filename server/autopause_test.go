@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+// TestAutoPauseStopsAndRestarts tests that the auto-pause stops the stream
+// after the silence threshold and restarts it on the next real buffer,
+// fading that buffer in
+func TestAutoPauseStopsAndRestarts(t *testing.T) {
+	a := NewAutoPause(3)
+	quiet := make([]int16, FramesPerBuffer*Channels)
+	for i := range quiet {
+		quiet[i] = AutoPauseLevel // Faint hiss still counts as silence
+	}
+	for i := 0; i < 2; i++ {
+		if action := a.Observe(quiet); action != PauseNone {
+			t.Fatalf("silent buffer %d: got action %v, want none", i, action)
+		}
+	}
+	if action := a.Observe(quiet); action != PauseStop {
+		t.Fatalf("third silent buffer: got action %v, want stop", action)
+	}
+	if !a.Paused() {
+		t.Fatal("not paused after the silence threshold")
+	}
+	if action := a.Observe(quiet); action != PauseNone || !a.Paused() {
+		t.Fatalf("silence while paused: got action %v, paused %v", action, a.Paused())
+	}
+
+	loud := make([]int16, FramesPerBuffer*Channels)
+	for i := range loud {
+		loud[i] = 10000
+	}
+	if action := a.Observe(loud); action != PauseStart {
+		t.Fatalf("real audio while paused: got action %v, want start", action)
+	}
+	if a.Paused() {
+		t.Fatal("still paused after real audio")
+	}
+	if loud[0] != 0 || loud[len(loud)-1] <= loud[len(loud)/2] {
+		t.Errorf("resumed buffer not faded in: first %d, middle %d, last %d", loud[0], loud[len(loud)/2], loud[len(loud)-1])
+	}
+}
+
+// TestAutoPauseAudioResetsCount tests that real audio before the threshold
+// restarts the silence count
+func TestAutoPauseAudioResetsCount(t *testing.T) {
+	a := NewAutoPause(2)
+	quiet := make([]int16, FramesPerBuffer*Channels)
+	loud := make([]int16, FramesPerBuffer*Channels)
+	loud[7] = -1000
+	a.Observe(quiet)
+	a.Observe(loud)
+	if action := a.Observe(quiet); action != PauseNone {
+		t.Fatalf("got action %v after audio reset the count, want none", action)
+	}
+	if action := a.Observe(quiet); action != PauseStop {
+		t.Fatalf("got action %v, want stop", action)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "net"
+
+// DefaultReadBatchSize is the maximum number of datagrams read per syscall
+const DefaultReadBatchSize = 16
+
+// Datagram is a single received UDP packet
+type Datagram struct {
+	Buf  []byte // Receive buffer, must be allocated by the caller
+	N    int    // Number of bytes received into Buf
+	Addr *net.UDPAddr
+}
+
+// BatchReader reads one or more datagrams per call. ReadBatch blocks until at
+// least one datagram is available and returns the number of entries filled.
+type BatchReader interface {
+	ReadBatch(msgs []Datagram) (int, error)
+}
+
+// singleReader is the portable fallback that reads one datagram per call
+type singleReader struct {
+	conn *net.UDPConn
+}
+
+func (r *singleReader) ReadBatch(msgs []Datagram) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	n, addr, err := r.conn.ReadFromUDP(msgs[0].Buf)
+	if err != nil {
+		return 0, err
+	}
+	msgs[0].N = n
+	msgs[0].Addr = addr
+	return 1, nil
+}
+
+// NewBatchReader returns a reader that uses recvmmsg where the platform
+// supports it and falls back to ReadFromUDP elsewhere or when batchSize is 1
+func NewBatchReader(conn *net.UDPConn, batchSize int) BatchReader {
+	if batchSize > 1 {
+		if r := newPlatformBatchReader(conn, batchSize); r != nil {
+			return r
+		}
+	}
+	return &singleReader{conn: conn}
+}
@@ -0,0 +1,106 @@
+//go:build linux && (amd64 || arm64)
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// msgWaitForOne makes recvmmsg return as soon as one datagram has been received
+const msgWaitForOne = 0x10000
+
+// mmsghdr mirrors struct mmsghdr from <sys/socket.h>
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+}
+
+// mmsgReader reads datagrams in batches using recvmmsg(2)
+type mmsgReader struct {
+	raw   syscall.RawConn
+	hdrs  []mmsghdr
+	iovs  []syscall.Iovec
+	names []syscall.RawSockaddrAny
+}
+
+func newPlatformBatchReader(conn *net.UDPConn, batchSize int) BatchReader {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return &mmsgReader{
+		raw:   raw,
+		hdrs:  make([]mmsghdr, batchSize),
+		iovs:  make([]syscall.Iovec, batchSize),
+		names: make([]syscall.RawSockaddrAny, batchSize),
+	}
+}
+
+func (r *mmsgReader) ReadBatch(msgs []Datagram) (int, error) {
+	count := len(msgs)
+	if count > len(r.hdrs) {
+		count = len(r.hdrs)
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	for i := 0; i < count; i++ {
+		r.iovs[i].Base = &msgs[i].Buf[0]
+		r.iovs[i].SetLen(len(msgs[i].Buf))
+		r.hdrs[i] = mmsghdr{}
+		r.hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&r.names[i]))
+		r.hdrs[i].hdr.Namelen = syscall.SizeofSockaddrAny
+		r.hdrs[i].hdr.Iov = &r.iovs[i]
+		r.hdrs[i].hdr.Iovlen = 1
+	}
+
+	var received int
+	var opErr error
+	err := r.raw.Read(func(fd uintptr) bool {
+		n, _, errno := syscall.Syscall6(syscall.SYS_RECVMMSG, fd,
+			uintptr(unsafe.Pointer(&r.hdrs[0])), uintptr(count), msgWaitForOne, 0, 0)
+		if errno == syscall.EAGAIN || errno == syscall.EWOULDBLOCK {
+			return false // Wait for the socket to become readable
+		}
+		if errno != 0 {
+			opErr = errno
+			return true
+		}
+		received = int(n)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if opErr != nil {
+		return 0, opErr
+	}
+
+	for i := 0; i < received; i++ {
+		msgs[i].N = int(r.hdrs[i].len)
+		msgs[i].Addr = sockaddrToUDPAddr(&r.names[i])
+	}
+	return received, nil
+}
+
+// sockaddrToUDPAddr converts a raw IPv4 or IPv6 socket address
+func sockaddrToUDPAddr(sa *syscall.RawSockaddrAny) *net.UDPAddr {
+	switch sa.Addr.Family {
+	case syscall.AF_INET:
+		in4 := (*syscall.RawSockaddrInet4)(unsafe.Pointer(sa))
+		port := (*[2]byte)(unsafe.Pointer(&in4.Port))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, in4.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(port[:]))}
+	case syscall.AF_INET6:
+		in6 := (*syscall.RawSockaddrInet6)(unsafe.Pointer(sa))
+		port := (*[2]byte)(unsafe.Pointer(&in6.Port))
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, in6.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(port[:]))}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !(linux && (amd64 || arm64))
+
+package main
+
+import "net"
+
+// newPlatformBatchReader is unavailable on this platform
+func newPlatformBatchReader(conn *net.UDPConn, batchSize int) BatchReader {
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// newLoopbackPair opens a listening UDP socket and a client connected to it
+func newLoopbackPair(t testing.TB) (*net.UDPConn, *net.UDPConn) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	client, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	return server, client
+}
+
+// sequencedPacket builds a bare-sequence packet whose first sample carries seq
+func sequencedPacket(seq uint32) []byte {
+	packet := make([]byte, PacketSize+SequenceSize)
+	binary.LittleEndian.PutUint32(packet, seq)
+	binary.LittleEndian.PutUint16(packet[SequenceSize:], uint16(seq))
+	return packet
+}
+
+// TestBatchReaderDeliversInOrder tests that the batch-processing path delivers all packets in order
+func TestBatchReaderDeliversInOrder(t *testing.T) {
+	for _, batchSize := range []int{1, DefaultReadBatchSize} {
+		server, client := newLoopbackPair(t)
+		jb := NewJitterBuffer()
+		reader := NewBatchReader(server, batchSize)
+		msgs := make([]Datagram, batchSize)
+
+		const packets = 40
+		for i := uint32(0); i < packets; i++ {
+			if _, err := client.Write(sequencedPacket(i)); err != nil {
+				t.Fatalf("Failed to send packet %d: %v", i, err)
+			}
+		}
+
+		server.SetReadDeadline(time.Now().Add(2 * time.Second))
+		received := 0
+		for received < packets {
+			count, err := readBatch(reader, msgs, NewReceiver(jb))
+			if err != nil {
+				t.Fatalf("batch size %d: read failed after %d packets: %v", batchSize, received, err)
+			}
+			if count > batchSize {
+				t.Fatalf("batch size %d: read returned %d datagrams", batchSize, count)
+			}
+			received += count
+		}
+
+		for i := uint32(0); i < packets; i++ {
+			packet, ok := jb.GetPacket()
+			if !ok {
+				t.Fatalf("batch size %d: expected packet %d", batchSize, i)
+			}
+			if got := binary.LittleEndian.Uint16(packet); got != uint16(i) {
+				t.Errorf("batch size %d: expected packet %d, got %d", batchSize, i, got)
+			}
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+// TestBatchReaderSourceAddress tests that the sender address is reported for each datagram
+func TestBatchReaderSourceAddress(t *testing.T) {
+	server, client := newLoopbackPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	client.Write([]byte("hello"))
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	msgs := []Datagram{{Buf: make([]byte, 64)}, {Buf: make([]byte, 64)}}
+	count, err := NewBatchReader(server, len(msgs)).ReadBatch(msgs)
+	if err != nil || count != 1 {
+		t.Fatalf("expected 1 datagram, got %d (err: %v)", count, err)
+	}
+	if got := string(msgs[0].Buf[:msgs[0].N]); got != "hello" {
+		t.Errorf("expected payload %q, got %q", "hello", got)
+	}
+	if msgs[0].Addr == nil || msgs[0].Addr.String() != client.LocalAddr().String() {
+		t.Errorf("expected source %s, got %v", client.LocalAddr(), msgs[0].Addr)
+	}
+}
+
+// benchmarkBatchReader measures receive throughput for the given batch size
+func benchmarkBatchReader(b *testing.B, batchSize int) {
+	server, client := newLoopbackPair(b)
+	defer server.Close()
+	defer client.Close()
+	server.SetReadBuffer(4 << 20)
+
+	reader := NewBatchReader(server, batchSize)
+	msgs := make([]Datagram, batchSize)
+	for i := range msgs {
+		msgs[i].Buf = make([]byte, MaxDatagramSize)
+	}
+	packet := sequencedPacket(0)
+
+	b.SetBytes(int64(len(packet)))
+	b.ResetTimer()
+	for sent := 0; sent < b.N; {
+		// Send a burst no larger than the socket buffer, then drain it
+		burst := 64
+		if b.N-sent < burst {
+			burst = b.N - sent
+		}
+		for i := 0; i < burst; i++ {
+			client.Write(packet)
+		}
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		for got := 0; got < burst; {
+			count, err := reader.ReadBatch(msgs)
+			if err != nil {
+				b.Fatalf("read failed: %v", err)
+			}
+			got += count
+		}
+		sent += burst
+	}
+}
+
+func BenchmarkReadSingle(b *testing.B) { benchmarkBatchReader(b, 1) }
+func BenchmarkReadBatch(b *testing.B)  { benchmarkBatchReader(b, DefaultReadBatchSize) }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// OutputClock decides when the playback loop produces its next buffer
+type OutputClock interface {
+	// Wait blocks until the next buffer is due
+	Wait()
+}
+
+// ClockKind selects the playback loop's OutputClock
+type ClockKind string
+
+const (
+	// ClockDevice leaves pacing to stream.Write, which blocks until the
+	// device has room for another buffer
+	ClockDevice ClockKind = "device"
+	// ClockSoftware ticks once per buffer at the sample rate, for outputs
+	// with no device to block on
+	ClockSoftware ClockKind = "software"
+)
+
+// parseClockKind validates an -output-clock flag value
+func parseClockKind(s string) (ClockKind, error) {
+	switch kind := ClockKind(s); kind {
+	case ClockDevice, ClockSoftware:
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown clock %q (expected %q or %q)", s, ClockDevice, ClockSoftware)
+}
+
+// deviceClock never waits; the blocking device write is the clock
+type deviceClock struct{}
+
+func (deviceClock) Wait() {}
+
+// TickerClock is a software clock ticking once per buffer
+type TickerClock struct {
+	ticker   *time.Ticker
+	interval time.Duration
+}
+
+// NewTickerClock creates a clock ticking every PacketDuration, the playback
+// time of one buffer at the configured sample rate
+func NewTickerClock() *TickerClock {
+	return &TickerClock{ticker: time.NewTicker(PacketDuration), interval: PacketDuration}
+}
+
+// Wait blocks until the next tick. Ticks missed while the loop was busy
+// are dropped rather than delivered in a burst.
+func (c *TickerClock) Wait() {
+	<-c.ticker.C
+}
+
+// Interval returns the time between ticks
+func (c *TickerClock) Interval() time.Duration {
+	return c.interval
+}
+
+// Stop stops the clock ticking
+func (c *TickerClock) Stop() {
+	c.ticker.Stop()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseClockKind tests that only the known clocks are accepted
+func TestParseClockKind(t *testing.T) {
+	for _, s := range []string{"device", "software"} {
+		if kind, err := parseClockKind(s); err != nil || string(kind) != s {
+			t.Errorf("%s: expected it accepted, got %q (%v)", s, kind, err)
+		}
+	}
+	if _, err := parseClockKind("ticker"); err == nil {
+		t.Error("expected an unknown clock to be rejected")
+	}
+}
+
+// TestTickerClockInterval tests that the software clock ticks once per
+// buffer at the interval derived from the sample rate
+func TestTickerClockInterval(t *testing.T) {
+	t.Cleanup(func() { setStreamParams(defaultStreamParams) })
+	setStreamParams(StreamParams{SampleRate: 16000, Channels: 1, FramesPerBuffer: 80, BytesPerSample: 2})
+
+	clock := NewTickerClock()
+	defer clock.Stop()
+	if clock.Interval() != 5*time.Millisecond {
+		t.Fatalf("expected 80 frames at 16kHz to tick every 5ms, got %v", clock.Interval())
+	}
+
+	const ticks = 20
+	start := time.Now()
+	for i := 0; i < ticks; i++ {
+		clock.Wait()
+	}
+	elapsed := time.Since(start)
+	if elapsed < (ticks-1)*clock.Interval() || elapsed > 4*ticks*clock.Interval() {
+		t.Errorf("expected %d ticks to take about %v, took %v", ticks, ticks*clock.Interval(), elapsed)
+	}
+}
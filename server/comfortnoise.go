@@ -0,0 +1,35 @@
+package main
+
+import "math/rand"
+
+// MaxComfortNoiseLevel caps comfort noise at roughly -40 dBFS
+const MaxComfortNoiseLevel = 328
+
+// generateComfortNoise fills dst with uniform noise in [-level, level]
+func generateComfortNoise(dst []int16, level int, rng *rand.Rand) {
+	for i := range dst {
+		dst[i] = int16(rng.Intn(2*level+1) - level)
+	}
+}
+
+// crossfade writes a linear fade from one buffer into another into dst.
+// dst may alias either input.
+func crossfade(dst, from, to []int16) {
+	crossfadeFrames(dst, from, to, len(dst)/Channels)
+}
+
+// crossfadeFrames overlap-adds from and to into dst with a linear fade over
+// the first frames frames, then copies the rest of to. dst may alias either input.
+func crossfadeFrames(dst, from, to []int16, frames int) {
+	if max := len(dst) / Channels; frames > max {
+		frames = max
+	}
+	for frame := 0; frame < frames; frame++ {
+		t := float64(frame) / float64(frames)
+		for ch := 0; ch < Channels; ch++ {
+			i := frame*Channels + ch
+			dst[i] = int16(float64(from[i])*(1-t) + float64(to[i])*t)
+		}
+	}
+	copy(dst[frames*Channels:], to[frames*Channels:])
+}
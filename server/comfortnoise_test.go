@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestComfortNoiseBounds tests the noise amplitude stays within the level and averages near zero
+func TestComfortNoiseBounds(t *testing.T) {
+	const level = 16
+	rng := rand.New(rand.NewSource(1))
+	noise := make([]int16, 48000*Channels)
+	generateComfortNoise(noise, level, rng)
+
+	var sum float64
+	for i, sample := range noise {
+		if sample < -level || sample > level {
+			t.Fatalf("sample %d out of bounds: %d", i, sample)
+		}
+		sum += float64(sample)
+	}
+	if mean := sum / float64(len(noise)); mean < -0.5 || mean > 0.5 {
+		t.Errorf("expected mean near zero, got %.3f", mean)
+	}
+}
+
+// TestComfortNoiseSeeded tests that the same seed reproduces the same noise
+func TestComfortNoiseSeeded(t *testing.T) {
+	a := make([]int16, 64)
+	b := make([]int16, 64)
+	generateComfortNoise(a, 16, rand.New(rand.NewSource(42)))
+	generateComfortNoise(b, 16, rand.New(rand.NewSource(42)))
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d differs for the same seed: %d vs %d", i, a[i], b[i])
+		}
+	}
+}
+
+// TestCrossfade tests the fade starts at the first buffer and ramps toward the second
+func TestCrossfade(t *testing.T) {
+	from := make([]int16, 8*Channels)
+	to := make([]int16, 8*Channels)
+	for i := range to {
+		to[i] = 1000
+	}
+	dst := make([]int16, len(to))
+	crossfade(dst, from, to)
+
+	if dst[0] != 0 {
+		t.Errorf("expected fade to start at the first buffer, got %d", dst[0])
+	}
+	for i := Channels; i < len(dst); i += Channels {
+		if dst[i] < dst[i-Channels] {
+			t.Errorf("expected non-decreasing ramp at frame %d: %d < %d", i/Channels, dst[i], dst[i-Channels])
+		}
+	}
+	if last := dst[len(dst)-1]; last < 800 {
+		t.Errorf("expected fade to approach the second buffer, got %d", last)
+	}
+}
+
+// TestCrossfadeFrames tests a ramp of the configured length between two known buffers
+func TestCrossfadeFrames(t *testing.T) {
+	const frames = 4
+	from := make([]int16, 8*Channels)
+	to := make([]int16, 8*Channels)
+	for i := range from {
+		from[i] = 1000
+		to[i] = -1000
+	}
+	dst := make([]int16, len(to))
+	crossfadeFrames(dst, from, to, frames)
+
+	want := []int16{1000, 500, 0, -500, -1000, -1000, -1000, -1000}
+	for frame, w := range want {
+		for ch := 0; ch < Channels; ch++ {
+			if got := dst[frame*Channels+ch]; got != w {
+				t.Errorf("frame %d channel %d: expected %d, got %d", frame, ch, w, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// DefaultConcealPackets is how many packets loss concealment fades the last
+// packet out over before falling back to silence
+const DefaultConcealPackets = 3
+
+// MaxConcealPackets bounds -conceal-packets; repeating a packet for longer
+// than this sounds like a stuck loop rather than a dropout
+const MaxConcealPackets = 10
+
+// SetConcealment sets how many packets ConcealLoss fades the last played
+// packet over (0 plays silence instead)
+func (jb *JitterBuffer) SetConcealment(packets int) {
+	jb.concealPackets = packets
+}
+
+// rememberPlayed keeps a copy of a packet about to be played so a loss
+// right after it can be concealed. Packets dropped rather than played must
+// not be passed in. Silent packets are skipped, so concealment repeats the
+// last real audio.
+func (jb *JitterBuffer) rememberPlayed(packet []byte) {
+	if jb.concealPackets == 0 || isSilentPacket(packet) {
+		return
+	}
+	jb.lastPlayed = append(jb.lastPlayed[:0], packet...)
+	jb.concealRun = 0
+}
+
+// ConcealLoss returns a packet to play in place of a missing one. The last
+// packet played is repeated with a gain falling linearly to zero over
+// concealPackets packets, which sounds far less abrupt than a drop straight
+// to silence; after that, or with nothing to repeat, it is silence. Either
+// way the packet counts as a silence packet, and repeats also count as
+// concealed. The returned slice is reused and must not be kept.
+func (jb *JitterBuffer) ConcealLoss() []byte {
+	if len(jb.lastPlayed) == 0 || jb.concealRun >= jb.concealPackets {
+		return jb.InsertSilencePacket()
+	}
+	jb.InsertSilencePacket()
+	atomic.AddInt64(&jb.stats.concealedPackets, 1)
+	if len(jb.concealed) != len(jb.lastPlayed) {
+		jb.concealed = make([]byte, len(jb.lastPlayed))
+	}
+	// Each packet continues the fade where the previous one stopped
+	frames := len(jb.lastPlayed) / (Channels * 2)
+	total := float64(jb.concealPackets * frames)
+	start := jb.concealRun * frames
+	for frame := 0; frame < frames; frame++ {
+		gain := 1 - float64(start+frame+1)/total
+		for ch := 0; ch < Channels; ch++ {
+			i := (frame*Channels + ch) * 2
+			sample := int16(binary.LittleEndian.Uint16(jb.lastPlayed[i:]))
+			binary.LittleEndian.PutUint16(jb.concealed[i:], uint16(int16(float64(sample)*gain)))
+		}
+	}
+	jb.concealRun++
+	return jb.concealed
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestConcealLossFadesLastPacket tests that underflows repeat the last
+// packet played under a gain falling to zero, then fall back to silence
+func TestConcealLossFadesLastPacket(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetConcealment(2)
+	packet := make([]byte, PacketSize)
+	for i := 0; i < len(packet); i += 2 {
+		binary.LittleEndian.PutUint16(packet[i:], 10000)
+	}
+	jb.AddPacket(packet)
+	played, ok := jb.GetPacket()
+	if !ok {
+		t.Fatal("expected the packet back")
+	}
+	jb.rememberPlayed(played)
+	packet[0] = 0 // The buffer keeps its own copy
+
+	sample := func(p []byte, frame int) int16 {
+		return int16(binary.LittleEndian.Uint16(p[frame*Channels*2:]))
+	}
+	first := jb.ConcealLoss()
+	if got := sample(first, 0); got < 9900 || got >= 10000 {
+		t.Errorf("expected the first concealed frame just under full level, got %d", got)
+	}
+	middle := sample(first, FramesPerBuffer-1)
+	if middle < 4900 || middle > 5100 {
+		t.Errorf("expected the first concealed packet to end at half level, got %d", middle)
+	}
+	second := jb.ConcealLoss()
+	if got := sample(second, 0); got > middle {
+		t.Errorf("expected the second packet to continue the fade below %d, got %d", middle, got)
+	}
+	if got := sample(second, FramesPerBuffer-1); got != 0 {
+		t.Errorf("expected the fade to reach zero, got %d", got)
+	}
+	if !isSilentPacket(jb.ConcealLoss()) {
+		t.Error("expected silence once the fade is over")
+	}
+
+	stats := jb.GetStats()
+	if stats.concealedPackets != 2 || stats.silencePackets != 3 {
+		t.Errorf("expected 2 concealed of 3 silence packets, got %d of %d", stats.concealedPackets, stats.silencePackets)
+	}
+}
+
+// TestConcealLossDisabled tests that with concealment off, or nothing yet
+// played, underflows are silent
+func TestConcealLossDisabled(t *testing.T) {
+	jb := NewJitterBuffer()
+	if !isSilentPacket(jb.ConcealLoss()) {
+		t.Error("expected silence with nothing played yet")
+	}
+
+	jb.SetConcealment(0)
+	packet := make([]byte, PacketSize)
+	packet[0] = 1
+	jb.AddPacket(packet)
+	played, _ := jb.GetPacket()
+	jb.rememberPlayed(played)
+	if !isSilentPacket(jb.ConcealLoss()) {
+		t.Error("expected silence with concealment disabled")
+	}
+	if stats := jb.GetStats(); stats.concealedPackets != 0 {
+		t.Errorf("expected nothing concealed, got %d", stats.concealedPackets)
+	}
+}
+
+// TestConcealLossRepeatsPlayedPacket tests that concealment repeats the last
+// packet the player played, not one taken from the buffer and dropped
+func TestConcealLossRepeatsPlayedPacket(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetTargets(2, 2, DefaultStabilizeAfter) // Play single packets as they arrive
+	jb.SetLevelSmoothing(1)
+	volume, _ := NewVolume(1)
+	player := NewPlayer(jb, volume, VolumeCurveLinear)
+	player.waiting = false
+	level := func(sample int16) []byte {
+		packet := make([]byte, PacketSize)
+		for i := 0; i < len(packet); i += 2 {
+			binary.LittleEndian.PutUint16(packet[i:], uint16(sample))
+		}
+		return packet
+	}
+
+	jb.AddPacket(level(1000))
+	player.Fill(make([]int16, FramesPerBuffer*Channels))
+	// Drained without being played, as a resync or an overfull buffer does
+	jb.AddPacket(level(20000))
+	jb.GetPacket()
+
+	concealed := jb.ConcealLoss()
+	if got := int16(binary.LittleEndian.Uint16(concealed)); got < 900 || got > 1000 {
+		t.Errorf("expected the played packet repeated at about 1000, got %d", got)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Console runs operator commands against the running server. Commands come
+// from stdin or the HTTP control API and share one dispatcher.
+type Console struct {
+	volume         *Volume
+	clientControl  io.Writer // Nil without -client-control-addr
+	controlVersion int       // Control protocol version the client understands
+	jb             *JitterBuffer
+	receiver       *Receiver
+
+	mu          sync.Mutex
+	muted       bool
+	mutedVolume float64 // Volume to restore on unmute
+}
+
+// CommandResult is the outcome of a command
+type CommandResult struct {
+	OK      bool        `json:"ok"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// StatsData is the stats command's structured result
+type StatsData struct {
+	Level       int     `json:"level"`
+	Underflows  int64   `json:"underflows"`
+	Overflows   int64   `json:"overflows"`
+	Silence     int64   `json:"silence"`
+	Total       int64   `json:"total"`
+	LossPercent float64 `json:"loss_percent"`
+	JitterMs    float64 `json:"jitter_ms"`
+}
+
+// consoleHelp lists the commands handleCommand understands
+const consoleHelp = "Commands: volume <0.0-1.0> (client volume), server-volume <0.0-1.0>, mute, unmute, stats, clients, help"
+
+// handleCommand runs one command line and returns its result. A bare
+// number sets the client volume, as the console always has.
+func (c *Console) handleCommand(line string) CommandResult {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return failed(errors.New("empty command"))
+	}
+	if _, err := strconv.ParseFloat(fields[0], 64); err == nil {
+		fields = append([]string{"volume"}, fields...)
+	}
+	command, args := strings.ToLower(fields[0]), fields[1:]
+
+	switch command {
+	case "volume":
+		v, err := parseVolumeArg(args)
+		if err != nil {
+			return failed(err)
+		}
+		if err := c.sendClientVolume(v); err != nil {
+			return failed(err)
+		}
+		return CommandResult{OK: true, Message: fmt.Sprintf("Sent client volume: %.2f", v)}
+	case "server-volume":
+		v, err := parseVolumeArg(args)
+		if err != nil {
+			return failed(err)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.muted {
+			c.mutedVolume = v
+			return CommandResult{OK: true, Message: fmt.Sprintf("Server volume %.2f will apply when unmuted", v)}
+		}
+		c.volume.SetVolume(v)
+		return CommandResult{OK: true, Message: fmt.Sprintf("Server volume: %.2f", v)}
+	case "mute":
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.muted {
+			c.muted = true
+			c.mutedVolume = c.volume.GetVolume()
+			c.volume.SetVolume(0)
+		}
+		return CommandResult{OK: true, Message: "Muted"}
+	case "unmute":
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.muted {
+			c.muted = false
+			c.volume.SetVolume(c.mutedVolume)
+		}
+		return CommandResult{OK: true, Message: fmt.Sprintf("Unmuted, server volume %.2f", c.volume.GetVolume())}
+	case "stats":
+		stats := c.jb.GetStats()
+		arrivals := c.receiver.arrivals.Snapshot()
+		data := StatsData{
+			Level:       c.jb.GetBufferLevel(),
+			Underflows:  stats.underflows,
+			Overflows:   stats.overflows,
+			Silence:     stats.silencePackets,
+			Total:       stats.totalPackets,
+			LossPercent: arrivals.LossPercent(),
+			JitterMs:    float64(arrivals.jitter) / float64(time.Millisecond),
+		}
+		return CommandResult{OK: true, Data: data, Message: fmt.Sprintf(
+			"Level: %d, Underflows: %d, Overflows: %d, Silence: %d, Total: %d, Loss: %.2f%%, Jitter: %.3fms",
+			data.Level, data.Underflows, data.Overflows, data.Silence, data.Total, data.LossPercent, data.JitterMs)}
+	case "clients":
+		if c.receiver.mixer != nil {
+			return mixedClients(c.receiver.mixer.ActiveSources())
+		}
+		clients := c.receiver.sources.List()
+		message := "No clients"
+		if len(clients) > 0 {
+			message = "Clients: " + strings.Join(clients, ", ")
+		}
+		return CommandResult{OK: true, Message: message, Data: clients}
+	case "help":
+		return CommandResult{OK: true, Message: consoleHelp}
+	}
+	return failed(fmt.Errorf("unknown command %q. %s", command, consoleHelp))
+}
+
+// mixedClients reports the clients being mixed with their stats
+func mixedClients(sources []SourceStats) CommandResult {
+	if len(sources) == 0 {
+		return CommandResult{OK: true, Message: "No clients", Data: sources}
+	}
+	lines := make([]string, len(sources))
+	for i, s := range sources {
+		lines[i] = fmt.Sprintf("%s - Packets: %d, Loss: %.2f%%, Gain: %.2f, Last seen %v ago",
+			s.Addr, s.Packets, s.LossPercent, s.Gain, time.Since(s.LastSeen).Truncate(time.Millisecond))
+	}
+	return CommandResult{OK: true, Message: "Clients:\n" + strings.Join(lines, "\n"), Data: sources}
+}
+
+// failed wraps an error as a command result
+func failed(err error) CommandResult {
+	return CommandResult{Message: err.Error()}
+}
+
+// parseVolumeArg parses the single volume argument of a command
+func parseVolumeArg(args []string) (float64, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected one volume between 0.0 and 1.0")
+	}
+	v, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || v < 0.0 || v > 1.0 {
+		return 0, fmt.Errorf("invalid volume %q, expected a number between 0.0 and 1.0", args[0])
+	}
+	return v, nil
+}
+
+// sendClientVolume sends a volume control message to the client
+func (c *Console) sendClientVolume(v float64) error {
+	if c.clientControl == nil {
+		return errors.New("no client control address configured (use -client-control-addr)")
+	}
+	msg, err := encodeVolumeControl(c.controlVersion, v)
+	if err != nil {
+		return fmt.Errorf("encoding volume: %v", err)
+	}
+	if _, err := c.clientControl.Write(msg); err != nil {
+		return fmt.Errorf("sending client volume control: %v", err)
+	}
+	return nil
+}
+
+// RunAcks sends the client an AckMessage every interval until stop is closed
+func (c *Console) RunAcks(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ack, ok := currentAck(c.jb, c.receiver.arrivals)
+			if !ok {
+				continue
+			}
+			if _, err := c.clientControl.Write(encodeAck(ack)); err != nil {
+				log.Printf("Error sending ack: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Run reads commands from r, one per line, and prints their results to w
+// until r is exhausted
+func (c *Console) Run(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	fmt.Fprint(w, "> ")
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fmt.Fprintln(w, c.handleCommand(line).Message)
+		}
+		fmt.Fprint(w, "> ")
+	}
+}
+
+// List returns the known sources in order
+func (st *SourceTracker) List() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sources := make([]string, 0, len(st.lastSeen))
+	for key := range st.lastSeen {
+		sources = append(sources, key)
+	}
+	sort.Strings(sources)
+	return sources
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestConsole creates a console with a recording client control connection
+func newTestConsole(t *testing.T) (*Console, *bytes.Buffer) {
+	t.Helper()
+	volume, _ := NewVolume(0.8)
+	jb := NewJitterBuffer()
+	control := &bytes.Buffer{}
+	return &Console{volume: volume, clientControl: control, jb: jb, receiver: NewReceiver(jb)}, control
+}
+
+// TestConsoleClientVolume tests that volume commands send a control message
+func TestConsoleClientVolume(t *testing.T) {
+	for _, line := range []string{"volume 0.25", "0.25"} {
+		c, control := newTestConsole(t)
+		if result := c.handleCommand(line); !result.OK {
+			t.Fatalf("%q: unexpected failure: %s", line, result.Message)
+		}
+		if got := math.Float64frombits(binary.LittleEndian.Uint64(control.Bytes())); got != 0.25 {
+			t.Errorf("%q: expected 0.25 sent to the client, got %v", line, got)
+		}
+	}
+
+	c, _ := newTestConsole(t)
+	c.clientControl = nil
+	if result := c.handleCommand("volume 0.5"); result.OK {
+		t.Error("expected client volume to fail without a control address")
+	}
+}
+
+// TestConsoleMute tests that mute silences the server and unmute restores the volume
+func TestConsoleMute(t *testing.T) {
+	c, _ := newTestConsole(t)
+	c.handleCommand("mute")
+	if v := c.volume.GetVolume(); v != 0 {
+		t.Errorf("expected muted volume 0, got %v", v)
+	}
+	// Volume changes while muted apply on unmute
+	c.handleCommand("server-volume 0.5")
+	if v := c.volume.GetVolume(); v != 0 {
+		t.Errorf("expected to stay muted, got %v", v)
+	}
+	c.handleCommand("unmute")
+	if v := c.volume.GetVolume(); v != 0.5 {
+		t.Errorf("expected volume 0.5 after unmute, got %v", v)
+	}
+}
+
+// TestConsoleErrors tests that bad commands fail with a message
+func TestConsoleErrors(t *testing.T) {
+	c, _ := newTestConsole(t)
+	for _, line := range []string{"", "server-volume 2", "server-volume", "volume abc", "reboot"} {
+		if result := c.handleCommand(line); result.OK || result.Message == "" {
+			t.Errorf("%q: expected a failure with a message, got %+v", line, result)
+		}
+	}
+}
+
+// TestConsoleStatsAndClients tests the structured results of the query commands
+func TestConsoleStatsAndClients(t *testing.T) {
+	c, _ := newTestConsole(t)
+	c.receiver.HandleDatagram(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, make([]byte, PacketSize))
+
+	stats := c.handleCommand("stats")
+	if data, ok := stats.Data.(StatsData); !ok || data.Level != 1 || data.Total != 1 {
+		t.Errorf("expected stats for one buffered packet, got %+v", stats.Data)
+	}
+	clients := c.handleCommand("clients")
+	if list, ok := clients.Data.([]string); !ok || len(list) != 1 || list[0] != "10.0.0.1:5000" {
+		t.Errorf("expected one client, got %+v", clients.Data)
+	}
+}
+
+// TestConsoleClientsWhenMixing tests that the clients command reports each
+// mixed client's stats
+func TestConsoleClientsWhenMixing(t *testing.T) {
+	c, _ := newTestConsole(t)
+	c.receiver.mixer = newTestMixer(time.Minute)
+	c.receiver.HandleDatagram(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, sequencedPacket(0))
+
+	clients := c.handleCommand("clients")
+	sources, ok := clients.Data.([]SourceStats)
+	if !ok || len(sources) != 1 || sources[0].Addr != "10.0.0.1:5000" || sources[0].Packets != 1 {
+		t.Errorf("expected one mixed client, got %+v", clients.Data)
+	}
+	if !strings.Contains(clients.Message, "10.0.0.1:5000 - Packets: 1") {
+		t.Errorf("unexpected message %q", clients.Message)
+	}
+}
+
+// TestConsoleRun tests that stdin lines are dispatched and answered
+func TestConsoleRun(t *testing.T) {
+	c, _ := newTestConsole(t)
+	var out bytes.Buffer
+	c.Run(strings.NewReader("mute\nbogus\n"), &out)
+	if !strings.Contains(out.String(), "Muted") || !strings.Contains(out.String(), "unknown command") {
+		t.Errorf("unexpected console output %q", out.String())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Control messages to the client come in two versions. v0 is a bare
+// little-endian float64 volume, understood by every client. v1 frames carry
+// a type and length so more controls fit:
+//
+//	'A' 'C' version(1) type length(uint16 LE) payload
+const (
+	ControlMagic0     = 'A'
+	ControlMagic1     = 'C'
+	ControlVersion    = 1
+	ControlHeaderSize = 6
+)
+
+// Control message types
+const (
+	ControlVolume = 1 // Payload is a little-endian float64 volume
+	ControlAck    = 2 // Payload is an AckMessage
+)
+
+// DefaultAckInterval is how often the server acknowledges delivered packets
+const DefaultAckInterval = time.Second
+
+// AckMessage tells the client how far its stream has been delivered, so it
+// can free its send history, and how much of it arrived, so it can
+// estimate loss. All fields are little-endian uint32s, in order.
+type AckMessage struct {
+	Epoch    uint32
+	Sequence uint32 // Highest sequence delivered in order
+	Expected uint32 // Sequenced packets sent, judging by the highest received
+	Received uint32 // Sequenced packets received
+}
+
+// encodeAck frames an AckMessage as a v1 control message
+func encodeAck(ack AckMessage) []byte {
+	payload := make([]byte, 16)
+	binary.LittleEndian.PutUint32(payload[0:], ack.Epoch)
+	binary.LittleEndian.PutUint32(payload[4:], ack.Sequence)
+	binary.LittleEndian.PutUint32(payload[8:], ack.Expected)
+	binary.LittleEndian.PutUint32(payload[12:], ack.Received)
+	return encodeControlMessage(ControlAck, payload)
+}
+
+// currentAck builds the acknowledgment for the stream received so far, or
+// returns false if nothing has been delivered in order yet
+func currentAck(jb *JitterBuffer, arrivals *ArrivalStats) (AckMessage, bool) {
+	epoch, sequence, ok := jb.reorderBuffer.Delivered()
+	if !ok {
+		return AckMessage{}, false
+	}
+	snapshot := arrivals.Snapshot()
+	return AckMessage{
+		Epoch:    epoch,
+		Sequence: sequence,
+		Expected: uint32(snapshot.expected),
+		Received: uint32(snapshot.received),
+	}, true
+}
+
+// encodeControlMessage frames payload as a v1 control message of the given type
+func encodeControlMessage(msgType uint8, payload []byte) []byte {
+	b := make([]byte, ControlHeaderSize+len(payload))
+	b[0], b[1], b[2], b[3] = ControlMagic0, ControlMagic1, ControlVersion, msgType
+	binary.LittleEndian.PutUint16(b[4:6], uint16(len(payload)))
+	copy(b[ControlHeaderSize:], payload)
+	return b
+}
+
+// encodeVolumeControl encodes a volume control message in the given protocol version
+func encodeVolumeControl(version int, volume float64) ([]byte, error) {
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint64(payload, math.Float64bits(volume))
+	switch version {
+	case 0:
+		return payload, nil
+	case ControlVersion:
+		return encodeControlMessage(ControlVolume, payload), nil
+	}
+	return nil, fmt.Errorf("unknown control protocol version %d", version)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// TestEncodeVolumeControlVersions tests the v0 and v1 volume encodings
+func TestEncodeVolumeControlVersions(t *testing.T) {
+	v0, err := encodeVolumeControl(0, 0.75)
+	if err != nil || len(v0) != 8 || math.Float64frombits(binary.LittleEndian.Uint64(v0)) != 0.75 {
+		t.Errorf("expected a bare float64 for v0, got %v (%v)", v0, err)
+	}
+
+	v1, err := encodeVolumeControl(1, 0.75)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	header := []byte{'A', 'C', 1, ControlVolume, 8, 0}
+	if !bytes.Equal(v1[:ControlHeaderSize], header) || !bytes.Equal(v1[ControlHeaderSize:], v0) {
+		t.Errorf("expected header %v and the v0 payload, got %v", header, v1)
+	}
+
+	if _, err := encodeVolumeControl(7, 0.75); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
+
+// TestCurrentAck tests the acknowledgment of in-order delivery and arrivals
+func TestCurrentAck(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	if _, ok := currentAck(jb, r.arrivals); ok {
+		t.Error("expected no ack before anything is delivered")
+	}
+
+	// Packets 0-2 and 4 arrive; 3 is missing so delivery stops at 2
+	for _, seq := range []uint32{0, 1, 2, 4} {
+		packet := make([]byte, HeaderSize+PacketSize)
+		EncodeHeader(packet, PacketHeader{Epoch: 9, Sequence: seq})
+		r.HandleDatagram(nil, packet)
+	}
+	ack, ok := currentAck(jb, r.arrivals)
+	want := AckMessage{Epoch: 9, Sequence: 2, Expected: 5, Received: 4}
+	if !ok || ack != want {
+		t.Errorf("expected %+v, got %+v (ok %v)", want, ack, ok)
+	}
+
+	msg := encodeAck(want)
+	if len(msg) != ControlHeaderSize+16 || msg[3] != ControlAck {
+		t.Fatalf("expected a 16 byte ack frame, got %v", msg)
+	}
+	if seq := binary.LittleEndian.Uint32(msg[ControlHeaderSize+4:]); seq != 2 {
+		t.Errorf("expected acked sequence 2, got %d", seq)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ControlAPI serves console commands over HTTP to callers presenting the
+// bearer token:
+//
+//	POST /api/command  {"command": "server-volume 0.5"}
+//	GET  /api/stats
+//	GET  /api/clients
+//
+// Every response is a CommandResult as JSON.
+type ControlAPI struct {
+	console *Console
+	token   string
+}
+
+// commandRequest is the body of POST /api/command
+type commandRequest struct {
+	Command string `json:"command"`
+}
+
+// Handler returns the API's routes
+func (api *ControlAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/command", api.authorized(http.MethodPost, func(r *http.Request) (CommandResult, int) {
+		var req commandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return CommandResult{Message: "invalid request body: " + err.Error()}, http.StatusBadRequest
+		}
+		return api.console.handleCommand(req.Command), http.StatusOK
+	}))
+	mux.HandleFunc("/api/stats", api.authorized(http.MethodGet, func(r *http.Request) (CommandResult, int) {
+		return api.console.handleCommand("stats"), http.StatusOK
+	}))
+	mux.HandleFunc("/api/clients", api.authorized(http.MethodGet, func(r *http.Request) (CommandResult, int) {
+		return api.console.handleCommand("clients"), http.StatusOK
+	}))
+	return mux
+}
+
+// authorized checks the method and token before running handle, and writes
+// its result as JSON. Failed commands are reported with 422.
+func (api *ControlAPI) authorized(method string, handle func(*http.Request) (CommandResult, int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, status := api.serve(method, handle, r)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// serve authenticates and runs one request, returning its result and status
+func (api *ControlAPI) serve(method string, handle func(*http.Request) (CommandResult, int), r *http.Request) (CommandResult, int) {
+	token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !bearer || subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+		return CommandResult{Message: "unauthorized"}, http.StatusUnauthorized
+	}
+	if r.Method != method {
+		return CommandResult{Message: "method not allowed"}, http.StatusMethodNotAllowed
+	}
+	result, status := handle(r)
+	if status == http.StatusOK && !result.OK {
+		status = http.StatusUnprocessableEntity
+	}
+	return result, status
+}
+
+// startControlAPI serves the control API on addr in the background
+func startControlAPI(addr string, api *ControlAPI) {
+	go func() {
+		log.Printf("Control API listening on http://%s/api/", addr)
+		if err := http.ListenAndServe(addr, api.Handler()); err != nil {
+			log.Printf("Control API stopped: %v", err)
+		}
+	}()
+}
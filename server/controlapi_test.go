@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends a request to the control API and decodes the result
+func apiRequest(t *testing.T, api *ControlAPI, method, path, token, body string) (int, CommandResult) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	api.Handler().ServeHTTP(rec, req)
+	var result CommandResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return rec.Code, result
+}
+
+// TestControlAPICommands tests that the handlers invoke the right command
+func TestControlAPICommands(t *testing.T) {
+	c, _ := newTestConsole(t)
+	api := &ControlAPI{console: c, token: "secret"}
+
+	code, result := apiRequest(t, api, http.MethodPost, "/api/command", "secret", `{"command": "server-volume 0.3"}`)
+	if code != http.StatusOK || !result.OK || c.volume.GetVolume() != 0.3 {
+		t.Errorf("expected server volume 0.3, got %d %+v (volume %v)", code, result, c.volume.GetVolume())
+	}
+
+	code, result = apiRequest(t, api, http.MethodGet, "/api/stats", "secret", "")
+	if data, ok := result.Data.(map[string]interface{}); code != http.StatusOK || !ok || data["level"] != 0.0 {
+		t.Errorf("expected structured stats, got %d %+v", code, result)
+	}
+
+	code, result = apiRequest(t, api, http.MethodGet, "/api/clients", "secret", "")
+	if code != http.StatusOK || result.Message != "No clients" {
+		t.Errorf("expected an empty client list, got %d %+v", code, result)
+	}
+
+	code, result = apiRequest(t, api, http.MethodPost, "/api/command", "secret", `{"command": "reboot"}`)
+	if code != http.StatusUnprocessableEntity || result.OK {
+		t.Errorf("expected an unknown command to fail, got %d %+v", code, result)
+	}
+}
+
+// TestControlAPIRequiresToken tests that requests without the right token are refused
+func TestControlAPIRequiresToken(t *testing.T) {
+	c, _ := newTestConsole(t)
+	api := &ControlAPI{console: c, token: "secret"}
+
+	for _, token := range []string{"", "wrong"} {
+		code, _ := apiRequest(t, api, http.MethodPost, "/api/command", token, `{"command": "mute"}`)
+		if code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected 401, got %d", token, code)
+		}
+	}
+	// The token alone, or under another scheme, isn't accepted
+	for _, header := range []string{"secret", "Basic secret"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/command", strings.NewReader(`{"command": "mute"}`))
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		api.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", header, rec.Code)
+		}
+	}
+	if c.volume.GetVolume() == 0 {
+		t.Error("expected the unauthorized mute not to run")
+	}
+
+	if code, _ := apiRequest(t, api, http.MethodGet, "/api/command", "secret", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET /api/command, got %d", code)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// MaxSimulatedLatency bounds -simulate-latency; longer delays would hold
+// more packets than any jitter buffer setting can use
+const MaxSimulatedLatency = 10 * time.Second
+
+// delayedDatagram is a datagram held until due
+type delayedDatagram struct {
+	due    time.Time
+	addr   *net.UDPAddr
+	packet []byte
+}
+
+// DelayQueue holds received datagrams for a fixed delay before they are
+// handled, simulating a longer network path. Every datagram is delayed by
+// the same amount, so they are released in the order they arrived.
+type DelayQueue struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending []delayedDatagram
+
+	// Signalled (without blocking) when a datagram is pushed
+	wake chan struct{}
+}
+
+// NewDelayQueue creates an empty queue delaying datagrams by delay
+func NewDelayQueue(delay time.Duration) *DelayQueue {
+	return &DelayQueue{delay: delay, wake: make(chan struct{}, 1)}
+}
+
+// Push holds packet from addr, which arrived at now, until delay has passed.
+// The queue keeps packet, so the caller must not reuse it.
+func (q *DelayQueue) Push(now time.Time, addr *net.UDPAddr, packet []byte) {
+	q.mu.Lock()
+	q.pending = append(q.pending, delayedDatagram{due: now.Add(q.delay), addr: addr, packet: packet})
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pop removes the oldest datagram if it is due at now
+func (q *DelayQueue) Pop(now time.Time) (*net.UDPAddr, []byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 || q.pending[0].due.After(now) {
+		return nil, nil, false
+	}
+	d := q.pending[0]
+	q.pending[0] = delayedDatagram{} // Don't keep the packet alive once handled
+	q.pending = q.pending[1:]
+	return d.addr, d.packet, true
+}
+
+// Next returns when the oldest datagram is due, or false if none is held
+func (q *DelayQueue) Next() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return time.Time{}, false
+	}
+	return q.pending[0].due, true
+}
+
+// Len returns the number of datagrams held
+func (q *DelayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Run hands each datagram to handle once it is due, until stop is closed
+func (q *DelayQueue) Run(handle func(addr *net.UDPAddr, packet []byte), stop <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		for {
+			addr, packet, ok := q.Pop(time.Now())
+			if !ok {
+				break
+			}
+			handle(addr, packet)
+		}
+		wait := time.Hour
+		if due, ok := q.Next(); ok {
+			wait = time.Until(due)
+		}
+		timer.Reset(wait)
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		case <-stop:
+			return
+		}
+	}
+}
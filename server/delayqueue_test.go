@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestDelayQueueReleasesAfterDelay tests that datagrams are held for the
+// configured delay and released in arrival order
+func TestDelayQueueReleasesAfterDelay(t *testing.T) {
+	q := NewDelayQueue(50 * time.Millisecond)
+	start := time.Now()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	for i := 0; i < 3; i++ {
+		q.Push(start.Add(time.Duration(i)*10*time.Millisecond), addr, []byte{byte(i)})
+	}
+	if _, _, ok := q.Pop(start.Add(49 * time.Millisecond)); ok {
+		t.Fatal("datagram released before the delay")
+	}
+	if due, ok := q.Next(); !ok || !due.Equal(start.Add(50*time.Millisecond)) {
+		t.Fatalf("Next() = %v, %v, want %v", due, ok, start.Add(50*time.Millisecond))
+	}
+
+	// By 65ms the first two are due, not the third
+	for i := 0; i < 2; i++ {
+		from, packet, ok := q.Pop(start.Add(65 * time.Millisecond))
+		if !ok {
+			t.Fatalf("datagram %d not released", i)
+		}
+		if packet[0] != byte(i) || from != addr {
+			t.Errorf("released datagram %d from %v, want %d from %v", packet[0], from, i, addr)
+		}
+	}
+	if _, _, ok := q.Pop(start.Add(65 * time.Millisecond)); ok {
+		t.Fatal("third datagram released early")
+	}
+	if _, packet, ok := q.Pop(start.Add(80 * time.Millisecond)); !ok || packet[0] != 2 {
+		t.Fatalf("third datagram not released on time")
+	}
+	if q.Len() != 0 {
+		t.Errorf("%d datagrams left, want 0", q.Len())
+	}
+}
+
+// TestDelayQueueRun tests that Run hands datagrams on in order no sooner
+// than the delay
+func TestDelayQueueRun(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	q := NewDelayQueue(delay)
+	stop := make(chan struct{})
+	defer close(stop)
+	type release struct {
+		seq byte
+		at  time.Time
+	}
+	released := make(chan release, 10)
+	go q.Run(func(_ *net.UDPAddr, packet []byte) {
+		released <- release{packet[0], time.Now()}
+	}, stop)
+
+	pushed := time.Now()
+	for i := 0; i < 5; i++ {
+		q.Push(time.Now(), nil, []byte{byte(i)})
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case r := <-released:
+			if r.seq != byte(i) {
+				t.Fatalf("released datagram %d, want %d", r.seq, i)
+			}
+			if r.at.Sub(pushed) < delay {
+				t.Errorf("datagram %d released after %v, want at least %v", i, r.at.Sub(pushed), delay)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("datagram %d never released", i)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// StreamErrorKind classifies errors returned by PortAudio stream calls
+type StreamErrorKind int
+
+const (
+	StreamErrorNone StreamErrorKind = iota
+	StreamErrorUnderflow
+	StreamErrorOverflow
+	StreamErrorOther
+)
+
+// classifyStreamError separates device xruns from other stream errors
+func classifyStreamError(err error) StreamErrorKind {
+	if err == nil {
+		return StreamErrorNone
+	}
+	var paErr portaudio.Error
+	if errors.As(err, &paErr) {
+		switch paErr {
+		case portaudio.OutputUnderflowed:
+			return StreamErrorUnderflow
+		case portaudio.InputOverflowed:
+			return StreamErrorOverflow
+		}
+	}
+	return StreamErrorOther
+}
+
+// DeviceStats tracks xruns reported by the audio device, as opposed to the
+// jitter buffer's network-side statistics
+type DeviceStats struct {
+	underruns int64
+	overruns  int64
+	errors    int64
+}
+
+// Record counts a stream error by kind and returns its classification
+func (ds *DeviceStats) Record(err error) StreamErrorKind {
+	kind := classifyStreamError(err)
+	switch kind {
+	case StreamErrorUnderflow:
+		atomic.AddInt64(&ds.underruns, 1)
+	case StreamErrorOverflow:
+		atomic.AddInt64(&ds.overruns, 1)
+	case StreamErrorOther:
+		atomic.AddInt64(&ds.errors, 1)
+	}
+	return kind
+}
+
+// RecordFlags counts the xruns reported to an output stream callback
+func (ds *DeviceStats) RecordFlags(flags portaudio.StreamCallbackFlags) {
+	if flags&portaudio.OutputUnderflow != 0 {
+		atomic.AddInt64(&ds.underruns, 1)
+	}
+	if flags&portaudio.OutputOverflow != 0 {
+		atomic.AddInt64(&ds.overruns, 1)
+	}
+}
+
+// Snapshot returns a copy of the current device statistics
+func (ds *DeviceStats) Snapshot() DeviceStats {
+	return DeviceStats{
+		underruns: atomic.LoadInt64(&ds.underruns),
+		overruns:  atomic.LoadInt64(&ds.overruns),
+		errors:    atomic.LoadInt64(&ds.errors),
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// TestClassifyStreamError tests categorization of representative PortAudio errors
+func TestClassifyStreamError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected StreamErrorKind
+	}{
+		{"No Error", nil, StreamErrorNone},
+		{"Output Underflow", portaudio.OutputUnderflowed, StreamErrorUnderflow},
+		{"Input Overflow", portaudio.InputOverflowed, StreamErrorOverflow},
+		{"Wrapped Underflow", fmt.Errorf("write: %w", portaudio.OutputUnderflowed), StreamErrorUnderflow},
+		{"Device Unavailable", portaudio.DeviceUnavailable, StreamErrorOther},
+		{"Host Error", portaudio.UnanticipatedHostError{Text: "host failure"}, StreamErrorOther},
+		{"Generic Error", errors.New("boom"), StreamErrorOther},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if kind := classifyStreamError(tc.err); kind != tc.expected {
+				t.Errorf("expected kind %d, got %d", tc.expected, kind)
+			}
+		})
+	}
+}
+
+// TestDeviceStatsRecord tests that device xruns are counted by kind
+func TestDeviceStatsRecord(t *testing.T) {
+	var ds DeviceStats
+	ds.Record(portaudio.OutputUnderflowed)
+	ds.Record(portaudio.OutputUnderflowed)
+	ds.Record(portaudio.InputOverflowed)
+	ds.Record(errors.New("boom"))
+	ds.Record(nil)
+
+	stats := ds.Snapshot()
+	if stats.underruns != 2 || stats.overruns != 1 || stats.errors != 1 {
+		t.Errorf("unexpected device stats: %+v", stats)
+	}
+}
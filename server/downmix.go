@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// itu is the ITU-R BS.775 -3 dB coefficient for centre and surround channels
+const itu = 0.7071
+
+// downmixMatrices maps a source channel count to the left and right output
+// coefficients for each input channel. The LFE channel is dropped.
+var downmixMatrices = map[int][2][]float64{
+	// 5.1: L, R, C, LFE, Ls, Rs
+	6: {
+		{1, 0, itu, 0, itu, 0},
+		{0, 1, itu, 0, 0, itu},
+	},
+	// 7.1: L, R, C, LFE, Lb, Rb, Ls, Rs
+	8: {
+		{1, 0, itu, 0, itu, 0, itu, 0},
+		{0, 1, itu, 0, 0, itu, 0, itu},
+	},
+}
+
+// surroundPacketSize is the int16 payload size for a surround source
+func surroundPacketSize(channels int) int {
+	return FramesPerBuffer * channels * 2
+}
+
+// surroundChannels returns the source channel count for an int16 surround
+// payload of n bytes, or 0 if n is not a surround payload size. Surround is
+// only accepted when playing stereo, which the downmix produces.
+func surroundChannels(n int) int {
+	if Channels != 2 {
+		return 0
+	}
+	for channels := range downmixMatrices {
+		if n == surroundPacketSize(channels) {
+			return channels
+		}
+	}
+	return 0
+}
+
+// downmixToStereo mixes interleaved multichannel samples in src down to
+// interleaved stereo in dst, clipping to the int16 range
+func downmixToStereo(dst, src []int16, srcChannels int) error {
+	matrix, ok := downmixMatrices[srcChannels]
+	if !ok {
+		return fmt.Errorf("no downmix for %d channels", srcChannels)
+	}
+	frames := len(src) / srcChannels
+	if len(dst) < frames*Channels {
+		return fmt.Errorf("downmix output too small: %d samples for %d frames", len(dst), frames)
+	}
+	for frame := 0; frame < frames; frame++ {
+		in := src[frame*srcChannels : (frame+1)*srcChannels]
+		for out := 0; out < Channels; out++ {
+			var sum float64
+			for ch, coeff := range matrix[out] {
+				sum += coeff * float64(in[ch])
+			}
+			dst[frame*Channels+out] = clipInt16(sum)
+		}
+	}
+	return nil
+}
+
+// clipInt16 rounds and clamps a sample to the int16 range
+func clipInt16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// downmixPayload converts an int16 surround payload into a stereo payload
+func downmixPayload(payload []byte, srcChannels int) []byte {
+	src := make([]int16, len(payload)/2)
+	bytesToInt16(payload, src)
+	dst := make([]int16, len(src)/srcChannels*Channels)
+	downmixToStereo(dst, src, srcChannels)
+	out := make([]byte, len(dst)*2)
+	int16ToBytes(dst, out)
+	return out
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestDownmix51 tests the ITU coefficients on a known 5.1 frame
+func TestDownmix51(t *testing.T) {
+	// L, R, C, LFE, Ls, Rs
+	src := []int16{1000, 2000, 1000, 30000, 1000, -1000}
+	dst := make([]int16, 2)
+	if err := downmixToStereo(dst, src, 6); err != nil {
+		t.Fatalf("downmixToStereo failed: %v", err)
+	}
+
+	// Lo = 1000 + 0.7071*1000 + 0.7071*1000, Ro = 2000 + 0.7071*1000 - 0.7071*1000
+	if dst[0] != 2414 {
+		t.Errorf("expected left 2414, got %d", dst[0])
+	}
+	if dst[1] != 2000 {
+		t.Errorf("expected right 2000, got %d", dst[1])
+	}
+}
+
+// TestDownmix71 tests that back and side channels both reach their side's output
+func TestDownmix71(t *testing.T) {
+	// L, R, C, LFE, Lb, Rb, Ls, Rs
+	src := []int16{0, 0, 0, 0, 1000, 0, 0, 1000}
+	dst := make([]int16, 2)
+	if err := downmixToStereo(dst, src, 8); err != nil {
+		t.Fatalf("downmixToStereo failed: %v", err)
+	}
+	if dst[0] != 707 || dst[1] != 707 {
+		t.Errorf("expected 707/707, got %d/%d", dst[0], dst[1])
+	}
+}
+
+// TestDownmixClips tests that loud surround content is clipped rather than wrapped
+func TestDownmixClips(t *testing.T) {
+	src := []int16{32767, -32768, 32767, 0, 32767, -32768}
+	dst := make([]int16, 2)
+	downmixToStereo(dst, src, 6)
+	if dst[0] != 32767 || dst[1] != -32768 {
+		t.Errorf("expected clipped output 32767/-32768, got %d/%d", dst[0], dst[1])
+	}
+}
+
+// TestDownmixUnsupportedLayout tests that unknown channel counts are rejected
+func TestDownmixUnsupportedLayout(t *testing.T) {
+	if err := downmixToStereo(make([]int16, 2), make([]int16, 4), 4); err == nil {
+		t.Error("expected error for 4 channel source")
+	}
+}
+
+// TestSurroundPacketDownmixed tests a 5.1 packet is downmixed at ingest
+func TestSurroundPacketDownmixed(t *testing.T) {
+	packet := make([]byte, surroundPacketSize(6))
+	binary.LittleEndian.PutUint16(packet[4:], 1000) // First frame's centre channel
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, packet, binary.LittleEndian)
+
+	pcm, ok := jb.GetPacket()
+	if !ok {
+		t.Fatal("expected surround packet to be delivered")
+	}
+	if len(pcm) != PacketSize {
+		t.Fatalf("expected stereo packet length %d, got %d", PacketSize, len(pcm))
+	}
+	left := int16(binary.LittleEndian.Uint16(pcm))
+	right := int16(binary.LittleEndian.Uint16(pcm[2:]))
+	if left != 707 || right != 707 {
+		t.Errorf("expected centre to appear at 707 in both channels, got %d/%d", left, right)
+	}
+}
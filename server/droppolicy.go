@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// DropPolicy chooses which packet is discarded when the jitter buffer is full
+type DropPolicy string
+
+const (
+	// DropNewest discards the arriving packet, keeping what's already buffered
+	DropNewest DropPolicy = "newest"
+	// DropOldest evicts the packet due to play next so the freshest audio is kept
+	DropOldest DropPolicy = "oldest"
+)
+
+// parseDropPolicy validates a -drop-policy flag value
+func parseDropPolicy(s string) (DropPolicy, error) {
+	switch policy := DropPolicy(s); policy {
+	case DropNewest, DropOldest:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown drop policy %q (expected %q or %q)", s, DropNewest, DropOldest)
+}
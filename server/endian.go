@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// parseByteOrder validates an -endian flag value
+func parseByteOrder(s string) (binary.ByteOrder, error) {
+	switch s {
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("unknown byte order %q (expected little or big)", s)
+}
+
+// toLittleEndian returns payload with its sampleSize-byte samples in
+// little-endian order
+func toLittleEndian(payload []byte, order binary.ByteOrder, sampleSize int) []byte {
+	if order == binary.LittleEndian {
+		return payload
+	}
+	swapped := make([]byte, len(payload))
+	for i := 0; i+sampleSize <= len(payload); i += sampleSize {
+		for j := 0; j < sampleSize; j++ {
+			swapped[i+j] = payload[i+sampleSize-1-j]
+		}
+	}
+	return swapped
+}
+
+// payloadSampleSize returns the sample size of a single packet's payload.
+// Float32 payloads are recognised by their size and have 4-byte samples;
+// all others have 2. A coalesced datagram is always int16, however long.
+func payloadSampleSize(n int) int {
+	if n == Float32PacketSize {
+		return 4
+	}
+	return 2
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// TestParseByteOrder tests -endian parsing
+func TestParseByteOrder(t *testing.T) {
+	if order, err := parseByteOrder("big"); err != nil || order != binary.BigEndian {
+		t.Errorf("expected big endian, got %v, %v", order, err)
+	}
+	if order, err := parseByteOrder("little"); err != nil || order != binary.LittleEndian {
+		t.Errorf("expected little endian, got %v, %v", order, err)
+	}
+	if _, err := parseByteOrder("middle"); err == nil {
+		t.Error("expected an error for an unknown byte order")
+	}
+}
+
+// TestDecodeBigEndianPacket tests that a big-endian packet yields the correct samples
+func TestDecodeBigEndianPacket(t *testing.T) {
+	samples := []int16{1, -2, 300, -32768, 32767}
+	payload := make([]byte, PacketSize)
+	for i, s := range samples {
+		binary.BigEndian.PutUint16(payload[i*2:], uint16(s))
+	}
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, payload, binary.BigEndian)
+	data, ok := jb.GetPacket()
+	if !ok {
+		t.Fatal("expected a packet")
+	}
+	for i, want := range samples {
+		if got := int16(binary.LittleEndian.Uint16(data[i*2:])); got != want {
+			t.Errorf("sample %d: expected %d, got %d", i, want, got)
+		}
+	}
+}
+
+// TestBigEndianHeaderFlag tests that the header flag overrides the default byte order
+func TestBigEndianHeaderFlag(t *testing.T) {
+	packet := make([]byte, HeaderSize+PacketSize)
+	EncodeHeader(packet, PacketHeader{Flags: FlagBigEndian, Epoch: 1})
+	binary.BigEndian.PutUint16(packet[HeaderSize:], uint16(1234))
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, packet, binary.LittleEndian)
+	data, _ := jb.GetPacket()
+	if got := int16(binary.LittleEndian.Uint16(data)); got != 1234 {
+		t.Errorf("expected 1234, got %d", got)
+	}
+}
+
+// TestToLittleEndianFloat32 tests that float32 payloads are swapped 4 bytes at a time
+func TestToLittleEndianFloat32(t *testing.T) {
+	payload := make([]byte, Float32PacketSize)
+	binary.BigEndian.PutUint32(payload, math.Float32bits(0.5))
+	swapped := toLittleEndian(payload, binary.BigEndian, payloadSampleSize(len(payload)))
+	if got := math.Float32frombits(binary.LittleEndian.Uint32(swapped)); got != 0.5 {
+		t.Errorf("expected 0.5, got %v", got)
+	}
+}
+
+// TestBigEndianCoalescedChannelOrder tests that a big-endian coalesced
+// datagram of two packets, the same length as a float32 packet, is still
+// swapped as int16 samples and keeps left and right in place
+func TestBigEndianCoalescedChannelOrder(t *testing.T) {
+	packet := make([]byte, HeaderSize+2*PacketSize)
+	EncodeHeader(packet, PacketHeader{Flags: FlagBigEndian | FlagCoalesced, Epoch: 1})
+	payload := packet[HeaderSize:]
+	for p := 0; p < 2; p++ {
+		for frame := 0; frame < FramesPerBuffer; frame++ {
+			i := p*PacketSize + frame*Channels*2
+			binary.BigEndian.PutUint16(payload[i:], uint16(100+p))
+			binary.BigEndian.PutUint16(payload[i+2:], uint16(200+p))
+		}
+	}
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, packet, binary.LittleEndian)
+	for p := 0; p < 2; p++ {
+		data, ok := jb.GetPacket()
+		if !ok {
+			t.Fatalf("packet %d missing", p)
+		}
+		left, right := int16(binary.LittleEndian.Uint16(data)), int16(binary.LittleEndian.Uint16(data[2:]))
+		if left != int16(100+p) || right != int16(200+p) {
+			t.Errorf("packet %d first frame L=%d R=%d, want L=%d R=%d", p, left, right, 100+p, 200+p)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// DefaultLevelSmoothing is the weight given to each new buffer level reading.
+// At one reading per packet this averages over roughly 20 packets (about 200ms).
+const DefaultLevelSmoothing = 0.05
+
+// LevelAverage is an exponentially weighted moving average of the buffer level.
+// It is updated by the playback loop and may be read from other goroutines.
+type LevelAverage struct {
+	alpha  float64
+	bits   uint64 // math.Float64bits of the current average
+	primed bool
+}
+
+// NewLevelAverage creates an average giving weight alpha (0 < alpha <= 1) to each reading
+func NewLevelAverage(alpha float64) *LevelAverage {
+	return &LevelAverage{alpha: alpha}
+}
+
+// Update adds a reading and returns the new average. The first reading
+// seeds the average so it doesn't have to climb up from zero.
+func (la *LevelAverage) Update(level int) float64 {
+	value := float64(level)
+	if la.primed {
+		value = la.Value() + la.alpha*(value-la.Value())
+	}
+	la.primed = true
+	atomic.StoreUint64(&la.bits, math.Float64bits(value))
+	return value
+}
+
+// Value returns the current average
+func (la *LevelAverage) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&la.bits))
+}
+
+// Reset forgets all readings, so the next one seeds the average again.
+// Like Update, it must be called from the playback loop.
+func (la *LevelAverage) Reset() {
+	la.primed = false
+	atomic.StoreUint64(&la.bits, 0)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestLevelAverageConverges tests that the average settles on a steady input
+func TestLevelAverageConverges(t *testing.T) {
+	la := NewLevelAverage(DefaultLevelSmoothing)
+	la.Update(0)
+	for i := 0; i < 500; i++ {
+		la.Update(20)
+	}
+	if math.Abs(la.Value()-20) > 0.01 {
+		t.Errorf("expected average to converge to 20, got %v", la.Value())
+	}
+}
+
+// TestLevelAverageStepResponse tests the time constant of the response to a step change
+func TestLevelAverageStepResponse(t *testing.T) {
+	for _, alpha := range []float64{0.05, 0.1, 0.5} {
+		la := NewLevelAverage(alpha)
+		la.Update(10)
+
+		// After one time constant the average covers 1 - 1/e of the step
+		tau := -1 / math.Log(1-alpha)
+		steps := int(math.Round(tau))
+		var value float64
+		for i := 0; i < steps; i++ {
+			value = la.Update(110)
+		}
+		want := 10 + 100*(1-math.Pow(1-alpha, float64(steps)))
+		if math.Abs(value-want) > 1e-9 {
+			t.Errorf("alpha %v: expected %v after %d steps, got %v", alpha, want, steps, value)
+		}
+		if math.Abs(value-(10+100*(1-1/math.E))) > 100*alpha {
+			t.Errorf("alpha %v: expected about 63%% of the step after one time constant, got %v", alpha, value)
+		}
+	}
+}
+
+// TestLevelAverageSeedsFromFirstReading tests that the first reading is taken as-is
+func TestLevelAverageSeedsFromFirstReading(t *testing.T) {
+	la := NewLevelAverage(0.1)
+	if got := la.Update(30); got != 30 {
+		t.Errorf("expected first reading to seed the average at 30, got %v", got)
+	}
+}
+
+// TestLevelAverageNoSmoothing tests that alpha 1 tracks the input exactly
+func TestLevelAverageNoSmoothing(t *testing.T) {
+	la := NewLevelAverage(1)
+	la.Update(5)
+	if got := la.Update(40); got != 40 {
+		t.Errorf("expected 40, got %v", got)
+	}
+}
+
+// TestIsBufferFullUsesAverage tests that a brief spike doesn't count as a full buffer
+func TestIsBufferFullUsesAverage(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.UpdateAverageLevel()
+	for i := 0; i < jb.highWaterMark+5; i++ {
+		jb.AddPacket(make([]byte, PacketSize))
+	}
+	jb.UpdateAverageLevel()
+	if jb.IsBufferFull() {
+		t.Error("expected a single high reading not to mark the buffer full")
+	}
+	for i := 0; i < 200; i++ {
+		jb.UpdateAverageLevel()
+	}
+	if !jb.IsBufferFull() {
+		t.Error("expected a sustained high level to mark the buffer full")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Float32PacketSize is the payload size of a packet carrying float32 samples
+var Float32PacketSize = FramesPerBuffer * Channels * 4 // 4 bytes per float32 sample
+
+// MaxDatagramSize is the largest audio datagram the server accepts
+var MaxDatagramSize = HeaderSize + MaxCoalescedPackets*PacketSize
+
+// isPayloadSize reports whether n is the size of a stereo int16, stereo
+// float32 or surround int16 payload
+func isPayloadSize(n int) bool {
+	return n == PacketSize || n == Float32PacketSize || surroundChannels(n) != 0
+}
+
+// toPCM16 returns the payload as stereo little-endian int16 samples,
+// converting float32 payloads and downmixing surround payloads (identified
+// by size) to the server's output format
+func toPCM16(payload []byte) []byte {
+	if channels := surroundChannels(len(payload)); channels != 0 {
+		return downmixPayload(payload, channels)
+	}
+	if len(payload) != Float32PacketSize {
+		return payload
+	}
+	out := make([]byte, PacketSize)
+	for i := 0; i < len(payload)/4; i++ {
+		f := math.Float32frombits(binary.LittleEndian.Uint32(payload[i*4:]))
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(float32ToInt16(f)))
+	}
+	return out
+}
+
+// float32ToInt16 converts a [-1.0, 1.0] sample to int16, clipping out-of-range values
+func float32ToInt16(f float32) int16 {
+	if f >= 1.0 {
+		return math.MaxInt16
+	}
+	if f <= -1.0 {
+		return -math.MaxInt16
+	}
+	return int16(f * math.MaxInt16)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// TestFloat32ToInt16 tests conversion and clipping of float samples
+func TestFloat32ToInt16(t *testing.T) {
+	testCases := []struct {
+		in       float32
+		expected int16
+	}{
+		{0.0, 0},
+		{0.5, 16383},
+		{-0.5, -16383},
+		{1.0, 32767},
+		{-1.0, -32767},
+		{1.5, 32767},
+		{-1.5, -32767},
+	}
+
+	for _, tc := range testCases {
+		if got := float32ToInt16(tc.in); got != tc.expected {
+			t.Errorf("float32ToInt16(%f): expected %d, got %d", tc.in, tc.expected, got)
+		}
+	}
+}
+
+// TestFloat32PacketConversion tests that a float32 packet is unpacked into int16 samples
+func TestFloat32PacketConversion(t *testing.T) {
+	packet := make([]byte, SequenceSize+Float32PacketSize)
+	binary.LittleEndian.PutUint32(packet, 0)
+	binary.LittleEndian.PutUint32(packet[SequenceSize:], math.Float32bits(0.5))
+	binary.LittleEndian.PutUint32(packet[SequenceSize+4:], math.Float32bits(-0.25))
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, packet, binary.LittleEndian)
+
+	pcm, ok := jb.GetPacket()
+	if !ok {
+		t.Fatal("expected float32 packet to be delivered")
+	}
+	if len(pcm) != PacketSize {
+		t.Fatalf("expected converted packet length %d, got %d", PacketSize, len(pcm))
+	}
+	if got := int16(binary.LittleEndian.Uint16(pcm)); got != 16383 {
+		t.Errorf("expected first sample 16383, got %d", got)
+	}
+	if got := int16(binary.LittleEndian.Uint16(pcm[2:])); got != -8191 {
+		t.Errorf("expected second sample -8191, got %d", got)
+	}
+}
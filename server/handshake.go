@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+)
+
+// Before streaming, a client may send a hello to the audio port describing
+// the audio it will send. The server replies to the sender with an accept,
+// or a reject if it plays different parameters, so a mismatch is reported
+// instead of playing as garbled audio. Replies carry the server's own
+// parameters. Packets are a HandshakePacket written with binary.Write:
+//
+//	'A' 'H' version(1) type sample_rate(uint32 LE) channels(uint16 LE) frames(uint16 LE) codec
+const (
+	HandshakeMagic0  = 'A'
+	HandshakeMagic1  = 'H'
+	HandshakeVersion = 1
+	HandshakeSize    = 13 // No audio datagram has this size
+)
+
+// Handshake packet types
+const (
+	HandshakeHello  = 1
+	HandshakeAccept = 2
+	HandshakeReject = 3
+)
+
+// Codec IDs carried in handshakes
+const (
+	CodecPCM16   = 0 // int16 PCM, including surround sources
+	CodecFloat32 = 1 // float32 PCM
+)
+
+// HandshakePacket is the handshake's wire format, in field order
+type HandshakePacket struct {
+	Magic      [2]byte
+	Version    uint8
+	Type       uint8
+	SampleRate uint32
+	Channels   uint16
+	Frames     uint16
+	Codec      uint8
+}
+
+// newHandshake creates a handshake packet of the given type describing p
+func newHandshake(msgType uint8, p StreamParams, codec uint8) HandshakePacket {
+	return HandshakePacket{
+		Magic:      [2]byte{HandshakeMagic0, HandshakeMagic1},
+		Version:    HandshakeVersion,
+		Type:       msgType,
+		SampleRate: uint32(p.SampleRate),
+		Channels:   uint16(p.Channels),
+		Frames:     uint16(p.FramesPerBuffer),
+		Codec:      codec,
+	}
+}
+
+// Params returns the stream parameters the handshake describes
+func (h HandshakePacket) Params() StreamParams {
+	return StreamParams{SampleRate: int(h.SampleRate), Channels: int(h.Channels), FramesPerBuffer: int(h.Frames), BytesPerSample: 2}
+}
+
+// encodeHandshake encodes a handshake packet for sending
+func encodeHandshake(h HandshakePacket) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h) // Writes to a bytes.Buffer can't fail
+	return buf.Bytes()
+}
+
+// isHandshake reports whether a datagram is a handshake packet
+func isHandshake(b []byte) bool {
+	return len(b) == HandshakeSize && b[0] == HandshakeMagic0 && b[1] == HandshakeMagic1
+}
+
+// decodeHandshake parses a handshake packet
+func decodeHandshake(b []byte) (HandshakePacket, error) {
+	if !isHandshake(b) {
+		return HandshakePacket{}, fmt.Errorf("not a handshake packet (%d bytes)", len(b))
+	}
+	var h HandshakePacket
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &h); err != nil {
+		return HandshakePacket{}, err
+	}
+	if h.Version != HandshakeVersion {
+		return HandshakePacket{}, fmt.Errorf("unsupported handshake version %d", h.Version)
+	}
+	return h, nil
+}
+
+// checkHello checks that a handshake is a hello for a codec the server decodes
+func checkHello(hello HandshakePacket) error {
+	if hello.Type != HandshakeHello {
+		return fmt.Errorf("unexpected handshake type %d", hello.Type)
+	}
+	if hello.Codec != CodecPCM16 && hello.Codec != CodecFloat32 {
+		return fmt.Errorf("unsupported codec %d", hello.Codec)
+	}
+	return nil
+}
+
+// handshakeReply answers a client's hello, accepting it if the client will
+// send audio the server can play with its current parameters
+func handshakeReply(hello HandshakePacket) (HandshakePacket, error) {
+	params := currentStreamParams()
+	err := checkHello(hello)
+	if err == nil && hello.Params() != params {
+		err = fmt.Errorf("client sends %v but the server plays %v", hello.Params(), params)
+	}
+	if err != nil {
+		return newHandshake(HandshakeReject, params, CodecPCM16), err
+	}
+	return newHandshake(HandshakeAccept, params, hello.Codec), nil
+}
+
+// negotiateStream waits on conn for a client's hello, ignoring any audio,
+// and adopts the parameters it asks for if they are valid on a link of the
+// given MTU. Invalid requests are rejected and the next hello waited for.
+// With a pre-shared key, only hellos tagged with it count and replies are
+// tagged.
+func negotiateStream(conn net.PacketConn, mtu int, psk []byte) (StreamParams, error) {
+	buf := make([]byte, MaxDatagramSize+AuthTagSize)
+	reply := func(b []byte, addr net.Addr) {
+		if psk != nil {
+			b = appendAuthTag(psk, b)
+		}
+		conn.WriteTo(b, addr)
+	}
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return StreamParams{}, err
+		}
+		packet := buf[:n]
+		if psk != nil {
+			if packet, err = checkAuthTag(psk, packet); err != nil {
+				continue
+			}
+		}
+		if !isHandshake(packet) {
+			continue
+		}
+		hello, err := decodeHandshake(packet)
+		if err == nil {
+			err = checkHello(hello)
+		}
+		if err == nil {
+			_, err = checkPacketSize(hello.Params(), mtu)
+		}
+		if err != nil {
+			log.Printf("Rejecting handshake from %v: %v", addr, err)
+			reply(encodeHandshake(newHandshake(HandshakeReject, currentStreamParams(), CodecPCM16)), addr)
+			continue
+		}
+		setStreamParams(hello.Params())
+		accept, _ := handshakeReply(hello)
+		reply(encodeHandshake(accept), addr)
+		log.Printf("Negotiated %v with %v", hello.Params(), addr)
+		return hello.Params(), nil
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestHandshakeRoundTrip tests that a handshake decodes to what was encoded
+func TestHandshakeRoundTrip(t *testing.T) {
+	if size := binary.Size(HandshakePacket{}); size != HandshakeSize {
+		t.Fatalf("expected HandshakeSize to be the encoded size %d", size)
+	}
+	hello := newHandshake(HandshakeHello, StreamParams{SampleRate: 16000, Channels: 1, FramesPerBuffer: 320}, CodecFloat32)
+	encoded := encodeHandshake(hello)
+	if len(encoded) != HandshakeSize || !isHandshake(encoded) {
+		t.Fatalf("expected a %d-byte handshake, got %d bytes", HandshakeSize, len(encoded))
+	}
+	if err := validatePacket(encoded); err == nil {
+		t.Error("expected a handshake never to pass as audio")
+	}
+	decoded, err := decodeHandshake(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded != hello {
+		t.Errorf("expected %+v, got %+v", hello, decoded)
+	}
+	if p := decoded.Params(); p.SampleRate != 16000 || p.Channels != 1 || p.FramesPerBuffer != 320 {
+		t.Errorf("expected 16kHz mono 320-frame params, got %v", p)
+	}
+
+	encoded[2] = HandshakeVersion + 1
+	if _, err := decodeHandshake(encoded); err == nil {
+		t.Error("expected an unknown version to be rejected")
+	}
+}
+
+// TestHandshakeReplyRejectsMismatch tests that a hello is accepted only if
+// it matches the server's parameters and codecs
+func TestHandshakeReplyRejectsMismatch(t *testing.T) {
+	reply, err := handshakeReply(newHandshake(HandshakeHello, currentStreamParams(), CodecPCM16))
+	if err != nil || reply.Type != HandshakeAccept {
+		t.Errorf("expected a matching hello accepted, got type %d (%v)", reply.Type, err)
+	}
+
+	mono := currentStreamParams()
+	mono.Channels = 1
+	reply, err = handshakeReply(newHandshake(HandshakeHello, mono, CodecPCM16))
+	if err == nil || reply.Type != HandshakeReject {
+		t.Errorf("expected a channel mismatch rejected, got type %d", reply.Type)
+	}
+	if reply.Params() != currentStreamParams() {
+		t.Errorf("expected the rejection to carry the server's parameters, got %v", reply.Params())
+	}
+
+	if reply, err := handshakeReply(newHandshake(HandshakeHello, currentStreamParams(), 9)); err == nil || reply.Type != HandshakeReject {
+		t.Error("expected an unknown codec rejected")
+	}
+}
+
+// TestReceiverAnswersHandshake tests that a hello arriving on the audio
+// port is answered to its sender and kept out of the jitter buffer
+func TestReceiverAnswersHandshake(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	var replies [][]byte
+	r.reply = func(b []byte, _ *net.UDPAddr) (int, error) {
+		replies = append(replies, b)
+		return len(b), nil
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+	stereo := currentStreamParams()
+	mono := stereo
+	mono.Channels = 1
+	r.HandleDatagram(addr, encodeHandshake(newHandshake(HandshakeHello, stereo, CodecPCM16)))
+	r.HandleDatagram(addr, encodeHandshake(newHandshake(HandshakeHello, mono, CodecPCM16)))
+
+	if len(replies) != 2 {
+		t.Fatalf("expected 2 replies, got %d", len(replies))
+	}
+	for i, want := range []uint8{HandshakeAccept, HandshakeReject} {
+		if reply, err := decodeHandshake(replies[i]); err != nil || reply.Type != want {
+			t.Errorf("reply %d: expected type %d, got %d (%v)", i, want, reply.Type, err)
+		}
+	}
+	if jb.GetStats().totalPackets != 0 || r.Malformed() != 0 {
+		t.Error("expected handshakes kept out of the audio pipeline")
+	}
+}
+
+// TestNegotiateStream tests that the server adopts the first valid hello's
+// parameters after rejecting an invalid one
+func TestNegotiateStream(t *testing.T) {
+	t.Cleanup(func() { setStreamParams(defaultStreamParams) })
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	audio := make([]byte, PacketSize)
+	negotiated := make(chan StreamParams, 1)
+	go func() {
+		params, _ := negotiateStream(server, DefaultMTU, nil)
+		negotiated <- params
+	}()
+
+	exchange := func(hello HandshakePacket) HandshakePacket {
+		t.Helper()
+		client.Write(audio) // Audio before the handshake is ignored
+		client.Write(encodeHandshake(hello))
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 64)
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("expected a reply: %v", err)
+		}
+		reply, err := decodeHandshake(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	invalid := StreamParams{SampleRate: 1000, Channels: 1, FramesPerBuffer: 320}
+	if reply := exchange(newHandshake(HandshakeHello, invalid, CodecPCM16)); reply.Type != HandshakeReject {
+		t.Errorf("expected an invalid sample rate rejected, got type %d", reply.Type)
+	}
+	voice := StreamParams{SampleRate: 16000, Channels: 1, FramesPerBuffer: 320, BytesPerSample: 2}
+	if reply := exchange(newHandshake(HandshakeHello, voice, CodecPCM16)); reply.Type != HandshakeAccept || reply.Params() != voice {
+		t.Errorf("expected %v accepted, got type %d with %v", voice, reply.Type, reply.Params())
+	}
+
+	select {
+	case params := <-negotiated:
+		if params != voice || PacketSize != 640 {
+			t.Errorf("expected %v adopted with 640-byte packets, got %v and %d", voice, params, PacketSize)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected negotiation to finish")
+	}
+}
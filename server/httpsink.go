@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// HTTPSinkQueue is how many frames a listener may fall behind before it is dropped
+const HTTPSinkQueue = 64
+
+// HTTP sink formats for -http-sink-format
+const (
+	SinkFormatRaw = "raw" // Bare PCM, for players told the format out of band
+	SinkFormatWAV = "wav" // PCM after a WAV header, playable by browsers
+)
+
+// wavStreamSize stands in for the RIFF and data chunk sizes of a live
+// stream, whose length isn't known. Players treat it as "until the end".
+const wavStreamSize = 0xFFFFFFFF
+
+// wavStreamHeader returns a 44-byte WAV header for an endless stream of
+// little-endian PCM in the given format
+func wavStreamHeader(sampleRate, channels, bitsPerSample int) []byte {
+	blockAlign := channels * bitsPerSample / 8
+	h := make([]byte, 44)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], wavStreamSize)
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16) // fmt chunk size
+	binary.LittleEndian.PutUint16(h[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(h[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], uint16(bitsPerSample))
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], wavStreamSize)
+	return h
+}
+
+// StreamFanout copies played frames to any number of HTTP listeners.
+// Publishing never blocks: a listener whose queue is full is disconnected.
+type StreamFanout struct {
+	mu        sync.Mutex
+	listeners map[chan []byte]struct{}
+	active    int64 // len(listeners), read without the lock
+	queue     int
+	dropped   int64
+
+	// PublishSamples copies into a free buffer and hands it to the fan-out
+	// goroutine, which encodes and publishes it and hands the buffer back
+	free    chan []int16
+	samples chan []int16
+
+	// With -http-sink-format wav, sent to each listener before any audio
+	header []byte
+}
+
+// NewStreamFanout creates a fan-out allowing each listener queue frames of
+// backlog, and starts the goroutine publishing what PublishSamples hands it
+func NewStreamFanout(queue int) *StreamFanout {
+	sf := &StreamFanout{
+		listeners: make(map[chan []byte]struct{}),
+		queue:     queue,
+		free:      make(chan []int16, queue),
+		samples:   make(chan []int16, queue),
+	}
+	for i := 0; i < queue; i++ {
+		sf.free <- make([]int16, 0, FramesPerBuffer*Channels)
+	}
+	go sf.run()
+	return sf
+}
+
+// Subscribe registers a listener. The returned channel is closed when the
+// listener is dropped or unsubscribed.
+func (sf *StreamFanout) Subscribe() (<-chan []byte, func()) {
+	frames := make(chan []byte, sf.queue)
+	sf.mu.Lock()
+	sf.listeners[frames] = struct{}{}
+	atomic.AddInt64(&sf.active, 1)
+	sf.mu.Unlock()
+	return frames, func() { sf.remove(frames) }
+}
+
+// remove unregisters a listener and closes its channel if still registered
+func (sf *StreamFanout) remove(frames chan []byte) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if _, ok := sf.listeners[frames]; ok {
+		delete(sf.listeners, frames)
+		atomic.AddInt64(&sf.active, -1)
+		close(frames)
+	}
+}
+
+// Publish sends a frame to every listener. The frame is shared between
+// listeners and must not be modified afterwards.
+func (sf *StreamFanout) Publish(frame []byte) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for frames := range sf.listeners {
+		select {
+		case frames <- frame:
+		default:
+			// Too slow to keep up with playback
+			delete(sf.listeners, frames)
+			atomic.AddInt64(&sf.active, -1)
+			close(frames)
+			atomic.AddInt64(&sf.dropped, 1)
+		}
+	}
+}
+
+// PublishSamples queues int16 samples to be encoded as little-endian PCM
+// and published. It takes no lock and allocates nothing, so it is safe to
+// call from the output callback. If the fan-out goroutine has fallen queue
+// frames behind, the samples are left out.
+func (sf *StreamFanout) PublishSamples(samples []int16) {
+	if sf.Listeners() == 0 {
+		return
+	}
+	select {
+	case buffer := <-sf.free:
+		// There are never more buffers than samples holds, so this can't block
+		sf.samples <- append(buffer[:0], samples...)
+	default:
+	}
+}
+
+// run encodes and publishes the samples queued by PublishSamples. Each
+// frame is shared with the listeners, so it gets its own bytes.
+func (sf *StreamFanout) run() {
+	for samples := range sf.samples {
+		frame := make([]byte, len(samples)*2)
+		int16ToBytes(samples, frame)
+		sf.free <- samples
+		sf.Publish(frame)
+	}
+}
+
+// Listeners returns the number of connected listeners
+func (sf *StreamFanout) Listeners() int {
+	return int(atomic.LoadInt64(&sf.active))
+}
+
+// Dropped returns how many listeners were disconnected for falling behind
+func (sf *StreamFanout) Dropped() int64 {
+	return atomic.LoadInt64(&sf.dropped)
+}
+
+// SetWAVHeader makes every listener receive a WAV header for the played
+// format before the audio, so browsers can play the stream directly
+func (sf *StreamFanout) SetWAVHeader() {
+	sf.header = wavStreamHeader(SampleRate, Channels, 16)
+}
+
+// ServeHTTP streams the played audio as raw int16 little-endian PCM at the
+// server's sample rate and channels in a chunked response until the client disconnects or falls behind.
+// No Content-Length is set, so the response is chunked however long it runs.
+func (sf *StreamFanout) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	frames, unsubscribe := sf.Subscribe()
+	defer unsubscribe()
+
+	if sf.header != nil {
+		w.Header().Set("Content-Type", "audio/wav")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if sf.header != nil {
+		// Frames are whole sample frames, so audio after the header stays aligned
+		if _, err := w.Write(sf.header); err != nil {
+			return
+		}
+	}
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		// Send the headers (and any WAV header) now rather than with the first frame
+		flusher.Flush()
+	}
+
+	log.Printf("HTTP listener %s connected", r.RemoteAddr)
+	defer log.Printf("HTTP listener %s disconnected", r.RemoteAddr)
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(frame); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// startHTTPSink serves the fan-out at path on addr in the background
+func startHTTPSink(addr, path string, sf *StreamFanout) {
+	mux := http.NewServeMux()
+	mux.Handle(path, sf)
+	go func() {
+		log.Printf("Live audio stream available at http://%s%s", addr, path)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Error serving HTTP audio stream: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStreamFanoutMultipleListeners tests that every listener receives every frame
+func TestStreamFanoutMultipleListeners(t *testing.T) {
+	sf := NewStreamFanout(4)
+	a, unsubscribeA := sf.Subscribe()
+	defer unsubscribeA()
+	b, unsubscribeB := sf.Subscribe()
+	defer unsubscribeB()
+
+	for i := byte(0); i < 3; i++ {
+		sf.Publish([]byte{i})
+	}
+	for name, frames := range map[string]<-chan []byte{"a": a, "b": b} {
+		for i := byte(0); i < 3; i++ {
+			if frame := <-frames; frame[0] != i {
+				t.Errorf("listener %s: expected frame %d, got %d", name, i, frame[0])
+			}
+		}
+	}
+}
+
+// TestStreamFanoutDropsSlowListener tests that a full listener is dropped without blocking
+func TestStreamFanoutDropsSlowListener(t *testing.T) {
+	sf := NewStreamFanout(2)
+	slow, unsubscribeSlow := sf.Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := sf.Subscribe()
+	defer unsubscribeFast()
+
+	done := make(chan struct{})
+	go func() {
+		for i := byte(0); i < 10; i++ {
+			sf.Publish([]byte{i})
+			<-fast
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow listener")
+	}
+
+	if sf.Listeners() != 1 {
+		t.Errorf("expected 1 listener left, got %d", sf.Listeners())
+	}
+	if sf.Dropped() != 1 {
+		t.Errorf("expected 1 dropped listener, got %d", sf.Dropped())
+	}
+	// The slow listener gets what was queued, then sees its channel closed
+	count := 0
+	for range slow {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected the slow listener to have 2 queued frames, got %d", count)
+	}
+}
+
+// TestStreamFanoutServeHTTP tests streaming frames over HTTP
+func TestStreamFanoutServeHTTP(t *testing.T) {
+	sf := NewStreamFanout(HTTPSinkQueue)
+	server := httptest.NewServer(sf)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Wait for the handler to subscribe before publishing
+	deadline := time.Now().Add(time.Second)
+	for sf.Listeners() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sf.PublishSamples([]int16{1, -1})
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(bufio.NewReader(resp.Body), buf); err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	want := []byte{0x01, 0x00, 0xFF, 0xFF}
+	for i := range want {
+		if buf[i] != want[i] {
+			t.Fatalf("expected % x, got % x", want, buf)
+		}
+	}
+}
+
+// TestWAVStreamHeader tests that the header is a valid WAV header for the
+// given format with streaming sizes
+func TestWAVStreamHeader(t *testing.T) {
+	h := wavStreamHeader(48000, 2, 16)
+	if len(h) != 44 {
+		t.Fatalf("header is %d bytes, want 44", len(h))
+	}
+	if string(h[0:4]) != "RIFF" || string(h[8:12]) != "WAVE" || string(h[12:16]) != "fmt " || string(h[36:40]) != "data" {
+		t.Fatalf("bad chunk IDs in % x", h)
+	}
+	le := binary.LittleEndian
+	checks := []struct {
+		name      string
+		got, want uint32
+	}{
+		{"RIFF size", le.Uint32(h[4:]), wavStreamSize},
+		{"fmt size", le.Uint32(h[16:]), 16},
+		{"format", uint32(le.Uint16(h[20:])), 1},
+		{"channels", uint32(le.Uint16(h[22:])), 2},
+		{"sample rate", le.Uint32(h[24:]), 48000},
+		{"byte rate", le.Uint32(h[28:]), 48000 * 4},
+		{"block align", uint32(le.Uint16(h[32:])), 4},
+		{"bits per sample", uint32(le.Uint16(h[34:])), 16},
+		{"data size", le.Uint32(h[40:]), wavStreamSize},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, c.got, c.want)
+		}
+	}
+}
+
+// TestStreamFanoutServeWAV tests that a WAV stream starts with the header
+// followed by the audio, chunked
+func TestStreamFanoutServeWAV(t *testing.T) {
+	sf := NewStreamFanout(HTTPSinkQueue)
+	sf.SetWAVHeader()
+	server := httptest.NewServer(sf)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "audio/wav" {
+		t.Errorf("Content-Type %q, want audio/wav", ct)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("Transfer-Encoding %v, want chunked", resp.TransferEncoding)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for sf.Listeners() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sf.PublishSamples([]int16{1, -1})
+
+	buf := make([]byte, 48)
+	if _, err := io.ReadFull(bufio.NewReader(resp.Body), buf); err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	if !bytes.Equal(buf[:44], wavStreamHeader(SampleRate, Channels, 16)) {
+		t.Errorf("stream doesn't start with the WAV header: % x", buf[:44])
+	}
+	if want := []byte{0x01, 0x00, 0xFF, 0xFF}; !bytes.Equal(buf[44:], want) {
+		t.Errorf("expected audio % x after the header, got % x", want, buf[44:])
+	}
+}
+
+// TestStreamFanoutPublishSamplesNeverWaits tests that publishing samples
+// neither waits for the fan-out lock nor allocates, so the output callback
+// can do it, and that the samples still reach listeners in order
+func TestStreamFanoutPublishSamplesNeverWaits(t *testing.T) {
+	sf := NewStreamFanout(4)
+	frames, unsubscribe := sf.Subscribe()
+	defer unsubscribe()
+
+	// With the lock held, the fan-out goroutine stalls in Publish and the
+	// buffers run out, after which samples are left out
+	sf.mu.Lock()
+	for i := int16(0); i < 8; i++ {
+		sf.PublishSamples([]int16{i})
+	}
+	time.Sleep(10 * time.Millisecond) // Let the goroutine reach the lock
+	samples := []int16{42}
+	if allocs := testing.AllocsPerRun(100, func() { sf.PublishSamples(samples) }); allocs != 0 {
+		t.Errorf("PublishSamples allocated %v times, want 0", allocs)
+	}
+	sf.mu.Unlock()
+
+	for i := byte(0); i < 4; i++ {
+		select {
+		case frame := <-frames:
+			if !bytes.Equal(frame, []byte{i, 0}) {
+				t.Fatalf("frame %d: got % x", i, frame)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("frame %d was never published", i)
+		}
+	}
+}
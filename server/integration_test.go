@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// TestReceivePipelineIntegration sends client-style sequenced packets over
+// loopback UDP through the server's receive path and checks they come out of
+// the jitter buffer in order.
+func TestReceivePipelineIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping UDP integration test in short mode")
+	}
+
+	server, client := newLoopbackPair(t)
+	defer client.Close()
+
+	jb := NewJitterBuffer()
+	done := make(chan struct{})
+	go func() {
+		receiveLoop(context.Background(), server, NewReceiver(jb), DefaultReadBatchSize)
+		close(done)
+	}()
+
+	// Send 30 packets with neighbouring pairs swapped to exercise reordering
+	const packets = 30
+	for i := uint32(0); i < packets; i += 2 {
+		for _, seq := range []uint32{i + 1, i} {
+			if _, err := client.Write(sequencedPacket(seq)); err != nil {
+				t.Fatalf("Failed to send packet %d: %v", seq, err)
+			}
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for jb.GetBufferLevel() < packets && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i := uint32(0); i < packets; i++ {
+		packet, ok := jb.GetPacket()
+		if !ok {
+			t.Fatalf("expected packet %d from the jitter buffer", i)
+		}
+		if got := binary.LittleEndian.Uint16(packet); got != uint16(i) {
+			t.Errorf("expected packet %d, got %d", i, got)
+		}
+	}
+
+	stats := jb.GetStats()
+	if stats.totalPackets != packets {
+		t.Errorf("expected %d total packets, got %d", packets, stats.totalPackets)
+	}
+	if stats.overflows != 0 {
+		t.Errorf("expected no overflows, got %d", stats.overflows)
+	}
+	if jb.reorderBuffer.HasPendingPackets() {
+		t.Errorf("expected reorder buffer to be empty, %d packets pending", jb.reorderBuffer.Len())
+	}
+
+	// Closing the connection stops the receive loop
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("receiveLoop did not return after the connection was closed")
+	}
+}
+
+// TestReceiveLoopCancel tests that cancelling the context terminates the receive loop
+func TestReceiveLoopCancel(t *testing.T) {
+	server, client := newLoopbackPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		receiveLoop(ctx, server, NewReceiver(NewJitterBuffer()), 1)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("receiveLoop did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// With -encrypt, each client agrees a fresh session key with the server
+// before streaming, so no key is configured on either side and a key
+// recovered later doesn't expose earlier sessions. The client sends a hello
+// carrying an ephemeral X25519 public key to the audio port and the server
+// replies with its own; both derive an AES-256-GCM key from the shared
+// secret with HKDF-SHA256. Key exchange packets are:
+//
+//	'A' 'K' version type suite public_key(32)
+//
+// which is an odd length, so never mistaken for audio.
+const (
+	KeyExchangeMagic0  = 'A'
+	KeyExchangeMagic1  = 'K'
+	KeyExchangeVersion = 1
+	KeyExchangeSize    = 37
+)
+
+// Key exchange packet types
+const (
+	KeyExchangeHello = 1
+	KeyExchangeReply = 2
+)
+
+// SuiteX25519AESGCM is the only cipher suite: X25519, HKDF-SHA256 and AES-256-GCM
+const SuiteX25519AESGCM = 1
+
+// sessionKeyInfo binds derived keys to this protocol
+const sessionKeyInfo = "cli-audio-streamer audio key v1"
+
+// Encrypted audio datagrams wrap what would otherwise be sent:
+//
+//	'A' 'E' counter(uint64 LE) ciphertext
+//
+// The counter is the GCM nonce, so each is used once per session key, and
+// the 10-byte prefix is authenticated along with the audio.
+const (
+	SealedMagic0     = 'A'
+	SealedMagic1     = 'E'
+	SealedHeaderSize = 10
+	SealOverhead     = SealedHeaderSize + 16 // Prefix and GCM tag
+)
+
+// MaxSessionKeys bounds how many clients may hold a session key at once
+const MaxSessionKeys = 256
+
+// isKeyExchange reports whether a datagram is a key exchange packet
+func isKeyExchange(b []byte) bool {
+	return len(b) == KeyExchangeSize && b[0] == KeyExchangeMagic0 && b[1] == KeyExchangeMagic1
+}
+
+// encodeKeyExchange builds a key exchange packet carrying public
+func encodeKeyExchange(msgType uint8, public *ecdh.PublicKey) []byte {
+	b := make([]byte, 0, KeyExchangeSize)
+	b = append(b, KeyExchangeMagic0, KeyExchangeMagic1, KeyExchangeVersion, msgType, SuiteX25519AESGCM)
+	return append(b, public.Bytes()...)
+}
+
+// decodeKeyExchange parses a key exchange packet
+func decodeKeyExchange(b []byte) (msgType uint8, public *ecdh.PublicKey, err error) {
+	if !isKeyExchange(b) {
+		return 0, nil, fmt.Errorf("not a key exchange packet (%d bytes)", len(b))
+	}
+	if b[2] != KeyExchangeVersion {
+		return 0, nil, fmt.Errorf("unsupported key exchange version %d", b[2])
+	}
+	if b[4] != SuiteX25519AESGCM {
+		return 0, nil, fmt.Errorf("unsupported cipher suite %d", b[4])
+	}
+	public, err = ecdh.X25519().NewPublicKey(b[5:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return b[3], public, nil
+}
+
+// deriveSessionKey combines private with the peer's public key and derives
+// the session's AES-GCM cipher. Both public keys salt the derivation, so a
+// key is tied to the exchange that produced it.
+func deriveSessionKey(private *ecdh.PrivateKey, peer, client, server *ecdh.PublicKey) (cipher.AEAD, error) {
+	secret, err := private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(client.Bytes(), server.Bytes()...)
+	key, err := hkdf.Key(sha256.New, secret, salt, sessionKeyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openDatagram decrypts and authenticates an encrypted datagram
+func openDatagram(aead cipher.AEAD, b []byte) ([]byte, error) {
+	if len(b) < SealOverhead || b[0] != SealedMagic0 || b[1] != SealedMagic1 {
+		return nil, fmt.Errorf("not an encrypted datagram (%d bytes)", len(b))
+	}
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce[aead.NonceSize()-8:], b[2:SealedHeaderSize])
+	return aead.Open(nil, nonce, b[SealedHeaderSize:], b[:SealedHeaderSize])
+}
+
+// errNoSessionKey means audio arrived from a client that hasn't exchanged keys
+var errNoSessionKey = errors.New("no session key; the client must exchange keys first")
+
+// SessionKeys holds the key agreed with each client, by source address.
+// When full, the key used least recently makes way for a new client.
+type SessionKeys struct {
+	mu   sync.Mutex
+	keys map[string]*sessionKey
+}
+
+// sessionKey is one client's key, with the hello and reply that agreed it
+type sessionKey struct {
+	aead      cipher.AEAD
+	lastUsed  time.Time
+	clientKey []byte // The client's public key from its hello
+	reply     []byte
+}
+
+// NewSessionKeys creates an empty key table
+func NewSessionKeys() *SessionKeys {
+	return &SessionKeys{keys: make(map[string]*sessionKey)}
+}
+
+// Accept answers a client's hello from addr and returns the reply to send.
+// A repeat of the hello the client's key came from, whether a retry or a
+// duplicate on the network, gets the same reply again, since the client
+// keeps whichever reply it reads first. A new hello replaces the key.
+func (s *SessionKeys) Accept(addr *net.UDPAddr, hello []byte) ([]byte, error) {
+	msgType, client, err := decodeKeyExchange(hello)
+	if err != nil {
+		return nil, err
+	}
+	if msgType != KeyExchangeHello {
+		return nil, fmt.Errorf("unexpected key exchange type %d", msgType)
+	}
+	key := addr.String()
+	if reply, ok := s.repeatedHello(key, client); ok {
+		return reply, nil
+	}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := deriveSessionKey(private, client, client, private.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; !ok && len(s.keys) >= MaxSessionKeys {
+		s.evictLeastRecent()
+	}
+	reply := encodeKeyExchange(KeyExchangeReply, private.PublicKey())
+	s.keys[key] = &sessionKey{aead: aead, lastUsed: time.Now(), clientKey: client.Bytes(), reply: reply}
+	return reply, nil
+}
+
+// repeatedHello returns the reply already sent to addr if its key was
+// agreed from the same client public key
+func (s *SessionKeys) repeatedHello(addr string, client *ecdh.PublicKey) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[addr]
+	if !ok || !bytes.Equal(k.clientKey, client.Bytes()) {
+		return nil, false
+	}
+	k.lastUsed = time.Now()
+	return k.reply, true
+}
+
+// evictLeastRecent drops the key used least recently
+func (s *SessionKeys) evictLeastRecent() {
+	var oldest string
+	for addr, k := range s.keys {
+		if oldest == "" || k.lastUsed.Before(s.keys[oldest].lastUsed) {
+			oldest = addr
+		}
+	}
+	delete(s.keys, oldest)
+}
+
+// Open decrypts a datagram from addr with its session key
+func (s *SessionKeys) Open(addr *net.UDPAddr, b []byte) ([]byte, error) {
+	s.mu.Lock()
+	k, ok := s.keys[addr.String()]
+	if ok {
+		k.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, errNoSessionKey
+	}
+	return openDatagram(k.aead, b)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// sealForTest encrypts plaintext as the client does
+func sealForTest(aead cipher.AEAD, counter uint64, plaintext []byte) []byte {
+	b := make([]byte, SealedHeaderSize, SealOverhead+len(plaintext))
+	b[0], b[1] = SealedMagic0, SealedMagic1
+	binary.LittleEndian.PutUint64(b[2:], counter)
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce[aead.NonceSize()-8:], b[2:SealedHeaderSize])
+	return aead.Seal(b, nonce, plaintext, b[:SealedHeaderSize])
+}
+
+// clientExchange runs the client's half of a key exchange against keys
+func clientExchange(t *testing.T, keys *SessionKeys, addr *net.UDPAddr) cipher.AEAD {
+	t.Helper()
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := keys.Accept(addr, encodeKeyExchange(KeyExchangeHello, private.PublicKey()))
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	msgType, server, err := decodeKeyExchange(reply)
+	if err != nil || msgType != KeyExchangeReply {
+		t.Fatalf("reply type %d, err %v", msgType, err)
+	}
+	aead, err := deriveSessionKey(private, server, private.PublicKey(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+// TestKeyExchangeAgreesKey tests that both ends of an exchange derive the
+// same key, so audio the client seals opens on the server
+func TestKeyExchangeAgreesKey(t *testing.T) {
+	keys := NewSessionKeys()
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	aead := clientExchange(t, keys, addr)
+
+	audio := []byte("some audio samples")
+	opened, err := keys.Open(addr, sealForTest(aead, 7, audio))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if string(opened) != string(audio) {
+		t.Errorf("opened %q, want %q", opened, audio)
+	}
+}
+
+// TestKeyExchangeRepeatedHello tests that a hello received twice, as from
+// a retry or a duplicated datagram, gets the same reply both times, so the
+// key from the first reply still opens the client's audio
+func TestKeyExchangeRepeatedHello(t *testing.T) {
+	keys := NewSessionKeys()
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := encodeKeyExchange(KeyExchangeHello, private.PublicKey())
+	first, err := keys.Accept(addr, hello)
+	if err != nil {
+		t.Fatalf("first Accept: %v", err)
+	}
+	second, err := keys.Accept(addr, hello)
+	if err != nil {
+		t.Fatalf("second Accept: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("repeated hello got a different reply")
+	}
+
+	_, server, err := decodeKeyExchange(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := deriveSessionKey(private, server, private.PublicKey(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Open(addr, sealForTest(aead, 0, []byte("audio"))); err != nil {
+		t.Errorf("audio sealed with the first reply's key didn't open: %v", err)
+	}
+}
+
+// TestKeyExchangeRejectsOtherKey tests that audio sealed under a key from
+// a different exchange, as a man in the middle substituting its own public
+// key would hold, doesn't decrypt, and that tampering is detected
+func TestKeyExchangeRejectsOtherKey(t *testing.T) {
+	keys := NewSessionKeys()
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	clientExchange(t, keys, addr)
+	mitm := clientExchange(t, NewSessionKeys(), addr)
+
+	if _, err := keys.Open(addr, sealForTest(mitm, 0, []byte("injected"))); err == nil {
+		t.Error("audio sealed under another key decrypted")
+	}
+
+	aead := clientExchange(t, keys, addr)
+	sealed := sealForTest(aead, 1, []byte("audio"))
+	sealed[len(sealed)-1] ^= 1
+	if _, err := keys.Open(addr, sealed); err == nil {
+		t.Error("tampered audio decrypted")
+	}
+	if _, err := keys.Open(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}, sealed); err != errNoSessionKey {
+		t.Errorf("audio from a client without a key: got %v, want errNoSessionKey", err)
+	}
+}
+
+// TestReceiverDecryptsAudio tests that with -encrypt the receiver answers a
+// key exchange, plays audio sealed with the agreed key and drops plaintext
+func TestReceiverDecryptsAudio(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	r.sessionKeys = NewSessionKeys()
+	var reply []byte
+	r.reply = func(b []byte, _ *net.UDPAddr) (int, error) {
+		reply = b
+		return len(b), nil
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	private, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	r.HandleDatagram(addr, encodeKeyExchange(KeyExchangeHello, private.PublicKey()))
+	_, server, err := decodeKeyExchange(reply)
+	if err != nil {
+		t.Fatalf("no key exchange reply: %v", err)
+	}
+	aead, _ := deriveSessionKey(private, server, private.PublicKey(), server)
+
+	r.HandleDatagram(addr, make([]byte, PacketSize)) // Plaintext
+	if r.Malformed() != 1 || jb.GetBufferLevel() != 0 {
+		t.Fatalf("plaintext audio accepted (malformed %d, level %d)", r.Malformed(), jb.GetBufferLevel())
+	}
+	r.HandleDatagram(addr, sealForTest(aead, 0, make([]byte, PacketSize)))
+	if level := jb.GetBufferLevel(); level != 1 {
+		t.Errorf("level %d after encrypted audio, want 1", level)
+	}
+}
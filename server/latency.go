@@ -0,0 +1,82 @@
+package main
+
+import "time"
+
+// PacketDuration is the playback time of one packet
+var PacketDuration = time.Duration(FramesPerBuffer) * time.Second / time.Duration(SampleRate)
+
+// LatencyAdjustInterval is how often the latency controller moves the buffer target
+const LatencyAdjustInterval = time.Second
+
+// MaxLatencyTarget caps the buffer target the latency controller may choose,
+// leaving headroom below the buffer capacity for the high water mark
+const MaxLatencyTarget = 100
+
+// packetsToLatency converts a buffer level in packets to playback time
+func packetsToLatency(packets float64) time.Duration {
+	return time.Duration(packets * float64(FramesPerBuffer) * float64(time.Second) / float64(SampleRate))
+}
+
+// LatencyController nudges the buffer target toward a requested output latency.
+// The achieved latency is the average buffered audio plus the device latency.
+type LatencyController struct {
+	target        time.Duration
+	deviceLatency time.Duration
+	minTarget     int
+	maxTarget     int
+
+	levelSum   int
+	readings   int
+	lastAdjust time.Time
+	achieved   time.Duration
+}
+
+// NewLatencyController creates a controller aiming for target total latency,
+// keeping the buffer target between minTarget and maxTarget packets
+func NewLatencyController(target, deviceLatency time.Duration, minTarget, maxTarget int) *LatencyController {
+	return &LatencyController{
+		target:        target,
+		deviceLatency: deviceLatency,
+		minTarget:     minTarget,
+		maxTarget:     maxTarget,
+	}
+}
+
+// Update records a buffer level reading and returns the buffer target to use.
+// The target moves by at most one packet per LatencyAdjustInterval.
+func (lc *LatencyController) Update(now time.Time, level, current int) int {
+	lc.levelSum += level
+	lc.readings++
+	if lc.lastAdjust.IsZero() {
+		lc.lastAdjust = now
+	}
+	if now.Sub(lc.lastAdjust) < LatencyAdjustInterval {
+		return current
+	}
+
+	average := float64(lc.levelSum) / float64(lc.readings)
+	lc.achieved = packetsToLatency(average) + lc.deviceLatency
+	lc.levelSum = 0
+	lc.readings = 0
+	lc.lastAdjust = now
+
+	// Allow half a packet either side so the target doesn't oscillate
+	next := current
+	if lc.achieved > lc.target+PacketDuration/2 {
+		next--
+	} else if lc.achieved < lc.target-PacketDuration/2 {
+		next++
+	}
+	if next < lc.minTarget {
+		next = lc.minTarget
+	}
+	if next > lc.maxTarget {
+		next = lc.maxTarget
+	}
+	return next
+}
+
+// Achieved returns the latency measured at the last adjustment
+func (lc *LatencyController) Achieved() time.Duration {
+	return lc.achieved
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPacketsToLatency tests the buffer level to playback time conversion
+func TestPacketsToLatency(t *testing.T) {
+	// 512 frames at 48kHz is 10.666ms per packet
+	if got := packetsToLatency(3); got != 32*time.Millisecond {
+		t.Errorf("expected 3 packets to be 32ms, got %v", got)
+	}
+	if got := packetsToLatency(0); got != 0 {
+		t.Errorf("expected an empty buffer to be 0ms, got %v", got)
+	}
+}
+
+// TestLatencyControllerNudgesTarget tests that the target converges toward the requested latency
+func TestLatencyControllerNudgesTarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		targetLatency time.Duration
+		deviceLatency time.Duration
+		initialTarget int
+		wantDirection int
+	}{
+		{"too much latency lowers target", 100 * time.Millisecond, 0, 20, -1},
+		{"too little latency raises target", 300 * time.Millisecond, 0, 20, 1},
+		{"device latency is included", 213 * time.Millisecond, 100 * time.Millisecond, 20, -1},
+		{"on target holds", 213 * time.Millisecond, 0, 20, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := NewLatencyController(tt.targetLatency, tt.deviceLatency, 2, MaxLatencyTarget)
+			start := time.Unix(0, 0)
+			target := tt.initialTarget
+
+			// Simulate the buffer settling at the target level each adjustment interval
+			for i := 0; i <= 5; i++ {
+				now := start.Add(time.Duration(i) * LatencyAdjustInterval)
+				target = lc.Update(now, target, target)
+			}
+
+			delta := target - tt.initialTarget
+			switch {
+			case tt.wantDirection < 0 && delta >= 0:
+				t.Errorf("expected target to drop below %d, got %d", tt.initialTarget, target)
+			case tt.wantDirection > 0 && delta <= 0:
+				t.Errorf("expected target to rise above %d, got %d", tt.initialTarget, target)
+			case tt.wantDirection == 0 && delta != 0:
+				t.Errorf("expected target to stay at %d, got %d", tt.initialTarget, target)
+			}
+			if delta > 5 || delta < -5 {
+				t.Errorf("expected at most one packet of movement per interval, moved %d", delta)
+			}
+		})
+	}
+}
+
+// TestLatencyControllerConverges tests that repeated updates settle at the requested latency
+func TestLatencyControllerConverges(t *testing.T) {
+	lc := NewLatencyController(128*time.Millisecond, 0, 2, MaxLatencyTarget)
+	start := time.Unix(0, 0)
+	target := 30
+	for i := 0; i <= 50; i++ {
+		target = lc.Update(start.Add(time.Duration(i)*LatencyAdjustInterval), target, target)
+	}
+	// 128ms is 12 packets
+	if target != 12 {
+		t.Errorf("expected target to converge to 12 packets, got %d", target)
+	}
+	if lc.Achieved() != 128*time.Millisecond {
+		t.Errorf("expected achieved latency 128ms, got %v", lc.Achieved())
+	}
+}
+
+// TestLatencyControllerLimits tests that the target stays within its bounds
+func TestLatencyControllerLimits(t *testing.T) {
+	lc := NewLatencyController(time.Millisecond, 0, 4, 10)
+	start := time.Unix(0, 0)
+	target := 5
+	for i := 0; i <= 10; i++ {
+		target = lc.Update(start.Add(time.Duration(i)*LatencyAdjustInterval), target, target)
+	}
+	if target != 4 {
+		t.Errorf("expected target clamped to minimum 4, got %d", target)
+	}
+
+	lc = NewLatencyController(10*time.Second, 0, 4, 10)
+	for i := 0; i <= 20; i++ {
+		target = lc.Update(start.Add(time.Duration(i)*LatencyAdjustInterval), target, target)
+	}
+	if target != 10 {
+		t.Errorf("expected target clamped to maximum 10, got %d", target)
+	}
+}
+
+// TestLatencyControllerAveragesReadings tests that adjustments use the average level over the interval
+func TestLatencyControllerAveragesReadings(t *testing.T) {
+	lc := NewLatencyController(213*time.Millisecond, 0, 2, MaxLatencyTarget)
+	start := time.Unix(0, 0)
+	lc.Update(start, 10, 20)
+	lc.Update(start.Add(LatencyAdjustInterval/2), 30, 20)
+	// Average of 10, 30 and 20 is 20 packets, on target
+	if got := lc.Update(start.Add(LatencyAdjustInterval), 20, 20); got != 20 {
+		t.Errorf("expected target to hold at 20 for an on-target average, got %d", got)
+	}
+}
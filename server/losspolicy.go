@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+// LossPolicy chooses what is played in place of packets the reorder buffer
+// gave up waiting for
+type LossPolicy string
+
+const (
+	// LossSkip plays on from the next packet received, so the audio jumps
+	// ahead and later audio plays earlier than it would have
+	LossSkip LossPolicy = "skip"
+	// LossFreeze holds the last frame played for the length of the gap, so
+	// the audio after it keeps its timing
+	LossFreeze LossPolicy = "freeze"
+)
+
+// parseLossPolicy validates an -on-loss flag value
+func parseLossPolicy(s string) (LossPolicy, error) {
+	switch policy := LossPolicy(s); policy {
+	case LossSkip, LossFreeze:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown loss policy %q (expected %q or %q)", s, LossSkip, LossFreeze)
+}
+
+// freezePacket returns a packet repeating the last stereo frame of last,
+// or silence if there is no previous packet
+func freezePacket(last []byte) []byte {
+	packet := make([]byte, PacketSize)
+	frameSize := Channels * 2
+	if len(last) < frameSize {
+		return packet
+	}
+	frame := last[len(last)-frameSize:]
+	for i := 0; i < len(packet); i += frameSize {
+		copy(packet[i:], frame)
+	}
+	return packet
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// framePacket makes a packet whose last stereo frame is (left, right)
+// and whose other samples are tag
+func framePacket(tag, left, right int16) []byte {
+	packet := make([]byte, PacketSize)
+	for i := 0; i < PacketSize; i += 2 {
+		binary.LittleEndian.PutUint16(packet[i:], uint16(tag))
+	}
+	binary.LittleEndian.PutUint16(packet[PacketSize-4:], uint16(left))
+	binary.LittleEndian.PutUint16(packet[PacketSize-2:], uint16(right))
+	return packet
+}
+
+// playLossScenario delivers packets 0, 1 and 4, with 2 and 3 lost, and
+// returns the packets the jitter buffer then holds
+func playLossScenario(t *testing.T, policy LossPolicy) [][]byte {
+	t.Helper()
+	jb := NewJitterBuffer()
+	jb.SetLossPolicy(policy)
+	jb.AddSequencedPacket(0, framePacket(10, 1, 2))
+	jb.AddSequencedPacket(1, framePacket(11, 3, 4))
+	jb.AddSequencedPacket(4, framePacket(14, 5, 6))
+	// Give up on the gap as if packet 4 had waited out the gap timeout
+	jb.reorderBuffer.buffer[4].arrived = time.Now().Add(-time.Second)
+	jb.AddSequencedPacket(6, framePacket(16, 7, 8))
+
+	var played [][]byte
+	for {
+		packet, ok := jb.GetPacket()
+		if !ok {
+			return played
+		}
+		played = append(played, packet)
+	}
+}
+
+// TestLossFreeze tests that freeze holds the last frame for the gap
+func TestLossFreeze(t *testing.T) {
+	played := playLossScenario(t, LossFreeze)
+	if len(played) != 5 {
+		t.Fatalf("expected 2 packets, 2 frozen and 1 after the gap, got %d", len(played))
+	}
+	frozen := freezePacket(played[1])
+	for _, i := range []int{2, 3} {
+		if !bytes.Equal(played[i], frozen) {
+			t.Errorf("packet %d: expected the last frame of packet 1 repeated", i)
+		}
+	}
+	if left := int16(binary.LittleEndian.Uint16(played[2][0:])); left != 3 {
+		t.Errorf("expected the frozen left sample 3, got %d", left)
+	}
+	if right := int16(binary.LittleEndian.Uint16(played[2][PacketSize-2:])); right != 4 {
+		t.Errorf("expected the frozen right sample 4, got %d", right)
+	}
+	if tag := int16(binary.LittleEndian.Uint16(played[4][0:])); tag != 14 {
+		t.Errorf("expected packet 4 after the freeze, got tag %d", tag)
+	}
+}
+
+// TestLossSkip tests that skip plays on from the packet after the gap
+func TestLossSkip(t *testing.T) {
+	played := playLossScenario(t, LossSkip)
+	if len(played) != 3 {
+		t.Fatalf("expected 3 packets with the gap skipped, got %d", len(played))
+	}
+	for i, want := range []int16{10, 11, 14} {
+		if tag := int16(binary.LittleEndian.Uint16(played[i][0:])); tag != want {
+			t.Errorf("packet %d: expected tag %d, got %d", i, want, tag)
+		}
+	}
+}
+
+// TestParseLossPolicy tests -on-loss validation
+func TestParseLossPolicy(t *testing.T) {
+	for _, s := range []string{"skip", "freeze"} {
+		if _, err := parseLossPolicy(s); err != nil {
+			t.Errorf("unexpected error for %q: %v", s, err)
+		}
+	}
+	if _, err := parseLossPolicy("repeat"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
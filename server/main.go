@@ -1,23 +1,26 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/binary"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gordonklaus/portaudio"
 )
 
-// Audio parameters
-const (
+// Audio parameters. These are the defaults; -sample-rate, -channels and
+// -frames replace them through setStreamParams before anything is sized
+// from them. Clients must be run with the same values.
+var (
 	SampleRate = 48000 // Hz
 	Channels   = 2     // Stereo
 
@@ -25,68 +28,59 @@ const (
 	PacketSize      = FramesPerBuffer * Channels * 2 // 2 bytes per int16 sample
 )
 
-// SequencedPacket represents a packet with sequence number for reordering
-type SequencedPacket struct {
-	sequence uint32
-	data     []byte
-}
-
-// PacketReorderBuffer handles out-of-order packet reordering
-type PacketReorderBuffer struct {
-	buffer     map[uint32]*SequencedPacket
-	nextSeq    uint32
-	maxLatency int // Maximum number of packets to wait for reordering
-}
-
-// NewPacketReorderBuffer creates a new packet reordering buffer
-func NewPacketReorderBuffer(maxLatency int) *PacketReorderBuffer {
-	return &PacketReorderBuffer{
-		buffer:     make(map[uint32]*SequencedPacket),
-		nextSeq:    0,
-		maxLatency: maxLatency,
-	}
-}
-
-// AddPacket adds a packet with sequence number
-func (prb *PacketReorderBuffer) AddPacket(seq uint32, data []byte) {
-	prb.buffer[seq] = &SequencedPacket{sequence: seq, data: data}
-}
-
-// GetNextPacket returns the next packet in sequence, or nil if not available
-func (prb *PacketReorderBuffer) GetNextPacket() []byte {
-	if packet, exists := prb.buffer[prb.nextSeq]; exists {
-		delete(prb.buffer, prb.nextSeq)
-		prb.nextSeq++
-		return packet.data
-	}
-	return nil
-}
+// DefaultResyncThreshold is the buffer level treated as a severe overflow
+const DefaultResyncThreshold = 100
 
-// HasPendingPackets returns true if there are packets waiting for reordering
-func (prb *PacketReorderBuffer) HasPendingPackets() bool {
-	return len(prb.buffer) > 0
-}
-
-// CleanupOldPackets removes packets that are too old to wait for
-func (prb *PacketReorderBuffer) CleanupOldPackets() {
-	for seq := range prb.buffer {
-		if seq < prb.nextSeq {
-			delete(prb.buffer, seq)
-		}
-	}
-}
+// DefaultMaxSilence is how long silence is played before the stream is
+// declared ended. It is converted to packets once the stream parameters
+// are known.
+const DefaultMaxSilence = 10 * time.Second
 
 // JitterBuffer manages audio packets with adaptive sizing and underflow prevention
 type JitterBuffer struct {
-	packets       chan []byte
+	packets       PacketQueue
 	bufferLevel   int64
 	minBufferSize int
 	maxBufferSize int
-	targetSize    int
+	targetSize    int64 // Read by the stats loop, so accessed atomically
 	highWaterMark int
 	lowWaterMark  int
 	stats         BufferStats
 	reorderBuffer *PacketReorderBuffer
+	averageLevel  *LevelAverage // Smoothed level for adaptive decisions
+	silence       []byte        // Shared zeroed packet, never written to
+	dropPolicy    DropPolicy    // Which packet to discard on overflow
+	lossPolicy    LossPolicy    // What plays in place of packets given up on
+	lastPacket    []byte        // Last packet released in order, for LossFreeze
+
+	// Both the receiver and the cleanup tick add packets, so adding is
+	// serialized to keep the queue single-producer and the order intact
+	addMu sync.Mutex
+
+	// Underflows are concealed by fading out a copy of the last packet
+	// played over concealPackets packets. Only the player touches these.
+	concealPackets int
+	concealRun     int // Packets concealed since the last real one
+	lastPlayed     []byte
+	concealed      []byte
+
+	// Cold start uses a larger target until the stream has been healthy for stabilizeAfter
+	coldTargetSize int
+	warmTargetSize int
+	stabilizeAfter time.Duration
+	startTime      int64 // UnixNano of the first packet, 0 until then
+	lastUnderflow  int64 // UnixNano of the most recent underflow
+
+	// The stream is declared ended after maxSilence consecutive silence packets
+	consecutiveSilence int64
+	maxSilence         int64
+
+	// With -adaptive-target, the target follows the measured jitter of
+	// packets reaching the buffer
+	arrivals *InterArrivalEstimator
+
+	// With -admission-pace, bursts are staged here and admitted gradually
+	admission *AdmissionQueue
 }
 
 // BufferStats tracks buffer performance metrics
@@ -95,12 +89,16 @@ type BufferStats struct {
 	overflows      int64
 	silencePackets int64
 	totalPackets   int64
+	resyncDrops    int64
+
+	// Silence packets that repeated faded audio instead of being silent
+	concealedPackets int64
 }
 
 // NewJitterBuffer creates a new adaptive jitter buffer
 func NewJitterBuffer() *JitterBuffer {
 	return &JitterBuffer{
-		packets:       make(chan []byte, 200), // Increased capacity
+		packets:       newPacketQueue(QueueChannel, 200), // Increased capacity
 		minBufferSize: 5,
 		maxBufferSize: 200,
 		targetSize:    20,
@@ -108,36 +106,163 @@ func NewJitterBuffer() *JitterBuffer {
 		lowWaterMark:  10,
 		stats:         BufferStats{},
 		reorderBuffer: NewPacketReorderBuffer(50), // Wait up to 50 packets for reordering
+		averageLevel:  NewLevelAverage(DefaultLevelSmoothing),
+		silence:       make([]byte, PacketSize),
+		dropPolicy:    DropNewest,
+		lossPolicy:    LossSkip,
+
+		coldTargetSize: 20,
+		warmTargetSize: 20,
+		stabilizeAfter: DefaultStabilizeAfter,
+
+		maxSilence:     int64(DefaultMaxSilence / PacketDuration),
+		concealPackets: DefaultConcealPackets,
 	}
 }
 
 // AddPacket adds a packet to the buffer with overflow protection
 func (jb *JitterBuffer) AddPacket(packet []byte) {
-	select {
-	case jb.packets <- packet:
+	jb.addMu.Lock()
+	defer jb.addMu.Unlock()
+	jb.addPacket(packet, time.Now())
+}
+
+// addPacket adds a packet that arrived at now, staging it if it is part of
+// a burst being admitted gradually
+func (jb *JitterBuffer) addPacket(packet []byte, now time.Time) {
+	if jb.arrivals != nil {
+		jb.arrivals.Record(now)
+	}
+	if jb.admission != nil && jb.admission.Stage(packet, now, func(p []byte) { jb.admit(p, now) }) {
+		return
+	}
+	jb.admit(packet, now)
+}
+
+// admit pushes packet into the queue, applying the drop policy if it is full
+func (jb *JitterBuffer) admit(packet []byte, now time.Time) {
+	if jb.packets.Push(packet) {
+		atomic.AddInt64(&jb.bufferLevel, 1)
+		atomic.AddInt64(&jb.stats.totalPackets, 1)
+		atomic.CompareAndSwapInt64(&jb.startTime, 0, now.UnixNano())
+		return
+	}
+	atomic.AddInt64(&jb.stats.overflows, 1)
+	if jb.dropPolicy == DropOldest {
+		log.Println("Jitter buffer overflow - dropping oldest packet")
+		jb.evictOldest(packet)
+		return
+	}
+	log.Println("Jitter buffer overflow - dropping packet")
+}
+
+// evictOldest discards the packet at the head of the buffer to make room
+// for packet. If the room is taken before packet can be added, packet is
+// dropped instead. Popping from the producer side needs a queue that
+// allows several consumers, so this isn't available with QueueSPSC.
+func (jb *JitterBuffer) evictOldest(packet []byte) {
+	if _, ok := jb.packets.Pop(); ok {
+		atomic.AddInt64(&jb.bufferLevel, -1)
+	}
+	if jb.packets.Push(packet) {
 		atomic.AddInt64(&jb.bufferLevel, 1)
 		atomic.AddInt64(&jb.stats.totalPackets, 1)
-	default:
-		atomic.AddInt64(&jb.stats.overflows, 1)
-		log.Println("Jitter buffer overflow - dropping packet")
+	}
+}
+
+// SetDropPolicy chooses which packet AddPacket discards when the buffer is full
+func (jb *JitterBuffer) SetDropPolicy(policy DropPolicy) {
+	jb.dropPolicy = policy
+}
+
+// SetQueue replaces the packet queue with an empty one of the given kind.
+// It must be called before any packets are added.
+func (jb *JitterBuffer) SetQueue(kind QueueKind) {
+	jb.packets = newPacketQueue(kind, jb.packets.Cap())
+}
+
+// SetLossPolicy chooses what plays in place of packets the reorder buffer gives up on
+func (jb *JitterBuffer) SetLossPolicy(policy LossPolicy) {
+	jb.lossPolicy = policy
+}
+
+// AddSequencedPacket passes a packet through the reorder buffer and adds
+// any packets that are now in order to the jitter buffer
+func (jb *JitterBuffer) AddSequencedPacket(seq uint32, data []byte) {
+	jb.reorderBuffer.AddPacket(seq, data)
+	jb.releaseOrdered()
+}
+
+// releaseOrdered adds the packets the reorder buffer now releases in order
+// to the jitter buffer
+func (jb *JitterBuffer) releaseOrdered() {
+	jb.addMu.Lock()
+	defer jb.addMu.Unlock()
+	for {
+		orderedPacket, skipped := jb.reorderBuffer.NextPacket()
+		if orderedPacket == nil {
+			break
+		}
+		if skipped > 0 && jb.lossPolicy == LossFreeze {
+			// Hold the last frame for as long as the missing packets would
+			// have played; gaps longer than the reorder window are skipped
+			if skipped > jb.reorderBuffer.maxLatency {
+				skipped = jb.reorderBuffer.maxLatency
+			}
+			freeze := freezePacket(jb.lastPacket)
+			for i := 0; i < skipped; i++ {
+				jb.addPacket(freeze, time.Now())
+			}
+		}
+		jb.addPacket(orderedPacket, time.Now())
+		jb.lastPacket = orderedPacket
+	}
+}
+
+// RunCleanup releases packets whose gap has timed out and drops those too
+// late to be played, every interval until stop is closed. The gap timeout
+// is otherwise only checked when a packet arrives, so after a loss followed
+// by silence on the wire the packets behind the gap would wait until
+// cleanup evicted them.
+func (jb *JitterBuffer) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			jb.releaseOrdered()
+			jb.reorderBuffer.CleanupOldPackets()
+		case <-stop:
+			return
+		}
 	}
 }
 
 // GetPacket retrieves a packet from the buffer
 func (jb *JitterBuffer) GetPacket() ([]byte, bool) {
-	select {
-	case packet := <-jb.packets:
+	if packet, ok := jb.packets.Pop(); ok {
 		atomic.AddInt64(&jb.bufferLevel, -1)
+		atomic.StoreInt64(&jb.consecutiveSilence, 0)
 		return packet, true
-	default:
-		atomic.AddInt64(&jb.stats.underflows, 1)
-		return nil, false
 	}
+	atomic.AddInt64(&jb.stats.underflows, 1)
+	atomic.StoreInt64(&jb.lastUnderflow, time.Now().UnixNano())
+	return nil, false
 }
 
 // GetBufferLevel returns current buffer level
+// The counter is updated after the queue operation it tracks, so it can be
+// momentarily out by one while an add and a get race; it is clamped to the
+// range the queue can actually hold.
 func (jb *JitterBuffer) GetBufferLevel() int {
-	return int(atomic.LoadInt64(&jb.bufferLevel))
+	level := int(atomic.LoadInt64(&jb.bufferLevel))
+	if level < 0 {
+		return 0
+	}
+	if level > jb.packets.Cap() {
+		return jb.packets.Cap()
+	}
+	return level
 }
 
 // ShouldInsertSilence determines if silence should be inserted
@@ -146,10 +271,37 @@ func (jb *JitterBuffer) ShouldInsertSilence() bool {
 	return level < jb.lowWaterMark
 }
 
-// IsBufferFull checks if buffer is approaching capacity
+// IsBufferFull checks if the smoothed buffer level is approaching capacity
 func (jb *JitterBuffer) IsBufferFull() bool {
-	level := jb.GetBufferLevel()
-	return level > jb.highWaterMark
+	return jb.averageLevel.Value() > float64(jb.highWaterMark)
+}
+
+// Resync drops packets down to the target size in one step if the buffer
+// holds more than threshold packets, and returns the number dropped.
+// Draining one extra packet per loop is too slow to recover from a burst.
+func (jb *JitterBuffer) Resync(threshold int) int {
+	if threshold <= 0 || jb.GetBufferLevel() <= threshold {
+		return 0
+	}
+	dropped := 0
+	for jb.GetBufferLevel() > jb.GetTargetSize() {
+		if _, ok := jb.GetPacket(); !ok {
+			break
+		}
+		dropped++
+	}
+	atomic.AddInt64(&jb.stats.resyncDrops, int64(dropped))
+	return dropped
+}
+
+// UpdateAverageLevel feeds the current level into the smoothed level and returns it
+func (jb *JitterBuffer) UpdateAverageLevel() float64 {
+	return jb.averageLevel.Update(jb.GetBufferLevel())
+}
+
+// SetLevelSmoothing sets the weight of each reading in the smoothed level
+func (jb *JitterBuffer) SetLevelSmoothing(alpha float64) {
+	jb.averageLevel = NewLevelAverage(alpha)
 }
 
 // GetStats returns current buffer statistics
@@ -159,25 +311,369 @@ func (jb *JitterBuffer) GetStats() BufferStats {
 		overflows:      atomic.LoadInt64(&jb.stats.overflows),
 		silencePackets: atomic.LoadInt64(&jb.stats.silencePackets),
 		totalPackets:   atomic.LoadInt64(&jb.stats.totalPackets),
+		resyncDrops:    atomic.LoadInt64(&jb.stats.resyncDrops),
+
+		concealedPackets: atomic.LoadInt64(&jb.stats.concealedPackets),
+	}
+}
+
+// Since returns the change in each counter from an earlier snapshot. The
+// zero value as prev gives the totals, for the first interval.
+func (s BufferStats) Since(prev BufferStats) BufferStats {
+	return BufferStats{
+		underflows:     s.underflows - prev.underflows,
+		overflows:      s.overflows - prev.overflows,
+		silencePackets: s.silencePackets - prev.silencePackets,
+		totalPackets:   s.totalPackets - prev.totalPackets,
+		resyncDrops:    s.resyncDrops - prev.resyncDrops,
+
+		concealedPackets: s.concealedPackets - prev.concealedPackets,
+	}
+}
+
+// Plus returns the sum of s and other, as for the buffers of several clients
+func (s BufferStats) Plus(other BufferStats) BufferStats {
+	return BufferStats{
+		underflows:     s.underflows + other.underflows,
+		overflows:      s.overflows + other.overflows,
+		silencePackets: s.silencePackets + other.silencePackets,
+		totalPackets:   s.totalPackets + other.totalPackets,
+		resyncDrops:    s.resyncDrops + other.resyncDrops,
+
+		concealedPackets: s.concealedPackets + other.concealedPackets,
 	}
 }
 
-// InsertSilencePacket creates a silent audio packet
+// InsertSilencePacket returns a silent audio packet.
+// The returned slice is shared between calls and must not be modified.
 func (jb *JitterBuffer) InsertSilencePacket() []byte {
 	atomic.AddInt64(&jb.stats.silencePackets, 1)
-	return make([]byte, PacketSize) // Zero-filled buffer = silence
+	atomic.AddInt64(&jb.consecutiveSilence, 1)
+	return jb.silence // Zero-filled buffer = silence
+}
+
+// SetMaxSilence sets how many consecutive silence packets end the stream (0 disables)
+func (jb *JitterBuffer) SetMaxSilence(packets int) {
+	jb.maxSilence = int64(packets)
+}
+
+// StreamEnded reports whether silence has been inserted for maxSilence
+// consecutive packets, meaning the client has most likely gone away
+func (jb *JitterBuffer) StreamEnded() bool {
+	return jb.maxSilence > 0 && atomic.LoadInt64(&jb.consecutiveSilence) >= jb.maxSilence
+}
+
+// Reset discards all buffered audio and returns to the cold start state,
+// ready for a new stream
+func (jb *JitterBuffer) Reset() {
+	for {
+		if _, ok := jb.packets.Pop(); !ok {
+			break
+		}
+		atomic.AddInt64(&jb.bufferLevel, -1)
+	}
+	jb.reorderBuffer.Reset()
+	atomic.StoreInt64(&jb.consecutiveSilence, 0)
+	atomic.StoreInt64(&jb.startTime, 0)
+	atomic.StoreInt64(&jb.lastUnderflow, 0)
+	jb.lastPlayed = jb.lastPlayed[:0] // A new stream mustn't conceal with the old one's audio
+	jb.averageLevel.Reset()
+	if jb.arrivals != nil {
+		jb.arrivals.Reset()
+	}
+	if jb.admission != nil {
+		jb.admission.Reset()
+	}
+	jb.setTarget(jb.coldTargetSize)
 }
 
 func main() {
 	listenPort := flag.Int("port", 8080, "Port to listen for audio stream")
 	serverVolume := flag.Float64("volume", 1.0, "Server-side volume adjustment (0.0 to 1.0)")
 	clientControlAddrStr := flag.String("client-control-addr", "", "Client address (IP:Port) for sending control messages (e.g., 127.0.0.1:8081)")
+	comfortNoiseLevel := flag.Int("comfort-noise", 16, fmt.Sprintf("Peak amplitude of comfort noise played while pre-buffering (0 to %d, 0 disables)", MaxComfortNoiseLevel))
+	comfortNoiseSeed := flag.Int64("comfort-noise-seed", 1, "Random seed for comfort noise generation")
+	pprofAddr := flag.String("pprof-addr", "", "Address (host:port) to serve net/http/pprof profiling endpoints on (disabled if empty)")
+	volumeCurveStr := flag.String("volume-curve", string(VolumeCurveLinear), "Mapping from the volume setting to output gain (linear or log)")
+	reorderCap := flag.Int("reorder-cap", DefaultReorderCap, "Maximum packets held in the reorder buffer")
+	reorderEvictGaps := flag.Bool("reorder-evict-gaps", false, "When the reorder buffer is full, give up on its oldest gap so the freshest contiguous audio keeps playing, instead of evicting a waiting packet")
+	reorderMaxAge := flag.Duration("reorder-max-age", DefaultReorderMaxAge, "Maximum time a packet may wait in the reorder buffer for missing packets")
+	coldTarget := flag.Int("cold-target", 30, "Jitter buffer target (packets) while the stream is starting up")
+	warmTarget := flag.Int("warm-target", 20, "Jitter buffer target (packets) once the stream has stabilized")
+	maxSilence := flag.Duration("max-silence", DefaultMaxSilence, "Silence after which the stream is declared ended and the server waits for a new one (0 disables)")
+	stabilizeAfter := flag.Duration("stabilize-after", DefaultStabilizeAfter, "Time without underflows before switching from the cold to the warm target")
+	adaptiveTarget := flag.Bool("adaptive-target", false, "Size the jitter buffer target from the measured packet inter-arrival jitter instead of -cold-target and -warm-target")
+	targetLatencyMs := flag.Int("target-latency-ms", 0, "Desired total output latency in milliseconds; the steady state buffer target is tuned toward it (0 disables)")
+	levelSmoothing := flag.Float64("level-smoothing", DefaultLevelSmoothing, "Weight of each reading in the smoothed buffer level used for adaptive decisions (0 to 1, 1 disables smoothing)")
+	treatMono := flag.Bool("treat-mono", false, "Process only one channel while the source is detected as mono duplicated to both channels")
+	httpSinkAddr := flag.String("http-sink-addr", "", "Address (host:port) to serve the played audio on as a chunked HTTP stream (disabled if empty)")
+	httpSinkPath := flag.String("http-sink-path", "/stream", "URL path of the HTTP audio stream")
+	httpSinkFormat := flag.String("http-sink-format", SinkFormatRaw, "Format of the HTTP audio stream: raw (bare PCM) or wav (PCM after a WAV header, playable in browsers)")
+	resyncThreshold := flag.Int("resync-threshold", DefaultResyncThreshold, "Buffer level (packets) above which the buffer is dropped straight back to its target (0 disables)")
+	statsInterval := flag.Duration("stats-interval", DefaultStatsInterval, "How often to log stats and write -stats-csv rows")
+	statsAlways := flag.Bool("stats-always", false, "Log buffer, device and ingress stats every interval, even when nothing has gone wrong")
+	reportOnSignal := flag.Bool("report-on-signal", false, fmt.Sprintf("Print a full stats snapshot whenever the server receives %s, without stopping it", reportSignalName))
+	statsCSVPath := flag.String("stats-csv", "", "Append a row of buffer and network stats to this CSV file every stats interval")
+	useOutputCallback := flag.Bool("output-callback", false, "Let PortAudio pull audio from a callback instead of writing it from a blocking loop")
+	primeBuffers := flag.Int("prime-buffers", 0, "Buffers of silence written to the output device before playback, so its own buffer isn't empty for the first real audio (not with -output-callback)")
+	outputBuffers := flag.Int("output-buffers", 0, "With -output-callback, number of buffers filled ahead of the callback so it never allocates or waits on the jitter buffer (0 fills from the callback)")
+	pinThread := flag.Bool("pin-thread", false, "Lock the playback goroutine (the write loop or -output-buffers filler) to one OS thread to reduce scheduling jitter")
+	raisePriority := flag.Bool("raise-priority", false, "Raise the playback thread's priority (implies -pin-thread; may need elevated privileges)")
+	verifyPattern := flag.Bool("verify-pattern", false, "Check received audio against the mock-client's -pattern and report mismatches")
+	readBatchSize := flag.Int("read-batch", DefaultReadBatchSize, "Maximum datagrams to read per syscall where supported (1 disables batching)")
+	paceWrites := flag.Bool("pace-writes", false, "Produce output buffers at a steady rate from the sample clock instead of relying on stream.Write blocking (ignored with -output-callback)")
+	outputClockStr := flag.String("output-clock", string(ClockDevice), "What paces playback: device (blocking writes to the output device) or software (a timer at the sample rate, for outputs with no device clock; not with -output-callback)")
+	nullOutput := flag.Bool("null-output", false, "Open no output device; audio only reaches -http-sink-addr and -verify-pattern, paced by -output-clock software")
+	negotiate := flag.Bool("negotiate", false, "Wait for a client's handshake (client -handshake) and play at the sample rate, channels and frames it asks for instead of -sample-rate, -channels and -frames")
+	sampleRate := flag.Int("sample-rate", defaultStreamParams.SampleRate, fmt.Sprintf("Sample rate of the stream in Hz (%d to %d); clients must send at the same rate", MinSampleRate, MaxSampleRate))
+	channels := flag.Int("channels", defaultStreamParams.Channels, "Channels to play: 1 (mono) or 2 (stereo); clients must send the same number, though stereo also accepts downmixed 5.1 and 7.1")
+	frames := flag.Int("frames", defaultStreamParams.FramesPerBuffer, fmt.Sprintf("Audio frames per packet (%d to %d); clients must use the same value", MinFrames, MaxFrames))
+	mtu := flag.Int("mtu", DefaultMTU, "Link MTU to check the packet size against (e.g. 65535 for loopback); the default packet size is only checked if this is given")
+	recordPath := flag.String("record", "", "Also write everything played, after the server volume and including silence, to this WAV file")
+	outputDevices := flag.String("output-devices", "", "Comma-separated output device indices or names to play on simultaneously, instead of the default device (not with -output-callback)")
+	autoPauseAfter := flag.Duration("auto-pause", 0, "Stop the output device after this long of silence and restart it when audio returns (0 disables; not with -output-callback)")
+	concealPackets := flag.Int("conceal-packets", DefaultConcealPackets, fmt.Sprintf("On underflow, repeat the last packet fading out over this many packets instead of playing silence (0 to %d, 0 disables)", MaxConcealPackets))
+	onLoss := flag.String("on-loss", string(LossSkip), "When packets are lost: skip (play on from the next packet) or freeze (hold the last frame for the gap, keeping timing)")
+	admissionPace := flag.Float64("admission-pace", 0, fmt.Sprintf("Stage packets arriving in a burst and admit them to the jitter buffer at this multiple of the playback rate, e.g. 2 (up to %d; 0 admits them immediately)", MaxAdmissionPace))
+	jitterQueue := flag.String("jitter-queue", string(QueueChannel), "Jitter buffer queue: chan (buffered channel) or spsc (lock-free ring, incompatible with -drop-policy oldest)")
+	dropPolicyStr := flag.String("drop-policy", string(DropNewest), "Packet to discard when the jitter buffer is full: newest (keep buffered audio) or oldest (keep latency low)")
+	allowSources := flag.String("allow", "", "Comma-separated subnets (CIDR) or addresses to accept audio from; empty accepts any")
+	denySources := flag.String("deny", "", "Comma-separated subnets (CIDR) or addresses to drop audio from, overriding -allow")
+	simulateLatency := flag.Duration("simulate-latency", 0, "Delay every received packet by this long before it reaches the jitter buffer, simulating a longer network path (for testing)")
+	ingressPPS := flag.Float64("ingress-pps", 0, "Maximum datagrams per second accepted from each source; excess is dropped (0 disables)")
+	ingressBurst := flag.Int("ingress-burst", DefaultIngressBurst, "Datagrams a source may send back to back before -ingress-pps applies")
+	crossfadeMs := flag.Int("crossfade-ms", 0, "Fade real audio in over this many milliseconds when it resumes after inserted silence, to avoid clicks (0 disables, at most one packet)")
+	statsConfig := flag.Bool("stats-config", false, "Include the received stream's sample rate, channels, format, codec and transport in the stats log and -stats-csv")
+	clientTimeout := flag.Duration("client-timeout", DefaultClientTimeout, "Announce a client as left after this long without packets or keepalives (0 disables join/leave announcements)")
+	startupTimeout := flag.Duration("startup-timeout", 0, fmt.Sprintf("Exit with code %d if no audio arrives within this long of starting (0 waits forever)", ExitNoAudio))
+	deadStreamTimeout := flag.Duration("dead-stream-timeout", 0, fmt.Sprintf("Exit with code %d if audio stops for this long once it has started (0 waits forever)", ExitAudioStopped))
+	mixClients := flag.Bool("mix-clients", false, "Give each client its own jitter buffer and mix them all into the output, instead of treating every packet as one stream")
+	mixTimeout := flag.Duration("mix-timeout", DefaultClientTimeout, "With -mix-clients, stop mixing a client after this long without packets")
+	psk := flag.String("psk", "", "Pre-shared key: accept only audio, handshakes and key exchanges tagged with it and tag everything sent to the client with it (clients need the same -psk)")
+	encrypt := flag.Bool("encrypt", false, "Accept only audio encrypted with a session key agreed with each client (clients need -encrypt)")
+	eventWebhook := flag.String("event-webhook", "", "URL to POST client join/leave events to as JSON")
+	controlAPIAddr := flag.String("control-api-addr", "", "Serve console commands over HTTP on this address (e.g. 127.0.0.1:8092); requires -control-api-token")
+	controlAPIToken := flag.String("control-api-token", "", "Bearer token callers of the HTTP control API must present")
+	controlVersion := flag.Int("control-version", 0, "Client control protocol version: 0 (bare volume, any client) or 1 (framed, needs a current client)")
+	statsSkew := flag.Bool("stats-skew", false, "Estimate the sender's clock skew in ppm from sequenced packet arrivals and include it in the stats log and -stats-csv")
+	statsMemory := flag.Bool("stats-memory", false, "Include buffer, reorder map and per-source table sizes in the stats log and -stats-csv, to make memory growth visible")
+	ackInterval := flag.Duration("ack-interval", DefaultAckInterval, "How often to acknowledge delivered packets to the client with -control-version 1 (0 disables)")
+	presetName := flag.String("preset", "", "Tuned settings for low-latency or robust (lossy network) playback; flags given explicitly take precedence")
+	endian := flag.String("endian", "little", "Byte order of samples from senders that don't flag it in the packet header (little or big)")
 	flag.Parse()
 
+	// Apply the preset to any setting not given explicitly
+	var outputPreset *preset
+	if *presetName != "" {
+		p, err := presetConfig(*presetName)
+		if err != nil {
+			log.Fatalf("Invalid preset: %v", err)
+		}
+		outputPreset = &p
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["cold-target"] {
+			*coldTarget = p.coldTarget
+		}
+		if !set["warm-target"] {
+			*warmTarget = p.warmTarget
+		}
+		if !set["resync-threshold"] {
+			*resyncThreshold = p.resyncThreshold
+		}
+		if !set["drop-policy"] {
+			*dropPolicyStr = string(p.dropPolicy)
+		}
+		if !set["prime-buffers"] && !*useOutputCallback {
+			*primeBuffers = p.primeBuffers
+		}
+	}
+
 	if *serverVolume < 0.0 || *serverVolume > 1.0 {
 		log.Fatalf("Server volume must be between 0.0 and 1.0")
 	}
+	volumeCurve, err := parseVolumeCurve(*volumeCurveStr)
+	if err != nil {
+		log.Fatalf("Invalid volume curve: %v", err)
+	}
+	dropPolicy, err := parseDropPolicy(*dropPolicyStr)
+	if err != nil {
+		log.Fatalf("Invalid drop policy: %v", err)
+	}
+	streamParams := StreamParams{SampleRate: *sampleRate, Channels: *channels, FramesPerBuffer: *frames, BytesPerSample: 2}
+	// Clients send the default packet size whatever the link, so it is only
+	// checked for fragmentation once the packet size or the MTU is configured
+	checkMTU := 0
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "sample-rate", "channels", "frames", "mtu":
+			checkMTU = *mtu
+		}
+	})
+	packetWarnings, err := checkPacketSize(streamParams, checkMTU)
+	if err != nil {
+		log.Fatalf("Invalid stream parameters: %v", err)
+	}
+	setStreamParams(streamParams)
+	if Channels != 2 && (*treatMono || *verifyPattern) {
+		log.Fatalf("-treat-mono and -verify-pattern need -channels 2")
+	}
+	if !*negotiate {
+		log.Printf("Expecting %d-byte audio packets plus a %d-byte header (%v); configure clients to match",
+			streamParams.PayloadSize(), HeaderSize, streamParams)
+	}
+	for _, warning := range packetWarnings {
+		log.Printf("Warning: %s", warning)
+	}
+	lossPolicy, err := parseLossPolicy(*onLoss)
+	if err != nil {
+		log.Fatalf("Invalid loss policy: %v", err)
+	}
+	if *outputDevices != "" && *useOutputCallback {
+		log.Fatalf("-output-devices writes to each device in turn and can't be combined with -output-callback")
+	}
+	outputClock, err := parseClockKind(*outputClockStr)
+	if err != nil {
+		log.Fatalf("Invalid output clock: %v", err)
+	}
+	if *nullOutput {
+		if *useOutputCallback || *outputDevices != "" {
+			log.Fatalf("-null-output opens no device and can't be combined with -output-callback or -output-devices")
+		}
+		// Nothing blocks on a device, so only a software clock can pace playback
+		outputClock = ClockSoftware
+	}
+	if outputClock == ClockSoftware && *useOutputCallback {
+		log.Fatalf("-output-clock %s paces the write loop and can't be combined with -output-callback", ClockSoftware)
+	}
+	if outputClock == ClockSoftware && *paceWrites {
+		log.Fatalf("-pace-writes already paces writes from the sample clock and can't be combined with -output-clock %s", ClockSoftware)
+	}
+	if *simulateLatency < 0 || *simulateLatency > MaxSimulatedLatency {
+		log.Fatalf("Simulated latency must be between 0 and %v", MaxSimulatedLatency)
+	}
+	if *concealPackets < 0 || *concealPackets > MaxConcealPackets {
+		log.Fatalf("Conceal packets must be between 0 and %d", MaxConcealPackets)
+	}
+	if *autoPauseAfter < 0 {
+		log.Fatalf("Auto-pause delay must not be negative")
+	}
+	if *autoPauseAfter > 0 && *useOutputCallback {
+		log.Fatalf("-auto-pause stops the stream the output callback runs on and can't be combined with -output-callback")
+	}
+	queueKind, err := parseQueueKind(*jitterQueue)
+	if err != nil {
+		log.Fatalf("Invalid jitter queue: %v", err)
+	}
+	if *admissionPace != 0 && (*admissionPace <= 1 || *admissionPace > MaxAdmissionPace) {
+		// At the playback rate or slower, a burst would stay staged for good
+		log.Fatalf("Admission pace must be 0, or above 1 and at most %d", MaxAdmissionPace)
+	}
+	if queueKind == QueueSPSC && *admissionPace > 0 {
+		log.Fatalf("-jitter-queue %s has a single producer, so it can't be combined with -admission-pace", QueueSPSC)
+	}
+	if queueKind == QueueSPSC && dropPolicy == DropOldest {
+		log.Fatalf("-jitter-queue %s has a single consumer, so it can't evict on overflow with -drop-policy %s", QueueSPSC, DropOldest)
+	}
+	var sourceFilter *SourceFilter
+	if *allowSources != "" || *denySources != "" {
+		sourceFilter, err = NewSourceFilter(*allowSources, *denySources)
+		if err != nil {
+			log.Fatalf("Invalid source filter: %v", err)
+		}
+	}
+	byteOrder, err := parseByteOrder(*endian)
+	if err != nil {
+		log.Fatalf("Invalid endian: %v", err)
+	}
+	volume, err := NewVolume(*serverVolume)
+	if err != nil {
+		log.Fatalf("Invalid server volume: %v", err)
+	}
+	if *reorderCap < 1 {
+		log.Fatalf("Reorder cap must be at least 1")
+	}
+	if *reorderMaxAge <= 0 {
+		log.Fatalf("Reorder max age must be positive")
+	}
+	if *coldTarget < 2 || *warmTarget < 2 {
+		log.Fatalf("Jitter buffer targets must be at least 2 packets")
+	}
+	if *maxSilence < 0 {
+		log.Fatalf("Max silence must not be negative")
+	}
+	if *resyncThreshold < 0 {
+		log.Fatalf("Resync threshold must not be negative")
+	}
+	if *levelSmoothing <= 0 || *levelSmoothing > 1 {
+		log.Fatalf("Level smoothing must be greater than 0 and at most 1")
+	}
+	if *adaptiveTarget && *targetLatencyMs > 0 {
+		log.Fatalf("-adaptive-target can't be combined with -target-latency-ms")
+	}
+	if *targetLatencyMs < 0 {
+		log.Fatalf("Target latency must not be negative")
+	}
+	if *ingressPPS < 0 || *ingressBurst < 1 {
+		log.Fatalf("Ingress rate must not be negative and burst must be at least 1")
+	}
+	if *controlVersion != 0 && *controlVersion != ControlVersion {
+		log.Fatalf("Control version must be 0 or %d", ControlVersion)
+	}
+	if *controlAPIAddr != "" && *controlAPIToken == "" {
+		log.Fatalf("The control API requires -control-api-token")
+	}
+	if *clientTimeout < 0 {
+		log.Fatalf("Client timeout must not be negative")
+	}
+	if *startupTimeout < 0 || *deadStreamTimeout < 0 {
+		log.Fatalf("Startup and dead stream timeouts must not be negative")
+	}
+	// Set when the watchdog declares the stream dead. Deferred first so it
+	// runs last, once the rest of the cleanup is done.
+	var exitCode int32
+	defer func() {
+		if code := atomic.LoadInt32(&exitCode); code != 0 {
+			os.Exit(int(code))
+		}
+	}()
+	if *mixClients && (*treatMono || *verifyPattern) {
+		log.Fatalf("-mix-clients can't be combined with -treat-mono or -verify-pattern")
+	}
+	if *mixTimeout <= 0 {
+		log.Fatalf("Mix timeout must be positive")
+	}
+	if *crossfadeMs < 0 {
+		log.Fatalf("Crossfade length must not be negative")
+	}
+	if *primeBuffers < 0 || *primeBuffers > MaxPrimeBuffers {
+		log.Fatalf("Prime buffers must be between 0 and %d", MaxPrimeBuffers)
+	}
+	if *primeBuffers > 0 && *useOutputCallback {
+		log.Fatalf("-prime-buffers only applies to blocking writes and can't be combined with -output-callback")
+	}
+	if *outputBuffers < 0 {
+		log.Fatalf("Output buffers must not be negative")
+	}
+	if *statsInterval <= 0 {
+		log.Fatalf("Stats interval must be positive")
+	}
+	if *readBatchSize < 1 {
+		log.Fatalf("Read batch size must be at least 1")
+	}
+	if *httpSinkAddr != "" && !strings.HasPrefix(*httpSinkPath, "/") {
+		log.Fatalf("HTTP sink path must start with /")
+	}
+	if *httpSinkFormat != SinkFormatRaw && *httpSinkFormat != SinkFormatWAV {
+		log.Fatalf("Unknown HTTP sink format %q (expected %q or %q)", *httpSinkFormat, SinkFormatRaw, SinkFormatWAV)
+	}
+	if *comfortNoiseLevel < 0 || *comfortNoiseLevel > MaxComfortNoiseLevel {
+		log.Fatalf("Comfort noise level must be between 0 and %d", MaxComfortNoiseLevel)
+	}
 
+	if *pprofAddr != "" {
+		startPprofServer(*pprofAddr)
+	}
 	// Resolve UDP address to listen on for audio stream
 	audioAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", *listenPort))
 	if err != nil {
@@ -191,11 +687,39 @@ func main() {
 	}
 	defer audioConn.Close()
 
+	var pskKey []byte
+	if *psk != "" {
+		pskKey = []byte(*psk)
+	}
+
+	// With -negotiate, the first client's handshake sets the stream
+	// parameters, so nothing may be sized from them before this
+	if *negotiate {
+		log.Printf("Waiting on UDP port %d for a client handshake to set the stream parameters", *listenPort)
+		if _, err := negotiateStream(audioConn, *mtu, pskKey); err != nil {
+			log.Fatalf("Error waiting for a client handshake: %v", err)
+		}
+		if Channels != 2 && (*treatMono || *verifyPattern) {
+			log.Println("Warning: -treat-mono and -verify-pattern need stereo and are disabled")
+			*treatMono, *verifyPattern = false, false
+		}
+	}
+
+	var httpSink *StreamFanout
+	if *httpSinkAddr != "" {
+		httpSink = NewStreamFanout(HTTPSinkQueue)
+		if *httpSinkFormat == SinkFormatWAV {
+			httpSink.SetWAVHeader()
+		}
+		startHTTPSink(*httpSinkAddr, *httpSinkPath, httpSink)
+	}
+
 	fmt.Printf("Server started. Listening for audio on UDP port %d with server volume %.2f\\n", *listenPort, *serverVolume)
 	fmt.Println("Waiting for audio stream...")
 	fmt.Println("Press Ctrl+C to stop.")
 
 	// Handle client control if address is provided
+	var clientControl io.Writer
 	if *clientControlAddrStr != "" {
 		clientControlAddr, err := net.ResolveUDPAddr("udp", *clientControlAddrStr)
 		if err != nil {
@@ -207,44 +731,12 @@ func main() {
 			log.Fatalf("Error creating UDP control connection: %v", err)
 		}
 		defer controlConn.Close()
+		clientControl = controlConn
+		if pskKey != nil {
+			clientControl = newSigningWriter(controlConn, pskKey)
+		}
 
 		fmt.Printf("Ready to send client volume control to %s\\n", *clientControlAddrStr)
-		fmt.Println("Enter new client volume (0.0-1.0) and press Enter:")
-
-		// Goroutine to read volume from stdin and send to client
-		go func() {
-			reader := bufio.NewReader(os.Stdin)
-			for {
-				fmt.Print("> ")
-				input, _ := reader.ReadString('\n')
-				input = input[:len(input)-1] // Remove newline
-
-				newVolume, err := strconv.ParseFloat(input, 64)
-				if err != nil {
-					fmt.Println("Invalid input. Please enter a number between 0.0 and 1.0.")
-					continue
-				}
-				if newVolume < 0.0 || newVolume > 1.0 {
-					fmt.Println("Volume must be between 0.0 and 1.0.")
-					continue
-				}
-
-				// Convert float64 to byte slice
-				buf := new(bytes.Buffer)
-				err = binary.Write(buf, binary.LittleEndian, newVolume)
-				if err != nil {
-					log.Printf("Error encoding volume for sending: %v", err)
-					continue
-				}
-
-				_, err = controlConn.Write(buf.Bytes())
-				if err != nil {
-					log.Printf("Error sending client volume control: %v", err)
-				} else {
-					fmt.Printf("Sent client volume: %.2f\\n", newVolume)
-				}
-			}
-		}()
 	}
 
 	// Initialize PortAudio
@@ -254,123 +746,413 @@ func main() {
 	}
 	defer portaudio.Terminate()
 
+	// Create adaptive jitter buffer. With -mix-clients each client gets
+	// one configured the same way.
+	newBuffer := func() *JitterBuffer {
+		jb := NewJitterBuffer()
+		jb.reorderBuffer.SetMaxAge(*reorderMaxAge)
+		jb.reorderBuffer.SetCapacity(*reorderCap, *reorderEvictGaps)
+		jb.SetTargets(*coldTarget, *warmTarget, *stabilizeAfter)
+		// Rounded up, so a -max-silence shorter than a packet doesn't disable it
+		jb.SetMaxSilence(int((*maxSilence + PacketDuration - 1) / PacketDuration))
+		jb.SetLevelSmoothing(*levelSmoothing)
+		jb.SetDropPolicy(dropPolicy)
+		jb.SetQueue(queueKind)
+		jb.SetLossPolicy(lossPolicy)
+		jb.SetConcealment(*concealPackets)
+		jb.SetAdaptiveTarget(*adaptiveTarget)
+		jb.SetAdmissionPace(*admissionPace)
+		if outputPreset != nil {
+			jb.minBufferSize = outputPreset.preBuffer
+		}
+		return jb
+	}
+	jitterBuffer := newBuffer()
+	var mixer *ClientMixer
+	if *mixClients {
+		mixer = NewClientMixer(*mixTimeout, newBuffer)
+		log.Printf("Mixing clients, each with its own jitter buffer")
+	}
+
+	// Device-level xruns, tracked separately from network jitter
+	var deviceStats DeviceStats
+
 	// Create output stream
+	// With -output-callback, PortAudio asks the player for audio from its
+	// callback instead of the playback loop writing it
+	player := NewPlayer(jitterBuffer, volume, volumeCurve)
 	outputBuffer := make([]int16, FramesPerBuffer*Channels) // 16-bit stereo samples
-	stream, err := portaudio.OpenDefaultStream(0, Channels, SampleRate, FramesPerBuffer, outputBuffer)
-	if err != nil {
-		log.Fatalf("Error opening default output stream: %v", err)
+	if *recordPath != "" {
+		player.recorder, err = CreateWAVRecorder(*recordPath, SampleRate, Channels)
+		if err != nil {
+			log.Fatalf("Error creating recording: %v", err)
+		}
+		log.Printf("Recording played audio to %s", *recordPath)
+	}
+	var streamBuffer interface{} = outputBuffer
+	var outputRing *OutputRing
+	if *useOutputCallback && *outputBuffers > 0 {
+		outputRing = NewOutputRing(*outputBuffers, FramesPerBuffer*Channels)
+		streamBuffer = ringOutputCallback(outputRing, &deviceStats)
+	} else if *useOutputCallback {
+		streamBuffer = outputCallback(player, &deviceStats)
+	}
+	// With -output-devices, each device has its own stream and buffer and
+	// the prepared buffer is copied to each
+	var stream *portaudio.Stream
+	var outputStreams []*portaudio.Stream
+	var multiSink *MultiSink
+	if *nullOutput {
+		log.Println("Playing to no output device")
+	} else if *outputDevices != "" {
+		multiSink, outputStreams, err = openOutputSinks(*outputDevices, outputPreset != nil && outputPreset.highLatencyOutput)
+		if err != nil {
+			log.Fatalf("Error opening output devices: %v", err)
+		}
+		stream = outputStreams[0]
+	} else {
+		if outputPreset != nil {
+			stream, err = openOutputStream(outputPreset.highLatencyOutput, streamBuffer)
+		} else {
+			stream, err = portaudio.OpenDefaultStream(0, Channels, float64(SampleRate), FramesPerBuffer, streamBuffer)
+		}
+		if err != nil {
+			log.Fatalf("Error opening default output stream: %v", err)
+		}
+		outputStreams = []*portaudio.Stream{stream}
+	}
+	for _, s := range outputStreams {
+		defer s.Close()
 	}
-	defer stream.Close()
 
-	// Create adaptive jitter buffer
-	jitterBuffer := NewJitterBuffer()
+	// Tune the steady state target toward the requested latency, accounting for the device's own latency
+	var latencyController *LatencyController
+	if *targetLatencyMs > 0 {
+		var deviceLatency time.Duration
+		if stream == nil {
+			// With -null-output there's no device latency to account for
+		} else if info := stream.Info(); info != nil {
+			deviceLatency = info.OutputLatency
+		}
+		latencyController = NewLatencyController(time.Duration(*targetLatencyMs)*time.Millisecond, deviceLatency, 2, MaxLatencyTarget)
+		log.Printf("Targeting %dms output latency (device latency %v)", *targetLatencyMs, deviceLatency)
+	}
+
+	var patternVerifier *PatternVerifier
+	if *verifyPattern {
+		patternVerifier = &PatternVerifier{}
+	}
 
 	// Goroutine to read from network and send to jitter buffer
-	go func() {
-		for {
-			buffer := make([]byte, PacketSize+4) // +4 for sequence number
-			n, _, err := audioConn.ReadFromUDP(buffer)
-			if err != nil {
-				log.Printf("Error reading UDP packet: %v", err)
-				continue
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, shutdownSignals...)
+	stop := closeOnce(done)
+	go awaitShutdown(interrupts, stop)
+	receiver := NewReceiver(jitterBuffer)
+	receiver.byteOrder = byteOrder
+	receiver.reply = audioConn.WriteToUDP
+	receiver.filter = sourceFilter
+	if pskKey != nil {
+		receiver.psk = pskKey
+		log.Println("Accepting only audio authenticated with the pre-shared key")
+	}
+	if *encrypt {
+		receiver.sessionKeys = NewSessionKeys()
+		log.Println("Accepting only encrypted audio")
+	}
+	receiver.mixer = mixer
+	if *statsSkew {
+		receiver.skew = NewClockSkew(DefaultSkewWindow)
+	}
+	if *clientTimeout > 0 {
+		receiver.sources = NewSourceTracker(*clientTimeout)
+		receiver.protocols = NewProtocolTracker(*clientTimeout)
+		receiver.sessions = NewSessionTracker(*clientTimeout)
+		receiver.onSession = sessionAnnouncer(*eventWebhook)
+		go receiver.sessions.RunExpiry(time.Second, receiver.onSession, ctx.Done())
+	}
+	if *ingressPPS > 0 {
+		receiver.limiter = NewIngressLimiter(*ingressPPS, float64(*ingressBurst))
+	}
+	if *simulateLatency > 0 {
+		receiver.delay = NewDelayQueue(*simulateLatency)
+		go receiver.delay.Run(receiver.HandleDatagram, ctx.Done())
+		log.Printf("Simulating %v of extra network latency", *simulateLatency)
+	}
+	if *startupTimeout > 0 || *deadStreamTimeout > 0 {
+		receiver.watchdog = NewStreamWatchdog(*startupTimeout, *deadStreamTimeout, time.Now())
+		go runStatsTicker(WatchdogInterval, ctx.Done(), func() {
+			code, reason := receiver.watchdog.Check(time.Now())
+			if code != 0 && atomic.CompareAndSwapInt32(&exitCode, 0, int32(code)) {
+				log.Printf("%s, exiting with code %d", reason, code)
+				stop()
 			}
-			if n == PacketSize+4 {
-				// Extract sequence number (first 4 bytes)
-				seq := binary.LittleEndian.Uint32(buffer[:4])
-				audioData := buffer[4:n]
-
-				// Add to reorder buffer
-				jitterBuffer.reorderBuffer.AddPacket(seq, audioData)
-
-				// Try to get packets in order and add to jitter buffer
-				for {
-					if orderedPacket := jitterBuffer.reorderBuffer.GetNextPacket(); orderedPacket != nil {
-						jitterBuffer.AddPacket(orderedPacket)
-					} else {
-						break
-					}
-				}
+		})
+	}
+	go receiveLoop(ctx, audioConn, receiver, *readBatchSize)
 
-				// Periodically clean up old packets
-				jitterBuffer.reorderBuffer.CleanupOldPackets()
-			} else if n == PacketSize {
-				// Fallback for packets without sequence numbers (legacy support)
-				jitterBuffer.AddPacket(buffer[:n])
-			} else {
-				log.Printf("Received packet of unexpected size: %d bytes (expected %d or %d)", n, PacketSize, PacketSize+4)
-			}
+	// Operator commands from stdin and, with -control-api-addr, over HTTP
+	console := &Console{volume: volume, clientControl: clientControl, controlVersion: *controlVersion, jb: jitterBuffer, receiver: receiver}
+	fmt.Println(consoleHelp)
+	go console.Run(os.Stdin, os.Stdout)
+	if clientControl != nil && *controlVersion == ControlVersion && *ackInterval > 0 {
+		go console.RunAcks(*ackInterval, ctx.Done())
+	}
+	if *controlAPIAddr != "" {
+		startControlAPI(*controlAPIAddr, &ControlAPI{console: console, token: *controlAPIToken})
+	}
+
+	// Goroutine to periodically release packets past timed-out gaps and drop
+	// those that arrived too late to be played
+	go jitterBuffer.RunCleanup(ReorderCleanupInterval, nil)
+
+	// Goroutine to forget senders that have gone quiet
+	go receiver.RunExpiry(time.Second, ctx.Done())
+
+	var statsCSV *StatsCSV
+	if *statsCSVPath != "" {
+		header := statsCSVHeader
+		if *statsConfig {
+			header = append(append([]string(nil), header...), streamConfigCSVHeader...)
 		}
-	}()
+		if *statsSkew {
+			header = append(append([]string(nil), header...), clockSkewCSVHeader...)
+		}
+		if *statsMemory {
+			header = append(append([]string(nil), header...), memorySizesCSVHeader...)
+		}
+		statsCSV, err = OpenStatsCSV(*statsCSVPath, header)
+		if err != nil {
+			log.Fatalf("Error opening stats CSV: %v", err)
+		}
+		defer statsCSV.Close()
+	}
+
+	if *reportOnSignal {
+		reporter := &StatsReporter{jb: jitterBuffer, receiver: receiver, device: &deviceStats}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, reportSignal)
+		go runSignalReports(signals, ctx.Done(), func() {
+			log.Printf("Stats report:\n%v", reporter.Snapshot())
+		})
+		log.Printf("Send %s to the server (pid %d) for a stats report", reportSignalName, os.Getpid())
+	}
 
 	// Goroutine to periodically log buffer statistics
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			stats := jitterBuffer.GetStats()
-			level := jitterBuffer.GetBufferLevel()
-			if stats.underflows > 0 || stats.overflows > 0 || stats.silencePackets > 0 {
-				log.Printf("Buffer stats - Level: %d, Underflows: %d, Overflows: %d, Silence: %d, Total: %d",
-					level, stats.underflows, stats.overflows, stats.silencePackets, stats.totalPackets)
+	gate := StatsGate{always: *statsAlways}
+	var previous BufferStats
+	go runStatsTicker(*statsInterval, ctx.Done(), func() {
+		stats := jitterBuffer.GetStats()
+		delta := stats.Since(previous)
+		previous = stats
+		level := jitterBuffer.GetBufferLevel()
+		if statsCSV != nil {
+			row := formatStatsRow(time.Now(), level, stats, receiver.arrivals.Snapshot())
+			if *statsConfig {
+				row = append(row, receiver.Config().csvFields()...)
+			}
+			if *statsSkew {
+				row = append(row, receiver.skew.csvFields()...)
+			}
+			if *statsMemory {
+				row = append(row, gatherMemorySizes(jitterBuffer, receiver, httpSink).csvFields()...)
+			}
+			if err := statsCSV.Write(row); err != nil {
+				log.Printf("Error writing stats CSV: %v", err)
 			}
 		}
-	}()
+		if *statsConfig {
+			log.Printf("Stream config - %v", receiver.Config())
+		}
+		if *statsSkew {
+			log.Printf("Clock skew - %v", receiver.skew)
+		}
+		if *statsMemory {
+			sizes := gatherMemorySizes(jitterBuffer, receiver, httpSink)
+			log.Printf("Memory stats - Jitter packets: %d, Reorder packets: %d, Sources: %d, Rate limited sources: %d, Sessions: %d, Listeners: %d",
+				sizes.jitterPackets, sizes.reorderPackets, sizes.sources, sizes.rateLimited, sizes.sessions, sizes.listeners)
+		}
+		if gate.Buffer(stats) {
+			log.Printf("Buffer stats - Level: %d (avg %.1f, target %d), Underflows: %d (+%d), Overflows: %d (+%d), Silence: %d (+%d), Concealed: %d (+%d), Resync drops: %d (+%d), Total: %d (+%d)",
+				level, jitterBuffer.averageLevel.Value(), jitterBuffer.GetTargetSize(), stats.underflows, delta.underflows, stats.overflows, delta.overflows,
+				stats.silencePackets, delta.silencePackets, stats.concealedPackets, delta.concealedPackets, stats.resyncDrops, delta.resyncDrops, stats.totalPackets, delta.totalPackets)
+		}
+		device := deviceStats.Snapshot()
+		if gate.Device(device) {
+			log.Printf("Device stats - Underruns: %d, Overruns: %d, Errors: %d",
+				device.underruns, device.overruns, device.errors)
+		}
+		if multiSink != nil {
+			for _, sink := range multiSink.sinks {
+				device := sink.stats.Snapshot()
+				if gate.Device(device) {
+					log.Printf("Device stats (%s) - Underruns: %d, Overruns: %d, Errors: %d",
+						sink.name, device.underruns, device.overruns, device.errors)
+				}
+			}
+		}
+		if outputRing != nil {
+			if starved := outputRing.Starved(); gate.Count(starved) {
+				log.Printf("Output ring stats - Starved callbacks: %d", starved)
+			}
+		}
+		abandoned, evicted := jitterBuffer.reorderBuffer.CapStats()
+		if duplicates := jitterBuffer.reorderBuffer.Duplicates(); gate.Count(int64(abandoned + evicted + duplicates)) {
+			log.Printf("Reorder stats - Abandoned with gaps: %d, Evicted: %d, Duplicates: %d", abandoned, evicted, duplicates)
+		}
+		if malformed := receiver.Malformed(); gate.Count(malformed) {
+			log.Printf("Ingress stats - Malformed: %d", malformed)
+		}
+		if failures := receiver.AuthFailures(); gate.Count(failures) {
+			log.Printf("Ingress stats - Auth failures: %d", failures)
+		}
+		if switches := receiver.ProtocolSwitches(); gate.Count(switches) {
+			log.Printf("Ingress stats - Protocol switches: %d", switches)
+		}
+		if dropped := receiver.RateLimited(); gate.Count(dropped) {
+			log.Printf("Ingress stats - Rate limited: %d", dropped)
+		}
+		if mixer != nil {
+			log.Printf("Mixer stats - Clients: %d", mixer.Len())
+		}
+		if patternVerifier != nil {
+			pattern := patternVerifier.Stats()
+			log.Printf("Pattern verify - Frames: %d, Mismatches: %d, Discontinuities: %d",
+				pattern.frames, pattern.mismatches, pattern.discontinuities)
+		}
+	})
 
-	// Pre-buffering: wait until we have a minimum number of packets
-	fmt.Println("Pre-buffering audio...")
-	for jitterBuffer.GetBufferLevel() < jitterBuffer.minBufferSize {
-		time.Sleep(10 * time.Millisecond)
+	player.resyncThreshold = *resyncThreshold
+	player.treatMono = *treatMono
+	player.latency = latencyController
+	player.pattern = patternVerifier
+	player.sink = httpSink
+	player.mixer = mixer
+	player.SetComfortNoise(*comfortNoiseLevel, *comfortNoiseSeed)
+	player.SetCrossfade(*crossfadeMs)
+	pinPlayback := *pinThread || *raisePriority
+	if outputRing != nil {
+		// Start filling the ring before the stream so the first callbacks have audio
+		go func() {
+			if pinPlayback {
+				lockRealtimeThread(*raisePriority)
+			}
+			outputRing.Run(player.Fill, ctx.Done())
+		}()
 	}
-	fmt.Println("Pre-buffering complete. Starting playback.")
 
-	// Start the stream
-	err = stream.Start()
-	if err != nil {
-		log.Fatalf("Error starting output stream: %v", err)
+	// Pre-buffering: the player outputs comfort noise or silence until the
+	// buffer holds a minimum number of packets
+	fmt.Println("Pre-buffering audio...")
+	for _, s := range outputStreams {
+		if err := s.Start(); err != nil {
+			log.Fatalf("Error starting output stream: %v", err)
+		}
 	}
-	defer stream.Stop()
 
-	for {
-		var receiveBuffer []byte
-		var ok bool
-
-		// Get packet from jitter buffer or insert silence if underflow
-		if jitterBuffer.ShouldInsertSilence() {
-			receiveBuffer = jitterBuffer.InsertSilencePacket()
-		} else {
-			receiveBuffer, ok = jitterBuffer.GetPacket()
-			if !ok {
-				// This shouldn't happen due to ShouldInsertSilence check, but just in case
-				receiveBuffer = jitterBuffer.InsertSilencePacket()
+	// On shutdown, stop the devices before anything else so they stop
+	// pulling audio, then stop receiving and print the final stats. The
+	// deferred cleanup, down to portaudio.Terminate, runs as main returns.
+	var autoPause *AutoPause
+	finish := func() {
+		var streams []outputStopper
+		if autoPause == nil || !autoPause.Paused() {
+			for _, s := range outputStreams {
+				streams = append(streams, s)
 			}
 		}
-
-		// Read int16 samples from byte buffer
-		reader := bytes.NewReader(receiveBuffer)
-		for i := 0; i < len(outputBuffer); i++ {
-			var sample int16
-			err = binary.Read(reader, binary.LittleEndian, &sample)
-			if err != nil {
-				// This can happen if a packet is smaller than expected
-				break
+		stats := shutdown(streams, jitterBuffer, mixer)
+		cancel()
+		if player.recorder != nil {
+			if err := player.recorder.Close(); err != nil {
+				log.Printf("Error finishing recording: %v", err)
+			} else {
+				seconds := float64(player.recorder.Bytes()) / float64(2*Channels*SampleRate)
+				log.Printf("Recorded %.1fs of audio to %s", seconds, *recordPath)
 			}
-			// Apply server-side volume adjustment
-			outputBuffer[i] = int16(float64(sample) * *serverVolume)
 		}
+		log.Printf("Final buffer stats - %s", formatFinalStats(stats))
+	}
 
-		// If buffer is too full, consume an extra packet to speed up playback
-		if jitterBuffer.IsBufferFull() {
-			if extraPacket, ok := jitterBuffer.GetPacket(); ok {
-				// We consumed an extra packet but don't use it for audio
-				// This helps reduce latency when buffer is building up
-				_ = extraPacket
+	if *useOutputCallback {
+		// PortAudio pulls audio through the callback; nothing left to do
+		// here until shutdown
+		<-done
+		finish()
+		return
+	}
+
+	if pinPlayback {
+		lockRealtimeThread(*raisePriority)
+	}
+	var clock OutputClock = deviceClock{}
+	if *paceWrites {
+		clock = &Pacer{}
+	} else if outputClock == ClockSoftware {
+		ticker := NewTickerClock()
+		defer ticker.Stop()
+		clock = ticker
+	}
+	// While auto-paused nothing blocks on the device, so the idle pacer
+	// keeps buffers coming at the sample rate
+	var idle Pacer
+	if *autoPauseAfter > 0 {
+		autoPause = NewAutoPause(int(*autoPauseAfter / PacketDuration))
+	}
+	if stream != nil {
+		primeOutput(outputBuffer, *primeBuffers, func(buffer []int16) {
+			if multiSink != nil {
+				multiSink.Write(buffer)
+				return
 			}
+			deviceStats.Record(stream.Write())
+		})
+	}
+	for !stopped(done) {
+		clock.Wait()
+		player.Fill(outputBuffer)
+		if autoPause != nil {
+			switch autoPause.Observe(outputBuffer) {
+			case PauseStop:
+				log.Printf("Silent for %v, pausing the output device", *autoPauseAfter)
+				for _, s := range outputStreams {
+					if err := s.Stop(); err != nil {
+						log.Printf("Error stopping output stream: %v", err)
+					}
+				}
+				idle = Pacer{}
+			case PauseStart:
+				log.Println("Audio resumed, restarting the output device")
+				for _, s := range outputStreams {
+					if err := s.Start(); err != nil {
+						log.Printf("Error restarting output stream: %v", err)
+					}
+				}
+			}
+			if autoPause.Paused() {
+				if _, device := clock.(deviceClock); device {
+					idle.Wait()
+				}
+				continue
+			}
+		}
+		if multiSink != nil {
+			multiSink.Write(outputBuffer)
+			continue
+		}
+		if stream == nil {
+			continue // -null-output: the player has already fed the HTTP sink
 		}
 
 		// Write audio frames to output device
+		// Device xruns are counted and reported with the stats; only log other errors
 		err = stream.Write()
-		if err != nil {
+		if deviceStats.Record(err) == StreamErrorOther {
 			log.Printf("Error writing to stream: %v", err)
 		}
 	}
+	finish()
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -99,10 +100,10 @@ func TestJitterBufferUnderflowPrevention(t *testing.T) {
 		t.Error("expected ShouldInsertSilence to return true when buffer is low")
 	}
 
-	// Insert silence packet
+	// Insert silence packet, one packet of the configured int16 audio
 	silencePacket := jb.InsertSilencePacket()
-	if len(silencePacket) != PacketSize {
-		t.Errorf("expected silence packet length %d, got %d", PacketSize, len(silencePacket))
+	if want := FramesPerBuffer * Channels * 2; len(silencePacket) != want {
+		t.Errorf("expected silence packet length %d, got %d", want, len(silencePacket))
 	}
 
 	// Check that all bytes are zero (silence)
@@ -118,6 +119,37 @@ func TestJitterBufferUnderflowPrevention(t *testing.T) {
 	}
 }
 
+// TestSilencePacketNoAllocation tests that silence insertion reuses a single buffer
+func TestSilencePacketNoAllocation(t *testing.T) {
+	jb := NewJitterBuffer()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		jb.InsertSilencePacket()
+	})
+	if allocs != 0 {
+		t.Errorf("expected 0 allocations per silence insertion, got %.1f", allocs)
+	}
+
+	before := jb.GetStats().silencePackets
+	first := jb.InsertSilencePacket()
+	second := jb.InsertSilencePacket()
+	if &first[0] != &second[0] {
+		t.Error("expected silence packets to share the same backing buffer")
+	}
+	if stats := jb.GetStats(); stats.silencePackets != before+2 {
+		t.Errorf("expected %d silence packets, got %d", before+2, stats.silencePackets)
+	}
+}
+
+// BenchmarkInsertSilencePacket measures the cost of inserting a silence packet
+func BenchmarkInsertSilencePacket(b *testing.B) {
+	jb := NewJitterBuffer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		jb.InsertSilencePacket()
+	}
+}
+
 // TestJitterBufferOverflowProtection tests buffer overflow handling
 func TestJitterBufferOverflowProtection(t *testing.T) {
 	jb := NewJitterBuffer()
@@ -136,6 +168,59 @@ func TestJitterBufferOverflowProtection(t *testing.T) {
 	}
 }
 
+// TestJitterBufferDropPolicy tests which packet is discarded on overflow under each policy
+func TestJitterBufferDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy    DropPolicy
+		wantFirst byte // Packet played next after the overflow
+		wantLast  byte // Packet played last
+	}{
+		{DropNewest, 0, 199},
+		{DropOldest, 1, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			jb := NewJitterBuffer()
+			jb.SetDropPolicy(tt.policy)
+			for i := 0; i <= 200; i++ {
+				packet := make([]byte, PacketSize)
+				packet[0] = byte(i)
+				jb.AddPacket(packet)
+			}
+
+			if stats := jb.GetStats(); stats.overflows != 1 {
+				t.Errorf("expected 1 overflow, got %d", stats.overflows)
+			}
+			if level := jb.GetBufferLevel(); level != 200 {
+				t.Fatalf("expected the buffer to stay full at 200, got %d", level)
+			}
+			var played []byte
+			for {
+				packet, ok := jb.GetPacket()
+				if !ok {
+					break
+				}
+				played = append(played, packet[0])
+			}
+			if len(played) != 200 || played[0] != tt.wantFirst || played[199] != tt.wantLast {
+				t.Errorf("expected packets %d to %d, got %d packets from %d to %d",
+					tt.wantFirst, tt.wantLast, len(played), played[0], played[len(played)-1])
+			}
+		})
+	}
+}
+
+// TestParseDropPolicy tests -drop-policy parsing
+func TestParseDropPolicy(t *testing.T) {
+	if policy, err := parseDropPolicy("oldest"); err != nil || policy != DropOldest {
+		t.Errorf("expected oldest, got %q, %v", policy, err)
+	}
+	if _, err := parseDropPolicy("random"); err == nil {
+		t.Error("expected an error for an unknown drop policy")
+	}
+}
+
 // TestPacketReorderBuffer tests packet reordering functionality
 func TestPacketReorderBuffer(t *testing.T) {
 	prb := NewPacketReorderBuffer(10)
@@ -244,6 +329,72 @@ func TestJitterBufferConcurrentAccess(t *testing.T) {
 	}
 }
 
+// TestBufferLevelStaysInRange stresses concurrent adds and gets, checking the level is never
+// negative or above capacity
+func TestBufferLevelStaysInRange(t *testing.T) {
+	jb := NewJitterBuffer()
+	capacity := jb.packets.Cap()
+	stop := make(chan struct{})
+	var workers sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		workers.Add(2)
+		go func() {
+			defer workers.Done()
+			for j := 0; j < 20000; j++ {
+				jb.AddPacket(jb.silence)
+			}
+		}()
+		go func() {
+			defer workers.Done()
+			for j := 0; j < 20000; j++ {
+				jb.GetPacket()
+			}
+		}()
+	}
+
+	violations := make(chan int, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				close(violations)
+				return
+			default:
+			}
+			if level := jb.GetBufferLevel(); level < 0 || level > capacity {
+				violations <- level
+				close(violations)
+				return
+			}
+		}
+	}()
+
+	workers.Wait()
+	close(stop)
+	if level, ok := <-violations; ok {
+		t.Fatalf("buffer level %d outside [0, %d]", level, capacity)
+	}
+	if level, held := jb.GetBufferLevel(), jb.packets.Len(); level != held {
+		t.Errorf("expected the level to settle at the %d packets held, got %d", held, level)
+	}
+}
+
+// TestBufferStatsSince tests per-interval deltas between snapshots
+func TestBufferStatsSince(t *testing.T) {
+	first := BufferStats{underflows: 3, overflows: 1, silencePackets: 5, totalPackets: 900, resyncDrops: 0}
+	second := BufferStats{underflows: 4, overflows: 1, silencePackets: 9, totalPackets: 1840, resyncDrops: 20}
+
+	// The first interval has no previous snapshot, so its delta is the totals
+	if got := first.Since(BufferStats{}); got != first {
+		t.Errorf("expected the first interval to report the totals %+v, got %+v", first, got)
+	}
+	want := BufferStats{underflows: 1, overflows: 0, silencePackets: 4, totalPackets: 940, resyncDrops: 20}
+	if got := second.Since(first); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
 // TestBufferStats tests buffer statistics tracking
 func TestBufferStats(t *testing.T) {
 	jb := NewJitterBuffer()
@@ -306,3 +457,113 @@ func TestAtomicBufferLevel(t *testing.T) {
 		t.Error("expected buffer level to be updated atomically")
 	}
 }
+
+// TestStreamEndedAfterMaxSilence tests that the buffer resets after too much silence and resumes with new packets
+func TestStreamEndedAfterMaxSilence(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetMaxSilence(3)
+	jb.AddPacket(make([]byte, PacketSize))
+	jb.AddSequencedPacket(0, make([]byte, PacketSize))
+	jb.UpdateAverageLevel()
+	jb.GetPacket()
+
+	for i := 0; i < 2; i++ {
+		jb.InsertSilencePacket()
+	}
+	if jb.StreamEnded() {
+		t.Fatal("expected stream to still be live below the threshold")
+	}
+	jb.InsertSilencePacket()
+	if !jb.StreamEnded() {
+		t.Fatal("expected stream to have ended after 3 consecutive silence packets")
+	}
+
+	jb.Reset()
+	if jb.StreamEnded() {
+		t.Error("expected reset to clear the silence count")
+	}
+	if jb.GetBufferLevel() != 0 {
+		t.Errorf("expected empty buffer after reset, got level %d", jb.GetBufferLevel())
+	}
+	if jb.reorderBuffer.nextSeq != 0 {
+		t.Errorf("expected reorder buffer to restart at sequence 0, got %d", jb.reorderBuffer.nextSeq)
+	}
+	if jb.IsStable(time.Now().Add(time.Hour)) {
+		t.Error("expected reset to return to the cold start state")
+	}
+	if level := jb.averageLevel.Value(); level != 0 {
+		t.Errorf("expected reset to clear the average level, got %v", level)
+	}
+	if level := jb.UpdateAverageLevel(); level != 0 {
+		t.Errorf("expected the first reading after reset to seed the average, got %v", level)
+	}
+
+	// A new stream starting at sequence 0 plays normally
+	packet := make([]byte, PacketSize)
+	packet[0] = 42
+	jb.AddSequencedPacket(0, packet)
+	data, ok := jb.GetPacket()
+	if !ok || data[0] != 42 {
+		t.Fatalf("expected the new stream's first packet, got ok=%v", ok)
+	}
+	jb.InsertSilencePacket()
+	jb.InsertSilencePacket()
+	if jb.StreamEnded() {
+		t.Error("expected played packets to restart the silence count")
+	}
+}
+
+// TestStreamEndedDisabled tests that a zero threshold never ends the stream
+func TestStreamEndedDisabled(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetMaxSilence(0)
+	for i := 0; i < int(2*DefaultMaxSilence/PacketDuration); i++ {
+		jb.InsertSilencePacket()
+	}
+	if jb.StreamEnded() {
+		t.Error("expected stream end detection to be disabled")
+	}
+}
+
+// TestDefaultMaxSilenceFollowsStreamParams tests that the default silence
+// threshold is the same length of time whatever the packet duration
+func TestDefaultMaxSilenceFollowsStreamParams(t *testing.T) {
+	t.Cleanup(func() { setStreamParams(defaultStreamParams) })
+	for _, frames := range []int{128, 512, 2048} {
+		setStreamParams(StreamParams{SampleRate: 44100, Channels: 2, FramesPerBuffer: frames, BytesPerSample: 2})
+		jb := NewJitterBuffer()
+		if silence := time.Duration(jb.maxSilence) * PacketDuration; silence > DefaultMaxSilence || silence < DefaultMaxSilence-PacketDuration {
+			t.Errorf("%d frames: stream ends after %v of silence, want about %v", frames, silence, DefaultMaxSilence)
+		}
+	}
+}
+
+// TestResyncDropsToTarget tests that a severely overfull buffer is cut back to its target in one step
+func TestResyncDropsToTarget(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetTargets(20, 20, DefaultStabilizeAfter)
+	for i := 0; i < 150; i++ {
+		jb.AddPacket(make([]byte, PacketSize))
+	}
+
+	if dropped := jb.Resync(0); dropped != 0 {
+		t.Errorf("expected a zero threshold to disable resync, dropped %d", dropped)
+	}
+	if dropped := jb.Resync(150); dropped != 0 {
+		t.Errorf("expected no resync at the threshold, dropped %d", dropped)
+	}
+
+	if dropped := jb.Resync(100); dropped != 130 {
+		t.Errorf("expected 130 packets dropped, got %d", dropped)
+	}
+	if jb.GetBufferLevel() != 20 {
+		t.Errorf("expected level at target 20 after resync, got %d", jb.GetBufferLevel())
+	}
+	stats := jb.GetStats()
+	if stats.resyncDrops != 130 {
+		t.Errorf("expected 130 resync drops counted, got %d", stats.resyncDrops)
+	}
+	if stats.underflows != 0 {
+		t.Errorf("expected resync not to count underflows, got %d", stats.underflows)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGatherMemorySizes tests that the sizes match a populated server
+func TestGatherMemorySizes(t *testing.T) {
+	jb := NewJitterBuffer()
+	receiver := NewReceiver(jb)
+	receiver.limiter = NewIngressLimiter(1000, 1000)
+	receiver.sessions = NewSessionTracker(time.Minute)
+	receiver.onSession = func(SessionEvent) {}
+	sink := NewStreamFanout(HTTPSinkQueue)
+	sink.Subscribe()
+
+	// Two sources each send a packet in order and one that skips ahead
+	for i := 1; i <= 2; i++ {
+		addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5000}
+		receiver.HandleDatagram(addr, make([]byte, PacketSize))
+	}
+	jb.AddSequencedPacket(0, make([]byte, PacketSize))
+	jb.AddSequencedPacket(5, make([]byte, PacketSize))
+	jb.AddSequencedPacket(6, make([]byte, PacketSize))
+
+	want := MemorySizes{jitterPackets: 3, reorderPackets: 2, sources: 2, rateLimited: 2, sessions: 2, listeners: 1}
+	if got := gatherMemorySizes(jb, receiver, sink); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if got := strings.Join(want.csvFields(), ","); got != "3,2,2,2,2,1" {
+		t.Errorf("unexpected CSV fields %q", got)
+	}
+
+	// Optional parts are reported as zero when absent
+	if got := gatherMemorySizes(NewJitterBuffer(), nil, nil); got != (MemorySizes{}) {
+		t.Errorf("expected all zero sizes, got %+v", got)
+	}
+}
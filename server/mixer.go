@@ -0,0 +1,217 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientMixer gives every client, identified by its UDP source address, its
+// own jitter buffer and mixes the clients playing into one output buffer,
+// so several senders can share the server without corrupting each other
+type ClientMixer struct {
+	mu        sync.Mutex
+	clients   map[string]*mixerClient
+	timeout   time.Duration
+	newBuffer func() *JitterBuffer
+	mix       []int32 // Running sums, kept between calls to avoid allocating
+	samples   []int16 // One client's decoded packet
+}
+
+// mixerClient is one client's buffer and playback state
+type mixerClient struct {
+	jb       *JitterBuffer
+	lastSeen time.Time
+	waiting  bool          // Pre-buffering; not mixed until the buffer fills
+	stop     chan struct{} // Closed when reaped, ending the reorder cleanup
+	arrivals ArrivalStats  // This client's loss, before reordering
+	packets  int64         // Packets received from this client
+}
+
+// SourceStats describes one client being mixed
+type SourceStats struct {
+	Addr        string    `json:"addr"`
+	LastSeen    time.Time `json:"last_seen"`
+	Packets     int64     `json:"packets"`
+	LossPercent float64   `json:"loss_percent"`
+	Gain        float64   `json:"gain"` // Applied to the client in the mix, before the server volume
+}
+
+// NewClientMixer creates a mixer creating client buffers with newBuffer and
+// forgetting clients that send nothing for timeout
+func NewClientMixer(timeout time.Duration, newBuffer func() *JitterBuffer) *ClientMixer {
+	return &ClientMixer{
+		clients:   make(map[string]*mixerClient),
+		timeout:   timeout,
+		newBuffer: newBuffer,
+	}
+}
+
+// Buffer returns the jitter buffer for addr's audio, creating it for a new
+// client, and marks the client as active
+func (m *ClientMixer) Buffer(addr *net.UDPAddr) *JitterBuffer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := addr.String()
+	client, ok := m.clients[key]
+	if !ok {
+		client = &mixerClient{jb: m.newBuffer(), waiting: true, stop: make(chan struct{})}
+		m.clients[key] = client
+		go client.jb.RunCleanup(ReorderCleanupInterval, client.stop)
+		log.Printf("Mixing new client %s (%d clients)", key, len(m.clients))
+	}
+	client.lastSeen = time.Now()
+	return client.jb
+}
+
+// AddPacket adds a sequenced packet of int16 audio from addr
+func (m *ClientMixer) AddPacket(addr *net.UDPAddr, seq uint32, data []byte) {
+	m.Buffer(addr).AddSequencedPacket(seq, data)
+}
+
+// Record adds a datagram from addr that arrived at now to the client's
+// stats. Clients that aren't being mixed are ignored.
+func (m *ClientMixer) Record(addr *net.UDPAddr, now time.Time, info packetInfo) {
+	m.mu.Lock()
+	client, ok := m.clients[addr.String()]
+	if ok {
+		client.packets += int64(info.packets)
+	}
+	m.mu.Unlock()
+	if ok {
+		client.arrivals.Record(now, info)
+	}
+}
+
+// ActiveSources returns the stats of every client being mixed, ordered by
+// address
+func (m *ClientMixer) ActiveSources() []SourceStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sources := make([]SourceStats, 0, len(m.clients))
+	for key, client := range m.clients {
+		sources = append(sources, SourceStats{
+			Addr:        key,
+			LastSeen:    client.lastSeen,
+			Packets:     client.packets,
+			LossPercent: client.arrivals.Snapshot().LossPercent(),
+			Gain:        1, // Clients are summed unscaled
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Addr < sources[j].Addr })
+	return sources
+}
+
+// Reap forgets clients that have sent nothing for the timeout at now and
+// returns their addresses
+func (m *ClientMixer) Reap(now time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var reaped []string
+	for key, client := range m.clients {
+		if now.Sub(client.lastSeen) > m.timeout {
+			delete(m.clients, key)
+			close(client.stop)
+			reaped = append(reaped, key)
+		}
+	}
+	sort.Strings(reaped)
+	return reaped
+}
+
+// MixInto writes the next buffer of every playing client's audio, summed
+// sample by sample and clipped to the int16 range, to out. Clients still
+// pre-buffering add nothing; with none playing out is silent.
+func (m *ClientMixer) MixInto(out []int16) {
+	for _, key := range m.Reap(time.Now()) {
+		log.Printf("Client %s timed out, no longer mixing it", key)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.mix) < len(out) {
+		m.mix = make([]int32, len(out))
+	}
+	if len(m.samples) < len(out) {
+		m.samples = make([]int16, len(out))
+	}
+	mix := m.mix[:len(out)]
+	clear(mix)
+	for _, client := range m.clients {
+		packet, ok := client.next()
+		if !ok {
+			continue
+		}
+		n := bytesToInt16(packet, m.samples[:len(out)])
+		for i, sample := range m.samples[:n] {
+			mix[i] += int32(sample)
+		}
+	}
+	for i, sum := range mix {
+		out[i] = int16(max(math.MinInt16, min(math.MaxInt16, sum)))
+	}
+}
+
+// next returns the client's next packet to mix, or false while it is
+// pre-buffering. Underflows are concealed, and a client whose stream has
+// ended goes back to pre-buffering.
+func (c *mixerClient) next() ([]byte, bool) {
+	jb := c.jb
+	jb.AdmitStaged(time.Now())
+	if c.waiting {
+		if jb.GetBufferLevel() < jb.minBufferSize {
+			return nil, false
+		}
+		c.waiting = false
+	}
+	jb.UpdateTarget(time.Now())
+	if jb.StreamEnded() {
+		jb.Reset()
+		c.waiting = true
+		return nil, false
+	}
+	if jb.ShouldInsertSilence() {
+		return jb.ConcealLoss(), true
+	}
+	if packet, ok := jb.GetPacket(); ok {
+		jb.rememberPlayed(packet)
+		return packet, true
+	}
+	return jb.ConcealLoss(), true
+}
+
+// ClientBufferStats is one mixed client's final buffer statistics
+type ClientBufferStats struct {
+	Addr  string
+	Stats BufferStats
+}
+
+// Shutdown stops mixing every client: each one's buffered packets are
+// discarded and its reorder cleanup stopped. It returns each client's
+// final statistics, ordered by address.
+func (m *ClientMixer) Shutdown() []ClientBufferStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	final := make([]ClientBufferStats, 0, len(m.clients))
+	for key, client := range m.clients {
+		if level := client.jb.GetBufferLevel(); level > 0 {
+			log.Printf("Discarding %d buffered packets from %s", level, key)
+		}
+		client.jb.Reset()
+		close(client.stop)
+		delete(m.clients, key)
+		final = append(final, ClientBufferStats{Addr: key, Stats: client.jb.GetStats()})
+	}
+	sort.Slice(final, func(i, j int) bool { return final[i].Addr < final[j].Addr })
+	return final
+}
+
+// Len returns the number of clients being mixed
+func (m *ClientMixer) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.clients)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestMixer returns a mixer whose clients start playing on their first
+// packet and play whatever is buffered
+func newTestMixer(timeout time.Duration) *ClientMixer {
+	return NewClientMixer(timeout, func() *JitterBuffer {
+		jb := NewJitterBuffer()
+		jb.SetTargets(1, 1, time.Minute)
+		jb.minBufferSize = 1
+		return jb
+	})
+}
+
+// constantPacket returns a packet of PCM with every sample set to value
+func constantPacket(value int16) []byte {
+	samples := make([]int16, FramesPerBuffer*Channels)
+	for i := range samples {
+		samples[i] = value
+	}
+	packet := make([]byte, PacketSize)
+	int16ToBytes(samples, packet)
+	return packet
+}
+
+// TestClientMixerAddsClients tests that two clients' audio is summed sample
+// by sample and the sum clipped to the int16 range
+func TestClientMixerAddsClients(t *testing.T) {
+	a := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	b := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	m := newTestMixer(time.Minute)
+	m.AddPacket(a, 0, constantPacket(1000))
+	m.AddPacket(b, 0, constantPacket(-300))
+	m.AddPacket(a, 1, constantPacket(30000))
+	m.AddPacket(b, 1, constantPacket(30000))
+	if m.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", m.Len())
+	}
+
+	out := make([]int16, FramesPerBuffer*Channels)
+	m.MixInto(out)
+	for i, sample := range out {
+		if sample != 700 {
+			t.Fatalf("first mix sample %d = %d, want 700", i, sample)
+		}
+	}
+	m.MixInto(out)
+	for i, sample := range out {
+		if sample != 32767 {
+			t.Fatalf("second mix sample %d = %d, want clipped to 32767", i, sample)
+		}
+	}
+}
+
+// TestClientMixerReapsIdleClient tests that a client that stops sending is
+// dropped from the mix after the timeout while an active one keeps playing
+func TestClientMixerReapsIdleClient(t *testing.T) {
+	a := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	b := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	m := newTestMixer(time.Second)
+	m.AddPacket(a, 0, constantPacket(100))
+	m.AddPacket(b, 0, constantPacket(100))
+
+	// Only b is heard from after the timeout
+	later := time.Now().Add(2 * time.Second)
+	m.clients[b.String()].lastSeen = later
+	reaped := m.Reap(later)
+	if len(reaped) != 1 || reaped[0] != a.String() {
+		t.Fatalf("Reap() = %v, want [%v]", reaped, a)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("Len() = %d after reaping, want 1", m.Len())
+	}
+
+	out := make([]int16, FramesPerBuffer*Channels)
+	m.MixInto(out)
+	if out[0] != 100 {
+		t.Errorf("mix after reaping = %d, want only the remaining client's 100", out[0])
+	}
+}
+
+// TestClientMixerActiveSources tests that packets from several addresses
+// are reported per source, with each source's own loss
+func TestClientMixerActiveSources(t *testing.T) {
+	a := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	b := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	r := NewReceiver(NewJitterBuffer())
+	r.mixer = newTestMixer(time.Minute)
+
+	// a sends 0-3 without loss; b sends 0, 1 and 3, losing 2
+	for seq := uint32(0); seq < 4; seq++ {
+		r.HandleDatagram(a, sequencedPacket(seq))
+		if seq != 2 {
+			r.HandleDatagram(b, sequencedPacket(seq))
+		}
+	}
+
+	sources := r.mixer.ActiveSources()
+	if len(sources) != 2 {
+		t.Fatalf("got %d sources, want 2", len(sources))
+	}
+	if s := sources[0]; s.Addr != a.String() || s.Packets != 4 || s.LossPercent != 0 || s.Gain != 1 {
+		t.Errorf("first source %+v, want %v with 4 packets and no loss", s, a)
+	}
+	if s := sources[1]; s.Addr != b.String() || s.Packets != 3 || s.LossPercent != 25 {
+		t.Errorf("second source %+v, want %v with 3 packets and 25%% loss", s, b)
+	}
+	if time.Since(sources[1].LastSeen) > time.Minute {
+		t.Errorf("last seen %v, want just now", sources[1].LastSeen)
+	}
+}
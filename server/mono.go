@@ -0,0 +1,76 @@
+package main
+
+import "encoding/binary"
+
+// MonoDetectPackets is how many consecutive packets (about one second) must
+// have identical channels before the source is reported as mono
+const MonoDetectPackets = 94
+
+// isDualMono reports whether every frame of an int16 stereo packet has
+// identical left and right samples
+func isDualMono(packet []byte) bool {
+	for i := 0; i+4 <= len(packet); i += 4 {
+		if packet[i] != packet[i+2] || packet[i+1] != packet[i+3] {
+			return false
+		}
+	}
+	return true
+}
+
+// isSilentPacket reports whether a packet is digital silence
+func isSilentPacket(packet []byte) bool {
+	for _, b := range packet {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MonoDetector tracks whether the source is a mono signal duplicated to
+// both channels. Silent packets are ignored since they match trivially.
+type MonoDetector struct {
+	threshold int
+	run       int
+	mono      bool
+}
+
+// NewMonoDetector creates a detector reporting mono after threshold matching packets
+func NewMonoDetector(threshold int) *MonoDetector {
+	return &MonoDetector{threshold: threshold}
+}
+
+// Observe checks one packet and returns whether the source is considered
+// mono and whether that changed with this packet. A packet with differing
+// channels ends mono mode immediately.
+func (md *MonoDetector) Observe(packet []byte) (mono, changed bool) {
+	if isSilentPacket(packet) {
+		return md.mono, false
+	}
+	if !isDualMono(packet) {
+		md.run = 0
+		changed = md.mono
+		md.mono = false
+		return false, changed
+	}
+	md.run++
+	if !md.mono && md.run >= md.threshold {
+		md.mono = true
+		return true, true
+	}
+	return md.mono, false
+}
+
+// applyGainMono scales the left channel of an int16 stereo packet and
+// copies it to both output channels, halving the conversion work. If the
+// packet is short, the rest of dst is zeroed rather than left holding the
+// previous buffer's samples.
+func applyGainMono(dst []int16, packet []byte, gain float64) {
+	i := 0
+	for ; i+1 < len(dst) && i*2+2 <= len(packet); i += 2 {
+		sample := int16(float64(int16(binary.LittleEndian.Uint16(packet[i*2:]))) * gain)
+		dst[i] = sample
+		dst[i+1] = sample
+	}
+	clear(dst[i:])
+}
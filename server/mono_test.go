@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// stereoPacket builds an int16 stereo packet from left and right sample functions
+func stereoPacket(left, right func(i int) int16) []byte {
+	packet := make([]byte, PacketSize)
+	for i := 0; i < FramesPerBuffer; i++ {
+		binary.LittleEndian.PutUint16(packet[i*4:], uint16(left(i)))
+		binary.LittleEndian.PutUint16(packet[i*4+2:], uint16(right(i)))
+	}
+	return packet
+}
+
+// TestIsDualMono tests L==R detection on identical and differing channels
+func TestIsDualMono(t *testing.T) {
+	ramp := func(i int) int16 { return int16(i * 37) }
+	tests := []struct {
+		name   string
+		packet []byte
+		want   bool
+	}{
+		{"identical", stereoPacket(ramp, ramp), true},
+		{"inverted", stereoPacket(ramp, func(i int) int16 { return -ramp(i) }), false},
+		{"one frame differs", stereoPacket(ramp, func(i int) int16 {
+			if i == 300 {
+				return ramp(i) + 1
+			}
+			return ramp(i)
+		}), false},
+		{"high byte differs", stereoPacket(ramp, func(i int) int16 { return ramp(i) ^ 0x100 }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDualMono(tt.packet); got != tt.want {
+				t.Errorf("isDualMono() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMonoDetector tests that mono is reported only after consistent matching packets
+func TestMonoDetector(t *testing.T) {
+	ramp := func(i int) int16 { return int16(i*37 + 1) }
+	mono := stereoPacket(ramp, ramp)
+	stereo := stereoPacket(ramp, func(i int) int16 { return -ramp(i) })
+	silence := make([]byte, PacketSize)
+
+	md := NewMonoDetector(3)
+	for i := 0; i < 2; i++ {
+		if got, changed := md.Observe(mono); got || changed {
+			t.Fatalf("packet %d: expected not mono yet", i)
+		}
+	}
+	if got, _ := md.Observe(silence); got {
+		t.Fatal("expected silence not to count towards mono")
+	}
+	if got, changed := md.Observe(mono); !got || !changed {
+		t.Fatal("expected mono to be reported on the third matching packet")
+	}
+	if got, changed := md.Observe(silence); !got || changed {
+		t.Error("expected silence not to end mono mode")
+	}
+	if got, changed := md.Observe(stereo); got || !changed {
+		t.Error("expected differing channels to end mono mode immediately")
+	}
+}
+
+// TestApplyGainMono tests that the mono path matches per-channel processing
+func TestApplyGainMono(t *testing.T) {
+	ramp := func(i int) int16 { return int16(i*64 - 16000) }
+	packet := stereoPacket(ramp, ramp)
+	dst := make([]int16, FramesPerBuffer*Channels)
+	applyGainMono(dst, packet, 0.5)
+	for i := 0; i < FramesPerBuffer; i++ {
+		want := int16(float64(ramp(i)) * 0.5)
+		if dst[i*2] != want || dst[i*2+1] != want {
+			t.Fatalf("frame %d: expected %d on both channels, got %d and %d", i, want, dst[i*2], dst[i*2+1])
+		}
+	}
+}
+
+// TestApplyGainMonoShortPacket tests that the output past a short packet is
+// zeroed rather than left holding the previous packet's samples
+func TestApplyGainMonoShortPacket(t *testing.T) {
+	dst := make([]int16, FramesPerBuffer*Channels)
+	for i := range dst {
+		dst[i] = 1000
+	}
+	packet := stereoPacket(func(int) int16 { return 200 }, func(int) int16 { return 200 })[:10*Channels*2]
+	applyGainMono(dst, packet, 1)
+	for i, sample := range dst {
+		want := int16(0)
+		if i < 10*Channels {
+			want = 200
+		}
+		if sample != want {
+			t.Fatalf("sample %d: expected %d, got %d", i, want, sample)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// outputWriter is the part of *portaudio.Stream a blocking sink writes with
+type outputWriter interface {
+	Write() error
+}
+
+// OutputSink is one output device written from its own stream buffer
+type OutputSink struct {
+	name   string
+	stream outputWriter
+	buffer []int16 // The buffer the stream was opened with
+	stats  DeviceStats
+}
+
+// MultiSink plays each prepared buffer on several output devices. A
+// device that fails doesn't stop the others.
+type MultiSink struct {
+	sinks []*OutputSink
+}
+
+// Write copies buffer to every sink and writes it, counting each device's
+// xruns separately and logging its other errors
+func (m *MultiSink) Write(buffer []int16) {
+	for _, sink := range m.sinks {
+		copy(sink.buffer, buffer)
+		err := sink.stream.Write()
+		if sink.stats.Record(err) == StreamErrorOther {
+			log.Printf("Error writing to %s: %v", sink.name, err)
+		}
+	}
+}
+
+// resolveOutputDevices finds the output devices in a comma-separated list
+// of device indices and names
+func resolveOutputDevices(devices []*portaudio.DeviceInfo, list string) ([]*portaudio.DeviceInfo, error) {
+	var resolved []*portaudio.DeviceInfo
+	for _, spec := range strings.Split(list, ",") {
+		spec = strings.TrimSpace(spec)
+		device, err := findOutputDevice(devices, spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range resolved {
+			if d == device {
+				return nil, fmt.Errorf("output device %q listed twice", device.Name)
+			}
+		}
+		resolved = append(resolved, device)
+	}
+	return resolved, nil
+}
+
+// findOutputDevice finds an output device by index or case-insensitive name
+func findOutputDevice(devices []*portaudio.DeviceInfo, spec string) (*portaudio.DeviceInfo, error) {
+	if index, err := strconv.Atoi(spec); err == nil {
+		if index < 0 || index >= len(devices) {
+			return nil, fmt.Errorf("invalid device index %d, max index is %d", index, len(devices)-1)
+		}
+		if devices[index].MaxOutputChannels < Channels {
+			return nil, fmt.Errorf("device at index %d is not a stereo output device", index)
+		}
+		return devices[index], nil
+	}
+	for _, device := range devices {
+		if strings.EqualFold(device.Name, spec) && device.MaxOutputChannels >= Channels {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("output device %q not found", spec)
+}
+
+// openOutputSinks opens a blocking stream on each listed output device. The
+// streams are returned in order for starting, stopping and closing.
+func openOutputSinks(list string, highLatency bool) (*MultiSink, []*portaudio.Stream, error) {
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, nil, err
+	}
+	outputs, err := resolveOutputDevices(devices, list)
+	if err != nil {
+		return nil, nil, err
+	}
+	multi := &MultiSink{}
+	var streams []*portaudio.Stream
+	for _, device := range outputs {
+		buffer := make([]int16, FramesPerBuffer*Channels)
+		stream, err := openOutputDevice(device, highLatency, buffer)
+		if err != nil {
+			for _, s := range streams {
+				s.Close()
+			}
+			return nil, nil, fmt.Errorf("opening %s: %v", device.Name, err)
+		}
+		streams = append(streams, stream)
+		multi.sinks = append(multi.sinks, &OutputSink{name: device.Name, stream: stream, buffer: buffer})
+	}
+	return multi, streams, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// fakeOutputStream records the first sample of its buffer on each write
+type fakeOutputStream struct {
+	buffer  []int16
+	written []int16
+	err     error
+}
+
+func (s *fakeOutputStream) Write() error {
+	s.written = append(s.written, s.buffer[0])
+	return s.err
+}
+
+// TestMultiSinkWritesEverySink tests that each prepared buffer reaches
+// every sink, and that one device failing doesn't affect the others
+func TestMultiSinkWritesEverySink(t *testing.T) {
+	multi := &MultiSink{}
+	var fakes []*fakeOutputStream
+	for i, err := range []error{nil, errors.New("device unplugged"), portaudio.OutputUnderflowed} {
+		buffer := make([]int16, FramesPerBuffer*Channels)
+		fake := &fakeOutputStream{buffer: buffer, err: err}
+		fakes = append(fakes, fake)
+		multi.sinks = append(multi.sinks, &OutputSink{name: string(rune('A' + i)), stream: fake, buffer: buffer})
+	}
+
+	prepared := make([]int16, FramesPerBuffer*Channels)
+	for i := int16(1); i <= 3; i++ {
+		prepared[0] = i
+		multi.Write(prepared)
+	}
+	for i, fake := range fakes {
+		if len(fake.written) != 3 || fake.written[0] != 1 || fake.written[2] != 3 {
+			t.Errorf("sink %d: expected buffers 1-3, got %v", i, fake.written)
+		}
+	}
+	if stats := multi.sinks[1].stats.Snapshot(); stats.errors != 3 || stats.underruns != 0 {
+		t.Errorf("expected the failing sink to count 3 errors, got %+v", stats)
+	}
+	if stats := multi.sinks[2].stats.Snapshot(); stats.underruns != 3 || stats.errors != 0 {
+		t.Errorf("expected the underrunning sink to count 3 underruns, got %+v", stats)
+	}
+	if stats := multi.sinks[0].stats.Snapshot(); stats != (DeviceStats{}) {
+		t.Errorf("expected the healthy sink to count nothing, got %+v", stats)
+	}
+}
+
+// TestResolveOutputDevices tests finding output devices by index and name
+func TestResolveOutputDevices(t *testing.T) {
+	devices := []*portaudio.DeviceInfo{
+		{Name: "Microphone", MaxInputChannels: 2},
+		{Name: "Speakers", MaxOutputChannels: 2},
+		{Name: "Headphones", MaxOutputChannels: 2},
+	}
+	resolved, err := resolveOutputDevices(devices, "2, speakers")
+	if err != nil || len(resolved) != 2 || resolved[0] != devices[2] || resolved[1] != devices[1] {
+		t.Errorf("expected Headphones and Speakers, got %v (%v)", resolved, err)
+	}
+	for _, list := range []string{"0", "Microphone", "3", "Printer", "1,Speakers"} {
+		if _, err := resolveOutputDevices(devices, list); err == nil {
+			t.Errorf("expected an error for %q", list)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// OutputRing hands pre-filled output buffers from the player to the output
+// callback without locks or allocation, so the real-time callback never
+// waits on the jitter buffer. It is single-producer, single-consumer: one
+// goroutine fills buffers and the callback drains them.
+type OutputRing struct {
+	buffers [][]int16
+	read    uint64 // Buffers consumed by the callback
+	write   uint64 // Buffers filled by the producer
+	starved int64  // Callbacks that found the ring empty
+
+	// Signalled (without blocking) each time the callback frees a buffer
+	freed chan struct{}
+}
+
+// NewOutputRing creates a ring of size buffers of samples samples each
+func NewOutputRing(size, samples int) *OutputRing {
+	r := &OutputRing{
+		buffers: make([][]int16, size),
+		freed:   make(chan struct{}, 1),
+	}
+	for i := range r.buffers {
+		r.buffers[i] = make([]int16, samples)
+	}
+	return r
+}
+
+// Produce fills the next free buffer with fill and hands it to the
+// consumer, or returns false if every buffer is waiting to be played
+func (r *OutputRing) Produce(fill func(out []int16)) bool {
+	w := atomic.LoadUint64(&r.write)
+	if w-atomic.LoadUint64(&r.read) == uint64(len(r.buffers)) {
+		return false
+	}
+	fill(r.buffers[w%uint64(len(r.buffers))])
+	atomic.StoreUint64(&r.write, w+1)
+	return true
+}
+
+// Consume copies the oldest filled buffer to out and recycles it, or
+// writes silence and returns false if none is ready
+func (r *OutputRing) Consume(out []int16) bool {
+	rd := atomic.LoadUint64(&r.read)
+	if rd == atomic.LoadUint64(&r.write) {
+		clear(out)
+		atomic.AddInt64(&r.starved, 1)
+		return false
+	}
+	copy(out, r.buffers[rd%uint64(len(r.buffers))])
+	atomic.StoreUint64(&r.read, rd+1)
+	select {
+	case r.freed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Run keeps the ring full from fill until stop is closed, waiting for the
+// callback to free a buffer whenever it is full
+func (r *OutputRing) Run(fill func(out []int16), stop <-chan struct{}) {
+	for {
+		for r.Produce(fill) {
+		}
+		select {
+		case <-r.freed:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Starved returns how many callbacks found no buffer ready
+func (r *OutputRing) Starved() int64 {
+	return atomic.LoadInt64(&r.starved)
+}
+
+// ringOutputCallback returns a PortAudio output callback that plays buffers
+// from the ring, counting the xruns PortAudio reports
+func ringOutputCallback(ring *OutputRing, deviceStats *DeviceStats) func([]int16, portaudio.StreamCallbackTimeInfo, portaudio.StreamCallbackFlags) {
+	return func(out []int16, _ portaudio.StreamCallbackTimeInfo, flags portaudio.StreamCallbackFlags) {
+		deviceStats.RecordFlags(flags)
+		ring.Consume(out)
+	}
+}
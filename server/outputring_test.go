@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// TestOutputRingOrder tests that buffers reach the callback in order and
+// that the ring refuses to overwrite buffers not yet played
+func TestOutputRingOrder(t *testing.T) {
+	ring := NewOutputRing(3, 4)
+	next := int16(1)
+	fill := func(out []int16) {
+		out[0] = next
+		next++
+	}
+	for i := 0; i < 3; i++ {
+		if !ring.Produce(fill) {
+			t.Fatalf("expected buffer %d to be free", i)
+		}
+	}
+	if ring.Produce(fill) {
+		t.Fatal("expected a full ring to refuse another buffer")
+	}
+
+	out := make([]int16, 4)
+	for want := int16(1); want <= 3; want++ {
+		if !ring.Consume(out) || out[0] != want {
+			t.Fatalf("expected buffer %d, got %d", want, out[0])
+		}
+	}
+	out[0] = 9
+	if ring.Consume(out) || out[0] != 0 {
+		t.Errorf("expected silence from an empty ring, got %d", out[0])
+	}
+	if ring.Starved() != 1 {
+		t.Errorf("expected 1 starved callback, got %d", ring.Starved())
+	}
+}
+
+// TestOutputRingNoAllocation tests that sustained filling and playing
+// recycles the ring's buffers without allocating
+func TestOutputRingNoAllocation(t *testing.T) {
+	ring := NewOutputRing(4, FramesPerBuffer*Channels)
+	var deviceStats DeviceStats
+	callback := ringOutputCallback(ring, &deviceStats)
+	next := int16(0)
+	fill := func(out []int16) {
+		out[0] = next
+		next++
+	}
+	out := make([]int16, FramesPerBuffer*Channels)
+	expected := int16(0)
+	allocs := testing.AllocsPerRun(1000, func() {
+		for ring.Produce(fill) {
+		}
+		callback(out, portaudio.StreamCallbackTimeInfo{}, 0)
+		if out[0] != expected {
+			t.Fatalf("expected buffer %d, got %d", expected, out[0])
+		}
+		expected++
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v per buffer", allocs)
+	}
+	if ring.Starved() != 0 {
+		t.Errorf("expected the callback never to starve, got %d", ring.Starved())
+	}
+}
+
+// TestOutputRingRun tests that the producer goroutine refills freed buffers
+func TestOutputRingRun(t *testing.T) {
+	ring := NewOutputRing(2, 4)
+	stop := make(chan struct{})
+	defer close(stop)
+	filled := make(chan int16, 8)
+	next := int16(1)
+	go ring.Run(func(out []int16) {
+		out[0] = next
+		filled <- next
+		next++
+	}, stop)
+
+	out := make([]int16, 4)
+	for want := int16(1); want <= 5; want++ {
+		// Wait until the producer has filled the buffer we're about to play
+		for (<-filled) < want {
+		}
+		if !ring.Consume(out) || out[0] != want {
+			t.Fatalf("expected buffer %d, got %d", want, out[0])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// PacerLead is how far ahead of the sample clock buffers may be produced,
+// keeping the device fed while the pacer sleeps
+var PacerLead = 2 * time.Duration(FramesPerBuffer) * time.Second / time.Duration(SampleRate)
+
+// MaxPacerLag is how far behind schedule the pacer may fall before it stops
+// trying to catch up and restarts its clock from now
+var MaxPacerLag = 4 * time.Duration(FramesPerBuffer) * time.Second / time.Duration(SampleRate)
+
+// Pacer schedules output buffers against the sample clock so they are
+// produced at a steady rate, whether they hold audio or inserted silence
+type Pacer struct {
+	start  time.Time
+	frames int64
+}
+
+// Next returns how long to wait at now before producing the next buffer,
+// and schedules the one after it a buffer's worth of frames later
+func (p *Pacer) Next(now time.Time) time.Duration {
+	if p.start.IsZero() || now.Sub(p.deadline()) > MaxPacerLag {
+		// Starting, or stalled (e.g. the device blocked): don't burst to catch up
+		p.start = now
+		p.frames = 0
+	}
+	wait := p.deadline().Sub(now) - PacerLead
+	p.frames += int64(FramesPerBuffer)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// deadline is when the next buffer is due to start playing
+func (p *Pacer) deadline() time.Time {
+	return p.start.Add(time.Duration(p.frames * int64(time.Second) / int64(SampleRate)))
+}
+
+// Wait sleeps until the next buffer is due
+func (p *Pacer) Wait() {
+	if wait := p.Next(time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+}
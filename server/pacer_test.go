@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPacerCadenceDuringUnderflow tests that silence buffers are produced at the sample rate
+func TestPacerCadenceDuringUnderflow(t *testing.T) {
+	jb := NewJitterBuffer()
+	volume, _ := NewVolume(1)
+	player := NewPlayer(jb, volume, VolumeCurveLinear)
+	out := make([]int16, FramesPerBuffer*Channels)
+	for i := 0; i < jb.minBufferSize; i++ {
+		jb.AddPacket(make([]byte, PacketSize))
+	}
+
+	// Once the pre-buffered packets run out, each fill returns silence
+	// immediately, so only the pacer limits how fast buffers are produced
+	var pacer Pacer
+	start := time.Unix(0, 0)
+	now := start
+	var produced []time.Time
+	for i := 0; i < 100; i++ {
+		now = now.Add(pacer.Next(now))
+		player.Fill(out)
+		produced = append(produced, now)
+	}
+
+	if stats := jb.GetStats(); stats.silencePackets == 0 {
+		t.Fatal("expected silence to be inserted once the buffer ran dry")
+	}
+	for i, at := range produced {
+		// Buffers run PacerLead ahead of the sample clock once it's reached
+		want := start.Add(time.Duration(int64(i)*int64(FramesPerBuffer)*int64(time.Second)/int64(SampleRate)) - PacerLead)
+		if want.Before(start) {
+			want = start
+		}
+		if !at.Equal(want) {
+			t.Fatalf("buffer %d: produced at %v, expected %v", i, at.Sub(start), want.Sub(start))
+		}
+	}
+	if elapsed := produced[99].Sub(start); elapsed < 97*PacketDuration || elapsed > 99*PacketDuration {
+		t.Errorf("expected 100 buffers to take about 99 packet durations, took %v", elapsed)
+	}
+}
+
+// TestPacerRestartsAfterStall tests that the pacer doesn't burst to catch up after falling behind
+func TestPacerRestartsAfterStall(t *testing.T) {
+	var pacer Pacer
+	start := time.Unix(0, 0)
+	pacer.Next(start)
+
+	// Slightly late buffers are produced immediately to catch up
+	if wait := pacer.Next(start.Add(PacketDuration + PacerLead)); wait != 0 {
+		t.Errorf("expected no wait when behind schedule, got %v", wait)
+	}
+
+	// After a long stall the schedule restarts: the lead is produced at once,
+	// then the pacer waits rather than bursting through the missed buffers
+	stalled := start.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		if wait := pacer.Next(stalled); wait != 0 {
+			t.Errorf("buffer %d after the stall: expected no wait, got %v", i, wait)
+		}
+	}
+	if want := packetsToLatency(3) - PacerLead; pacer.Next(stalled) != want {
+		t.Errorf("expected to wait %v for the next buffer", want)
+	}
+}
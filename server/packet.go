@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Packet header layout (all multi-byte fields little-endian):
+//
+//	offset 0  magic    [2]byte "AS"
+//	offset 2  version  uint8
+//	offset 3  flags    uint8
+//	offset 4  epoch    uint32, incremented by the client on each stream (re)start
+//	offset 8  sequence uint32, restarts at 0 in every epoch
+//
+// Packets without the magic fall back to the older formats: a bare uint32
+// sequence prefix (PacketSize+SequenceSize) or raw PCM (PacketSize).
+const (
+	HeaderMagic0  = 'A'
+	HeaderMagic1  = 'S'
+	HeaderVersion = 1
+	HeaderSize    = 12
+	SequenceSize  = 4 // Size of the bare sequence number prefix
+)
+
+// Header flags
+const (
+	// FlagCoalesced marks a datagram carrying up to MaxCoalescedPackets
+	// consecutive int16 stereo packets; Sequence is that of the first packet
+	FlagCoalesced = 0x01
+	// FlagKeepalive marks a datagram the client sends in place of a run of
+	// packets of silence; they are played as silence and keep their
+	// sequences. A header-only keepalive stands for one packet, otherwise a
+	// uint16 count follows the header.
+	FlagKeepalive = 0x02
+	// FlagBigEndian marks a payload whose samples are big-endian
+	FlagBigEndian = 0x04
+)
+
+// MaxCoalescedPackets is the most packets a coalesced datagram may carry
+const MaxCoalescedPackets = 8
+
+const (
+	// KeepaliveCountSize is the size of the packet count after a keepalive's header
+	KeepaliveCountSize = 2
+	// MaxKeepalivePackets is the most packets of silence one keepalive fills
+	MaxKeepalivePackets = 64
+)
+
+// keepaliveCount returns how many packets of silence a keepalive stands for
+func keepaliveCount(packet []byte) int {
+	if len(packet) < HeaderSize+KeepaliveCountSize {
+		return 1
+	}
+	count := int(binary.LittleEndian.Uint16(packet[HeaderSize:]))
+	return max(1, min(count, MaxKeepalivePackets))
+}
+
+// isCoalescedSize reports whether n is a valid coalesced payload size
+func isCoalescedSize(n int) bool {
+	return n > 0 && n%PacketSize == 0 && n/PacketSize <= MaxCoalescedPackets
+}
+
+// PacketHeader is the decoded extended packet header
+type PacketHeader struct {
+	Flags    uint8
+	Epoch    uint32
+	Sequence uint32
+}
+
+// HasHeaderMagic reports whether the packet starts with the extended header magic
+func HasHeaderMagic(packet []byte) bool {
+	return len(packet) >= HeaderSize && packet[0] == HeaderMagic0 && packet[1] == HeaderMagic1
+}
+
+// EncodeHeader writes the header into the first HeaderSize bytes of dst
+func EncodeHeader(dst []byte, h PacketHeader) {
+	dst[0] = HeaderMagic0
+	dst[1] = HeaderMagic1
+	dst[2] = HeaderVersion
+	dst[3] = h.Flags
+	binary.LittleEndian.PutUint32(dst[4:8], h.Epoch)
+	binary.LittleEndian.PutUint32(dst[8:12], h.Sequence)
+}
+
+// DecodeHeader parses the extended header at the start of packet
+func DecodeHeader(packet []byte) (PacketHeader, error) {
+	if !HasHeaderMagic(packet) {
+		return PacketHeader{}, errors.New("missing packet header magic")
+	}
+	if packet[2] != HeaderVersion {
+		return PacketHeader{}, errors.New("unsupported packet header version")
+	}
+	return PacketHeader{
+		Flags:    packet[3],
+		Epoch:    binary.LittleEndian.Uint32(packet[4:8]),
+		Sequence: binary.LittleEndian.Uint32(packet[8:12]),
+	}, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestPacketHeaderRoundTrip tests encoding and decoding the extended header
+func TestPacketHeaderRoundTrip(t *testing.T) {
+	packet := make([]byte, HeaderSize+PacketSize)
+	want := PacketHeader{Flags: 0x01, Epoch: 7, Sequence: 123456}
+	EncodeHeader(packet, want)
+
+	if !HasHeaderMagic(packet) {
+		t.Fatal("expected encoded packet to carry the header magic")
+	}
+	got, err := DecodeHeader(packet)
+	if err != nil {
+		t.Fatalf("DecodeHeader failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected header %+v, got %+v", want, got)
+	}
+}
+
+// TestDecodeHeaderRejectsBadInput tests that packets without a valid header are rejected
+func TestDecodeHeaderRejectsBadInput(t *testing.T) {
+	if _, err := DecodeHeader(make([]byte, HeaderSize)); err == nil {
+		t.Error("expected error for packet without magic")
+	}
+
+	packet := make([]byte, HeaderSize)
+	EncodeHeader(packet, PacketHeader{})
+	packet[2] = HeaderVersion + 1
+	if _, err := DecodeHeader(packet); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+
+	if HasHeaderMagic([]byte{HeaderMagic0, HeaderMagic1}) {
+		t.Error("expected truncated packet not to match header magic")
+	}
+}
+
+// TestJitterBufferResetForgetsEpoch tests that after a reset, the stream
+// restarts at the next packet even if its epoch hasn't changed
+func TestJitterBufferResetForgetsEpoch(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.reorderBuffer.ResetOnEpoch(1, 0)
+	jb.AddSequencedPacket(0, []byte{0})
+	jb.Reset()
+
+	if jb.reorderBuffer.ResetOnEpoch(1, 2) {
+		t.Error("expected the first packet after a reset not to count as a new epoch")
+	}
+	jb.AddSequencedPacket(2, []byte{2})
+	if jb.reorderBuffer.HasPendingPackets() {
+		t.Error("expected the packet to be delivered instead of waiting on a gap back to 0")
+	}
+	if jb.GetBufferLevel() != 1 {
+		t.Errorf("expected 1 packet delivered, got %d", jb.GetBufferLevel())
+	}
+}
+
+// TestNewEpochResetsReorderBuffer tests that a new epoch resets reordering state
+func TestNewEpochResetsReorderBuffer(t *testing.T) {
+	jb := NewJitterBuffer()
+
+	// First session delivers 0 and 1 and leaves 5 waiting on a gap
+	if jb.reorderBuffer.ResetOnEpoch(1, 0) {
+		t.Error("expected first epoch not to reset the reorder buffer")
+	}
+	jb.AddSequencedPacket(0, []byte{0})
+	jb.AddSequencedPacket(1, []byte{1})
+	jb.AddSequencedPacket(5, []byte{5})
+	if jb.reorderBuffer.nextSeq != 2 {
+		t.Fatalf("expected nextSeq 2, got %d", jb.reorderBuffer.nextSeq)
+	}
+
+	// Same epoch must not reset
+	if jb.reorderBuffer.ResetOnEpoch(1, 0) {
+		t.Error("expected same epoch not to reset the reorder buffer")
+	}
+	if !jb.reorderBuffer.HasPendingPackets() {
+		t.Error("expected pending packet to survive same-epoch check")
+	}
+
+	// Restarted client begins again at sequence 0 in a new epoch
+	if !jb.reorderBuffer.ResetOnEpoch(2, 0) {
+		t.Error("expected new epoch to reset the reorder buffer")
+	}
+	jb.AddSequencedPacket(0, []byte{100})
+	if jb.reorderBuffer.HasPendingPackets() {
+		t.Error("expected stale packets to be cleared on new epoch")
+	}
+	if jb.reorderBuffer.nextSeq != 1 {
+		t.Errorf("expected nextSeq 1 after new epoch's first packet, got %d", jb.reorderBuffer.nextSeq)
+	}
+	if jb.GetBufferLevel() != 3 {
+		t.Errorf("expected 3 packets delivered, got %d", jb.GetBufferLevel())
+	}
+}
+
+// TestNewEpochStartsAtItsFirstSequence tests that an epoch change restarts
+// the reorder buffer at the new stream's first packet, delivering it at once
+func TestNewEpochStartsAtItsFirstSequence(t *testing.T) {
+	jb := NewJitterBuffer()
+	send := func(epoch, seq uint32) {
+		packet := make([]byte, HeaderSize+PacketSize)
+		EncodeHeader(packet, PacketHeader{Epoch: epoch, Sequence: seq})
+		packet[HeaderSize] = byte(seq)
+		handlePacket(jb, packet, binary.LittleEndian)
+	}
+	send(1, 100)
+	send(1, 101)
+	send(1, 105) // Waits on a gap
+	if jb.GetBufferLevel() != 2 {
+		t.Fatalf("expected the first stream delivered from its first packet, got %d", jb.GetBufferLevel())
+	}
+
+	send(2, 7000)
+	if jb.GetBufferLevel() != 3 {
+		t.Errorf("expected the new epoch's first packet delivered at once, level %d", jb.GetBufferLevel())
+	}
+	if jb.reorderBuffer.HasPendingPackets() {
+		t.Error("expected the old stream's waiting packet cleared")
+	}
+	if jb.reorderBuffer.nextSeq != 7001 {
+		t.Errorf("expected nextSeq 7001, got %d", jb.reorderBuffer.nextSeq)
+	}
+}
+
+// TestCoalescedPacketSplit tests that a coalesced datagram is split into sequenced packets
+func TestCoalescedPacketSplit(t *testing.T) {
+	packet := make([]byte, HeaderSize+3*PacketSize)
+	EncodeHeader(packet, PacketHeader{Flags: FlagCoalesced, Epoch: 1, Sequence: 0})
+	for i := 0; i < 3; i++ {
+		packet[HeaderSize+i*PacketSize] = byte(i + 1)
+	}
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, packet, binary.LittleEndian)
+
+	if jb.GetBufferLevel() != 3 {
+		t.Fatalf("expected 3 packets, got %d", jb.GetBufferLevel())
+	}
+	for i := 0; i < 3; i++ {
+		data, _ := jb.GetPacket()
+		if len(data) != PacketSize || data[0] != byte(i+1) {
+			t.Errorf("packet %d: unexpected content (length %d, first byte %d)", i, len(data), data[0])
+		}
+	}
+	if jb.reorderBuffer.nextSeq != 3 {
+		t.Errorf("expected nextSeq 3, got %d", jb.reorderBuffer.nextSeq)
+	}
+}
+
+// TestKeepalivePlayedAsSilence tests that a keepalive fills its sequence slot with silence
+func TestKeepalivePlayedAsSilence(t *testing.T) {
+	audio := func(seq uint32) []byte {
+		packet := make([]byte, HeaderSize+PacketSize)
+		EncodeHeader(packet, PacketHeader{Epoch: 1, Sequence: seq})
+		packet[HeaderSize] = byte(seq + 1)
+		return packet
+	}
+	keepalive := make([]byte, HeaderSize)
+	EncodeHeader(keepalive, PacketHeader{Flags: FlagKeepalive, Epoch: 1, Sequence: 1})
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, audio(0), binary.LittleEndian)
+	handlePacket(jb, keepalive, binary.LittleEndian)
+	handlePacket(jb, audio(2), binary.LittleEndian)
+
+	if jb.GetBufferLevel() != 3 {
+		t.Fatalf("expected 3 packets, got %d", jb.GetBufferLevel())
+	}
+	for i, want := range []byte{1, 0, 3} {
+		data, _ := jb.GetPacket()
+		if len(data) != PacketSize || data[0] != want {
+			t.Errorf("packet %d: unexpected content (length %d, first byte %d)", i, len(data), data[0])
+		}
+	}
+	if jb.reorderBuffer.nextSeq != 3 {
+		t.Errorf("expected nextSeq 3 after the keepalive, got %d", jb.reorderBuffer.nextSeq)
+	}
+	if jb.reorderBuffer.Len() != 0 {
+		t.Errorf("expected no packets held for reordering, got %d", jb.reorderBuffer.Len())
+	}
+}
+
+// TestKeepaliveCount tests that a keepalive carrying a count fills that many
+// slots with silence, capped at MaxKeepalivePackets
+func TestKeepaliveCount(t *testing.T) {
+	keepalive := func(seq uint32, count uint16) []byte {
+		packet := make([]byte, HeaderSize+KeepaliveCountSize)
+		EncodeHeader(packet, PacketHeader{Flags: FlagKeepalive, Epoch: 1, Sequence: seq})
+		binary.LittleEndian.PutUint16(packet[HeaderSize:], count)
+		return packet
+	}
+
+	jb := NewJitterBuffer()
+	handlePacket(jb, keepalive(0, 5), binary.LittleEndian)
+	if jb.reorderBuffer.nextSeq != 5 {
+		t.Errorf("expected nextSeq 5, got %d", jb.reorderBuffer.nextSeq)
+	}
+	handlePacket(jb, keepalive(5, 60000), binary.LittleEndian)
+	if want := uint32(5 + MaxKeepalivePackets); jb.reorderBuffer.nextSeq != want {
+		t.Errorf("expected the count capped at %d, nextSeq %d", MaxKeepalivePackets, jb.reorderBuffer.nextSeq)
+	}
+	handlePacket(jb, keepalive(5+MaxKeepalivePackets, 0), binary.LittleEndian)
+	if want := uint32(6 + MaxKeepalivePackets); jb.reorderBuffer.nextSeq != want {
+		t.Errorf("expected a zero count to fill one slot, nextSeq %d", jb.reorderBuffer.nextSeq)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultMTU is the link MTU packet sizes are checked against
+const DefaultMTU = 1500
+
+// UDPOverhead is the IPv4 and UDP header bytes in each datagram
+const UDPOverhead = 20 + 8
+
+// MaxUDPPayload is the largest datagram UDP over IPv4 can carry
+const MaxUDPPayload = 65535 - UDPOverhead
+
+// Limits on the audio parameters that can be configured
+const (
+	MinSampleRate = 8000
+	MaxSampleRate = 192000
+	MaxChannels   = 2 // Surround sources are downmixed to stereo
+	MinFrames     = 16
+	MaxFrames     = 8192
+)
+
+// StreamParams are the audio parameters that fix the packet size
+type StreamParams struct {
+	SampleRate      int
+	Channels        int
+	FramesPerBuffer int
+	BytesPerSample  int
+}
+
+// defaultStreamParams are the parameters used unless flags override them
+var defaultStreamParams = StreamParams{SampleRate: SampleRate, Channels: Channels, FramesPerBuffer: FramesPerBuffer, BytesPerSample: 2}
+
+// setStreamParams makes p the server's audio parameters, updating the sizes
+// and durations derived from them. It must be called before anything is
+// allocated or opened with them.
+func setStreamParams(p StreamParams) {
+	SampleRate, Channels, FramesPerBuffer = p.SampleRate, p.Channels, p.FramesPerBuffer
+	PacketSize = FramesPerBuffer * Channels * 2
+	Float32PacketSize = FramesPerBuffer * Channels * 4
+	MaxDatagramSize = HeaderSize + MaxCoalescedPackets*PacketSize
+	PacketDuration = time.Duration(FramesPerBuffer) * time.Second / time.Duration(SampleRate)
+	PacerLead = 2 * time.Duration(FramesPerBuffer) * time.Second / time.Duration(SampleRate)
+	MaxPacerLag = 4 * time.Duration(FramesPerBuffer) * time.Second / time.Duration(SampleRate)
+}
+
+// currentStreamParams returns the parameters the server is playing with
+func currentStreamParams() StreamParams {
+	return StreamParams{SampleRate: SampleRate, Channels: Channels, FramesPerBuffer: FramesPerBuffer, BytesPerSample: 2}
+}
+
+// PayloadSize returns the audio bytes in one packet
+func (p StreamParams) PayloadSize() int {
+	return p.FramesPerBuffer * p.Channels * p.BytesPerSample
+}
+
+// String describes how the packet size is made up, for matching a client to the server
+func (p StreamParams) String() string {
+	return fmt.Sprintf("%d frames x %d channels x %d bytes at %d Hz",
+		p.FramesPerBuffer, p.Channels, p.BytesPerSample, p.SampleRate)
+}
+
+// checkPacketSize validates p and returns warnings about the datagrams it
+// produces on a link of the given MTU. Datagrams larger than the MTU allows
+// are IP fragmented, and losing any fragment loses the whole packet. An mtu
+// of 0 skips the fragmentation check.
+func checkPacketSize(p StreamParams, mtu int) ([]string, error) {
+	if p.SampleRate <= 0 || p.Channels <= 0 || p.FramesPerBuffer <= 0 || p.BytesPerSample <= 0 {
+		return nil, fmt.Errorf("stream parameters must be positive, got %v", p)
+	}
+	if p.SampleRate < MinSampleRate || p.SampleRate > MaxSampleRate {
+		return nil, fmt.Errorf("sample rate must be between %d and %d Hz, got %d", MinSampleRate, MaxSampleRate, p.SampleRate)
+	}
+	if p.Channels > MaxChannels {
+		return nil, fmt.Errorf("at most %d channels can be played, got %d", MaxChannels, p.Channels)
+	}
+	if p.FramesPerBuffer < MinFrames || p.FramesPerBuffer > MaxFrames {
+		return nil, fmt.Errorf("frames per buffer must be between %d and %d, got %d", MinFrames, MaxFrames, p.FramesPerBuffer)
+	}
+	datagram := HeaderSize + p.PayloadSize()
+	if datagram > MaxUDPPayload {
+		return nil, fmt.Errorf("%d-byte packets don't fit in a UDP datagram (max %d)", datagram, MaxUDPPayload)
+	}
+	var warnings []string
+	if limit := mtu - UDPOverhead; mtu > 0 && datagram > limit {
+		warnings = append(warnings, fmt.Sprintf(
+			"%d-byte packets exceed the %d-byte UDP payload of a %d-byte MTU and will be fragmented",
+			datagram, limit, mtu))
+	}
+	if packetMs := p.FramesPerBuffer * 1000 / p.SampleRate; packetMs > 50 {
+		warnings = append(warnings, fmt.Sprintf("%dms packets add noticeable latency", packetMs))
+	}
+	return warnings, nil
+}
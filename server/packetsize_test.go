@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckPacketSize tests the warnings for oversized packets
+func TestCheckPacketSize(t *testing.T) {
+	normal := StreamParams{SampleRate: 48000, Channels: 2, FramesPerBuffer: 256, BytesPerSample: 2}
+	if warnings, err := checkPacketSize(normal, DefaultMTU); err != nil || len(warnings) != 0 {
+		t.Errorf("expected 1036-byte packets to pass, got %v (%v)", warnings, err)
+	}
+
+	warnings, err := checkPacketSize(defaultStreamParams, DefaultMTU)
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "fragmented") {
+		t.Errorf("expected a fragmentation warning for %d-byte packets, got %v (%v)",
+			HeaderSize+defaultStreamParams.PayloadSize(), warnings, err)
+	}
+	if warnings, _ := checkPacketSize(defaultStreamParams, 65535); len(warnings) != 0 {
+		t.Errorf("expected no warnings on loopback, got %v", warnings)
+	}
+	if warnings, _ := checkPacketSize(defaultStreamParams, 0); len(warnings) != 0 {
+		t.Errorf("expected no warnings without an MTU to check, got %v", warnings)
+	}
+
+	slow := StreamParams{SampleRate: 8000, Channels: 1, FramesPerBuffer: 512, BytesPerSample: 2}
+	if warnings, _ := checkPacketSize(slow, DefaultMTU); len(warnings) != 1 || !strings.Contains(warnings[0], "latency") {
+		t.Errorf("expected a latency warning for 64ms packets, got %v", warnings)
+	}
+
+	if _, err := checkPacketSize(StreamParams{SampleRate: 48000, Channels: 0, FramesPerBuffer: 512, BytesPerSample: 2}, DefaultMTU); err == nil {
+		t.Error("expected an error for zero channels")
+	}
+
+	invalid := map[string]StreamParams{
+		"rate too low":   {SampleRate: 4000, Channels: 2, FramesPerBuffer: 512, BytesPerSample: 2},
+		"rate too high":  {SampleRate: 384000, Channels: 2, FramesPerBuffer: 512, BytesPerSample: 2},
+		"surround":       {SampleRate: 48000, Channels: 6, FramesPerBuffer: 512, BytesPerSample: 2},
+		"too few frames": {SampleRate: 48000, Channels: 2, FramesPerBuffer: 8, BytesPerSample: 2},
+		"too large":      {SampleRate: 48000, Channels: 2, FramesPerBuffer: MaxFrames, BytesPerSample: 4},
+	}
+	for name, p := range invalid {
+		if _, err := checkPacketSize(p, DefaultMTU); err == nil {
+			t.Errorf("%s: expected an error for %v", name, p)
+		}
+	}
+}
+
+// TestSetStreamParams tests that configured parameters resize packets and
+// the durations derived from them
+func TestSetStreamParams(t *testing.T) {
+	t.Cleanup(func() { setStreamParams(defaultStreamParams) })
+	setStreamParams(StreamParams{SampleRate: 16000, Channels: 1, FramesPerBuffer: 320, BytesPerSample: 2})
+
+	if PacketSize != 640 || Float32PacketSize != 1280 {
+		t.Errorf("expected 640 and 1280 byte payloads, got %d and %d", PacketSize, Float32PacketSize)
+	}
+	if PacketDuration != 20*time.Millisecond || PacerLead != 40*time.Millisecond {
+		t.Errorf("expected 20ms packets with a 40ms pacer lead, got %v and %v", PacketDuration, PacerLead)
+	}
+	if MaxDatagramSize != HeaderSize+MaxCoalescedPackets*640 {
+		t.Errorf("expected the datagram limit resized, got %d", MaxDatagramSize)
+	}
+	if !isPayloadSize(640) || isPayloadSize(defaultStreamParams.PayloadSize()) || surroundChannels(320*6*2) != 0 {
+		t.Error("expected only mono payloads accepted")
+	}
+	if silence := NewJitterBuffer().InsertSilencePacket(); len(silence) != 640 {
+		t.Errorf("expected 640-byte silence packets, got %d", len(silence))
+	}
+}
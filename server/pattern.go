@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// The mock-client's verification pattern numbers every stereo frame with a
+// counter. The left channel carries the low 15 bits of the counter and the
+// right channel a scrambled copy. Keep in sync with mock-client/pattern.go.
+const patternMask = 0x7FFF
+
+// patternLeft returns the left sample for frame counter c
+func patternLeft(c uint32) int16 {
+	return int16(c & patternMask)
+}
+
+// patternRight returns the right sample for frame counter c
+func patternRight(c uint32) int16 {
+	return int16((c * 3) & patternMask)
+}
+
+// PatternVerifier checks played audio against the verification pattern.
+// Each packet is checked on its own, so lost packets show up as
+// discontinuities rather than as corrupted frames.
+type PatternVerifier struct {
+	next    uint32 // Counter expected at the start of the next packet
+	started bool
+
+	frames          int64
+	mismatches      int64
+	discontinuities int64
+}
+
+// PatternStats is a snapshot of verification results
+type PatternStats struct {
+	frames          int64
+	mismatches      int64
+	discontinuities int64
+}
+
+// Verify checks one packet of int16 stereo samples that were scaled by gain
+// and returns the number of frames that don't match the pattern
+func (pv *PatternVerifier) Verify(samples []int16, gain float64) int {
+	frames := len(samples) / Channels
+	if frames == 0 || gain <= 0 {
+		return 0
+	}
+
+	start := pv.recoverStart(samples[0], samples[1], gain)
+	if pv.started && start != pv.next&patternMask {
+		atomic.AddInt64(&pv.discontinuities, 1)
+	}
+
+	mismatched := 0
+	for i := 0; i < frames; i++ {
+		c := start + uint32(i)
+		if !patternMatches(samples[i*Channels], patternLeft(c), gain) ||
+			!patternMatches(samples[i*Channels+1], patternRight(c), gain) {
+			mismatched++
+		}
+	}
+
+	pv.next = start + uint32(frames)
+	pv.started = true
+	atomic.AddInt64(&pv.frames, int64(frames))
+	atomic.AddInt64(&pv.mismatches, int64(mismatched))
+	return mismatched
+}
+
+// recoverStart returns the counter of the first frame, left and right. The
+// player scales by truncating, so the nearest counter to left/gain may be
+// one off, and at low gain neighbouring counters scale to the same sample:
+// the candidates are checked against the scaled pattern exactly, and the
+// one continuing the previous packet is preferred.
+func (pv *PatternVerifier) recoverStart(left, right int16, gain float64) uint32 {
+	guess := uint32(math.Round(float64(left) / gain))
+	start, found := guess&patternMask, false
+	for _, c := range []uint32{guess, guess - 1, guess + 1} {
+		c &= patternMask
+		if scalePattern(patternLeft(c), gain) != left || scalePattern(patternRight(c), gain) != right {
+			continue
+		}
+		if pv.started && c == pv.next&patternMask {
+			return c
+		}
+		if !found {
+			start, found = c, true
+		}
+	}
+	return start
+}
+
+// scalePattern scales a pattern sample by gain as the player does
+func scalePattern(sample int16, gain float64) int16 {
+	return int16(float64(sample) * gain)
+}
+
+// patternMatches reports whether got is want scaled by gain, allowing for rounding
+func patternMatches(got, want int16, gain float64) bool {
+	diff := float64(got) - float64(want)*gain
+	return diff >= -1 && diff <= 1
+}
+
+// Stats returns the verification results so far
+func (pv *PatternVerifier) Stats() PatternStats {
+	return PatternStats{
+		frames:          atomic.LoadInt64(&pv.frames),
+		mismatches:      atomic.LoadInt64(&pv.mismatches),
+		discontinuities: atomic.LoadInt64(&pv.discontinuities),
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+// patternPacket builds one packet of the verification pattern starting at counter start, scaled by gain
+func patternPacket(start uint32, gain float64) []int16 {
+	samples := make([]int16, FramesPerBuffer*Channels)
+	for i := 0; i < FramesPerBuffer; i++ {
+		c := start + uint32(i)
+		samples[i*Channels] = int16(float64(patternLeft(c)) * gain)
+		samples[i*Channels+1] = int16(float64(patternRight(c)) * gain)
+	}
+	return samples
+}
+
+// TestPatternVerifierRoundTrip tests that an intact pattern verifies cleanly, including across the counter wrap
+func TestPatternVerifierRoundTrip(t *testing.T) {
+	for _, gain := range []float64{1.0, 0.9, 0.5} {
+		var pv PatternVerifier
+		for p := uint32(0); p < 100; p++ {
+			if n := pv.Verify(patternPacket(p*uint32(FramesPerBuffer), gain), gain); n != 0 {
+				t.Fatalf("gain %v, packet %d: expected no mismatches, got %d", gain, p, n)
+			}
+		}
+		stats := pv.Stats()
+		if stats.frames != int64(100*FramesPerBuffer) {
+			t.Errorf("gain %v: expected %d frames, got %d", gain, 100*FramesPerBuffer, stats.frames)
+		}
+		if stats.mismatches != 0 {
+			t.Errorf("gain %v: expected 0 mismatches, got %d", gain, stats.mismatches)
+		}
+		if stats.discontinuities != 0 {
+			t.Errorf("gain %v: expected 0 discontinuities, got %d", gain, stats.discontinuities)
+		}
+	}
+}
+
+// TestPatternVerifierDetectsCorruption tests that an injected error is reported
+func TestPatternVerifierDetectsCorruption(t *testing.T) {
+	var pv PatternVerifier
+	pv.Verify(patternPacket(0, 1), 1)
+
+	corrupt := patternPacket(uint32(FramesPerBuffer), 1)
+	corrupt[100*Channels+1] += 500
+	if n := pv.Verify(corrupt, 1); n != 1 {
+		t.Errorf("expected 1 mismatched frame, got %d", n)
+	}
+
+	swapped := patternPacket(uint32(2*FramesPerBuffer), 1)
+	for i := 0; i < len(swapped); i += Channels {
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+	}
+	if n := pv.Verify(swapped, 1); n == 0 {
+		t.Error("expected swapped channels to be detected")
+	}
+}
+
+// TestPatternVerifierDetectsLoss tests that a missing packet is reported as a discontinuity
+func TestPatternVerifierDetectsLoss(t *testing.T) {
+	var pv PatternVerifier
+	pv.Verify(patternPacket(0, 1), 1)
+	pv.Verify(patternPacket(uint32(2*FramesPerBuffer), 1), 1)
+
+	stats := pv.Stats()
+	if stats.discontinuities != 1 {
+		t.Errorf("expected 1 discontinuity, got %d", stats.discontinuities)
+	}
+	if stats.mismatches != 0 {
+		t.Errorf("expected a lost packet not to count as corruption, got %d mismatches", stats.mismatches)
+	}
+}
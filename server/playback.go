@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// Player fills output buffers from the jitter buffer. The blocking write
+// loop and the output callback both use it, so underflow and overflow
+// handling is the same in either mode.
+type Player struct {
+	jb          *JitterBuffer
+	volume      *Volume
+	volumeCurve VolumeCurve
+
+	resyncThreshold int
+	treatMono       bool
+	latency         *LatencyController
+	mono            *MonoDetector
+	pattern         *PatternVerifier
+	sink            *StreamFanout
+
+	// With -record, everything played, silence included, is also written here
+	recorder *WAVRecorder
+
+	// With -mix-clients, audio comes from the mixer instead of jb
+	mixer *ClientMixer
+
+	// Comfort noise is played while pre-buffering and faded into the first real audio
+	noiseLevel int
+	noiseRand  *rand.Rand
+	noise      []int16
+	fadeIn     bool
+
+	// With -crossfade-ms, the first real audio after inserted silence is
+	// faded in from the previous buffer
+	crossfadeFrames int
+	previous        []int16
+	concealed       bool
+
+	waiting bool // Pre-buffering until the buffer reaches its minimum size
+
+	// Packets whose length isn't a whole number of samples, logged at most
+	// once per MisalignedLogInterval
+	misalignedPackets int64
+	lastMisalignedLog time.Time
+}
+
+// MaxPrimeBuffers bounds -prime-buffers; each adds a buffer of latency
+const MaxPrimeBuffers = 16
+
+// primeOutput writes count buffers of silence before playback starts, so
+// the device's own buffer already holds audio when the first real packet
+// is written and doesn't underflow straight away. No packets are consumed.
+func primeOutput(buffer []int16, count int, write func(buffer []int16)) {
+	clear(buffer)
+	for i := 0; i < count; i++ {
+		write(buffer)
+	}
+}
+
+// MisalignedLogInterval limits how often misaligned packet lengths are logged
+const MisalignedLogInterval = 10 * time.Second
+
+// NewPlayer creates a player for buffers of FramesPerBuffer stereo frames,
+// starting out pre-buffering
+func NewPlayer(jb *JitterBuffer, volume *Volume, volumeCurve VolumeCurve) *Player {
+	return &Player{
+		jb:          jb,
+		volume:      volume,
+		volumeCurve: volumeCurve,
+		mono:        NewMonoDetector(MonoDetectPackets),
+		noise:       make([]int16, FramesPerBuffer*Channels),
+		waiting:     true,
+	}
+}
+
+// SetComfortNoise plays noise of the given peak level while pre-buffering (0 disables)
+func (p *Player) SetComfortNoise(level int, seed int64) {
+	p.noiseLevel = level
+	p.noiseRand = rand.New(rand.NewSource(seed))
+}
+
+// SetCrossfade sets the length of the fade from inserted silence back into
+// real audio, capped at one buffer (0 disables)
+func (p *Player) SetCrossfade(ms int) {
+	p.crossfadeFrames = ms * SampleRate / 1000
+	if p.crossfadeFrames > FramesPerBuffer {
+		p.crossfadeFrames = FramesPerBuffer
+	}
+	if p.crossfadeFrames > 0 && p.previous == nil {
+		p.previous = make([]int16, FramesPerBuffer*Channels)
+	}
+}
+
+// Fill writes the next buffer of audio to out
+func (p *Player) Fill(out []int16) {
+	p.fill(out)
+	if p.recorder != nil {
+		p.recorder.Write(out)
+	}
+}
+
+// fill writes the next buffer of audio to out, from the mixer or jb
+func (p *Player) fill(out []int16) {
+	if p.mixer != nil {
+		p.fillMixed(out)
+		return
+	}
+	jb := p.jb
+	jb.AdmitStaged(time.Now())
+	if p.waiting {
+		if jb.GetBufferLevel() < jb.minBufferSize {
+			p.fillWaiting(out)
+			return
+		}
+		p.waiting = false
+		p.fadeIn = p.noiseLevel > 0
+		fmt.Println("Pre-buffering complete. Starting playback.")
+	}
+
+	var receiveBuffer []byte
+	var ok bool
+
+	// Get packet from jitter buffer or insert silence if underflow
+	now := time.Now()
+	averageLevel := jb.UpdateAverageLevel()
+	if p.latency != nil && jb.IsStable(now) {
+		target := p.latency.Update(now, int(math.Round(averageLevel)), jb.warmTargetSize)
+		if target != jb.warmTargetSize {
+			log.Printf("Output latency %v (target %v), adjusting buffer target to %d packets",
+				p.latency.Achieved(), p.latency.target, target)
+			jb.warmTargetSize = target
+		}
+	}
+	jb.UpdateTarget(now)
+	if jb.StreamEnded() {
+		log.Printf("No audio for %d packets, stream ended. Waiting for a new stream...", jb.maxSilence)
+		jb.Reset()
+		p.waiting = true
+		p.fillWaiting(out)
+		return
+	}
+	if dropped := jb.Resync(p.resyncThreshold); dropped > 0 {
+		log.Printf("Buffer severely overfull, resynced by dropping %d packets", dropped)
+	}
+	if jb.ShouldInsertSilence() {
+		receiveBuffer = jb.ConcealLoss()
+	} else {
+		receiveBuffer, ok = jb.GetPacket()
+		if ok {
+			jb.rememberPlayed(receiveBuffer)
+		} else {
+			// This shouldn't happen due to ShouldInsertSilence check, but just in case
+			receiveBuffer = jb.ConcealLoss()
+		}
+	}
+
+	// Detect a mono source duplicated to both channels
+	mono := false
+	if ok {
+		var changed bool
+		mono, changed = p.mono.Observe(receiveBuffer)
+		if changed && mono {
+			log.Println("Source appears to be mono duplicated to both channels")
+		} else if changed {
+			log.Println("Source channels differ again, back to stereo")
+		}
+	}
+
+	// Read int16 samples from byte buffer
+	serverGain := volumeGain(p.volume.GetVolume(), p.volumeCurve)
+	if mono && p.treatMono {
+		applyGainMono(out, receiveBuffer, serverGain)
+	} else if !decodeSamples(out, receiveBuffer, serverGain) {
+		p.misaligned(len(receiveBuffer))
+	}
+
+	// Check the scaled audio before any fade is applied
+	if p.pattern != nil && ok {
+		if n := p.pattern.Verify(out, serverGain); n > 0 {
+			log.Printf("Pattern verify: %d of %d frames mismatched", n, FramesPerBuffer)
+		}
+	}
+
+	// Fade from the comfort noise into the first real audio
+	if p.fadeIn {
+		crossfade(out, p.noise, out)
+		p.fadeIn = false
+	} else if p.crossfadeFrames > 0 && ok && p.concealed {
+		// Fade from the last silence buffer so resuming audio doesn't click
+		crossfadeFrames(out, p.previous, out, p.crossfadeFrames)
+	}
+	if p.crossfadeFrames > 0 {
+		p.concealed = !ok
+		copy(p.previous, out)
+	}
+
+	// If buffer is too full, consume an extra packet to speed up playback
+	if jb.IsBufferFull() {
+		if extraPacket, ok := jb.GetPacket(); ok {
+			// We consumed an extra packet but don't use it for audio
+			// This helps reduce latency when buffer is building up
+			_ = extraPacket
+		}
+	}
+
+	if p.sink != nil {
+		p.sink.PublishSamples(out)
+	}
+}
+
+// fillMixed writes the mix of all clients' audio to out, scaled by the
+// server volume
+func (p *Player) fillMixed(out []int16) {
+	p.mixer.MixInto(out)
+	if gain := volumeGain(p.volume.GetVolume(), p.volumeCurve); gain != 1 {
+		for i, sample := range out {
+			out[i] = int16(float64(sample) * gain)
+		}
+	}
+	if p.sink != nil {
+		p.sink.PublishSamples(out)
+	}
+}
+
+// decodeSamples writes the little-endian int16 samples in packet to out,
+// scaled by gain. Only whole samples are decoded; the rest of out, including
+// the slot a trailing partial sample would have filled, is zeroed. It
+// returns false if packet isn't a whole number of samples long.
+func decodeSamples(out []int16, packet []byte, gain float64) bool {
+	n := len(packet) / 2
+	if n > len(out) {
+		n = len(out)
+	}
+	for i := 0; i < n; i++ {
+		out[i] = int16(float64(int16(binary.LittleEndian.Uint16(packet[i*2:]))) * gain)
+	}
+	clear(out[n:])
+	return len(packet)%2 == 0
+}
+
+// misaligned counts a packet of length bytes that ended mid-sample
+func (p *Player) misaligned(length int) {
+	p.misalignedPackets++
+	if now := time.Now(); now.Sub(p.lastMisalignedLog) >= MisalignedLogInterval {
+		p.lastMisalignedLog = now
+		log.Printf("Warning: misaligned packet length %d bytes, trailing partial sample dropped (%d such packets so far)",
+			length, p.misalignedPackets)
+	}
+}
+
+// fillWaiting writes comfort noise, or silence, while pre-buffering
+func (p *Player) fillWaiting(out []int16) {
+	if p.noiseLevel > 0 {
+		generateComfortNoise(p.noise, p.noiseLevel, p.noiseRand)
+		copy(out, p.noise)
+		return
+	}
+	for i := range out {
+		out[i] = 0
+	}
+}
+
+// outputCallback returns a PortAudio output callback that pulls audio from
+// the player and counts the xruns PortAudio reports
+func outputCallback(player *Player, deviceStats *DeviceStats) func([]int16, portaudio.StreamCallbackTimeInfo, portaudio.StreamCallbackFlags) {
+	return func(out []int16, _ portaudio.StreamCallbackTimeInfo, flags portaudio.StreamCallbackFlags) {
+		deviceStats.RecordFlags(flags)
+		player.Fill(out)
+	}
+}
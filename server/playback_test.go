@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// runPlaybackScenario plays a burst of packets through a player until well past the
+// end of the burst, using fill to drive it, and returns the output and buffer stats
+func runPlaybackScenario(t *testing.T, fill func(p *Player, out []int16)) ([]int16, BufferStats) {
+	t.Helper()
+	jb := NewJitterBuffer()
+	jb.SetTargets(10, 10, DefaultStabilizeAfter)
+	jb.SetLevelSmoothing(1)
+	volume, _ := NewVolume(1)
+	player := NewPlayer(jb, volume, VolumeCurveLinear)
+
+	// A burst above the high water mark of 15 packets
+	for i := 0; i < 40; i++ {
+		packet := make([]byte, PacketSize)
+		packet[0] = byte(i + 1)
+		jb.AddPacket(packet)
+	}
+
+	// Record the first sample of each buffer played
+	var firstSamples []int16
+	for i := 0; i < 40; i++ {
+		out := make([]int16, FramesPerBuffer*Channels)
+		fill(player, out)
+		firstSamples = append(firstSamples, out[0])
+	}
+	return firstSamples, jb.GetStats()
+}
+
+// TestPlayerModesMatch tests that the blocking loop and the output callback handle underflow and overflow identically
+func TestPlayerModesMatch(t *testing.T) {
+	blockingBuffer := make([]int16, FramesPerBuffer*Channels)
+	blocking, blockingStats := runPlaybackScenario(t, func(p *Player, out []int16) {
+		p.Fill(blockingBuffer)
+		copy(out, blockingBuffer)
+	})
+	var deviceStats DeviceStats
+	callback, callbackStats := runPlaybackScenario(t, func(p *Player, out []int16) {
+		outputCallback(p, &deviceStats)(out, portaudio.StreamCallbackTimeInfo{}, 0)
+	})
+
+	for i := range blocking {
+		if blocking[i] != callback[i] {
+			t.Fatalf("buffer %d: blocking played %d, callback played %d", i, blocking[i], callback[i])
+		}
+	}
+	if blockingStats != callbackStats {
+		t.Errorf("expected identical stats, blocking %+v, callback %+v", blockingStats, callbackStats)
+	}
+
+	// The burst is drained faster than real time, then the buffer runs dry
+	if blocking[0] != 1 || blocking[1] != 3 {
+		t.Errorf("expected an extra packet to be drained while over the high water mark, played %v", blocking[:3])
+	}
+	if blockingStats.silencePackets == 0 {
+		t.Error("expected silence to be inserted once the buffer ran low")
+	}
+}
+
+// TestPlayerPreBuffering tests that silence is played until the buffer reaches its minimum size
+func TestPlayerPreBuffering(t *testing.T) {
+	jb := NewJitterBuffer()
+	volume, _ := NewVolume(1)
+	player := NewPlayer(jb, volume, VolumeCurveLinear)
+	out := make([]int16, FramesPerBuffer*Channels)
+	out[0] = 99
+
+	for i := 0; i < jb.minBufferSize-1; i++ {
+		packet := make([]byte, PacketSize)
+		packet[0] = 1
+		jb.AddPacket(packet)
+	}
+	player.Fill(out)
+	if out[0] != 0 || !player.waiting {
+		t.Fatalf("expected silence while pre-buffering, got %d", out[0])
+	}
+	if jb.GetBufferLevel() != jb.minBufferSize-1 {
+		t.Errorf("expected no packets consumed while pre-buffering, level %d", jb.GetBufferLevel())
+	}
+
+	jb.AddPacket(make([]byte, PacketSize))
+	player.Fill(out)
+	if player.waiting {
+		t.Error("expected playback to start once the minimum was buffered")
+	}
+}
+
+// TestPrimeOutput tests that startup writes the configured number of silent
+// buffers before any real packet is consumed
+func TestPrimeOutput(t *testing.T) {
+	jb := NewJitterBuffer()
+	volume, _ := NewVolume(1)
+	player := NewPlayer(jb, volume, VolumeCurveLinear)
+	buffered := jb.lowWaterMark // Enough to play rather than insert silence
+	for i := 0; i < buffered; i++ {
+		packet := make([]byte, PacketSize)
+		binary.LittleEndian.PutUint16(packet[PacketSize-2:], 1)
+		jb.AddPacket(packet)
+	}
+	out := make([]int16, FramesPerBuffer*Channels)
+	out[len(out)-1] = 99 // Left over from before, must not be played
+
+	// Playback may fade in, so the last sample tells real audio from silence
+	var written []int16
+	write := func(buffer []int16) { written = append(written, buffer[len(buffer)-1]) }
+	primeOutput(out, 3, write)
+	if len(written) != 3 {
+		t.Fatalf("expected 3 priming writes, got %d", len(written))
+	}
+	for i, last := range written {
+		if last != 0 {
+			t.Errorf("priming write %d not silent: %d", i, last)
+		}
+	}
+	if jb.GetBufferLevel() != buffered {
+		t.Errorf("expected no packets consumed while priming, level %d", jb.GetBufferLevel())
+	}
+
+	player.Fill(out)
+	write(out)
+	if written[3] != 1 {
+		t.Errorf("expected the first real packet after priming, got %d", written[3])
+	}
+}
+
+// TestRecordFlags tests that callback xrun flags are counted
+func TestRecordFlags(t *testing.T) {
+	var ds DeviceStats
+	ds.RecordFlags(portaudio.OutputUnderflow)
+	ds.RecordFlags(portaudio.OutputUnderflow | portaudio.OutputOverflow)
+	ds.RecordFlags(0)
+	snap := ds.Snapshot()
+	if snap.underruns != 2 || snap.overruns != 1 {
+		t.Errorf("expected 2 underruns and 1 overrun, got %d and %d", snap.underruns, snap.overruns)
+	}
+}
+
+// TestPlayerCrossfadesAfterSilence tests that real audio resuming after inserted silence is faded in
+func TestPlayerCrossfadesAfterSilence(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetTargets(2, 2, DefaultStabilizeAfter) // Play single packets as they arrive
+	jb.SetLevelSmoothing(1)
+	volume, _ := NewVolume(1)
+	player := NewPlayer(jb, volume, VolumeCurveLinear)
+	player.SetCrossfade(2) // 96 frames
+	player.waiting = false
+
+	loud := func() []byte {
+		packet := make([]byte, PacketSize)
+		for i := 0; i < len(packet); i += 2 {
+			binary.LittleEndian.PutUint16(packet[i:], 10000)
+		}
+		return packet
+	}
+
+	out := make([]int16, FramesPerBuffer*Channels)
+	player.Fill(out) // Empty buffer, silence is inserted
+	if out[0] != 0 {
+		t.Fatalf("expected silence, got %d", out[0])
+	}
+
+	jb.AddPacket(loud())
+	player.Fill(out)
+	if out[0] != 0 {
+		t.Errorf("expected the fade to start from silence, got %d", out[0])
+	}
+	if mid := out[48*Channels]; mid < 4000 || mid > 6000 {
+		t.Errorf("expected about half level midway through the fade, got %d", mid)
+	}
+	if after := out[96*Channels]; after != 10000 {
+		t.Errorf("expected full level after the fade, got %d", after)
+	}
+
+	// Consecutive real packets aren't faded
+	jb.AddPacket(loud())
+	player.Fill(out)
+	if out[0] != 10000 {
+		t.Errorf("expected no fade between real packets, got %d", out[0])
+	}
+}
+
+// TestDecodeSamplesMisaligned tests that a trailing partial sample is
+// dropped without shifting the whole samples, and the rest is zeroed
+func TestDecodeSamplesMisaligned(t *testing.T) {
+	packet := make([]byte, 7) // Three samples and a stray byte
+	for i, v := range []int16{100, -200, 300} {
+		binary.LittleEndian.PutUint16(packet[i*2:], uint16(v))
+	}
+	packet[6] = 0x7f
+	out := []int16{9, 9, 9, 9, 9, 9}
+	if decodeSamples(out, packet, 0.5) {
+		t.Error("expected a 7-byte packet to be reported as misaligned")
+	}
+	want := []int16{50, -100, 150, 0, 0, 0}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, out)
+		}
+	}
+
+	if !decodeSamples(out, packet[:6], 1) || out[2] != 300 {
+		t.Errorf("expected an aligned packet to decode fully, got %v", out)
+	}
+}
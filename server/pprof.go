@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPprof adds the net/http/pprof handlers to mux under /debug/pprof/,
+// so they can share a mux with other HTTP handlers or be served on their own.
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// startPprofServer serves the pprof endpoints on addr in the background
+func startPprofServer(addr string) {
+	mux := http.NewServeMux()
+	registerPprof(mux)
+	go func() {
+		log.Printf("pprof endpoints available at http://%s/debug/pprof/", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Error serving pprof: %v", err)
+		}
+	}()
+}
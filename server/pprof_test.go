@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPprofHandlersRegistered tests that the pprof endpoints are reachable on the mux
+func TestPprofHandlersRegistered(t *testing.T) {
+	mux := http.NewServeMux()
+	registerPprof(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/goroutine?debug=1"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected status 200, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// preset bundles tuned settings selected together with -preset
+type preset struct {
+	coldTarget        int        // Buffer target until the stream is stable
+	warmTarget        int        // Buffer target once stable
+	preBuffer         int        // Packets buffered before playback starts
+	primeBuffers      int        // Buffers of silence written to the device first
+	resyncThreshold   int        // Buffer level that triggers a resync
+	dropPolicy        DropPolicy // Packet discarded on overflow
+	highLatencyOutput bool       // Open the device with its high latency parameters
+}
+
+// presetConfig returns the settings of a named preset. "low-latency" keeps
+// as little audio buffered as possible; "robust" rides out lossy, jittery
+// networks at the cost of delay.
+func presetConfig(name string) (preset, error) {
+	switch name {
+	case "low-latency":
+		return preset{
+			coldTarget:      4,
+			warmTarget:      3,
+			preBuffer:       1, // Start playing with the first packet
+			resyncThreshold: 10,
+			dropPolicy:      DropOldest,
+		}, nil
+	case "robust":
+		return preset{
+			coldTarget:        40,
+			warmTarget:        30,
+			preBuffer:         20,
+			primeBuffers:      2,
+			resyncThreshold:   150,
+			dropPolicy:        DropNewest,
+			highLatencyOutput: true,
+		}, nil
+	}
+	return preset{}, fmt.Errorf("unknown preset %q (expected low-latency or robust)", name)
+}
+
+// openOutputStream opens the default output device for playback from buffer
+// using the device's low or high latency parameters
+func openOutputStream(highLatency bool, buffer interface{}) (*portaudio.Stream, error) {
+	device, err := portaudio.DefaultOutputDevice()
+	if err != nil {
+		return nil, err
+	}
+	return openOutputDevice(device, highLatency, buffer)
+}
+
+// openOutputDevice opens device for playback from buffer using its low or
+// high latency parameters
+func openOutputDevice(device *portaudio.DeviceInfo, highLatency bool, buffer interface{}) (*portaudio.Stream, error) {
+	params := portaudio.LowLatencyParameters(nil, device)
+	if highLatency {
+		params = portaudio.HighLatencyParameters(nil, device)
+	}
+	params.Output.Channels = Channels
+	params.SampleRate = float64(SampleRate)
+	params.FramesPerBuffer = FramesPerBuffer
+	return portaudio.OpenStream(params, buffer)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+// TestPresetConfig tests that each preset yields its documented settings
+func TestPresetConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		want preset
+	}{
+		{"low-latency", preset{coldTarget: 4, warmTarget: 3, preBuffer: 1, resyncThreshold: 10, dropPolicy: DropOldest}},
+		{"robust", preset{coldTarget: 40, warmTarget: 30, preBuffer: 20, primeBuffers: 2, resyncThreshold: 150, dropPolicy: DropNewest, highLatencyOutput: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := presetConfig(tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			// The resync threshold must leave room above the high water mark
+			if high := got.coldTarget + got.coldTarget/2; got.resyncThreshold <= high {
+				t.Errorf("resync threshold %d is not above the high water mark %d", got.resyncThreshold, high)
+			}
+		})
+	}
+
+	if _, err := presetConfig("fast"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ProtocolTracker remembers which protocol each source last sent with and
+// where its sequence has reached, so legacy packets from a sequenced source
+// can be slotted into its sequence instead of bypassing the reorder buffer.
+// Sources silent for longer than the timeout are forgotten by Expire.
+type ProtocolTracker struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	sources map[string]*sourceProtocol
+}
+
+// sourceProtocol is the protocol state of one source
+type sourceProtocol struct {
+	legacy    bool   // The last packet had no sequence number
+	sequenced bool   // The source has sent sequenced packets
+	next      uint32 // Sequence after the last one seen, if sequenced
+	lastSeen  time.Time
+}
+
+// NewProtocolTracker creates an empty protocol tracker forgetting sources after timeout
+func NewProtocolTracker(timeout time.Duration) *ProtocolTracker {
+	return &ProtocolTracker{timeout: timeout, sources: make(map[string]*sourceProtocol)}
+}
+
+// source returns the state for key seen at now, and whether it was already known
+func (pt *ProtocolTracker) source(key string, now time.Time) (*sourceProtocol, bool) {
+	s, ok := pt.sources[key]
+	if !ok {
+		s = &sourceProtocol{}
+		pt.sources[key] = s
+	}
+	s.lastSeen = now
+	return s, ok
+}
+
+// Expire forgets sources silent for longer than the timeout and returns
+// how many it forgot
+func (pt *ProtocolTracker) Expire(now time.Time) int {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	expired := 0
+	for key, s := range pt.sources {
+		if now.Sub(s.lastSeen) > pt.timeout {
+			delete(pt.sources, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Legacy records a packet without a sequence number from key at now. If the source
+// has sent sequenced packets, it returns the sequence the packet takes and
+// true. switched reports a change from the sequenced protocol.
+func (pt *ProtocolTracker) Legacy(key string, now time.Time) (seq uint32, sequenced, switched bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	s, known := pt.source(key, now)
+	switched = known && !s.legacy
+	s.legacy = true
+	if !s.sequenced {
+		return 0, false, switched
+	}
+	seq = s.next
+	s.next++
+	return seq, true, switched
+}
+
+// Sequenced records sequenced packets from key up to last at now, and
+// reports a change from the legacy protocol
+func (pt *ProtocolTracker) Sequenced(key string, last uint32, now time.Time) (switched bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	s, known := pt.source(key, now)
+	switched = known && s.legacy
+	s.legacy = false
+	// Late packets don't move the sequence back, unless it went back far
+	// enough to be a restarted sender
+	if d := seqDiff(last+1, s.next); !s.sequenced || d > 0 || d < -restartGap {
+		s.next = last + 1
+	}
+	s.sequenced = true
+	return switched
+}
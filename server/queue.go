@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// PacketQueue holds the jitter buffer's packets in the order they are
+// played. Push and Pop never block.
+type PacketQueue interface {
+	// Push appends packet, or returns false if the queue is full
+	Push(packet []byte) bool
+	// Pop removes the oldest packet, or returns false if the queue is empty
+	Pop() ([]byte, bool)
+	// Len returns the number of packets held
+	Len() int
+	// Cap returns the most packets the queue can hold
+	Cap() int
+}
+
+// QueueKind selects the jitter buffer's PacketQueue implementation
+type QueueKind string
+
+const (
+	// QueueChannel is a buffered channel, safe for any number of goroutines
+	QueueChannel QueueKind = "chan"
+	// QueueSPSC is a lock-free ring for one producer and one consumer
+	QueueSPSC QueueKind = "spsc"
+)
+
+// parseQueueKind validates a -jitter-queue flag value
+func parseQueueKind(s string) (QueueKind, error) {
+	switch kind := QueueKind(s); kind {
+	case QueueChannel, QueueSPSC:
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown queue %q (expected %q or %q)", s, QueueChannel, QueueSPSC)
+}
+
+// newPacketQueue creates an empty queue of the given kind and capacity
+func newPacketQueue(kind QueueKind, capacity int) PacketQueue {
+	if kind == QueueSPSC {
+		return NewSPSCQueue(capacity)
+	}
+	return make(chanQueue, capacity)
+}
+
+// chanQueue is a PacketQueue backed by a buffered channel
+type chanQueue chan []byte
+
+func (q chanQueue) Push(packet []byte) bool {
+	select {
+	case q <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q chanQueue) Pop() ([]byte, bool) {
+	select {
+	case packet := <-q:
+		return packet, true
+	default:
+		return nil, false
+	}
+}
+
+func (q chanQueue) Len() int { return len(q) }
+func (q chanQueue) Cap() int { return cap(q) }
+
+// SPSCQueue is a lock-free PacketQueue for exactly one goroutine pushing
+// and one popping, which is how the receive loop and the player use the
+// jitter buffer. It avoids the channel's lock on every operation.
+type SPSCQueue struct {
+	slots [][]byte
+	head  uint64 // Packets popped, written only by the consumer
+	tail  uint64 // Packets pushed, written only by the producer
+}
+
+// NewSPSCQueue creates an empty queue holding up to capacity packets
+func NewSPSCQueue(capacity int) *SPSCQueue {
+	return &SPSCQueue{slots: make([][]byte, capacity)}
+}
+
+// Push appends packet; it must only be called from the producer
+func (q *SPSCQueue) Push(packet []byte) bool {
+	tail := atomic.LoadUint64(&q.tail)
+	if tail-atomic.LoadUint64(&q.head) == uint64(len(q.slots)) {
+		return false
+	}
+	q.slots[tail%uint64(len(q.slots))] = packet
+	atomic.StoreUint64(&q.tail, tail+1)
+	return true
+}
+
+// Pop removes the oldest packet; it must only be called from the consumer
+func (q *SPSCQueue) Pop() ([]byte, bool) {
+	head := atomic.LoadUint64(&q.head)
+	if head == atomic.LoadUint64(&q.tail) {
+		return nil, false
+	}
+	slot := &q.slots[head%uint64(len(q.slots))]
+	packet := *slot
+	*slot = nil // Don't keep the packet alive once played
+	atomic.StoreUint64(&q.head, head+1)
+	return packet, true
+}
+
+// Len returns the number of packets held, which may be momentarily stale
+func (q *SPSCQueue) Len() int {
+	head := atomic.LoadUint64(&q.head)
+	return int(atomic.LoadUint64(&q.tail) - head)
+}
+
+// Cap returns the most packets the queue can hold
+func (q *SPSCQueue) Cap() int {
+	return len(q.slots)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// queueKinds are the PacketQueue implementations under test
+var queueKinds = []QueueKind{QueueChannel, QueueSPSC}
+
+// numberedPacket makes a packet carrying n in its first bytes
+func numberedPacket(n int) []byte {
+	packet := make([]byte, PacketSize)
+	binary.LittleEndian.PutUint32(packet, uint32(n))
+	return packet
+}
+
+// TestPacketQueueStatsMatch tests that both queues give the jitter buffer
+// the same overflow and underflow behavior
+func TestPacketQueueStatsMatch(t *testing.T) {
+	var results [][]uint32
+	var stats []BufferStats
+	for _, kind := range queueKinds {
+		jb := NewJitterBuffer()
+		jb.SetQueue(kind)
+		var played []uint32
+		// Overfill, drain past empty, then refill partway
+		for i := 0; i < 250; i++ {
+			jb.AddPacket(numberedPacket(i))
+		}
+		for i := 0; i < 210; i++ {
+			if packet, ok := jb.GetPacket(); ok {
+				played = append(played, binary.LittleEndian.Uint32(packet))
+			}
+		}
+		for i := 250; i < 260; i++ {
+			jb.AddPacket(numberedPacket(i))
+		}
+		jb.Reset()
+		if level := jb.GetBufferLevel(); level != 0 {
+			t.Errorf("%s: expected an empty buffer after reset, got level %d", kind, level)
+		}
+		results = append(results, played)
+		stats = append(stats, jb.GetStats())
+	}
+	if stats[0] != stats[1] || stats[0].overflows != 50 || stats[0].underflows != 10 {
+		t.Errorf("expected 50 overflows and 10 underflows from both, got %+v and %+v", stats[0], stats[1])
+	}
+	if len(results[0]) != 200 || len(results[1]) != 200 {
+		t.Fatalf("expected 200 packets played from both, got %d and %d", len(results[0]), len(results[1]))
+	}
+	for i := range results[0] {
+		if results[0][i] != results[1][i] {
+			t.Fatalf("packet %d: channel played %d, spsc played %d", i, results[0][i], results[1][i])
+		}
+	}
+}
+
+// TestSPSCQueueOrderUnderLoad tests that a concurrent producer and consumer
+// see every packet that was accepted, in order
+func TestSPSCQueueOrderUnderLoad(t *testing.T) {
+	const packets = 200000
+	for _, kind := range queueKinds {
+		jb := NewJitterBuffer()
+		jb.SetQueue(kind)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < packets; i++ {
+				jb.packets.Push(numberedPacket(i)) // Without the overflow logging
+			}
+		}()
+
+		received, last := 0, -1
+		finished := false
+		for !finished {
+			select {
+			case <-done:
+				finished = true
+			default:
+			}
+			for {
+				packet, ok := jb.packets.Pop()
+				if !ok {
+					break
+				}
+				n := int(binary.LittleEndian.Uint32(packet))
+				if n <= last {
+					t.Fatalf("%s: packet %d arrived after %d", kind, n, last)
+				}
+				last = n
+				received++
+			}
+		}
+		if received == 0 || jb.packets.Len() != 0 {
+			t.Errorf("%s: expected packets to be received and the queue drained, got %d received and %d left",
+				kind, received, jb.packets.Len())
+		}
+	}
+}
+
+// benchmarkPacketQueue measures pushing and popping through one producer
+// and one consumer goroutine
+func benchmarkPacketQueue(b *testing.B, kind QueueKind) {
+	q := newPacketQueue(kind, 200)
+	packet := make([]byte, PacketSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < b.N; {
+			if q.Push(packet) {
+				i++
+			}
+		}
+	}()
+	for i := 0; i < b.N; {
+		if _, ok := q.Pop(); ok {
+			i++
+		}
+	}
+	<-done
+}
+
+func BenchmarkPacketQueueChannel(b *testing.B) { benchmarkPacketQueue(b, QueueChannel) }
+func BenchmarkPacketQueueSPSC(b *testing.B)    { benchmarkPacketQueue(b, QueueSPSC) }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultIngressBurst is how many packets a source may send back to back
+// before -ingress-pps limiting applies
+const DefaultIngressBurst = 50
+
+// MaxRateLimitedSources bounds the per-source buckets kept, so a flood from
+// spoofed addresses can't grow the table without limit
+const MaxRateLimitedSources = 1024
+
+// TokenBucket allows events at a sustained rate with bursts up to its size
+type TokenBucket struct {
+	rate   float64 // Tokens added per second
+	size   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full bucket of size tokens refilled at rate per second
+func NewTokenBucket(rate, size float64) *TokenBucket {
+	return &TokenBucket{rate: rate, size: size, tokens: size}
+}
+
+// Allow takes n tokens at now if available and reports whether it did
+func (b *TokenBucket) Allow(now time.Time, n float64) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.size {
+			b.tokens = b.size
+		}
+	}
+	b.last = now
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// IngressLimiter keeps a token bucket of packets per source address
+type IngressLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*TokenBucket
+}
+
+// NewIngressLimiter creates a limiter allowing each source rate packets per
+// second with bursts of burst packets
+func NewIngressLimiter(rate, burst float64) *IngressLimiter {
+	return &IngressLimiter{rate: rate, burst: burst, buckets: make(map[string]*TokenBucket)}
+}
+
+// Allow reports whether a packet from addr at now is within its source's rate
+func (l *IngressLimiter) Allow(addr *net.UDPAddr, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := addr.IP.String()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= MaxRateLimitedSources {
+			l.prune(now)
+		}
+		bucket = NewTokenBucket(l.rate, l.burst)
+		l.buckets[key] = bucket
+	}
+	return bucket.Allow(now, 1)
+}
+
+// Sources returns how many sources have a bucket
+func (l *IngressLimiter) Sources() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// prune forgets sources quiet long enough for their bucket to have refilled,
+// or every source if none have
+func (l *IngressLimiter) prune(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets) >= MaxRateLimitedSources {
+		l.buckets = make(map[string]*TokenBucket)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestTokenBucketBurst tests that a full bucket allows a burst up to its size
+func TestTokenBucketBurst(t *testing.T) {
+	b := NewTokenBucket(100, 10)
+	now := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		if !b.Allow(now, 1) {
+			t.Fatalf("expected packet %d of the burst to be allowed", i)
+		}
+	}
+	if b.Allow(now, 1) {
+		t.Error("expected a packet beyond the bucket size to be dropped")
+	}
+}
+
+// TestTokenBucketThrottlesSustainedExcess tests that sending faster than the rate is limited to the rate
+func TestTokenBucketThrottlesSustainedExcess(t *testing.T) {
+	b := NewTokenBucket(100, 10)
+	start := time.Unix(0, 0)
+
+	// Offer 500 packets per second for 10 seconds
+	allowed := 0
+	for i := 0; i < 5000; i++ {
+		if b.Allow(start.Add(time.Duration(i)*2*time.Millisecond), 1) {
+			allowed++
+		}
+	}
+	// The initial burst plus 100 packets per second
+	if allowed < 1000 || allowed > 1010 {
+		t.Errorf("expected about 1010 packets allowed, got %d", allowed)
+	}
+
+	// A source within the rate is never throttled
+	b = NewTokenBucket(100, 10)
+	for i := 0; i < 1000; i++ {
+		if !b.Allow(start.Add(time.Duration(i)*10*time.Millisecond), 1) {
+			t.Fatalf("packet %d at the sustained rate was dropped", i)
+		}
+	}
+}
+
+// TestIngressLimiterPerSource tests that each source has its own bucket
+func TestIngressLimiterPerSource(t *testing.T) {
+	l := NewIngressLimiter(100, 2)
+	now := time.Unix(0, 0)
+	flooder := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	other := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+
+	l.Allow(flooder, now)
+	l.Allow(flooder, now)
+	if l.Allow(flooder, now) {
+		t.Error("expected the flooding source to be throttled")
+	}
+	if !l.Allow(other, now) {
+		t.Error("expected another source to be unaffected")
+	}
+}
+
+// TestReceiverDropsRateLimited tests that throttled datagrams are dropped and counted
+func TestReceiverDropsRateLimited(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	r.limiter = NewIngressLimiter(1, 3)
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	for i := 0; i < 5; i++ {
+		r.HandleDatagram(addr, make([]byte, PacketSize))
+	}
+	if level := jb.GetBufferLevel(); level != 3 {
+		t.Errorf("expected the 3 packet burst to be buffered, got %d", level)
+	}
+	if dropped := r.RateLimited(); dropped != 2 {
+		t.Errorf("expected 2 rate limited datagrams, got %d", dropped)
+	}
+}
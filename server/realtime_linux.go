@@ -0,0 +1,17 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// raiseThreadPriority lowers the nice value of the calling thread, which
+// Linux schedules independently of the rest of the process
+func raiseThreadPriority() error {
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, syscall.Gettid(), RealtimeNice); err != nil {
+		return fmt.Errorf("setpriority to nice %d: %w", RealtimeNice, err)
+	}
+	return nil
+}
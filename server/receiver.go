@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Receiver feeds datagrams from the network into the jitter buffer
+type Receiver struct {
+	jb       *JitterBuffer
+	sources  *SourceTracker
+	arrivals *ArrivalStats
+
+	// byteOrder is assumed for samples in packets not flagged as big-endian
+	byteOrder binary.ByteOrder
+
+	// With -allow or -deny, datagrams from other addresses are dropped
+	filter        *SourceFilter
+	rejected      int64
+	lastRejectLog time.Time
+
+	// With -ingress-pps, datagrams over a source's rate are dropped
+	limiter     *IngressLimiter
+	rateLimited int64
+
+	// Empty and wrongly sized datagrams are dropped before the pipeline
+	malformed        int64
+	lastMalformedLog time.Time
+
+	// Each source's packets are handled as one protocol; switching between
+	// sequenced and legacy packets mid-stream is counted and warned about
+	protocols        *ProtocolTracker
+	protocolSwitches int64
+	lastSwitchLog    time.Time
+
+	// With -startup-timeout or -dead-stream-timeout, arrivals keep the
+	// watchdog from declaring the stream dead
+	watchdog *StreamWatchdog
+
+	// With -stats-skew, the sender's clock rate is estimated from arrivals
+	skew *ClockSkew
+
+	// With -mix-clients, each source's packets go to its own buffer in the
+	// mixer instead of jb
+	mixer *ClientMixer
+
+	// With -simulate-latency, datagrams are held here before being handled
+	delay *DelayQueue
+
+	// With -psk, audio must carry a tag made with the pre-shared key
+	psk          []byte
+	authFailures int64
+	lastAuthLog  time.Time
+
+	// With -encrypt, audio is decrypted with the key each source agreed in
+	// a key exchange, and datagrams that don't decrypt are dropped
+	sessionKeys *SessionKeys
+
+	// Handshakes are answered through reply, the audio socket's WriteToUDP;
+	// they are ignored if it is nil
+	reply func(b []byte, addr *net.UDPAddr) (int, error)
+
+	configMu sync.Mutex
+	config   StreamConfig // Format of the most recent audio received
+
+	// Join events are announced as sources first send; leaves are found by
+	// the tracker's expiry loop
+	sessions  *SessionTracker
+	onSession func(SessionEvent)
+}
+
+// RejectLogInterval limits how often rejected datagrams are logged
+const RejectLogInterval = 10 * time.Second
+
+// NewReceiver creates a receiver feeding jb
+func NewReceiver(jb *JitterBuffer) *Receiver {
+	return &Receiver{
+		jb:        jb,
+		sources:   NewSourceTracker(DefaultClientTimeout),
+		protocols: NewProtocolTracker(DefaultClientTimeout),
+		arrivals:  &ArrivalStats{},
+		byteOrder: binary.LittleEndian,
+	}
+}
+
+// RunExpiry forgets senders that have gone quiet, and their protocols, every
+// interval until stop is closed
+func (r *Receiver) RunExpiry(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.sources.Expire(now)
+			r.protocols.Expire(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// HandleDatagram processes one datagram received from addr
+func (r *Receiver) HandleDatagram(addr *net.UDPAddr, packet []byte) {
+	if r.filter != nil && addr != nil && !r.filter.Allows(addr.IP) {
+		r.reject(addr)
+		return
+	}
+	if r.limiter != nil && addr != nil && !r.limiter.Allow(addr, time.Now()) {
+		atomic.AddInt64(&r.rateLimited, 1)
+		return
+	}
+	// With -psk handshakes and key exchanges are tagged too, so nobody can
+	// replace a client's session key or stream parameters
+	if r.psk != nil {
+		authenticated, err := checkAuthTag(r.psk, packet)
+		if err != nil {
+			r.authFailed(addr, err)
+			return
+		}
+		packet = authenticated
+	}
+	if isHandshake(packet) {
+		r.answerHandshake(addr, packet)
+		return
+	}
+	if isKeyExchange(packet) {
+		r.answerKeyExchange(addr, packet)
+		return
+	}
+	if r.sessionKeys != nil {
+		if addr == nil {
+			return
+		}
+		plaintext, err := r.sessionKeys.Open(addr, packet)
+		if err != nil {
+			r.dropMalformed(addr, fmt.Errorf("decrypting: %v", err))
+			return
+		}
+		packet = plaintext
+	}
+	if err := validatePacket(packet); err != nil {
+		r.dropMalformed(addr, err)
+		return
+	}
+	if r.sessions != nil && addr != nil {
+		for _, e := range r.sessions.Observe(addr.String(), time.Now()) {
+			r.onSession(e)
+		}
+	}
+	// Packets from several senders would be interleaved into one stream
+	// unless they are mixed
+	if addr != nil && r.sources.Observe(addr, time.Now()) && r.mixer == nil {
+		log.Printf("Warning: multiple senders detected, now receiving from %s as well as %v. Audio will be corrupted.",
+			addr, r.sources.Others(addr))
+	}
+	if info := r.handleFromSource(addr, packet); info.packets > 0 {
+		now := time.Now()
+		r.arrivals.Record(now, info)
+		if r.mixer != nil && addr != nil {
+			r.mixer.Record(addr, now, info)
+		}
+		if r.watchdog != nil {
+			r.watchdog.Seen(now)
+		}
+		if r.skew != nil && info.sequenced {
+			r.skew.Record(now, info.sequence)
+		}
+		if info.payloadSize > 0 {
+			r.setConfig(streamConfigFor(info))
+		}
+	}
+}
+
+// answerHandshake replies to a client's hello, warning if it was rejected
+func (r *Receiver) answerHandshake(addr *net.UDPAddr, packet []byte) {
+	hello, err := decodeHandshake(packet)
+	if err != nil {
+		r.dropMalformed(addr, err)
+		return
+	}
+	reply, err := handshakeReply(hello)
+	if err != nil {
+		log.Printf("Warning: rejecting handshake from %v: %v", addr, err)
+	} else {
+		log.Printf("Accepted handshake from %v", addr)
+	}
+	if r.reply != nil && addr != nil {
+		if _, err := r.sendReply(encodeHandshake(reply), addr); err != nil {
+			log.Printf("Error replying to handshake from %v: %v", addr, err)
+		}
+	}
+}
+
+// answerKeyExchange agrees a session key with a client sending a hello.
+// Without -encrypt hellos are ignored, so the client knows to give up.
+func (r *Receiver) answerKeyExchange(addr *net.UDPAddr, packet []byte) {
+	if r.sessionKeys == nil || addr == nil {
+		return
+	}
+	reply, err := r.sessionKeys.Accept(addr, packet)
+	if err != nil {
+		r.dropMalformed(addr, err)
+		return
+	}
+	log.Printf("Agreed a session key with %v", addr)
+	if r.reply != nil {
+		if _, err := r.sendReply(reply, addr); err != nil {
+			log.Printf("Error replying to key exchange from %v: %v", addr, err)
+		}
+	}
+}
+
+// sendReply sends b to addr through reply, tagged with the pre-shared key
+// under -psk. The tag never goes in b's spare capacity, since b may be a
+// reply the session keys keep to resend.
+func (r *Receiver) sendReply(b []byte, addr *net.UDPAddr) (int, error) {
+	if r.psk != nil {
+		b = appendAuthTag(r.psk, b[:len(b):len(b)])
+	}
+	return r.reply(b, addr)
+}
+
+// handleFromSource decodes a datagram from addr, keeping each source on one
+// protocol. Legacy packets from a source that has sent sequenced ones take
+// the sequence after its last, so they queue in the reorder buffer behind
+// the packets waiting there instead of jumping ahead of them.
+func (r *Receiver) handleFromSource(addr *net.UDPAddr, packet []byte) packetInfo {
+	if addr == nil {
+		return handlePacket(r.jb, packet, r.byteOrder)
+	}
+	jb := r.jb
+	if r.mixer != nil {
+		jb = r.mixer.Buffer(addr)
+	}
+	key := addr.String()
+	if isLegacyPacket(packet) {
+		seq, sequenced, switched := r.protocols.Legacy(key, time.Now())
+		if switched {
+			r.protocolSwitched(addr, "sequenced", "legacy")
+		}
+		if !sequenced {
+			return handlePacket(jb, packet, r.byteOrder)
+		}
+		jb.AddSequencedPacket(seq, toPCM16(toLittleEndian(packet, r.byteOrder, payloadSampleSize(len(packet)))))
+		return packetInfo{packets: 1, transport: TransportLegacy, payloadSize: len(packet)}
+	}
+	info := handlePacket(jb, packet, r.byteOrder)
+	if info.sequenced && r.protocols.Sequenced(key, info.sequence+uint32(info.packets-1), time.Now()) {
+		r.protocolSwitched(addr, "legacy", "sequenced")
+	}
+	return info
+}
+
+// protocolSwitched counts a source changing protocol mid-stream, logging at
+// most once per RejectLogInterval
+func (r *Receiver) protocolSwitched(addr *net.UDPAddr, from, to string) {
+	switches := atomic.AddInt64(&r.protocolSwitches, 1)
+	if now := time.Now(); now.Sub(r.lastSwitchLog) >= RejectLogInterval {
+		r.lastSwitchLog = now
+		log.Printf("Warning: %s switched from %s to %s packets mid-stream (%d switches so far)", addr, from, to, switches)
+	}
+}
+
+// ProtocolSwitches returns how many times a source has changed between
+// sequenced and legacy packets
+func (r *Receiver) ProtocolSwitches() int64 {
+	return atomic.LoadInt64(&r.protocolSwitches)
+}
+
+// reject counts a datagram dropped by the source filter, logging at most
+// once per RejectLogInterval
+func (r *Receiver) reject(addr *net.UDPAddr) {
+	rejected := atomic.AddInt64(&r.rejected, 1)
+	if now := time.Now(); now.Sub(r.lastRejectLog) >= RejectLogInterval {
+		r.lastRejectLog = now
+		log.Printf("Dropping audio from %s: source not allowed (%d datagrams rejected so far)", addr, rejected)
+	}
+}
+
+// dropMalformed counts a datagram that failed validation, logging at most
+// once per RejectLogInterval
+func (r *Receiver) dropMalformed(addr *net.UDPAddr, err error) {
+	malformed := atomic.AddInt64(&r.malformed, 1)
+	if now := time.Now(); now.Sub(r.lastMalformedLog) >= RejectLogInterval {
+		r.lastMalformedLog = now
+		log.Printf("Dropping malformed datagram from %v: %v (%d malformed so far)", addr, err, malformed)
+	}
+}
+
+// authFailed counts a datagram dropped for failing -psk authentication,
+// logging at most once per RejectLogInterval
+func (r *Receiver) authFailed(addr *net.UDPAddr, err error) {
+	failures := atomic.AddInt64(&r.authFailures, 1)
+	if now := time.Now(); now.Sub(r.lastAuthLog) >= RejectLogInterval {
+		r.lastAuthLog = now
+		log.Printf("Dropping unauthenticated datagram from %v: %v (%d so far)", addr, err, failures)
+	}
+}
+
+// AuthFailures returns how many datagrams failed -psk authentication
+func (r *Receiver) AuthFailures() int64 {
+	return atomic.LoadInt64(&r.authFailures)
+}
+
+// Malformed returns how many datagrams failed validation
+func (r *Receiver) Malformed() int64 {
+	return atomic.LoadInt64(&r.malformed)
+}
+
+// Rejected returns how many datagrams the source filter has dropped
+func (r *Receiver) Rejected() int64 {
+	return atomic.LoadInt64(&r.rejected)
+}
+
+// RateLimited returns how many datagrams the ingress limiter has dropped
+func (r *Receiver) RateLimited() int64 {
+	return atomic.LoadInt64(&r.rateLimited)
+}
+
+// SourceTracker records the addresses audio has been received from.
+// Sources silent for longer than the timeout are forgotten by Expire, so
+// the table doesn't grow with every address that has ever sent.
+type SourceTracker struct {
+	mu       sync.Mutex
+	timeout  time.Duration
+	lastSeen map[string]time.Time
+}
+
+// NewSourceTracker creates an empty source tracker forgetting sources after timeout
+func NewSourceTracker(timeout time.Duration) *SourceTracker {
+	return &SourceTracker{timeout: timeout, lastSeen: make(map[string]time.Time)}
+}
+
+// Observe records a packet from addr at now and returns true if addr is a
+// new source and another source is already known
+func (st *SourceTracker) Observe(addr *net.UDPAddr, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	key := addr.String()
+	_, known := st.lastSeen[key]
+	st.lastSeen[key] = now
+	if known {
+		return false
+	}
+	return len(st.lastSeen) > 1
+}
+
+// Expire forgets sources silent for longer than the timeout and returns
+// how many it forgot
+func (st *SourceTracker) Expire(now time.Time) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	expired := 0
+	for key, seen := range st.lastSeen {
+		if now.Sub(seen) > st.timeout {
+			delete(st.lastSeen, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Len returns the number of known sources
+func (st *SourceTracker) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.lastSeen)
+}
+
+// Others returns the known sources other than addr
+func (st *SourceTracker) Others(addr *net.UDPAddr) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var others []string
+	for key := range st.lastSeen {
+		if key != addr.String() {
+			others = append(others, key)
+		}
+	}
+	return others
+}
+
+// packetInfo describes the audio a datagram carried
+type packetInfo struct {
+	sequence  uint32 // Sequence of the first packet, if sequenced
+	packets   int    // Number of packets of audio, 0 if the datagram was rejected
+	sequenced bool
+
+	transport   string // Header variant the audio arrived with
+	payloadSize int    // Bytes of audio per packet, 0 for keepalives
+}
+
+// errEmptyPacket is returned by validatePacket for zero-length datagrams,
+// which ReadFromUDP returns for empty UDP packets
+var errEmptyPacket = errors.New("empty datagram")
+
+// validatePacket checks that a datagram has the size of one of the header
+// variants handlePacket decodes, so nothing malformed reaches the pipeline
+func validatePacket(packet []byte) error {
+	n := len(packet)
+	switch {
+	case n == 0:
+		return errEmptyPacket
+	case n < HeaderSize:
+		return fmt.Errorf("datagram too short: %d bytes", n)
+	case n > MaxDatagramSize:
+		return fmt.Errorf("datagram too long: %d bytes (max %d)", n, MaxDatagramSize)
+	}
+	if isHeaderedPacket(packet) {
+		return nil
+	}
+	if isPayloadSize(n-SequenceSize) || isPayloadSize(n) {
+		return nil
+	}
+	return fmt.Errorf("unexpected datagram size: %d bytes", n)
+}
+
+// isHeaderedPacket reports whether a datagram carries the extended header
+func isHeaderedPacket(packet []byte) bool {
+	n := len(packet)
+	if !HasHeaderMagic(packet) {
+		return false
+	}
+	if packet[3]&FlagKeepalive != 0 && n == HeaderSize+KeepaliveCountSize {
+		return true
+	}
+	return n == HeaderSize || isPayloadSize(n-HeaderSize) || isCoalescedSize(n-HeaderSize)
+}
+
+// isLegacyPacket reports whether handlePacket takes a datagram to be raw
+// PCM with no sequence number
+func isLegacyPacket(packet []byte) bool {
+	n := len(packet)
+	return !isHeaderedPacket(packet) && !isPayloadSize(n-SequenceSize) && isPayloadSize(n)
+}
+
+// handlePacket decodes a received datagram and feeds it into the jitter buffer.
+// The header variant and sample format are identified by the datagram size.
+// Samples are in the given byte order unless the header flags them as big-endian.
+func handlePacket(jb *JitterBuffer, packet []byte, order binary.ByteOrder) packetInfo {
+	n := len(packet)
+	if isHeaderedPacket(packet) {
+		header, err := DecodeHeader(packet)
+		if err != nil {
+			log.Printf("Error decoding packet header: %v", err)
+			return packetInfo{}
+		}
+		// A new epoch means the client restarted its stream
+		if jb.reorderBuffer.ResetOnEpoch(header.Epoch, header.Sequence) {
+			log.Printf("Client stream restarted (epoch %d), resetting reorder buffer", header.Epoch)
+		}
+		if header.Flags&FlagKeepalive != 0 {
+			// Keepalives fill their slots in the sequence with silence
+			count := keepaliveCount(packet)
+			for i := 0; i < count; i++ {
+				jb.AddSequencedPacket(header.Sequence+uint32(i), jb.silence)
+			}
+			return packetInfo{sequence: header.Sequence, packets: count, sequenced: true}
+		}
+		if header.Flags&FlagBigEndian != 0 {
+			order = binary.BigEndian
+		}
+		payload := packet[HeaderSize:]
+		if header.Flags&FlagCoalesced != 0 {
+			payload = toLittleEndian(payload, order, 2)
+			// Split the datagram back into consecutively numbered packets
+			for i := 0; i+PacketSize <= len(payload); i += PacketSize {
+				jb.AddSequencedPacket(header.Sequence+uint32(i/PacketSize), payload[i:i+PacketSize])
+			}
+			return packetInfo{sequence: header.Sequence, packets: len(payload) / PacketSize, sequenced: true,
+				transport: TransportCoalesced, payloadSize: PacketSize}
+		}
+		if !isPayloadSize(len(payload)) {
+			log.Printf("Received uncoalesced packet with unexpected payload size: %d bytes", len(payload))
+			return packetInfo{}
+		}
+		payload = toLittleEndian(payload, order, payloadSampleSize(len(payload)))
+		jb.AddSequencedPacket(header.Sequence, toPCM16(payload))
+		return packetInfo{sequence: header.Sequence, packets: 1, sequenced: true,
+			transport: TransportExtended, payloadSize: len(payload)}
+	} else if isPayloadSize(n - SequenceSize) {
+		// Extract sequence number (first 4 bytes)
+		seq := binary.LittleEndian.Uint32(packet[:SequenceSize])
+		jb.AddSequencedPacket(seq, toPCM16(toLittleEndian(packet[SequenceSize:], order, payloadSampleSize(n-SequenceSize))))
+		return packetInfo{sequence: seq, packets: 1, sequenced: true,
+			transport: TransportSequenced, payloadSize: n - SequenceSize}
+	} else if isPayloadSize(n) {
+		// Fallback for packets without sequence numbers (legacy support)
+		jb.AddPacket(toPCM16(toLittleEndian(packet, order, payloadSampleSize(n))))
+		return packetInfo{packets: 1, transport: TransportLegacy, payloadSize: n}
+	}
+	log.Printf("Received packet of unexpected size: %d bytes (expected %d, %d, %d or %d byte payload)",
+		n, PacketSize, Float32PacketSize, surroundPacketSize(6), surroundPacketSize(8))
+	return packetInfo{}
+}
+
+// readBatch reads one batch of datagrams and hands each to the receiver.
+// Packet data is retained by the buffers, so used receive buffers are replaced.
+func readBatch(reader BatchReader, msgs []Datagram, r *Receiver) (int, error) {
+	for i := range msgs {
+		if msgs[i].Buf == nil {
+			msgs[i].Buf = make([]byte, MaxDatagramSize+SealOverhead+AuthTagSize)
+		}
+	}
+	count, err := reader.ReadBatch(msgs)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		if r.delay != nil {
+			r.delay.Push(now, msgs[i].Addr, msgs[i].Buf[:msgs[i].N])
+		} else {
+			r.HandleDatagram(msgs[i].Addr, msgs[i].Buf[:msgs[i].N])
+		}
+		msgs[i].Buf = nil
+	}
+	return count, nil
+}
+
+// ReceivePollInterval bounds how long receiveLoop blocks in a read before
+// checking for cancellation
+const ReceivePollInterval = 100 * time.Millisecond
+
+// receiveLoop reads datagrams from conn into the receiver until ctx is
+// cancelled or the connection is closed
+func receiveLoop(ctx context.Context, conn *net.UDPConn, r *Receiver, batchSize int) {
+	reader := NewBatchReader(conn, batchSize)
+	msgs := make([]Datagram, batchSize)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(ReceivePollInterval))
+		if _, err := readBatch(reader, msgs, r); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error reading UDP packet: %v", err)
+		}
+	}
+}
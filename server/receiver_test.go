@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestSourceTrackerDetectsSecondSource tests that a second distinct sender is flagged
+func TestSourceTrackerDetectsSecondSource(t *testing.T) {
+	st := NewSourceTracker(DefaultClientTimeout)
+	now := time.Now()
+	first := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	second := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+
+	if st.Observe(first, now) {
+		t.Error("expected the first source not to be flagged")
+	}
+	if st.Observe(first, now) {
+		t.Error("expected repeated packets from the first source not to be flagged")
+	}
+	if !st.Observe(second, now) {
+		t.Error("expected a second distinct source to be flagged")
+	}
+	if st.Observe(second, now) {
+		t.Error("expected the second source to be flagged only once")
+	}
+
+	others := st.Others(second)
+	if len(others) != 1 || others[0] != first.String() {
+		t.Errorf("expected others to be [%s], got %v", first, others)
+	}
+}
+
+// TestSourceTrackerSameHostDifferentPort tests that a new port on the same host counts as a new sender
+func TestSourceTrackerSameHostDifferentPort(t *testing.T) {
+	st := NewSourceTracker(DefaultClientTimeout)
+	now := time.Now()
+	st.Observe(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, now)
+	if !st.Observe(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5001}, now) {
+		t.Error("expected a different source port to be flagged")
+	}
+}
+
+// TestSourceTrackerExpiresIdleSources tests that sources silent for longer
+// than the timeout are forgotten, so one returning counts as new again
+func TestSourceTrackerExpiresIdleSources(t *testing.T) {
+	st := NewSourceTracker(time.Second)
+	now := time.Now()
+	first := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	second := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	st.Observe(first, now)
+	st.Observe(second, now.Add(800*time.Millisecond))
+
+	if expired := st.Expire(now.Add(time.Second)); expired != 0 {
+		t.Errorf("expected no sources expired within the timeout, got %d", expired)
+	}
+	if expired := st.Expire(now.Add(1500 * time.Millisecond)); expired != 1 {
+		t.Errorf("expected the first source to expire, got %d expired", expired)
+	}
+	if others := st.Others(first); len(others) != 1 || others[0] != second.String() {
+		t.Errorf("expected only the second source to be known, got %v", others)
+	}
+	if !st.Observe(first, now.Add(2*time.Second)) {
+		t.Error("expected the first source to be flagged as new after expiring")
+	}
+}
+
+// TestValidatePacket tests that empty, too short, too long and wrongly
+// sized datagrams are rejected and every header variant is accepted
+func TestValidatePacket(t *testing.T) {
+	header := func(payload int) []byte {
+		packet := make([]byte, HeaderSize+payload)
+		EncodeHeader(packet, PacketHeader{Epoch: 1})
+		return packet
+	}
+	keepalive := make([]byte, HeaderSize+KeepaliveCountSize)
+	EncodeHeader(keepalive, PacketHeader{Flags: FlagKeepalive, Epoch: 1})
+	valid := map[string][]byte{
+		"legacy":    make([]byte, PacketSize),
+		"sequenced": make([]byte, SequenceSize+PacketSize),
+		"float32":   make([]byte, SequenceSize+Float32PacketSize),
+		"extended":  header(PacketSize),
+		"keepalive": header(0),
+		"counted":   keepalive,
+		"coalesced": header(3 * PacketSize),
+	}
+	for name, packet := range valid {
+		if err := validatePacket(packet); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	invalid := map[string][]byte{
+		"empty":      {},
+		"too short":  make([]byte, HeaderSize-1),
+		"too long":   make([]byte, MaxDatagramSize+1),
+		"odd size":   make([]byte, PacketSize+1),
+		"bare magic": header(1),
+	}
+	for name, packet := range invalid {
+		if err := validatePacket(packet); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := validatePacket(nil); err != errEmptyPacket {
+		t.Errorf("expected errEmptyPacket for an empty datagram, got %v", err)
+	}
+}
+
+// TestReceiverDropsMalformed tests that malformed datagrams are counted and
+// never reach the jitter buffer
+func TestReceiverDropsMalformed(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+	r.HandleDatagram(addr, []byte{})
+	r.HandleDatagram(addr, make([]byte, 7))
+	if r.Malformed() != 2 {
+		t.Errorf("expected 2 malformed datagrams, got %d", r.Malformed())
+	}
+	if jb.GetStats().totalPackets != 0 || r.sources.Len() != 0 {
+		t.Error("expected malformed datagrams kept out of the pipeline")
+	}
+	r.HandleDatagram(addr, make([]byte, PacketSize))
+	if jb.GetBufferLevel() != 1 {
+		t.Errorf("expected the valid packet buffered, level %d", jb.GetBufferLevel())
+	}
+}
+
+// TestReceiverKeepsSourceProtocolOrdered tests that a legacy packet from a
+// sequenced source is counted as a protocol switch and played after the
+// sequenced packets still waiting in the reorder buffer
+func TestReceiverKeepsSourceProtocolOrdered(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+	sequenced := func(seq uint32) []byte {
+		packet := make([]byte, SequenceSize+PacketSize)
+		binary.LittleEndian.PutUint32(packet, seq)
+		packet[SequenceSize] = byte(seq + 1)
+		return packet
+	}
+	legacy := make([]byte, PacketSize)
+	legacy[0] = 4
+
+	r.HandleDatagram(addr, sequenced(0))
+	r.HandleDatagram(addr, sequenced(2))
+	r.HandleDatagram(addr, legacy)
+	if r.ProtocolSwitches() != 1 {
+		t.Errorf("expected 1 protocol switch, got %d", r.ProtocolSwitches())
+	}
+	r.HandleDatagram(addr, sequenced(1))
+	if r.ProtocolSwitches() != 2 {
+		t.Errorf("expected the return to sequenced packets counted, got %d switches", r.ProtocolSwitches())
+	}
+
+	for want := byte(1); want <= 4; want++ {
+		packet, ok := jb.GetPacket()
+		if !ok {
+			t.Fatalf("expected packet %d, buffer empty", want)
+		}
+		if packet[0] != want {
+			t.Errorf("expected packet %d, got %d", want, packet[0])
+		}
+	}
+}
+
+// TestProtocolTrackerExpiresIdleSources tests that sources silent for longer
+// than the timeout are forgotten, so one returning with another protocol
+// isn't counted as switching
+func TestProtocolTrackerExpiresIdleSources(t *testing.T) {
+	pt := NewProtocolTracker(time.Second)
+	now := time.Now()
+	pt.Sequenced("192.0.2.1:5000", 9, now)
+	pt.Legacy("192.0.2.2:5000", now.Add(800*time.Millisecond))
+
+	if expired := pt.Expire(now.Add(time.Second)); expired != 0 {
+		t.Errorf("expected no sources expired within the timeout, got %d", expired)
+	}
+	if expired := pt.Expire(now.Add(1500 * time.Millisecond)); expired != 1 {
+		t.Errorf("expected the sequenced source to expire, got %d expired", expired)
+	}
+	if len(pt.sources) != 1 {
+		t.Errorf("expected 1 source left, got %d", len(pt.sources))
+	}
+	if _, sequenced, switched := pt.Legacy("192.0.2.1:5000", now.Add(2*time.Second)); sequenced || switched {
+		t.Errorf("expected the returning source to start afresh, got sequenced %v and switched %v", sequenced, switched)
+	}
+}
+
+// TestReceiverLegacySourceUnaffected tests that a source only ever sending
+// legacy packets neither switches nor waits in the reorder buffer
+func TestReceiverLegacySourceUnaffected(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+	for i := 0; i < 3; i++ {
+		r.HandleDatagram(addr, make([]byte, PacketSize))
+	}
+	if jb.GetBufferLevel() != 3 || r.ProtocolSwitches() != 0 {
+		t.Errorf("expected 3 packets buffered and no switches, got %d and %d", jb.GetBufferLevel(), r.ProtocolSwitches())
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync/atomic"
+)
+
+// wavHeaderSize is the size of the header wavStreamHeader writes; the
+// audio follows it directly
+const wavHeaderSize = 44
+
+// RecordQueue is how many buffers the recording may fall behind playback
+// before buffers are left out of it
+const RecordQueue = 64
+
+// WAVRecorder writes everything the player plays to a 16-bit PCM WAV
+// file. The header is written with the streaming placeholder sizes, so a
+// file cut off by a crash still plays, and the real sizes are filled in by
+// Close. The file is written by its own goroutine, and Write copies into
+// buffers allocated up front and handed back once written, so it neither
+// waits on the disk nor allocates and is safe to call from the output
+// callback.
+type WAVRecorder struct {
+	closed  int32
+	free    chan []int16  // Buffers ready to be filled by Write
+	queue   chan []int16  // Filled buffers, then nil once closed
+	done    chan struct{} // Closed once the queue is drained
+	dropped int64
+
+	// Owned by the writing goroutine until done is closed
+	file      *os.File
+	w         *bufio.Writer
+	buf       []byte
+	dataBytes int64
+	stopped   bool // Full or failed; further audio is ignored
+}
+
+// CreateWAVRecorder creates path, replacing any existing file, writes the
+// header for audio of the given format and starts writing
+func CreateWAVRecorder(path string, sampleRate, channels int) (*WAVRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &WAVRecorder{
+		free:  make(chan []int16, RecordQueue),
+		queue: make(chan []int16, RecordQueue+1), // Room for every buffer and the nil
+		done:  make(chan struct{}),
+		file:  file,
+		w:     bufio.NewWriter(file),
+	}
+	for i := 0; i < RecordQueue; i++ {
+		r.free <- make([]int16, 0, FramesPerBuffer*channels)
+	}
+	if _, err := r.w.Write(wavStreamHeader(sampleRate, channels, 16)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+// Write queues a copy of samples for the recording. If the disk has fallen
+// RecordQueue buffers behind, the buffer is left out and counted instead.
+// A buffer only grows if samples is longer than a packet, after which it
+// is big enough.
+func (r *WAVRecorder) Write(samples []int16) {
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return
+	}
+	select {
+	case buffer := <-r.free:
+		// There are never more buffers than the queue holds, so this can't block
+		r.queue <- append(buffer[:0], samples...)
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+// run writes queued buffers to the file and hands them back to Write,
+// until the nil queued by Close
+func (r *WAVRecorder) run() {
+	defer close(r.done)
+	for samples := range r.queue {
+		if samples == nil {
+			return
+		}
+		r.write(samples)
+		r.free <- samples
+	}
+}
+
+// write appends samples to the file. A write error or reaching the WAV
+// format's 4 GiB limit is logged once and ends the recording.
+func (r *WAVRecorder) write(samples []int16) {
+	if r.stopped {
+		return
+	}
+	if r.dataBytes+int64(len(samples)*2) > math.MaxUint32-(wavHeaderSize-8) {
+		log.Printf("Recording reached the WAV size limit, no longer recording")
+		r.stopped = true
+		return
+	}
+	if len(r.buf) < len(samples)*2 {
+		r.buf = make([]byte, len(samples)*2)
+	}
+	int16ToBytes(samples, r.buf)
+	if _, err := r.w.Write(r.buf[:len(samples)*2]); err != nil {
+		log.Printf("Error writing recording, no longer recording: %v", err)
+		r.stopped = true
+		return
+	}
+	atomic.AddInt64(&r.dataBytes, int64(len(samples)*2))
+}
+
+// Close writes out the queued audio and fills in the header's sizes
+func (r *WAVRecorder) Close() error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return nil
+	}
+	// A Write racing with this may still queue a buffer after the nil,
+	// which is left out like any audio played after closing
+	r.queue <- nil
+	<-r.done
+
+	if dropped := atomic.LoadInt64(&r.dropped); dropped > 0 {
+		log.Printf("Warning: %d buffers were left out of the recording because the disk couldn't keep up", dropped)
+	}
+	if err := r.finalize(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// finalize flushes buffered audio and rewrites the RIFF and data chunk sizes
+func (r *WAVRecorder) finalize() error {
+	if err := r.w.Flush(); err != nil {
+		return fmt.Errorf("flushing recording: %v", err)
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(r.dataBytes+wavHeaderSize-8))
+	if _, err := r.file.WriteAt(size[:], 4); err != nil {
+		return fmt.Errorf("writing RIFF size: %v", err)
+	}
+	binary.LittleEndian.PutUint32(size[:], uint32(r.dataBytes))
+	if _, err := r.file.WriteAt(size[:], wavHeaderSize-4); err != nil {
+		return fmt.Errorf("writing data size: %v", err)
+	}
+	return nil
+}
+
+// Bytes returns how many bytes of audio have been written to the file
+func (r *WAVRecorder) Bytes() int64 {
+	return atomic.LoadInt64(&r.dataBytes)
+}
+
+// Dropped returns how many buffers were left out of the recording
+func (r *WAVRecorder) Dropped() int64 {
+	return atomic.LoadInt64(&r.dropped)
+}
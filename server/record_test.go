@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWAVRecorder tests that recorded buffers are read back intact after a
+// header whose format and sizes describe them
+func TestWAVRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	r, err := CreateWAVRecorder(path, 16000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffers := [][]int16{{1, -1, 32767}, {-32768, 0, 42}}
+	for _, b := range buffers {
+		r.Write(b)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]int16{7}) // Ignored once closed
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != wavHeaderSize+12 {
+		t.Fatalf("file is %d bytes, want %d", len(data), wavHeaderSize+12)
+	}
+	le := binary.LittleEndian
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" || string(data[36:40]) != "data" {
+		t.Errorf("bad chunk ids in header %q", data[:wavHeaderSize])
+	}
+	if size := le.Uint32(data[4:]); size != 36+12 {
+		t.Errorf("RIFF size %d, want %d", size, 36+12)
+	}
+	if size := le.Uint32(data[40:]); size != 12 {
+		t.Errorf("data size %d, want 12", size)
+	}
+	if channels, rate, bits := le.Uint16(data[22:]), le.Uint32(data[24:]), le.Uint16(data[34:]); channels != 1 || rate != 16000 || bits != 16 {
+		t.Errorf("format %d channels, %d Hz, %d bits; want 1, 16000, 16", channels, rate, bits)
+	}
+	want := append(append([]int16(nil), buffers[0]...), buffers[1]...)
+	for i, sample := range want {
+		if got := int16(le.Uint16(data[wavHeaderSize+i*2:])); got != sample {
+			t.Errorf("sample %d = %d, want %d", i, got, sample)
+		}
+	}
+}
+
+// TestPlayerRecordsSilence tests that the player records the silence it
+// plays while pre-buffering, keeping the file aligned with playback
+func TestPlayerRecordsSilence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	r, err := CreateWAVRecorder(path, SampleRate, Channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, _ := NewVolume(1)
+	p := NewPlayer(NewJitterBuffer(), volume, VolumeCurveLinear)
+	p.recorder = r
+	out := make([]int16, FramesPerBuffer*Channels)
+	p.Fill(out)
+	p.Fill(out)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Bytes(), int64(2*len(out)*2); got != want {
+		t.Errorf("recorded %d bytes of pre-buffering silence, want %d", got, want)
+	}
+}
+
+// TestWAVRecorderAccountsForBursts tests that a burst of far more buffers
+// than the queue holds is either written or counted as left out
+func TestWAVRecorderAccountsForBursts(t *testing.T) {
+	r, err := CreateWAVRecorder(filepath.Join(t.TempDir(), "out.wav"), SampleRate, Channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]int16, FramesPerBuffer*Channels)
+	for i := 0; i < 100*RecordQueue; i++ {
+		r.Write(buffer)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written := r.Bytes() / int64(len(buffer)*2)
+	if written+r.Dropped() != int64(100*RecordQueue) {
+		t.Errorf("%d buffers written and %d dropped, want %d in all", written, r.Dropped(), 100*RecordQueue)
+	}
+}
+
+// TestWAVRecorderWriteDoesNotAllocate tests that recording a buffer reuses
+// the recorder's own buffers, so it is safe in the output callback
+func TestWAVRecorderWriteDoesNotAllocate(t *testing.T) {
+	r, err := CreateWAVRecorder(filepath.Join(t.TempDir(), "out.wav"), SampleRate, Channels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buffer := make([]int16, FramesPerBuffer*Channels)
+	if allocs := testing.AllocsPerRun(1000, func() { r.Write(buffer) }); allocs != 0 {
+		t.Errorf("Write allocated %v times per buffer, want 0", allocs)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written := r.Bytes() / int64(len(buffer)*2)
+	if written+r.Dropped() != 1001 {
+		t.Errorf("%d buffers written and %d dropped, want 1001 in all", written, r.Dropped())
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ReorderCleanupInterval is how often timed-out gaps are released and late
+// packets purged from the reorder buffer
+const ReorderCleanupInterval = 100 * time.Millisecond
+
+// DefaultReorderMaxAge is how long a packet may wait in the reorder buffer
+const DefaultReorderMaxAge = 500 * time.Millisecond
+
+// DefaultGapTimeout is how long a missing packet is waited for before the
+// packets after it are released. It is capped at half the max age so they
+// are released before cleanup evicts them.
+const DefaultGapTimeout = 100 * time.Millisecond
+
+// DefaultReorderCap bounds how many packets the reorder buffer holds, so
+// late duplicates and packets far ahead can't grow it without limit
+const DefaultReorderCap = 256
+
+// seqDiff returns how far sequence a is ahead of b (negative if behind),
+// using serial number arithmetic (RFC 1982) so the distance stays right
+// across the wrap from math.MaxUint32 to 0
+func seqDiff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// seqBefore reports whether sequence a comes before b, allowing for wraparound
+func seqBefore(a, b uint32) bool {
+	return seqDiff(a, b) < 0
+}
+
+// SequencedPacket represents a packet with sequence number for reordering
+type SequencedPacket struct {
+	sequence uint32
+	data     []byte
+	arrived  time.Time
+}
+
+// PacketReorderBuffer handles out-of-order packet reordering
+type PacketReorderBuffer struct {
+	mu         sync.Mutex
+	buffer     map[uint32]*SequencedPacket
+	nextSeq    uint32
+	maxLatency int           // Maximum number of packets to wait for reordering
+	maxAge     time.Duration // Maximum time a packet may wait before it is evicted
+	epoch      uint32
+	hasEpoch   bool
+	started    bool // A packet has been delivered since the last reset
+
+	// At capacity a packet must go before another is added. With
+	// evictGaps the oldest gap is abandoned instead, so the freshest
+	// contiguous audio keeps flowing.
+	capacity  int
+	evictGaps bool
+	abandon   bool // Release past the current gap on the next NextPacket
+	abandoned int  // Packets given up on to relieve the cap
+	evicted   int  // Packets dropped to relieve the cap
+
+	// Packets for a sequence already waiting or already passed, which are
+	// dropped rather than replacing the waiting copy or being held for
+	// cleanup
+	duplicatePackets int
+}
+
+// NewPacketReorderBuffer creates a new packet reordering buffer
+func NewPacketReorderBuffer(maxLatency int) *PacketReorderBuffer {
+	return &PacketReorderBuffer{
+		buffer:     make(map[uint32]*SequencedPacket),
+		nextSeq:    0,
+		maxLatency: maxLatency,
+		maxAge:     DefaultReorderMaxAge,
+		capacity:   DefaultReorderCap,
+	}
+}
+
+// SetCapacity sets the most packets held and whether reaching it abandons
+// the oldest gap rather than evicting a waiting packet
+func (prb *PacketReorderBuffer) SetCapacity(capacity int, evictGaps bool) {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	prb.capacity = capacity
+	prb.evictGaps = evictGaps
+}
+
+// SetMaxAge sets how long a packet may wait before CleanupOldPackets evicts it
+func (prb *PacketReorderBuffer) SetMaxAge(maxAge time.Duration) {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	prb.maxAge = maxAge
+}
+
+// AddPacket adds a packet with sequence number. A sequence jumping well
+// back means the sender restarted without a new epoch, so the buffer
+// starts over from it rather than waiting for the old sequence forever.
+// Before anything is delivered, an earlier sequence becomes the start.
+// A sequence already waiting or already passed is dropped as a duplicate.
+func (prb *PacketReorderBuffer) AddPacket(seq uint32, data []byte) {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	if prb.started && seqDiff(seq, prb.nextSeq) < -restartGap {
+		prb.reset()
+		prb.nextSeq = seq
+	} else if !prb.started && seqBefore(seq, prb.nextSeq) {
+		prb.nextSeq = seq
+	} else if prb.started && seqBefore(seq, prb.nextSeq) {
+		prb.duplicatePackets++
+		return
+	}
+	if _, exists := prb.buffer[seq]; exists {
+		prb.duplicatePackets++
+		return
+	}
+	if len(prb.buffer) >= prb.capacity {
+		prb.makeRoom()
+	}
+	prb.buffer[seq] = &SequencedPacket{sequence: seq, data: data, arrived: time.Now()}
+}
+
+// makeRoom relieves a full buffer. Packets already passed are never
+// delivered, so one of those goes first. Otherwise, with evictGaps, the
+// oldest gap is abandoned so the packets after it are released by the next
+// NextPacket; failing that an arbitrary waiting packet is evicted.
+func (prb *PacketReorderBuffer) makeRoom() {
+	for seq := range prb.buffer {
+		if seqBefore(seq, prb.nextSeq) {
+			delete(prb.buffer, seq)
+			return
+		}
+	}
+	if _, next := prb.buffer[prb.nextSeq]; prb.evictGaps && !next {
+		prb.abandon = true
+		return
+	}
+	for seq := range prb.buffer {
+		delete(prb.buffer, seq)
+		prb.evicted++
+		return
+	}
+}
+
+// GetNextPacket returns the next packet in sequence, or nil if not available
+func (prb *PacketReorderBuffer) GetNextPacket() []byte {
+	packet, _ := prb.NextPacket()
+	return packet
+}
+
+// NextPacket returns the next packet in sequence, or nil if not available.
+// When more than maxLatency packets are waiting, one has arrived more than
+// maxLatency ahead of the next sequence, or the oldest has waited past the
+// gap timeout, the missing packets are given up on and the next one
+// waiting is returned with the number of packets skipped.
+func (prb *PacketReorderBuffer) NextPacket() (data []byte, skipped int) {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	if packet, exists := prb.buffer[prb.nextSeq]; exists {
+		delete(prb.buffer, prb.nextSeq)
+		prb.nextSeq++
+		prb.started = true
+		return packet.data, 0
+	}
+
+	// Find the earliest packet waiting past the gap
+	var next *SequencedPacket
+	oldest := time.Time{}
+	var furthest int32
+	for seq, packet := range prb.buffer {
+		ahead := seqDiff(seq, prb.nextSeq)
+		if ahead <= 0 {
+			continue // Already passed; left for cleanup
+		}
+		furthest = max(furthest, ahead)
+		if next == nil || seq-prb.nextSeq < next.sequence-prb.nextSeq {
+			next = packet
+		}
+		if oldest.IsZero() || packet.arrived.Before(oldest) {
+			oldest = packet.arrived
+		}
+	}
+	if next == nil {
+		return nil, 0
+	}
+	gapTimeout := DefaultGapTimeout
+	if prb.maxAge/2 < gapTimeout {
+		gapTimeout = prb.maxAge / 2
+	}
+	if !prb.abandon && len(prb.buffer) <= prb.maxLatency && int(furthest) <= prb.maxLatency && time.Since(oldest) <= gapTimeout {
+		return nil, 0
+	}
+	skipped = int(next.sequence - prb.nextSeq)
+	if !prb.started {
+		skipped = 0 // Joining mid-stream isn't a loss
+	}
+	if prb.abandon {
+		prb.abandon = false
+		prb.abandoned += skipped
+	}
+	delete(prb.buffer, next.sequence)
+	prb.nextSeq = next.sequence + 1
+	prb.started = true
+	return next.data, skipped
+}
+
+// Delivered returns the sender's epoch and the highest sequence delivered
+// in order, or false if nothing has been delivered since the last reset
+func (prb *PacketReorderBuffer) Delivered() (epoch, sequence uint32, ok bool) {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	if !prb.started {
+		return prb.epoch, 0, false
+	}
+	return prb.epoch, prb.nextSeq - 1, true
+}
+
+// CapStats returns how many packets have been abandoned with their gap
+// and how many evicted to keep the buffer within its capacity
+func (prb *PacketReorderBuffer) CapStats() (abandoned, evicted int) {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	return prb.abandoned, prb.evicted
+}
+
+// Duplicates returns how many packets have been dropped for a sequence
+// already waiting or already passed
+func (prb *PacketReorderBuffer) Duplicates() int {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	return prb.duplicatePackets
+}
+
+// HasPendingPackets returns true if there are packets waiting for reordering
+func (prb *PacketReorderBuffer) HasPendingPackets() bool {
+	return prb.Len() > 0
+}
+
+// Len returns the number of packets waiting for reordering
+func (prb *PacketReorderBuffer) Len() int {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	return len(prb.buffer)
+}
+
+// Reset discards all pending packets and restarts sequencing at 0
+func (prb *PacketReorderBuffer) Reset() {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	prb.reset()
+	// The next packet starts the stream again, whatever its epoch
+	prb.hasEpoch = false
+}
+
+func (prb *PacketReorderBuffer) reset() {
+	prb.buffer = make(map[uint32]*SequencedPacket)
+	prb.nextSeq = 0
+	prb.started = false
+	prb.abandon = false
+}
+
+// ResetOnEpoch records the sender's epoch from a packet numbered sequence
+// and resets the buffer when it changes. The new stream starts at that
+// packet, so it is delivered straight away instead of waiting out a gap
+// back to 0. Returns true if a reset happened.
+func (prb *PacketReorderBuffer) ResetOnEpoch(epoch, sequence uint32) bool {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	if !prb.hasEpoch {
+		prb.epoch = epoch
+		prb.hasEpoch = true
+		if !prb.started && len(prb.buffer) == 0 {
+			prb.nextSeq = sequence
+		}
+		return false
+	}
+	if epoch == prb.epoch {
+		return false
+	}
+	prb.epoch = epoch
+	prb.reset()
+	prb.nextSeq = sequence
+	return true
+}
+
+// CleanupOldPackets removes packets that are too old to wait for: those
+// already passed by nextSeq and those that have waited longer than maxAge
+func (prb *PacketReorderBuffer) CleanupOldPackets() {
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	now := time.Now()
+	for seq, packet := range prb.buffer {
+		if seqBefore(seq, prb.nextSeq) || now.Sub(packet.arrived) > prb.maxAge {
+			delete(prb.buffer, seq)
+		}
+	}
+}
+
+// RunCleanup calls CleanupOldPackets every interval until stop is closed
+func (prb *PacketReorderBuffer) RunCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			prb.CleanupOldPackets()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPeriodicCleanupBoundsBuffer tests that periodic cleanup bounds the buffer under a flood of old packets
+func TestPeriodicCleanupBoundsBuffer(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.nextSeq = 1000
+	prb.started = true // Playing, so the flood is behind the stream
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		prb.RunCleanup(5*time.Millisecond, stop)
+		close(done)
+	}()
+
+	// Flood with packets that are all behind nextSeq
+	for i := 0; i < 5000; i++ {
+		prb.AddPacket(uint32(i%1000), []byte{0})
+	}
+	prb.AddPacket(1005, []byte{1}) // A future packet that must be kept
+
+	deadline := time.Now().Add(time.Second)
+	for prb.Len() > 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	if prb.Len() != 1 {
+		t.Errorf("expected only the future packet to remain, got %d packets", prb.Len())
+	}
+	if _, exists := prb.buffer[1005]; !exists {
+		t.Error("expected future packet to survive cleanup")
+	}
+}
+
+// TestCleanupEvictsStalePackets tests that packets waiting longer than maxAge are evicted
+func TestCleanupEvictsStalePackets(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.SetMaxAge(100 * time.Millisecond)
+
+	// Both packets are the same distance ahead of nextSeq, only their age differs
+	prb.AddPacket(5, []byte{5})
+	prb.AddPacket(6, []byte{6})
+	prb.buffer[5].arrived = time.Now().Add(-time.Second)
+
+	prb.CleanupOldPackets()
+
+	if _, exists := prb.buffer[5]; exists {
+		t.Error("expected stale packet 5 to be evicted")
+	}
+	if _, exists := prb.buffer[6]; !exists {
+		t.Error("expected fresh packet 6 to be kept")
+	}
+}
+
+// TestReorderReleasesPastGap tests that a missing packet is given up on
+// once too many packets wait behind it or it has been waited on too long
+func TestReorderReleasesPastGap(t *testing.T) {
+	prb := NewPacketReorderBuffer(3)
+	prb.AddPacket(0, []byte{0})
+	if packet, skipped := prb.NextPacket(); packet == nil || skipped != 0 {
+		t.Fatalf("expected packet 0 in order, got %v skipping %d", packet, skipped)
+	}
+
+	// Packet 1 is lost; three waiting is still within the window
+	for seq := uint32(2); seq <= 4; seq++ {
+		prb.AddPacket(seq, []byte{byte(seq)})
+	}
+	if packet, _ := prb.NextPacket(); packet != nil {
+		t.Fatal("expected to keep waiting for packet 1")
+	}
+	prb.AddPacket(5, []byte{5})
+	if packet, skipped := prb.NextPacket(); packet == nil || packet[0] != 2 || skipped != 1 {
+		t.Fatalf("expected packet 2 after skipping 1, got %v skipping %d", packet, skipped)
+	}
+
+	// Packet 6 is lost and 7 waits out the gap timeout
+	prb.GetNextPacket()
+	prb.GetNextPacket()
+	prb.GetNextPacket()
+	prb.AddPacket(7, []byte{7})
+	if packet, _ := prb.NextPacket(); packet != nil {
+		t.Fatal("expected to wait for packet 6 before the timeout")
+	}
+	prb.buffer[7].arrived = time.Now().Add(-DefaultGapTimeout * 2)
+	if packet, skipped := prb.NextPacket(); packet == nil || packet[0] != 7 || skipped != 1 {
+		t.Errorf("expected packet 7 after skipping 6, got %v skipping %d", packet, skipped)
+	}
+}
+
+// TestReorderCapAbandonsOldestGap tests that a full buffer evicting gaps
+// gives up on the oldest gap and delivers the contiguous packets after it
+func TestReorderCapAbandonsOldestGap(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.SetCapacity(4, true)
+	prb.AddPacket(0, []byte{0})
+	prb.GetNextPacket()
+
+	// Packets 1 and 2 are lost; 3 to 6 fill the buffer within the window
+	for seq := uint32(3); seq <= 6; seq++ {
+		prb.AddPacket(seq, []byte{byte(seq)})
+	}
+	if packet, _ := prb.NextPacket(); packet != nil {
+		t.Fatal("expected to keep waiting below the cap")
+	}
+	prb.AddPacket(7, []byte{7})
+	for seq := byte(3); seq <= 7; seq++ {
+		packet, skipped := prb.NextPacket()
+		if packet == nil || packet[0] != seq {
+			t.Fatalf("expected packet %d, got %v", seq, packet)
+		}
+		want := 0
+		if seq == 3 {
+			want = 2 // Packets 1 and 2, abandoned with the gap
+		}
+		if skipped != want {
+			t.Errorf("packet %d: skipped %d, want %d", seq, skipped, want)
+		}
+	}
+	if abandoned, evicted := prb.CapStats(); abandoned != 2 || evicted != 0 {
+		t.Errorf("got %d abandoned and %d evicted, want 2 and 0", abandoned, evicted)
+	}
+}
+
+// TestReorderCapEvicts tests that a full buffer not evicting gaps drops a
+// waiting packet to stay within its capacity
+func TestReorderCapEvicts(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.SetCapacity(4, false)
+	for seq := uint32(1); seq <= 6; seq++ {
+		prb.AddPacket(seq, []byte{byte(seq)})
+	}
+	if prb.Len() != 4 {
+		t.Errorf("holding %d packets, want the cap of 4", prb.Len())
+	}
+	if abandoned, evicted := prb.CapStats(); abandoned != 0 || evicted != 2 {
+		t.Errorf("got %d abandoned and %d evicted, want 0 and 2", abandoned, evicted)
+	}
+}
+
+// TestReorderWraparound tests that sequences are ordered across the wrap
+// from 0xFFFFFFFF to 0 and that cleanup keeps the packets after the wrap
+func TestReorderWraparound(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.nextSeq = 0xFFFFFFFE
+	prb.started = true
+	for _, seq := range []uint32{1, 0, 0xFFFFFFFF} {
+		prb.AddPacket(seq, []byte{byte(seq)})
+	}
+	prb.CleanupOldPackets()
+	if prb.Len() != 3 {
+		t.Fatalf("cleanup left %d packets, want the 3 ahead of the wrap", prb.Len())
+	}
+	prb.AddPacket(0xFFFFFFFE, []byte{0xFE})
+	for _, want := range []byte{0xFE, 0xFF, 0, 1} {
+		packet, skipped := prb.NextPacket()
+		if packet == nil || packet[0] != want || skipped != 0 {
+			t.Fatalf("expected packet %#x in order, got %v skipping %d", want, packet, skipped)
+		}
+	}
+	if prb.nextSeq != 2 {
+		t.Errorf("next sequence %d, want 2", prb.nextSeq)
+	}
+
+	// Packets from before the wrap are now behind and cleaned up
+	prb.AddPacket(0xFFFFFFF0, []byte{0})
+	prb.CleanupOldPackets()
+	if prb.Len() != 0 {
+		t.Errorf("expected the pre-wrap packet cleaned up, %d left", prb.Len())
+	}
+}
+
+// TestReorderSenderRestart tests that a sequence dropping back to 0 without
+// a new epoch restarts the buffer instead of wedging it
+func TestReorderSenderRestart(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.nextSeq = 5000
+	prb.AddPacket(5000, []byte{1})
+	prb.GetNextPacket()
+
+	for seq := uint32(0); seq < 3; seq++ {
+		prb.AddPacket(seq, []byte{byte(seq)})
+		packet, skipped := prb.NextPacket()
+		if packet == nil || packet[0] != byte(seq) || skipped != 0 {
+			t.Fatalf("expected restarted packet %d, got %v skipping %d", seq, packet, skipped)
+		}
+	}
+}
+
+// TestReorderStartsBeforeWrap tests that a stream starting just before the
+// wrap, as with -initial-sequence on the client, isn't taken as old
+func TestReorderStartsBeforeWrap(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.AddPacket(0xFFFFFFF0, []byte{0xF0})
+	if packet, _ := prb.NextPacket(); packet == nil || packet[0] != 0xF0 {
+		t.Fatalf("expected the first packet delivered, got %v", packet)
+	}
+}
+
+// TestReorderDropsDuplicates tests that a second copy of a waiting packet
+// doesn't replace it and that a copy of a packet already delivered isn't
+// held, both being counted as duplicates
+func TestReorderDropsDuplicates(t *testing.T) {
+	prb := NewPacketReorderBuffer(50)
+	prb.AddPacket(0, []byte{0})
+	if packet := prb.GetNextPacket(); packet == nil || packet[0] != 0 {
+		t.Fatalf("expected packet 0 delivered, got %v", packet)
+	}
+
+	prb.AddPacket(2, []byte{2})
+	prb.AddPacket(2, []byte{0xFF}) // Duplicate of a waiting packet
+	prb.AddPacket(0, []byte{0xFF}) // Duplicate of a delivered packet
+	if n := prb.Len(); n != 1 {
+		t.Errorf("expected only packet 2 held, got %d packets", n)
+	}
+	if d := prb.Duplicates(); d != 2 {
+		t.Errorf("expected 2 duplicates, got %d", d)
+	}
+
+	prb.AddPacket(1, []byte{1})
+	for want := byte(1); want <= 2; want++ {
+		if packet := prb.GetNextPacket(); packet == nil || packet[0] != want {
+			t.Fatalf("expected packet %d delivered, got %v", want, packet)
+		}
+	}
+}
+
+// TestReorderSkipsFarGap tests that a packet arriving more than maxLatency
+// ahead of a permanently missing one forces the buffer past the gap, even
+// with few packets waiting and before the gap timeout
+func TestReorderSkipsFarGap(t *testing.T) {
+	prb := NewPacketReorderBuffer(3)
+	prb.AddPacket(0, []byte{0})
+	prb.GetNextPacket()
+
+	// Packets 1 and 3 are lost for good
+	prb.AddPacket(2, []byte{2})
+	prb.AddPacket(4, []byte{4})
+	if packet, _ := prb.NextPacket(); packet != nil {
+		t.Fatal("expected to keep waiting for packet 1 within maxLatency")
+	}
+	prb.AddPacket(5, []byte{5})
+	if packet, skipped := prb.NextPacket(); packet == nil || packet[0] != 2 || skipped != 1 {
+		t.Fatalf("expected packet 2 after skipping 1, got %v skipping %d", packet, skipped)
+	}
+	if prb.nextSeq != 3 {
+		t.Fatalf("expected nextSeq 3 after the skip, got %d", prb.nextSeq)
+	}
+
+	// Packet 4 is only 1 ahead now, so 3 is waited for until 7 arrives
+	if packet, _ := prb.NextPacket(); packet != nil {
+		t.Fatal("expected to wait for packet 3")
+	}
+	prb.AddPacket(7, []byte{7})
+	for _, want := range []byte{4, 5} {
+		if packet := prb.GetNextPacket(); packet == nil || packet[0] != want {
+			t.Fatalf("expected packet %d, got %v", want, packet)
+		}
+	}
+	if prb.nextSeq != 6 {
+		t.Errorf("expected nextSeq 6, got %d", prb.nextSeq)
+	}
+}
+
+// TestCleanupReleasesGapDuringSilence tests that packets waiting behind a
+// lost one are played once the gap times out, even if no further packet
+// arrives to trigger the check
+func TestCleanupReleasesGapDuringSilence(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.AddSequencedPacket(0, []byte{0})
+	jb.AddSequencedPacket(2, []byte{2}) // Packet 1 is lost
+	jb.AddSequencedPacket(3, []byte{3})
+	if level := jb.GetBufferLevel(); level != 1 {
+		t.Fatalf("expected packets 2 and 3 to wait for the gap, got level %d", level)
+	}
+
+	// The sender falls silent, so only the cleanup tick can release them
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		jb.RunCleanup(5*time.Millisecond, stop)
+		close(done)
+	}()
+	deadline := time.Now().Add(DefaultReorderMaxAge * 2)
+	for jb.GetBufferLevel() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	for _, want := range []byte{0, 2, 3} {
+		packet, ok := jb.GetPacket()
+		if !ok || packet[0] != want {
+			t.Fatalf("expected packet %d, got %v (ok=%v)", want, packet, ok)
+		}
+	}
+	if n := jb.reorderBuffer.Len(); n != 0 {
+		t.Errorf("expected nothing left waiting, got %d packets", n)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// StatsReporter gathers every statistic the server keeps into one report,
+// for printing on demand with -report-on-signal
+type StatsReporter struct {
+	jb       *JitterBuffer
+	receiver *Receiver
+	device   *DeviceStats
+}
+
+// StatsReport is a point-in-time copy of the server's statistics
+type StatsReport struct {
+	level    int
+	buffer   BufferStats
+	arrivals ArrivalSnapshot
+	device   DeviceStats
+
+	abandoned  int // Reorder buffer packets given up on to relieve the cap
+	evicted    int // Reorder buffer packets dropped to relieve the cap
+	duplicates int // Reorder buffer packets dropped as duplicates or already passed
+
+	malformed        int64
+	rateLimited      int64
+	rejected         int64
+	protocolSwitches int64
+	authFailures     int64
+}
+
+// Snapshot returns the current statistics
+func (sr *StatsReporter) Snapshot() StatsReport {
+	report := StatsReport{
+		level:            sr.jb.GetBufferLevel(),
+		buffer:           sr.jb.GetStats(),
+		arrivals:         sr.receiver.arrivals.Snapshot(),
+		device:           sr.device.Snapshot(),
+		malformed:        sr.receiver.Malformed(),
+		rateLimited:      sr.receiver.RateLimited(),
+		rejected:         sr.receiver.Rejected(),
+		protocolSwitches: sr.receiver.ProtocolSwitches(),
+		authFailures:     sr.receiver.AuthFailures(),
+	}
+	report.abandoned, report.evicted = sr.jb.reorderBuffer.CapStats()
+	report.duplicates = sr.jb.reorderBuffer.Duplicates()
+	return report
+}
+
+// String formats the report one group of statistics per line
+func (r StatsReport) String() string {
+	return fmt.Sprintf("Buffer - Level: %d, Underflows: %d, Overflows: %d, Silence: %d, Concealed: %d, Resync drops: %d, Total: %d\n"+
+		"Network - Received: %d of %d, Loss: %.2f%%, Jitter: %.3fms\n"+
+		"Reorder - Abandoned with gaps: %d, Evicted: %d, Duplicates: %d\n"+
+		"Ingress - Malformed: %d, Rate limited: %d, Rejected: %d, Protocol switches: %d, Auth failures: %d\n"+
+		"Device - Underruns: %d, Overruns: %d, Errors: %d",
+		r.level, r.buffer.underflows, r.buffer.overflows, r.buffer.silencePackets, r.buffer.concealedPackets, r.buffer.resyncDrops, r.buffer.totalPackets,
+		r.arrivals.received, r.arrivals.expected, r.arrivals.LossPercent(), float64(r.arrivals.jitter)/float64(time.Millisecond),
+		r.abandoned, r.evicted, r.duplicates,
+		r.malformed, r.rateLimited, r.rejected, r.protocolSwitches, r.authFailures,
+		r.device.underruns, r.device.overruns, r.device.errors)
+}
+
+// runSignalReports calls report for each signal received until stop is closed
+func runSignalReports(signals <-chan os.Signal, stop <-chan struct{}, report func()) {
+	for {
+		select {
+		case <-signals:
+			report()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// reportSignal asks the server for a stats report with -report-on-signal
+var reportSignal = syscall.SIGUSR1
+
+// reportSignalName names reportSignal for help and log messages
+const reportSignalName = "SIGUSR1"
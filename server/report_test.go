@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// TestStatsReportFormat tests that a snapshot reports every group of
+// statistics with the values held
+func TestStatsReportFormat(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	var device DeviceStats
+	for i := 0; i < 3; i++ {
+		jb.AddPacket(make([]byte, PacketSize))
+	}
+	jb.InsertSilencePacket()
+	r.HandleDatagram(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}, []byte{1})
+	device.Record(portaudio.OutputUnderflowed)
+
+	reporter := &StatsReporter{jb: jb, receiver: r, device: &device}
+	report := reporter.Snapshot().String()
+	for _, want := range []string{
+		"Buffer - Level: 3,", "Silence: 1,", "Total: 3",
+		"Network - Received: 0 of 0, Loss: 0.00%",
+		"Reorder - Abandoned with gaps: 0, Evicted: 0, Duplicates: 0",
+		"Ingress - Malformed: 1, Rate limited: 0, Rejected: 0, Protocol switches: 0, Auth failures: 0",
+		"Device - Underruns: 1, Overruns: 0, Errors: 0",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected the report to contain %q, got:\n%s", want, report)
+		}
+	}
+	if lines := strings.Count(report, "\n") + 1; lines != 5 {
+		t.Errorf("expected 5 lines, got %d", lines)
+	}
+}
+
+// TestRunSignalReports tests that each signal produces one report
+func TestRunSignalReports(t *testing.T) {
+	signals := make(chan os.Signal)
+	stop := make(chan struct{})
+	reports := make(chan struct{}, 2)
+	done := make(chan struct{})
+	go func() {
+		runSignalReports(signals, stop, func() { reports <- struct{}{} })
+		close(done)
+	}()
+	signals <- syscall.SIGINT
+	signals <- syscall.SIGINT
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the handler to stop")
+	}
+	if len(reports) != 2 {
+		t.Errorf("expected 2 reports, got %d", len(reports))
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// reportSignal asks the server for a stats report with -report-on-signal.
+// Windows has no SIGUSR1, so SIGHUP stands in for it.
+var reportSignal = syscall.SIGHUP
+
+// reportSignalName names reportSignal for help and log messages
+const reportSignalName = "SIGHUP"
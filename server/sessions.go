@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultClientTimeout is how long a source may go without sending anything,
+// keepalives included, before it is announced as having left
+const DefaultClientTimeout = 5 * time.Second
+
+// SessionEventBurst and SessionEventRate limit announcements so a flapping
+// or spoofed source can't flood the log or the webhook
+const (
+	SessionEventBurst = 10
+	SessionEventRate  = 1.0 // Events per second once the burst is spent
+)
+
+// WebhookTimeout bounds each -event-webhook request
+const WebhookTimeout = 5 * time.Second
+
+// Session event kinds
+const (
+	SessionJoined = "joined"
+	SessionLeft   = "left"
+)
+
+// SessionEvent records a client joining or leaving
+type SessionEvent struct {
+	Kind string    `json:"event"`
+	Addr string    `json:"addr"`
+	Time time.Time `json:"time"`
+}
+
+// String formats the event for the log
+func (e SessionEvent) String() string {
+	return fmt.Sprintf("client %s: %s", e.Kind, e.Addr)
+}
+
+// SessionTracker turns the stream of source addresses into join and leave
+// events. Each source joins once until it times out, and events beyond the
+// rate limit are counted and dropped.
+type SessionTracker struct {
+	mu         sync.Mutex
+	timeout    time.Duration
+	lastSeen   map[string]time.Time
+	limiter    *TokenBucket
+	suppressed int64
+}
+
+// NewSessionTracker creates a tracker announcing a source as left after timeout
+func NewSessionTracker(timeout time.Duration) *SessionTracker {
+	return &SessionTracker{
+		timeout:  timeout,
+		lastSeen: make(map[string]time.Time),
+		limiter:  NewTokenBucket(SessionEventRate, SessionEventBurst),
+	}
+}
+
+// Observe records activity from addr at now, returning a join event if it is new
+func (st *SessionTracker) Observe(addr string, now time.Time) []SessionEvent {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, known := st.lastSeen[addr]
+	st.lastSeen[addr] = now
+	if known {
+		return nil
+	}
+	return st.limit([]SessionEvent{{Kind: SessionJoined, Addr: addr, Time: now}}, now)
+}
+
+// Expire returns leave events for sources silent for longer than the timeout
+func (st *SessionTracker) Expire(now time.Time) []SessionEvent {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var events []SessionEvent
+	for addr, seen := range st.lastSeen {
+		if now.Sub(seen) > st.timeout {
+			delete(st.lastSeen, addr)
+			events = append(events, SessionEvent{Kind: SessionLeft, Addr: addr, Time: now})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Addr < events[j].Addr })
+	return st.limit(events, now)
+}
+
+// Active returns the number of sources that haven't left
+func (st *SessionTracker) Active() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.lastSeen)
+}
+
+// Suppressed returns how many events were dropped by the rate limit
+func (st *SessionTracker) Suppressed() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.suppressed
+}
+
+// limit drops the events over the rate limit
+func (st *SessionTracker) limit(events []SessionEvent, now time.Time) []SessionEvent {
+	allowed := events[:0]
+	for _, e := range events {
+		if st.limiter.Allow(now, 1) {
+			allowed = append(allowed, e)
+		} else {
+			st.suppressed++
+		}
+	}
+	return allowed
+}
+
+// RunExpiry announces sources that have left every interval until stop is closed
+func (st *SessionTracker) RunExpiry(interval time.Duration, announce func(SessionEvent), stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, e := range st.Expire(now) {
+				announce(e)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// postSessionEvent sends the event as JSON to url
+func postSessionEvent(client *http.Client, url string, e SessionEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sessionAnnouncer logs events and, if webhookURL is set, posts them to it
+// without blocking the caller
+func sessionAnnouncer(webhookURL string) func(SessionEvent) {
+	client := &http.Client{Timeout: WebhookTimeout}
+	return func(e SessionEvent) {
+		log.Println(e)
+		if webhookURL == "" {
+			return
+		}
+		go func() {
+			if err := postSessionEvent(client, webhookURL, e); err != nil {
+				log.Printf("Error posting %s event to webhook: %v", e.Kind, err)
+			}
+		}()
+	}
+}
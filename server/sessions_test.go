@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSessionTrackerJoinAndLeave tests that a new source joins and a silent one leaves
+func TestSessionTrackerJoinAndLeave(t *testing.T) {
+	st := NewSessionTracker(5 * time.Second)
+	start := time.Unix(0, 0)
+
+	events := st.Observe("10.0.0.1:5000", start)
+	if len(events) != 1 || events[0].Kind != SessionJoined || events[0].String() != "client joined: 10.0.0.1:5000" {
+		t.Fatalf("expected a join event, got %v", events)
+	}
+	// Further packets, keepalives included, don't announce again
+	for i := 1; i <= 10; i++ {
+		if events := st.Observe("10.0.0.1:5000", start.Add(time.Duration(i)*time.Second)); len(events) != 0 {
+			t.Fatalf("expected no repeated join, got %v", events)
+		}
+	}
+	if events := st.Expire(start.Add(14 * time.Second)); len(events) != 0 {
+		t.Fatalf("expected an active source not to leave, got %v", events)
+	}
+
+	events = st.Expire(start.Add(16 * time.Second))
+	if len(events) != 1 || events[0].Kind != SessionLeft || events[0].String() != "client left: 10.0.0.1:5000" {
+		t.Fatalf("expected a leave event, got %v", events)
+	}
+	if events := st.Expire(start.Add(20 * time.Second)); len(events) != 0 {
+		t.Errorf("expected a single leave event, got %v", events)
+	}
+
+	// Coming back is a new join
+	if events := st.Observe("10.0.0.1:5000", start.Add(30*time.Second)); len(events) != 1 {
+		t.Errorf("expected a rejoin event, got %v", events)
+	}
+}
+
+// TestSessionTrackerRateLimit tests that a flood of new sources is limited
+func TestSessionTrackerRateLimit(t *testing.T) {
+	st := NewSessionTracker(time.Second)
+	now := time.Unix(0, 0)
+	announced := 0
+	for i := 0; i < 100; i++ {
+		announced += len(st.Observe(fmt.Sprintf("10.0.0.%d:5000", i), now))
+	}
+	if announced != SessionEventBurst {
+		t.Errorf("expected %d events announced, got %d", SessionEventBurst, announced)
+	}
+	if st.Suppressed() != int64(100-SessionEventBurst) {
+		t.Errorf("expected %d suppressed events, got %d", 100-SessionEventBurst, st.Suppressed())
+	}
+}
+
+// TestPostSessionEvent tests the webhook payload
+func TestPostSessionEvent(t *testing.T) {
+	received := make(chan SessionEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e SessionEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("decoding webhook body: %v", err)
+		}
+		received <- e
+	}))
+	defer server.Close()
+
+	want := SessionEvent{Kind: SessionJoined, Addr: "10.0.0.1:5000", Time: time.Unix(60, 0).UTC()}
+	if err := postSessionEvent(server.Client(), server.URL, want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-received; got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// shutdownSignals ask the server to stop cleanly instead of being killed
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// outputStopper is the part of *portaudio.Stream shutdown needs
+type outputStopper interface {
+	Stop() error
+}
+
+// awaitShutdown calls stop when the first signal arrives
+func awaitShutdown(signals <-chan os.Signal, stop func()) {
+	sig := <-signals
+	log.Printf("Received %v, shutting down", sig)
+	stop()
+}
+
+// closeOnce returns a function closing done on its first call, so a signal
+// and the stream watchdog can both ask for shutdown
+func closeOnce(done chan<- struct{}) func() {
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// stopped reports whether done has been closed, without blocking
+func stopped(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown stops the output streams, which lets each device play out what
+// has already been written to it rather than cutting off mid-buffer, then
+// flushes jb and, with -mix-clients, every client's buffer. It logs each
+// client's final statistics and returns the totals.
+func shutdown(streams []outputStopper, jb *JitterBuffer, mixer *ClientMixer) BufferStats {
+	for _, s := range streams {
+		if err := s.Stop(); err != nil {
+			log.Printf("Error stopping output stream: %v", err)
+		}
+	}
+	if level := jb.GetBufferLevel(); level > 0 {
+		log.Printf("Discarding %d buffered packets", level)
+	}
+	jb.Reset()
+	stats := jb.GetStats()
+	if mixer != nil {
+		for _, client := range mixer.Shutdown() {
+			log.Printf("Final buffer stats for %s - %s", client.Addr, formatFinalStats(client.Stats))
+			stats = stats.Plus(client.Stats)
+		}
+	}
+	return stats
+}
+
+// formatFinalStats formats the statistics logged on shutdown
+func formatFinalStats(stats BufferStats) string {
+	return fmt.Sprintf("Underflows: %d, Overflows: %d, Silence: %d, Concealed: %d, Resync drops: %d, Total: %d",
+		stats.underflows, stats.overflows, stats.silencePackets, stats.concealedPackets, stats.resyncDrops, stats.totalPackets)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeStopper records whether Stop was called
+type fakeStopper struct {
+	stopped bool
+}
+
+func (f *fakeStopper) Stop() error {
+	f.stopped = true
+	return nil
+}
+
+// TestShutdownOnInterrupt tests that an interrupt closes done and that
+// shutting down then stops the output stream and flushes the jitter buffer
+func TestShutdownOnInterrupt(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go awaitShutdown(signals, closeOnce(done))
+	if stopped(done) {
+		t.Fatal("done closed before any signal")
+	}
+
+	signals <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done not closed after an interrupt")
+	}
+
+	jb := NewJitterBuffer()
+	jb.AddPacket(make([]byte, PacketSize))
+	jb.AddPacket(make([]byte, PacketSize))
+	stream := &fakeStopper{}
+	stats := shutdown([]outputStopper{stream}, jb, nil)
+	if !stream.stopped {
+		t.Error("output stream not stopped")
+	}
+	if level := jb.GetBufferLevel(); level != 0 {
+		t.Errorf("buffer level %d after shutdown, want 0", level)
+	}
+	if stats.totalPackets != 2 {
+		t.Errorf("final stats count %d packets, want 2", stats.totalPackets)
+	}
+}
+
+// TestShutdownFlushesMixer tests that with -mix-clients every client's
+// buffer is flushed and counted in the final stats
+func TestShutdownFlushesMixer(t *testing.T) {
+	a := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	b := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+	m := newTestMixer(time.Minute)
+	m.AddPacket(a, 0, constantPacket(1))
+	m.AddPacket(a, 1, constantPacket(1))
+	m.AddPacket(b, 0, constantPacket(1))
+	clientBuffer := m.Buffer(a)
+
+	stats := shutdown(nil, NewJitterBuffer(), m)
+	if level := clientBuffer.GetBufferLevel(); level != 0 {
+		t.Errorf("client buffer level %d after shutdown, want 0", level)
+	}
+	if m.Len() != 0 {
+		t.Errorf("%d clients still mixed after shutdown, want 0", m.Len())
+	}
+	if stats.totalPackets != 3 {
+		t.Errorf("final stats count %d packets, want 3 across both clients", stats.totalPackets)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultSkewWindow is how many timestamp pairs the skew estimate is fitted
+// over, about a minute of packets
+const DefaultSkewWindow = 6000
+
+// MinSkewSamples is how many pairs are needed before a skew is reported
+const MinSkewSamples = 100
+
+// SkewEstimator estimates how fast a sender's clock runs relative to ours
+// by fitting a line through (local, remote) timestamp pairs with least
+// squares. The slope is the rate ratio; its distance from 1 is the skew.
+type SkewEstimator struct {
+	mu     sync.Mutex
+	local  []float64 // Seconds since the first pair, by our clock
+	remote []float64 // Seconds since the first pair, by the sender's clock
+	start  int
+	count  int
+}
+
+// NewSkewEstimator creates an estimator fitted over the most recent window pairs
+func NewSkewEstimator(window int) *SkewEstimator {
+	return &SkewEstimator{local: make([]float64, window), remote: make([]float64, window)}
+}
+
+// Add records that the sender's clock read remote when ours read local
+func (s *SkewEstimator) Add(local, remote float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == len(s.local) {
+		s.start = (s.start + 1) % len(s.local)
+		s.count--
+	}
+	i := (s.start + s.count) % len(s.local)
+	s.local[i], s.remote[i] = local, remote
+	s.count++
+}
+
+// Reset forgets all pairs, as when the sender restarts its stream
+func (s *SkewEstimator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start, s.count = 0, 0
+}
+
+// PPM returns the sender's clock rate relative to ours in parts per
+// million; positive means the sender runs fast and the buffer will grow.
+// It returns false until MinSkewSamples pairs are held.
+func (s *SkewEstimator) PPM() (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count < MinSkewSamples {
+		return 0, false
+	}
+	var meanLocal, meanRemote float64
+	for i := 0; i < s.count; i++ {
+		j := (s.start + i) % len(s.local)
+		meanLocal += s.local[j]
+		meanRemote += s.remote[j]
+	}
+	meanLocal /= float64(s.count)
+	meanRemote /= float64(s.count)
+	var covariance, variance float64
+	for i := 0; i < s.count; i++ {
+		j := (s.start + i) % len(s.local)
+		dl := s.local[j] - meanLocal
+		covariance += dl * (s.remote[j] - meanRemote)
+		variance += dl * dl
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	return (covariance/variance - 1) * 1e6, true
+}
+
+// Len returns the number of pairs held
+func (s *SkewEstimator) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// ClockSkew feeds a SkewEstimator from arriving sequenced packets. The
+// sequence number is the sender's sample clock: packet n was captured
+// n*FramesPerBuffer samples after packet 0.
+type ClockSkew struct {
+	estimator *SkewEstimator
+	started   bool
+	baseTime  time.Time
+	baseSeq   uint32
+	lastSeq   uint32
+}
+
+// NewClockSkew creates a clock skew tracker fitted over window packets
+func NewClockSkew(window int) *ClockSkew {
+	return &ClockSkew{estimator: NewSkewEstimator(window)}
+}
+
+// Record adds a sequenced packet that arrived at now. A sequence jumping
+// well back means a new stream, so the estimate starts over.
+func (c *ClockSkew) Record(now time.Time, sequence uint32) {
+	if !c.started || int32(sequence-c.lastSeq) < -restartGap {
+		c.started = true
+		c.baseTime = now
+		c.baseSeq = sequence
+		c.estimator.Reset()
+	}
+	c.lastSeq = sequence
+	remote := float64(int32(sequence-c.baseSeq)) * float64(FramesPerBuffer) / float64(SampleRate)
+	c.estimator.Add(now.Sub(c.baseTime).Seconds(), remote)
+}
+
+// PPM returns the current skew estimate, or false if there isn't one yet
+func (c *ClockSkew) PPM() (float64, bool) {
+	return c.estimator.PPM()
+}
+
+// String formats the estimate for the stats log
+func (c *ClockSkew) String() string {
+	ppm, ok := c.PPM()
+	if !ok {
+		return "not enough packets yet"
+	}
+	return fmt.Sprintf("sender %+.1f ppm relative to this clock", ppm)
+}
+
+// clockSkewCSVHeader names the column -stats-skew adds to -stats-csv
+var clockSkewCSVHeader = []string{"skew_ppm"}
+
+// csvFields formats the estimate as the -stats-skew CSV column
+func (c *ClockSkew) csvFields() []string {
+	ppm, ok := c.PPM()
+	if !ok {
+		return []string{""}
+	}
+	return []string{strconv.FormatFloat(ppm, 'f', 1, 64)}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestSkewEstimatorRecoversSkew tests that a known skew is recovered from
+// timestamp pairs with arrival jitter
+func TestSkewEstimatorRecoversSkew(t *testing.T) {
+	for _, injected := range []float64{-150, 0, 42, 300} {
+		s := NewSkewEstimator(DefaultSkewWindow)
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < DefaultSkewWindow; i++ {
+			remote := float64(i) * 0.01
+			// Up to 2ms of jitter on our side
+			local := remote/(1+injected/1e6) + rng.Float64()*0.002
+			s.Add(local, remote)
+		}
+		ppm, ok := s.PPM()
+		if !ok || math.Abs(ppm-injected) > 2 {
+			t.Errorf("injected %v ppm, estimated %.2f (ok %v)", injected, ppm, ok)
+		}
+	}
+}
+
+// TestSkewEstimatorWindow tests that only the most recent pairs are fitted
+// and that too few pairs give no estimate
+func TestSkewEstimatorWindow(t *testing.T) {
+	s := NewSkewEstimator(MinSkewSamples)
+	for i := 0; i < MinSkewSamples-1; i++ {
+		s.Add(float64(i), float64(i))
+	}
+	if _, ok := s.PPM(); ok {
+		t.Error("expected no estimate before MinSkewSamples pairs")
+	}
+	// A burst at a very different rate, then enough pairs at +100 ppm to
+	// push it out of the window
+	for i := 0; i < MinSkewSamples; i++ {
+		s.Add(float64(1000+i), float64(1000+i)*(1+100e-6))
+	}
+	if s.Len() != MinSkewSamples {
+		t.Fatalf("expected %d pairs held, got %d", MinSkewSamples, s.Len())
+	}
+	if ppm, ok := s.PPM(); !ok || math.Abs(ppm-100) > 0.01 {
+		t.Errorf("expected 100 ppm from the latest pairs, got %.3f (ok %v)", ppm, ok)
+	}
+}
+
+// TestClockSkewFromSequences tests the estimate from packet arrivals and
+// that a restarted stream starts it over
+func TestClockSkewFromSequences(t *testing.T) {
+	c := NewClockSkew(DefaultSkewWindow)
+	start := time.Now()
+	// The sender's clock runs 50 ppm slow, so packets arrive a little late
+	spacing := float64(FramesPerBuffer) / float64(SampleRate) * (1 + 50e-6)
+	for seq := uint32(0); seq < 2000; seq++ {
+		c.Record(start.Add(time.Duration(float64(seq)*spacing*float64(time.Second))), seq)
+	}
+	if ppm, ok := c.PPM(); !ok || math.Abs(ppm+50) > 0.5 {
+		t.Errorf("expected about -50 ppm, got %.2f (ok %v)", ppm, ok)
+	}
+
+	c.Record(start.Add(time.Minute), 0)
+	if _, ok := c.PPM(); ok {
+		t.Error("expected a restarted stream to discard the estimate")
+	}
+}
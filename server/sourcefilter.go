@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SourceFilter restricts the addresses audio is accepted from. An empty
+// allow list accepts any address not denied; deny entries always win.
+type SourceFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewSourceFilter creates a filter from comma-separated allow and deny lists
+// of CIDR subnets or single IP addresses
+func NewSourceFilter(allow, deny string) (*SourceFilter, error) {
+	allowNets, err := parseCIDRList(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyNets, err := parseCIDRList(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &SourceFilter{allow: allowNets, deny: denyNets}, nil
+}
+
+// parseCIDRList parses a comma-separated list of subnets. A bare address is
+// treated as a subnet containing only that address.
+func parseCIDRList(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q: %v", entry, err)
+		}
+		nets = append(nets, subnet)
+	}
+	return nets, nil
+}
+
+// Allows reports whether audio from ip is accepted
+func (f *SourceFilter) Allows(ip net.IP) bool {
+	if containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+// containsIP reports whether any of nets contains ip
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// TestSourceFilterAllows tests allow and deny matching, with deny taking precedence
+func TestSourceFilterAllows(t *testing.T) {
+	filter, err := NewSourceFilter("192.168.1.0/24, 10.0.0.5, fd00::/8", "192.168.1.13")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.1.1", true},
+		{"192.168.1.254", true},
+		{"192.168.2.1", false},
+		{"10.0.0.5", true},
+		{"10.0.0.6", false},
+		{"fd00::1", true},
+		{"2001:db8::1", false},
+		{"192.168.1.13", false}, // Denied despite being in an allowed subnet
+	}
+	for _, tt := range tests {
+		if got := filter.Allows(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.ip, tt.want, got)
+		}
+	}
+}
+
+// TestSourceFilterDenyOnly tests that an empty allow list accepts everything not denied
+func TestSourceFilterDenyOnly(t *testing.T) {
+	filter, err := NewSourceFilter("", "203.0.113.0/24")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !filter.Allows(net.ParseIP("198.51.100.7")) {
+		t.Error("expected an address outside the deny list to be allowed")
+	}
+	if filter.Allows(net.ParseIP("203.0.113.9")) {
+		t.Error("expected an address in the deny list to be rejected")
+	}
+}
+
+// TestSourceFilterInvalid tests that malformed entries are reported
+func TestSourceFilterInvalid(t *testing.T) {
+	for _, list := range []string{"192.168.1.0/33", "not-an-ip", "10.0.0.0/8,bogus"} {
+		if _, err := NewSourceFilter(list, ""); err == nil {
+			t.Errorf("%q: expected an error", list)
+		}
+	}
+}
+
+// TestReceiverRejectsFilteredSources tests that filtered datagrams never reach the jitter buffer
+func TestReceiverRejectsFilteredSources(t *testing.T) {
+	jb := NewJitterBuffer()
+	r := NewReceiver(jb)
+	r.filter, _ = NewSourceFilter("10.0.0.0/8", "")
+
+	r.HandleDatagram(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}, make([]byte, PacketSize))
+	r.HandleDatagram(&net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 5000}, make([]byte, PacketSize))
+
+	if level := jb.GetBufferLevel(); level != 1 {
+		t.Errorf("expected only the allowed packet to be buffered, got %d", level)
+	}
+	if rejected := r.Rejected(); rejected != 1 {
+		t.Errorf("expected 1 rejected datagram, got %d", rejected)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+// statsCSVHeader names the columns written by -stats-csv
+var statsCSVHeader = []string{
+	"timestamp", "level", "underflows", "overflows", "silence", "total", "loss_percent", "jitter_ms",
+}
+
+// formatStatsRow formats one stats interval as a CSV record
+func formatStatsRow(now time.Time, level int, stats BufferStats, arrivals ArrivalSnapshot) []string {
+	return []string{
+		now.UTC().Format(time.RFC3339),
+		strconv.Itoa(level),
+		strconv.FormatInt(stats.underflows, 10),
+		strconv.FormatInt(stats.overflows, 10),
+		strconv.FormatInt(stats.silencePackets, 10),
+		strconv.FormatInt(stats.totalPackets, 10),
+		strconv.FormatFloat(arrivals.LossPercent(), 'f', 2, 64),
+		strconv.FormatFloat(float64(arrivals.jitter)/float64(time.Millisecond), 'f', 3, 64),
+	}
+}
+
+// StatsCSV appends stats rows to a CSV file
+type StatsCSV struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+// OpenStatsCSV opens path for appending, writing header if the file is new
+func OpenStatsCSV(path string, header []string) (*StatsCSV, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	sc := &StatsCSV{file: file, writer: csv.NewWriter(file)}
+	if info.Size() == 0 {
+		if err := sc.Write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// Write appends a record and flushes it so rows survive the server being killed
+func (sc *StatsCSV) Write(record []string) error {
+	if err := sc.writer.Write(record); err != nil {
+		return err
+	}
+	sc.writer.Flush()
+	return sc.writer.Error()
+}
+
+// Close flushes any buffered rows and closes the file
+func (sc *StatsCSV) Close() error {
+	sc.writer.Flush()
+	if err := sc.writer.Error(); err != nil {
+		sc.file.Close()
+		return err
+	}
+	return sc.file.Close()
+}
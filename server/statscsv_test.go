@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStatsCSVHeader tests the column names
+func TestStatsCSVHeader(t *testing.T) {
+	want := "timestamp,level,underflows,overflows,silence,total,loss_percent,jitter_ms"
+	if got := strings.Join(statsCSVHeader, ","); got != want {
+		t.Errorf("expected header %q, got %q", want, got)
+	}
+}
+
+// TestFormatStatsRow tests formatting of a sample row
+func TestFormatStatsRow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	stats := BufferStats{underflows: 3, overflows: 1, silencePackets: 12, totalPackets: 9400}
+	arrivals := ArrivalSnapshot{expected: 1000, received: 995, jitter: 1500 * time.Microsecond}
+
+	got := strings.Join(formatStatsRow(now, 18, stats, arrivals), ",")
+	want := "2024-05-01T12:30:00Z,18,3,1,12,9400,0.50,1.500"
+	if got != want {
+		t.Errorf("expected row %q, got %q", want, got)
+	}
+}
+
+// TestStatsCSVAppends tests that the header is written once and rows are appended
+func TestStatsCSVAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.csv")
+	row := formatStatsRow(time.Unix(0, 0), 1, BufferStats{}, ArrivalSnapshot{})
+
+	for i := 0; i < 2; i++ {
+		sc, err := OpenStatsCSV(path, statsCSVHeader)
+		if err != nil {
+			t.Fatalf("OpenStatsCSV failed: %v", err)
+		}
+		if err := sc.Write(row); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := sc.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d lines: %q", len(lines), lines)
+	}
+	if lines[0] != strings.Join(statsCSVHeader, ",") {
+		t.Errorf("expected header first, got %q", lines[0])
+	}
+}
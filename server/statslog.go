@@ -0,0 +1,42 @@
+package main
+
+import "time"
+
+// DefaultStatsInterval is how often stats are logged without -stats-interval
+const DefaultStatsInterval = 10 * time.Second
+
+// runStatsTicker calls tick every interval until stop is closed
+func runStatsTicker(interval time.Duration, stop <-chan struct{}, tick func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tick()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// StatsGate decides whether the stats lines that only report problems are
+// logged. Normally they appear only once something has gone wrong; with
+// -stats-always they are logged every interval, for monitoring.
+type StatsGate struct {
+	always bool
+}
+
+// Buffer reports whether to log the jitter buffer stats
+func (g StatsGate) Buffer(s BufferStats) bool {
+	return g.always || s.underflows > 0 || s.overflows > 0 || s.silencePackets > 0 || s.resyncDrops > 0
+}
+
+// Device reports whether to log an output device's stats
+func (g StatsGate) Device(d DeviceStats) bool {
+	return g.always || d.underruns > 0 || d.overruns > 0 || d.errors > 0
+}
+
+// Count reports whether to log a single problem counter
+func (g StatsGate) Count(n int64) bool {
+	return g.always || n > 0
+}
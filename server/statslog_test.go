@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestStatsGate tests that problem stats are logged only after activity
+// unless -stats-always is set
+func TestStatsGate(t *testing.T) {
+	gated := StatsGate{}
+	always := StatsGate{always: true}
+
+	var idle BufferStats
+	if gated.Buffer(idle) || gated.Device(DeviceStats{}) || gated.Count(0) {
+		t.Error("gated stats logged with no activity")
+	}
+	if !always.Buffer(idle) || !always.Device(DeviceStats{}) || !always.Count(0) {
+		t.Error("-stats-always didn't log idle stats")
+	}
+
+	for _, s := range []BufferStats{{underflows: 1}, {overflows: 1}, {silencePackets: 1}, {resyncDrops: 1}} {
+		if !gated.Buffer(s) {
+			t.Errorf("buffer stats %+v not logged", s)
+		}
+	}
+	if gated.Buffer(BufferStats{totalPackets: 100}) {
+		t.Error("buffer stats logged for packets played without problems")
+	}
+	for _, d := range []DeviceStats{{underruns: 1}, {overruns: 1}, {errors: 1}} {
+		if !gated.Device(d) {
+			t.Errorf("device stats %+v not logged", d)
+		}
+	}
+	if !gated.Count(3) {
+		t.Error("non-zero counter not logged")
+	}
+}
+
+// TestRunStatsTicker tests that the ticker uses the given interval and
+// stops when asked
+func TestRunStatsTicker(t *testing.T) {
+	stop := make(chan struct{})
+	ticks := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		runStatsTicker(5*time.Millisecond, stop, func() { ticks <- struct{}{} })
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(time.Second):
+			t.Fatalf("tick %d never came", i)
+		}
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ticker didn't stop")
+	}
+}
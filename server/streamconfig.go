@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Transports describe the header variant audio arrives with
+const (
+	TransportLegacy    = "legacy"    // Raw payload without sequence numbers
+	TransportSequenced = "sequenced" // Payload after a bare sequence number
+	TransportExtended  = "extended"  // Payload after the extended header
+	TransportCoalesced = "coalesced" // Several payloads after one extended header
+)
+
+// StreamConfig describes the audio stream being received
+type StreamConfig struct {
+	sampleRate int
+	channels   int
+	format     string
+	codec      string
+	transport  string
+}
+
+// streamConfigFor derives the stream configuration from a received packet,
+// whose sample format and channel count are identified by payload size
+func streamConfigFor(info packetInfo) StreamConfig {
+	config := StreamConfig{
+		sampleRate: SampleRate,
+		channels:   Channels,
+		format:     "s16",
+		codec:      "pcm",
+		transport:  info.transport,
+	}
+	if info.payloadSize == Float32PacketSize {
+		config.format = "f32"
+	} else if channels := surroundChannels(info.payloadSize); channels != 0 {
+		config.channels = channels
+	}
+	return config
+}
+
+// String formats the configuration for the stats log
+func (c StreamConfig) String() string {
+	if c.transport == "" {
+		return "no audio received"
+	}
+	return fmt.Sprintf("%d Hz, %d channels, %s, %s, %s transport",
+		c.sampleRate, c.channels, c.format, c.codec, c.transport)
+}
+
+// streamConfigCSVHeader names the columns -stats-config adds to -stats-csv
+var streamConfigCSVHeader = []string{"sample_rate", "channels", "format", "codec", "transport"}
+
+// csvFields formats the configuration as the -stats-config CSV columns
+func (c StreamConfig) csvFields() []string {
+	if c.transport == "" {
+		return make([]string, len(streamConfigCSVHeader))
+	}
+	return []string{strconv.Itoa(c.sampleRate), strconv.Itoa(c.channels), c.format, c.codec, c.transport}
+}
+
+// setConfig records the configuration of the latest audio received
+func (r *Receiver) setConfig(config StreamConfig) {
+	r.configMu.Lock()
+	defer r.configMu.Unlock()
+	r.config = config
+}
+
+// Config returns the configuration of the latest audio received
+func (r *Receiver) Config() StreamConfig {
+	r.configMu.Lock()
+	defer r.configMu.Unlock()
+	return r.config
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStreamConfigString tests that the formatted config includes every field
+func TestStreamConfigString(t *testing.T) {
+	config := StreamConfig{sampleRate: 48000, channels: 6, format: "s16", codec: "pcm", transport: TransportExtended}
+	got := config.String()
+	for _, want := range []string{"48000 Hz", "6 channels", "s16", "pcm", "extended transport"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+	if fields := config.csvFields(); strings.Join(fields, ",") != "48000,6,s16,pcm,extended" {
+		t.Errorf("unexpected CSV fields %q", fields)
+	}
+	if got := (StreamConfig{}).String(); got != "no audio received" {
+		t.Errorf("expected an empty config to say no audio was received, got %q", got)
+	}
+}
+
+// TestReceiverTracksStreamConfig tests that the config follows the packets received
+func TestReceiverTracksStreamConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   StreamConfig
+	}{
+		{"legacy s16", make([]byte, PacketSize), StreamConfig{SampleRate, 2, "s16", "pcm", TransportLegacy}},
+		{"sequenced f32", make([]byte, SequenceSize+Float32PacketSize), StreamConfig{SampleRate, 2, "f32", "pcm", TransportSequenced}},
+		{"extended 5.1", headerPacket(0, surroundPacketSize(6)), StreamConfig{SampleRate, 6, "s16", "pcm", TransportExtended}},
+		{"coalesced", headerPacket(FlagCoalesced, 2*PacketSize), StreamConfig{SampleRate, 2, "s16", "pcm", TransportCoalesced}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReceiver(NewJitterBuffer())
+			r.HandleDatagram(nil, tt.packet)
+			if got := r.Config(); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	// Keepalives carry no audio and leave the config alone
+	r := NewReceiver(NewJitterBuffer())
+	r.HandleDatagram(nil, make([]byte, Float32PacketSize))
+	r.HandleDatagram(nil, headerPacket(FlagKeepalive, 0))
+	if got := r.Config().format; got != "f32" {
+		t.Errorf("expected a keepalive not to change the format, got %q", got)
+	}
+}
+
+// headerPacket builds an extended header datagram with a zeroed payload
+func headerPacket(flags uint8, payloadSize int) []byte {
+	packet := make([]byte, HeaderSize+payloadSize)
+	EncodeHeader(packet, PacketHeader{Flags: flags, Epoch: 1})
+	return packet
+}
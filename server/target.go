@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStabilizeAfter is how long the stream must run without underflows
+// before the jitter buffer switches from its cold to its warm target
+const DefaultStabilizeAfter = 10 * time.Second
+
+// SetTargets configures the cold start and steady state buffer targets
+func (jb *JitterBuffer) SetTargets(cold, warm int, stabilizeAfter time.Duration) {
+	jb.coldTargetSize = cold
+	jb.warmTargetSize = warm
+	jb.stabilizeAfter = stabilizeAfter
+	jb.setTarget(cold)
+}
+
+// IsStable reports whether the stream has been running, without underflows,
+// for at least stabilizeAfter
+func (jb *JitterBuffer) IsStable(now time.Time) bool {
+	start := atomic.LoadInt64(&jb.startTime)
+	if start == 0 {
+		return false
+	}
+	healthySince := start
+	if last := atomic.LoadInt64(&jb.lastUnderflow); last > healthySince {
+		healthySince = last
+	}
+	return now.Sub(time.Unix(0, healthySince)) >= jb.stabilizeAfter
+}
+
+// UpdateTarget moves the buffer target between its cold and warm values,
+// or with an adaptive target to cover the measured jitter, and returns the
+// effective target
+func (jb *JitterBuffer) UpdateTarget(now time.Time) int {
+	target := jb.coldTargetSize
+	if jb.arrivals != nil {
+		target = jb.adaptiveTarget()
+	} else if jb.IsStable(now) {
+		target = jb.warmTargetSize
+	}
+	if target != jb.GetTargetSize() {
+		jb.setTarget(target)
+	}
+	return target
+}
+
+// setTarget sets the target size and derives the water marks from it
+func (jb *JitterBuffer) setTarget(target int) {
+	atomic.StoreInt64(&jb.targetSize, int64(target))
+	jb.lowWaterMark = target / 2
+	jb.highWaterMark = target + target/2
+}
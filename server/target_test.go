@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestColdToWarmTarget tests that the effective target starts high and drops once stable
+func TestColdToWarmTarget(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetTargets(40, 20, time.Second)
+
+	start := time.Now()
+	if target := jb.UpdateTarget(start); target != 40 {
+		t.Errorf("expected cold target 40 before any packets, got %d", target)
+	}
+
+	jb.AddPacket(make([]byte, PacketSize))
+	atomic.StoreInt64(&jb.startTime, start.UnixNano())
+
+	if target := jb.UpdateTarget(start.Add(500 * time.Millisecond)); target != 40 {
+		t.Errorf("expected cold target 40 before stabilizing, got %d", target)
+	}
+	if jb.lowWaterMark != 20 || jb.highWaterMark != 60 {
+		t.Errorf("expected water marks 20/60 for cold target, got %d/%d", jb.lowWaterMark, jb.highWaterMark)
+	}
+
+	if target := jb.UpdateTarget(start.Add(1500 * time.Millisecond)); target != 20 {
+		t.Errorf("expected warm target 20 after stabilizing, got %d", target)
+	}
+	if jb.lowWaterMark != 10 || jb.highWaterMark != 30 {
+		t.Errorf("expected water marks 10/30 for warm target, got %d/%d", jb.lowWaterMark, jb.highWaterMark)
+	}
+}
+
+// TestUnderflowDelaysWarmTarget tests that an underflow restarts the stabilization period
+func TestUnderflowDelaysWarmTarget(t *testing.T) {
+	jb := NewJitterBuffer()
+	jb.SetTargets(40, 20, time.Second)
+
+	start := time.Now()
+	atomic.StoreInt64(&jb.startTime, start.UnixNano())
+	atomic.StoreInt64(&jb.lastUnderflow, start.Add(800*time.Millisecond).UnixNano())
+
+	if target := jb.UpdateTarget(start.Add(1500 * time.Millisecond)); target != 40 {
+		t.Errorf("expected cold target 40 within a second of an underflow, got %d", target)
+	}
+	if target := jb.UpdateTarget(start.Add(2 * time.Second)); target != 20 {
+		t.Errorf("expected warm target 20 once healthy again, got %d", target)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// VolumeCurve maps a 0-1 volume control value to an output gain
+type VolumeCurve string
+
+const (
+	VolumeCurveLinear VolumeCurve = "linear"
+	VolumeCurveLog    VolumeCurve = "log"
+)
+
+// VolumeCurveRangeDB is the attenuation range of the log curve, from full
+// volume down to the quietest non-zero setting
+const VolumeCurveRangeDB = 60.0
+
+// parseVolumeCurve validates a -volume-curve flag value
+func parseVolumeCurve(s string) (VolumeCurve, error) {
+	switch curve := VolumeCurve(s); curve {
+	case VolumeCurveLinear, VolumeCurveLog:
+		return curve, nil
+	}
+	return "", fmt.Errorf("unknown volume curve %q (expected %q or %q)", s, VolumeCurveLinear, VolumeCurveLog)
+}
+
+// volumeGain converts a volume control value in [0, 1] to a linear gain.
+// The log curve spreads the control evenly over VolumeCurveRangeDB decibels,
+// which matches perceived loudness better than a linear gain.
+func volumeGain(volume float64, curve VolumeCurve) float64 {
+	if curve != VolumeCurveLog || volume <= 0 || volume >= 1 {
+		return volume
+	}
+	return math.Pow(10, VolumeCurveRangeDB*(volume-1)/20)
+}
+
+// Volume is a thread-safe volume setting in the range [0.0, 1.0]
+type Volume struct {
+	value atomic.Value // float64
+}
+
+// NewVolume creates a volume with the given initial value
+func NewVolume(initial float64) (*Volume, error) {
+	v := &Volume{}
+	if err := v.SetVolume(initial); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetVolume updates the volume, rejecting values outside [0.0, 1.0]
+func (v *Volume) SetVolume(volume float64) error {
+	if !(volume >= 0.0 && volume <= 1.0) {
+		return fmt.Errorf("volume %.2f out of range 0.0-1.0", volume)
+	}
+	v.value.Store(volume)
+	return nil
+}
+
+// GetVolume returns the current volume
+func (v *Volume) GetVolume() float64 {
+	return v.value.Load().(float64)
+}
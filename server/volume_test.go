@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+// TestVolumeGainCurves tests the gain produced by the linear and log curves
+func TestVolumeGainCurves(t *testing.T) {
+	testCases := []struct {
+		name     string
+		volume   float64
+		curve    VolumeCurve
+		expected float64
+	}{
+		{"Linear Half", 0.5, VolumeCurveLinear, 0.5},
+		{"Linear Full", 1.0, VolumeCurveLinear, 1.0},
+		{"Log Zero", 0.0, VolumeCurveLog, 0.0},
+		{"Log Full", 1.0, VolumeCurveLog, 1.0},
+		{"Log Half", 0.5, VolumeCurveLog, math.Pow(10, -30.0/20)}, // -30 dB
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gain := volumeGain(tc.volume, tc.curve)
+			if math.Abs(gain-tc.expected) > 1e-9 {
+				t.Errorf("expected gain %.6f, got %.6f", tc.expected, gain)
+			}
+		})
+	}
+
+	if gain := volumeGain(0.5, VolumeCurveLog); gain >= 0.1 {
+		t.Errorf("expected log gain at 0.5 to be well below linear, got %.4f", gain)
+	}
+}
+
+// TestVolumeGainLogMonotonic tests the log curve never decreases as volume rises
+func TestVolumeGainLogMonotonic(t *testing.T) {
+	prev := volumeGain(0, VolumeCurveLog)
+	for v := 0.01; v <= 1.0; v += 0.01 {
+		gain := volumeGain(v, VolumeCurveLog)
+		if gain < prev {
+			t.Fatalf("gain decreased at volume %.2f: %.6f < %.6f", v, gain, prev)
+		}
+		prev = gain
+	}
+}
+
+// TestParseVolumeCurve tests flag validation for volume curves
+func TestParseVolumeCurve(t *testing.T) {
+	for _, s := range []string{"linear", "log"} {
+		if _, err := parseVolumeCurve(s); err != nil {
+			t.Errorf("expected %q to be accepted: %v", s, err)
+		}
+	}
+	if _, err := parseVolumeCurve("exp"); err == nil {
+		t.Error("expected unknown curve to be rejected")
+	}
+}
+
+// TestVolumeBounds tests that SetVolume rejects out-of-range values
+func TestVolumeBounds(t *testing.T) {
+	v, err := NewVolume(0.5)
+	if err != nil {
+		t.Fatalf("NewVolume failed: %v", err)
+	}
+
+	for _, bad := range []float64{-0.1, 1.1, math.NaN()} {
+		if err := v.SetVolume(bad); err == nil {
+			t.Errorf("expected SetVolume(%v) to fail", bad)
+		}
+	}
+	if got := v.GetVolume(); got != 0.5 {
+		t.Errorf("expected rejected values to leave volume at 0.5, got %.2f", got)
+	}
+
+	if _, err := NewVolume(2.0); err == nil {
+		t.Error("expected NewVolume to reject an out-of-range initial value")
+	}
+}
+
+// TestVolumeConcurrentAccess tests concurrent SetVolume and GetVolume calls
+func TestVolumeConcurrentAccess(t *testing.T) {
+	v, _ := NewVolume(0.0)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				v.SetVolume(float64((i+j)%11) / 10)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if got := v.GetVolume(); got < 0.0 || got > 1.0 {
+					t.Errorf("read out-of-range volume %.2f", got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
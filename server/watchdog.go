@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Exit codes for a dead stream, so a supervisor can tell a client that
+// never connected apart from one that went away
+const (
+	// ExitNoAudio means no audio arrived within -startup-timeout
+	ExitNoAudio = 3
+	// ExitAudioStopped means audio arrived but then stopped for longer
+	// than -dead-stream-timeout
+	ExitAudioStopped = 4
+)
+
+// WatchdogInterval is how often the stream watchdog is checked
+const WatchdogInterval = time.Second
+
+// StreamWatchdog decides when the incoming stream should be considered
+// dead. A zero grace or timeout disables that half of the check.
+type StreamWatchdog struct {
+	grace   time.Duration // How long to wait for the first audio
+	timeout time.Duration // How long audio may stop once it has started
+	start   time.Time
+	last    int64 // UnixNano of the last audio packet, 0 until the first
+}
+
+// NewStreamWatchdog creates a watchdog whose startup grace period begins at start
+func NewStreamWatchdog(grace, timeout time.Duration, start time.Time) *StreamWatchdog {
+	return &StreamWatchdog{grace: grace, timeout: timeout, start: start}
+}
+
+// Seen records that audio arrived at now
+func (w *StreamWatchdog) Seen(now time.Time) {
+	atomic.StoreInt64(&w.last, now.UnixNano())
+}
+
+// Check returns the exit code and the reason if the stream is dead at now,
+// or 0 if it isn't
+func (w *StreamWatchdog) Check(now time.Time) (int, string) {
+	last := atomic.LoadInt64(&w.last)
+	if last == 0 {
+		if w.grace > 0 && now.Sub(w.start) >= w.grace {
+			return ExitNoAudio, fmt.Sprintf("No audio received within %v of starting", w.grace)
+		}
+		return 0, ""
+	}
+	if silent := now.Sub(time.Unix(0, last)); w.timeout > 0 && silent >= w.timeout {
+		return ExitAudioStopped, fmt.Sprintf("No audio received for %v", silent.Truncate(time.Millisecond))
+	}
+	return 0, ""
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWatchdogNeverReceived tests that a stream with no audio trips only
+// once the startup grace period has passed
+func TestWatchdogNeverReceived(t *testing.T) {
+	start := time.Unix(1000, 0)
+	w := NewStreamWatchdog(10*time.Second, 2*time.Second, start)
+	if code, _ := w.Check(start.Add(9 * time.Second)); code != 0 {
+		t.Errorf("tripped with code %d inside the grace period", code)
+	}
+	if code, _ := w.Check(start.Add(10 * time.Second)); code != ExitNoAudio {
+		t.Errorf("got code %d after the grace period, want ExitNoAudio", code)
+	}
+}
+
+// TestWatchdogStopped tests that a stream that has received audio trips
+// with ExitAudioStopped once the last packet is older than the timeout,
+// however long ago the server started
+func TestWatchdogStopped(t *testing.T) {
+	start := time.Unix(1000, 0)
+	w := NewStreamWatchdog(10*time.Second, 2*time.Second, start)
+	w.Seen(start.Add(30 * time.Second))
+	if code, _ := w.Check(start.Add(31 * time.Second)); code != 0 {
+		t.Errorf("tripped with code %d one second after audio", code)
+	}
+	if code, _ := w.Check(start.Add(32 * time.Second)); code != ExitAudioStopped {
+		t.Errorf("got code %d two seconds after audio, want ExitAudioStopped", code)
+	}
+
+	w.Seen(start.Add(40 * time.Second))
+	if code, _ := w.Check(start.Add(41 * time.Second)); code != 0 {
+		t.Errorf("tripped with code %d after audio resumed", code)
+	}
+}
+
+// TestWatchdogDisabledHalves tests that a zero grace or timeout never trips
+func TestWatchdogDisabledHalves(t *testing.T) {
+	start := time.Unix(1000, 0)
+	noGrace := NewStreamWatchdog(0, time.Second, start)
+	if code, _ := noGrace.Check(start.Add(time.Hour)); code != 0 {
+		t.Errorf("tripped with code %d without a grace period", code)
+	}
+	noTimeout := NewStreamWatchdog(time.Second, 0, start)
+	noTimeout.Seen(start)
+	if code, _ := noTimeout.Check(start.Add(time.Hour)); code != 0 {
+		t.Errorf("tripped with code %d without a timeout", code)
+	}
+}
+
+// TestReceiverFeedsWatchdog tests that audio handled by the receiver
+// resets the watchdog
+func TestReceiverFeedsWatchdog(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	r := NewReceiver(NewJitterBuffer())
+	r.watchdog = NewStreamWatchdog(time.Second, time.Minute, start)
+	if code, _ := r.watchdog.Check(time.Now()); code != ExitNoAudio {
+		t.Fatalf("got code %d before any audio, want ExitNoAudio", code)
+	}
+	r.HandleDatagram(nil, make([]byte, PacketSize))
+	if code, _ := r.watchdog.Check(time.Now()); code != 0 {
+		t.Errorf("got code %d after audio, want 0", code)
+	}
+}